@@ -0,0 +1,119 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// cacheEventTopic 各节点共用的 Redis 发布订阅频道
+const cacheEventTopic = "veloera:cache_events"
+
+// 缓存失效事件类型，payload 的含义见各处 RegisterCacheEventHandler
+const (
+	CacheEventChannel       = "channel"        // 渠道配置变更，payload 为空
+	CacheEventChannelStatus = "channel_status" // 渠道状态变更，payload 为 "id:status"
+	CacheEventOption        = "option"         // 选项变更，payload 为选项 key
+	CacheEventModelMapping  = "model_mapping"  // 全局模型映射重新加载，payload 为空
+	CacheEventPrefixCache   = "prefix_cache"   // 前缀渠道缓存刷新，payload 为逗号分隔的分组
+	CacheEventToken         = "token"          // 令牌缓存失效，payload 为令牌的 HMAC
+	CacheEventUser          = "user"           // 用户缓存失效，payload 为用户 id
+	CacheEventRole          = "role"           // 角色权限变更，payload 为空
+	CacheEventModelCatalog  = "model_catalog"  // 模型目录变更，payload 为空
+)
+
+type CacheEvent struct {
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+	Node    string `json:"node"`
+}
+
+var (
+	cacheEventNodeId       = GetUUID()
+	cacheEventHandlers     = make(map[string][]func(payload string))
+	cacheEventHandlersLock sync.RWMutex
+)
+
+// RegisterCacheEventHandler 注册其他节点广播的事件的处理函数，处理函数不应再次发布同类事件
+func RegisterCacheEventHandler(eventType string, handler func(payload string)) {
+	cacheEventHandlersLock.Lock()
+	defer cacheEventHandlersLock.Unlock()
+	cacheEventHandlers[eventType] = append(cacheEventHandlers[eventType], handler)
+}
+
+// PublishCacheEvent 通知其他节点刷新缓存，本节点的缓存由调用方自行更新。
+// 未启用 Redis 时视为单节点部署，不做任何事
+func PublishCacheEvent(eventType string, payload string) {
+	if !RedisEnabled || RDB == nil {
+		return
+	}
+	data, err := json.Marshal(CacheEvent{
+		Type:    eventType,
+		Payload: payload,
+		Node:    cacheEventNodeId,
+	})
+	if err != nil {
+		SysError("failed to marshal cache event: " + err.Error())
+		return
+	}
+	if err := RDB.Publish(context.Background(), cacheEventTopic, data).Err(); err != nil {
+		SysError(fmt.Sprintf("failed to publish cache event %s: %s", eventType, err.Error()))
+	}
+}
+
+// SubscribeCacheEvents 订阅其他节点的缓存事件并按顺序分发，断线由 go-redis 自动重连
+func SubscribeCacheEvents() {
+	if !RedisEnabled || RDB == nil {
+		return
+	}
+	pubsub := RDB.Subscribe(context.Background(), cacheEventTopic)
+	defer pubsub.Close()
+	SysLog("subscribed to cache events")
+	for msg := range pubsub.Channel() {
+		var event CacheEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			SysError("failed to unmarshal cache event: " + err.Error())
+			continue
+		}
+		if event.Node == cacheEventNodeId {
+			continue
+		}
+		dispatchCacheEvent(event)
+	}
+}
+
+func dispatchCacheEvent(event CacheEvent) {
+	cacheEventHandlersLock.RLock()
+	handlers := cacheEventHandlers[event.Type]
+	cacheEventHandlersLock.RUnlock()
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					SysError(fmt.Sprintf("cache event %s handler panic: %v", event.Type, r))
+				}
+			}()
+			handler(event.Payload)
+		}()
+	}
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("cache event handled: type=%s, payload=%s", event.Type, event.Payload))
+	}
+}
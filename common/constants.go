@@ -88,6 +88,18 @@ var MemoryCacheEnabled bool
 
 var LogConsumeEnabled = true
 var LogChatContentEnabled = false
+var ChatContentEncryptionKey = ""
+var ChatContentEncryptionOldKeys = ""
+
+// ConfigEncryptionKey 声明式配置导出/导入时加密密钥字段所用的主密钥
+var ConfigEncryptionKey = ""
+
+// SecretEncryptionKey 渠道密钥与敏感选项落库加密的主密钥，旧密钥以逗号分隔，仅用于解密
+var SecretEncryptionKey = ""
+var SecretEncryptionOldKeys = ""
+
+// SecretFileRefDir file:// 密钥引用允许读取的目录，为空时禁用 file:// 引用
+var SecretFileRefDir = "/run/secrets"
 var LogErrorEnabled = false
 
 var SMTPServer = ""
@@ -209,6 +221,11 @@ const (
 	UserStatusDisabled = 2 // also don't use 0
 )
 
+const (
+	UserBillingModePrepaid  = 0 // 默认预付费，余额耗尽后拒绝请求
+	UserBillingModePostpaid = 1 // 后付费，允许透支到授信额度
+)
+
 const (
 	TokenStatusEnabled   = 1 // don't use 0, 0 is the default value!
 	TokenStatusDisabled  = 2 // also don't use 0
@@ -275,6 +292,7 @@ const (
 	ChannelTypeXinference     = 47
 	ChannelTypeXai            = 48
 	ChannelTypeGitHub         = 49
+	ChannelTypeSelfHosted     = 50
 	ChannelTypeDummy          // this one is only for count, do not add any channel after this
 
 )
@@ -330,4 +348,5 @@ var ChannelBaseURLs = []string{
 	"",                                          //47
 	"https://api.x.ai",                          //48
 	"https://models.github.ai/inference",        //49
+	"",                                          //50
 }
@@ -0,0 +1,147 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Envelope 信封加密的结果：数据由随机生成的数据密钥加密，数据密钥再由主密钥加密
+type Envelope struct {
+	KeyId      string `json:"key_id"`      // 主密钥标识，用于密钥轮换
+	WrappedKey string `json:"wrapped_key"` // 被主密钥加密的数据密钥（base64）
+	Ciphertext string `json:"ciphertext"`  // nonce + 密文（base64）
+}
+
+// EnvelopeCipher 使用 AES-256-GCM 的信封加密器，支持保留旧主密钥用于解密
+type EnvelopeCipher struct {
+	primaryId string
+	keys      map[string][]byte
+}
+
+// envelopeKey 将任意长度的配置密钥派生为 32 字节主密钥，并计算其标识
+func envelopeKey(secret string) (id string, key []byte) {
+	sum := sha256.Sum256([]byte(secret))
+	idSum := sha256.Sum256(sum[:])
+	return hex.EncodeToString(idSum[:4]), sum[:]
+}
+
+// NewEnvelopeCipher 创建信封加密器，primary 用于加密，oldKeys 仅用于解密历史数据
+func NewEnvelopeCipher(primary string, oldKeys ...string) (*EnvelopeCipher, error) {
+	if strings.TrimSpace(primary) == "" {
+		return nil, errors.New("encryption key is empty")
+	}
+	e := &EnvelopeCipher{keys: make(map[string][]byte)}
+	id, key := envelopeKey(primary)
+	e.primaryId = id
+	e.keys[id] = key
+	for _, old := range oldKeys {
+		if strings.TrimSpace(old) == "" {
+			continue
+		}
+		oldId, oldKey := envelopeKey(old)
+		e.keys[oldId] = oldKey
+	}
+	return e, nil
+}
+
+// PrimaryKeyId 返回当前用于加密的主密钥标识
+func (e *EnvelopeCipher) PrimaryKeyId() string {
+	return e.primaryId
+}
+
+func gcmSeal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func gcmOpen(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// Encrypt 使用新的随机数据密钥加密数据
+func (e *EnvelopeCipher) Encrypt(plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	ciphertext, err := gcmSeal(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := gcmSeal(e.keys[e.primaryId], dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		KeyId:      e.primaryId,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// Decrypt 解密信封，主密钥已不在配置中时返回错误
+func (e *EnvelopeCipher) Decrypt(envelope *Envelope) ([]byte, error) {
+	key, ok := e.keys[envelope.KeyId]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %s is not configured", envelope.KeyId)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(envelope.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := gcmOpen(key, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(dataKey, ciphertext)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelopeCipherKeyRotation(t *testing.T) {
+	plaintext := []byte("sk-rotation-test")
+	oldCipher, err := NewEnvelopeCipher("old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := oldCipher.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		primary string
+		oldKeys []string
+		wantErr bool
+	}{
+		{"same key", "old-key", nil, false},
+		{"rotated with old key kept", "new-key", []string{"old-key"}, false},
+		{"rotated with blank entries", "new-key", []string{"", " ", "old-key"}, false},
+		{"rotated without old key", "new-key", nil, true},
+		{"rotated with other old key", "new-key", []string{"other-key"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewEnvelopeCipher(tt.primary, tt.oldKeys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Decrypt(envelope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, plaintext) {
+				t.Errorf("Decrypt() = %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestEnvelopeCipherEncryptsWithPrimaryKey(t *testing.T) {
+	c, err := NewEnvelopeCipher("new-key", "old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := c.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.KeyId != c.PrimaryKeyId() {
+		t.Errorf("KeyId = %s, want primary %s", envelope.KeyId, c.PrimaryKeyId())
+	}
+	oldOnly, _ := NewEnvelopeCipher("old-key")
+	if envelope.KeyId == oldOnly.PrimaryKeyId() {
+		t.Error("new envelopes must not be wrapped with the old key")
+	}
+}
+
+func TestEnvelopeCipherRejectsTampering(t *testing.T) {
+	c, err := NewEnvelopeCipher("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := c.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.Encrypt([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *envelope
+	tampered.Ciphertext = other.Ciphertext
+	if _, err = c.Decrypt(&tampered); err == nil {
+		t.Error("Decrypt() should fail when the ciphertext does not match the wrapped key")
+	}
+	if _, err = NewEnvelopeCipher("  "); err == nil {
+		t.Error("NewEnvelopeCipher() should reject an empty key")
+	}
+}
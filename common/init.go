@@ -31,6 +31,11 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+
+	ExportConfig  = flag.String("export-config", "", "export the declarative configuration to the given file (- for stdout) and exit")
+	ExportSecrets = flag.String("export-secrets", "omit", "how secrets are exported: omit, env, encrypt or plain")
+	ConfigFile    = flag.String("config-file", "", "reconcile the database from the given declarative configuration file on startup")
+	ConfigPrune   = flag.Bool("config-prune", false, "delete channels and subscription plans absent from --config-file")
 )
 
 func printHelp() {
@@ -38,6 +43,8 @@ func printHelp() {
 	fmt.Println("Copyright (C) 2023 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/songquanpeng/veloera")
 	fmt.Println("Usage: veloera [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("       veloera --export-config <file|-> [--export-secrets omit|env|encrypt|plain]")
+	fmt.Println("       veloera --config-file <file> [--config-prune]")
 }
 
 func LoadEnv() {
@@ -102,6 +109,13 @@ func LoadEnv() {
 	// Initialize string variables with GetEnvOrDefaultString
 	GeminiSafetySetting = GetEnvOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 	CohereSafetySetting = GetEnvOrDefaultString("COHERE_SAFETY_SETTING", "NONE")
+	// 对话内容留存的主密钥，旧密钥以逗号分隔，仅用于解密历史数据
+	ChatContentEncryptionKey = os.Getenv("CHAT_CONTENT_ENCRYPTION_KEY")
+	ChatContentEncryptionOldKeys = os.Getenv("CHAT_CONTENT_ENCRYPTION_OLD_KEYS")
+	ConfigEncryptionKey = os.Getenv("CONFIG_ENCRYPTION_KEY")
+	SecretEncryptionKey = os.Getenv("SECRET_ENCRYPTION_KEY")
+	SecretEncryptionOldKeys = os.Getenv("SECRET_ENCRYPTION_OLD_KEYS")
+	SecretFileRefDir = GetEnvOrDefaultString("SECRET_FILE_DIR", SecretFileRefDir)
 
 	// Initialize rate limit variables
 	GlobalApiRateLimitEnable = GetEnvOrDefaultBool("GLOBAL_API_RATE_LIMIT_ENABLE", true)
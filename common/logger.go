@@ -44,6 +44,12 @@ var setupLogLock sync.Mutex
 var setupLogWorking bool
 
 func SetupLogger() {
+	stdout := io.Writer(os.Stdout)
+	if *ExportConfig == "-" {
+		// 配置导出到标准输出时，日志改写到标准错误
+		stdout = os.Stderr
+		gin.DefaultWriter = os.Stderr
+	}
 	if *LogDir != "" {
 		ok := setupLogLock.TryLock()
 		if !ok {
@@ -59,7 +65,7 @@ func SetupLogger() {
 		if err != nil {
 			log.Fatal("failed to open log file")
 		}
-		gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
+		gin.DefaultWriter = io.MultiWriter(stdout, fd)
 		gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
 	}
 }
@@ -0,0 +1,199 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// ObjectStore 归档文件等大对象的存储后端
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalObjectStore 将对象保存在本地目录中，也可作为 S3 的本地替身用于测试
+type LocalObjectStore struct {
+	Dir string
+}
+
+func (s *LocalObjectStore) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", errors.New("empty object key")
+	}
+	return filepath.Join(s.Dir, cleaned), nil
+}
+
+func (s *LocalObjectStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免留下不完整的对象
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *LocalObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s *LocalObjectStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// S3ObjectStore 兼容 S3 协议的对象存储（AWS S3、MinIO、R2 等）
+type S3ObjectStore struct {
+	Endpoint        string // 留空时使用 AWS 官方地址
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	PathStyle       bool
+	Client          *http.Client
+}
+
+func (s *S3ObjectStore) objectURL(key string) (string, error) {
+	if s.Bucket == "" {
+		return "", errors.New("s3 bucket is required")
+	}
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimSuffix(s.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	escapedKey := (&url.URL{Path: strings.TrimPrefix(key, "/")}).EscapedPath()
+	if s.PathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", u.Scheme, u.Host, s.Bucket, escapedKey), nil
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", u.Scheme, s.Bucket, u.Host, escapedKey), nil
+}
+
+func (s *S3ObjectStore) do(ctx context.Context, method string, key string, body io.ReadSeeker, size int64) (*http.Response, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = body
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	// 大文件不计算正文哈希，依赖 HTTPS 保证传输完整性
+	payloadHash := "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	creds := aws.Credentials{AccessKeyID: s.AccessKeyId, SecretAccessKey: s.SecretAccessKey}
+	if err = v4.NewSigner().SignHTTP(ctx, creds, req, payloadHash, "s3", region, time.Now()); err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s failed: status %d, %s", method, key, resp.StatusCode, string(data))
+	}
+	return resp, nil
+}
+
+func (s *S3ObjectStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, body, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3ObjectStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
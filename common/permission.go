@@ -0,0 +1,114 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import "strings"
+
+// 细粒度权限，格式为 资源:动作。角色由若干权限组成，支持 "*" 与 "资源:*" 通配
+const (
+	PermissionAll = "*"
+
+	PermissionChannelsRead  = "channels:read"
+	PermissionChannelsWrite = "channels:write"
+
+	PermissionUsersRead   = "users:read"
+	PermissionUsersManage = "users:manage"
+	PermissionRolesManage = "roles:manage"
+
+	PermissionLogsRead    = "logs:read"
+	PermissionLogsDelete  = "logs:delete"
+	PermissionLogsArchive = "logs:archive"
+	PermissionLogsContent = "logs:content"
+
+	PermissionBillingRead   = "billing:read"
+	PermissionBillingManage = "billing:manage"
+	PermissionBillingRefund = "billing:refund"
+
+	PermissionRedemptionsRead  = "redemptions:read"
+	PermissionRedemptionsWrite = "redemptions:write"
+
+	PermissionPlansRead  = "plans:read"
+	PermissionPlansWrite = "plans:write"
+
+	PermissionOptionsRead  = "options:read"
+	PermissionOptionsWrite = "options:write"
+
+	PermissionModelsRead  = "models:read"
+	PermissionModelsWrite = "models:write"
+
+	PermissionMessagesRead  = "messages:read"
+	PermissionMessagesWrite = "messages:write"
+
+	PermissionTasksRead = "tasks:read"
+
+	PermissionAuditRead = "audit:read"
+)
+
+// AllPermissions 列出系统中定义的全部权限，用于校验角色配置与前端展示
+var AllPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionRolesManage,
+	PermissionLogsRead,
+	PermissionLogsDelete,
+	PermissionLogsArchive,
+	PermissionLogsContent,
+	PermissionBillingRead,
+	PermissionBillingManage,
+	PermissionBillingRefund,
+	PermissionRedemptionsRead,
+	PermissionRedemptionsWrite,
+	PermissionPlansRead,
+	PermissionPlansWrite,
+	PermissionOptionsRead,
+	PermissionOptionsWrite,
+	PermissionModelsRead,
+	PermissionModelsWrite,
+	PermissionMessagesRead,
+	PermissionMessagesWrite,
+	PermissionTasksRead,
+	PermissionAuditRead,
+}
+
+// IsValidPermission 判断权限字符串是否合法，通配形式要求资源名已定义
+func IsValidPermission(permission string) bool {
+	if permission == PermissionAll {
+		return true
+	}
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+		if strings.HasSuffix(permission, ":*") && strings.HasPrefix(p, strings.TrimSuffix(permission, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPermission 判断已授予的权限是否覆盖所需权限
+func MatchPermission(granted string, required string) bool {
+	if granted == PermissionAll || granted == required {
+		return true
+	}
+	if strings.HasSuffix(granted, ":*") {
+		return strings.HasPrefix(required, strings.TrimSuffix(granted, "*"))
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 落库加密的密钥以该前缀标识，其后为信封的 base64 JSON
+const encryptedSecretPrefix = "secret:v1:"
+
+// 外部密钥引用，在使用时解析，数据库中只保存引用本身
+const (
+	SecretEnvRefPrefix  = "env://"
+	SecretFileRefPrefix = "file://"
+)
+
+// SecretEnvAllowedPrefix env:// 引用只允许读取该前缀的环境变量，避免借渠道密钥读出数据库连接串等服务器配置
+const SecretEnvAllowedPrefix = "VELOERA_SECRET_"
+
+var (
+	secretCipher     *EnvelopeCipher
+	secretCipherErr  error
+	secretCipherOnce sync.Once
+)
+
+func getSecretCipher() (*EnvelopeCipher, error) {
+	secretCipherOnce.Do(func() {
+		if SecretEncryptionKey == "" {
+			secretCipherErr = errors.New("SECRET_ENCRYPTION_KEY is not configured")
+			return
+		}
+		secretCipher, secretCipherErr = NewEnvelopeCipher(SecretEncryptionKey,
+			strings.Split(SecretEncryptionOldKeys, ",")...)
+	})
+	return secretCipher, secretCipherErr
+}
+
+// SecretEncryptionEnabled 是否配置了落库加密主密钥，未配置时密钥按明文存储
+func SecretEncryptionEnabled() bool {
+	return SecretEncryptionKey != ""
+}
+
+// IsEncryptedSecret 判断存储值是否为加密后的密钥
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// IsSecretReference 判断是否为 env:// 或 file:// 外部引用
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, SecretEnvRefPrefix) || strings.HasPrefix(value, SecretFileRefPrefix)
+}
+
+// IsSecretOptionKey 判断选项是否保存密钥：以 token、secret、key 结尾的选项，不区分大小写，
+// 覆盖 SMTPToken、各 OAuth Client Secret 以及 oidc.client_secret 等注册配置
+func IsSecretOptionKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "token") ||
+		strings.HasSuffix(key, "secret") ||
+		strings.HasSuffix(key, "key")
+}
+
+func parseEncryptedSecret(value string) (*Envelope, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return nil, err
+	}
+	var envelope Envelope
+	if err = json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+// EncryptSecret 加密待落库的密钥；未配置主密钥、值为空或已加密时原样返回
+func EncryptSecret(value string) (string, error) {
+	if value == "" || !SecretEncryptionEnabled() || IsEncryptedSecret(value) {
+		return value, nil
+	}
+	cipher, err := getSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	envelope, err := cipher.Encrypt([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptSecret 解密数据库中的密钥，明文存储的历史数据原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	cipher, err := getSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	envelope, err := parseEncryptedSecret(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret: %w", err)
+	}
+	plaintext, err := cipher.Decrypt(envelope)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// SecretNeedsRotation 判断存储值是否需要用当前主密钥重新加密：明文存储或使用旧主密钥加密
+func SecretNeedsRotation(value string) bool {
+	if value == "" || !SecretEncryptionEnabled() {
+		return false
+	}
+	if !IsEncryptedSecret(value) {
+		return true
+	}
+	cipher, err := getSecretCipher()
+	if err != nil {
+		return false
+	}
+	envelope, err := parseEncryptedSecret(value)
+	if err != nil {
+		return false
+	}
+	return envelope.KeyId != cipher.PrimaryKeyId()
+}
+
+// SecretKeyId 返回加密存储值所用主密钥的标识，明文返回空字符串
+func SecretKeyId(value string) string {
+	if !IsEncryptedSecret(value) {
+		return ""
+	}
+	envelope, err := parseEncryptedSecret(value)
+	if err != nil {
+		return ""
+	}
+	return envelope.KeyId
+}
+
+// SecretPrimaryKeyId 返回当前主密钥的标识，未配置时返回空字符串
+func SecretPrimaryKeyId() string {
+	cipher, err := getSecretCipher()
+	if err != nil {
+		return ""
+	}
+	return cipher.PrimaryKeyId()
+}
+
+// ValidateSecretReference 校验外部引用是否在允许范围内：环境变量须以 VELOERA_SECRET_ 开头，
+// 文件须位于 SECRET_FILE_DIR 目录下，且不能包含 .. 或指向 /proc
+func ValidateSecretReference(value string) error {
+	switch {
+	case strings.HasPrefix(value, SecretEnvRefPrefix):
+		name := strings.TrimPrefix(value, SecretEnvRefPrefix)
+		if !strings.HasPrefix(name, SecretEnvAllowedPrefix) || len(name) == len(SecretEnvAllowedPrefix) {
+			return fmt.Errorf("env:// 引用只能使用 %s 开头的环境变量", SecretEnvAllowedPrefix)
+		}
+	case strings.HasPrefix(value, SecretFileRefPrefix):
+		_, err := secretFilePath(strings.TrimPrefix(value, SecretFileRefPrefix))
+		return err
+	}
+	return nil
+}
+
+func secretFilePath(path string) (string, error) {
+	if SecretFileRefDir == "" {
+		return "", errors.New("未配置 SECRET_FILE_DIR，file:// 引用已禁用")
+	}
+	if strings.Contains(path, "..") || !filepath.IsAbs(path) {
+		return "", errors.New("file:// 引用必须为绝对路径且不能包含 ..")
+	}
+	path = filepath.Clean(path)
+	if err := checkSecretFileDir(path, filepath.Clean(SecretFileRefDir)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func checkSecretFileDir(path string, dir string) error {
+	if path == "/proc" || strings.HasPrefix(path, "/proc/") {
+		return errors.New("file:// 引用不能指向 /proc")
+	}
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return fmt.Errorf("file:// 引用只能读取 %s 目录下的文件", dir)
+	}
+	return nil
+}
+
+// ResolveSecret 解析外部引用：env://NAME 读取环境变量，file:///path 读取文件内容（去除首尾空白），其余原样返回。
+// 不在允许范围内的引用一律拒绝，已存储的历史引用同样受限
+func ResolveSecret(value string) (string, error) {
+	if !IsSecretReference(value) {
+		return value, nil
+	}
+	if err := ValidateSecretReference(value); err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(value, SecretEnvRefPrefix):
+		name := strings.TrimPrefix(value, SecretEnvRefPrefix)
+		resolved, ok := os.LookupEnv(name)
+		if !ok || resolved == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return resolved, nil
+	default:
+		path, _ := secretFilePath(strings.TrimPrefix(value, SecretFileRefPrefix))
+		// 符号链接可能指向目录之外，按真实路径再校验一次
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+		}
+		realDir, err := filepath.EvalSymlinks(filepath.Clean(SecretFileRefDir))
+		if err != nil {
+			realDir = filepath.Clean(SecretFileRefDir)
+		}
+		if err = checkSecretFileDir(realPath, realDir); err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(realPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+		}
+		resolved := strings.TrimSpace(string(data))
+		if resolved == "" {
+			return "", fmt.Errorf("secret file %s is empty", path)
+		}
+		return resolved, nil
+	}
+}
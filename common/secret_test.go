@@ -0,0 +1,86 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "key.txt"), []byte("  s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "leak.txt"), []byte("leaked"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "leak.txt"), filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "key.txt"), filepath.Join(dir, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	oldDir := SecretFileRefDir
+	SecretFileRefDir = dir
+	t.Cleanup(func() { SecretFileRefDir = oldDir })
+	t.Setenv("VELOERA_SECRET_TEST_KEY", "from-env")
+	t.Setenv("VELOERA_TEST_DB_PASSWORD", "db-password")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"plain value", "sk-plain", "sk-plain", false},
+		{"allowed env", "env://VELOERA_SECRET_TEST_KEY", "from-env", false},
+		{"env without allowed prefix", "env://VELOERA_TEST_DB_PASSWORD", "", true},
+		{"env with bare prefix", "env://" + SecretEnvAllowedPrefix, "", true},
+		{"unset env", "env://VELOERA_SECRET_TEST_MISSING", "", true},
+		{"file in dir", "file://" + filepath.Join(dir, "key.txt"), "s3cret", false},
+		{"symlink inside dir", "file://" + filepath.Join(dir, "alias"), "s3cret", false},
+		{"symlink outside dir", "file://" + filepath.Join(dir, "escape"), "", true},
+		{"dot dot traversal", "file://" + dir + "/../" + filepath.Base(outside) + "/leak.txt", "", true},
+		{"relative path", "file://key.txt", "", true},
+		{"sibling dir with same prefix", "file://" + dir + "-evil/key.txt", "", true},
+		{"proc", "file:///proc/self/environ", "", true},
+		{"missing file", "file://" + filepath.Join(dir, "missing.txt"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSecret(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveSecret(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveSecret(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecretFileRefDisabled(t *testing.T) {
+	oldDir := SecretFileRefDir
+	SecretFileRefDir = ""
+	t.Cleanup(func() { SecretFileRefDir = oldDir })
+	if _, err := ResolveSecret("file:///run/secrets/key"); err == nil {
+		t.Error("file:// reference should be rejected when SECRET_FILE_DIR is empty")
+	}
+}
@@ -17,9 +17,14 @@
 package constant
 
 var (
-	ForceFormat                     = "force_format"        // ForceFormat 强制格式化为OpenAI格式
-	ChanelSettingProxy              = "proxy"               // Proxy 代理
-	ChannelSettingThinkingToContent = "thinking_to_content" // ThinkingToContent
-	ChannelSettingStreamSupport     = "stream_support"      // StreamSupport 控制上游流式请求行为
-	StreamSupportNonStreamOnly      = "NON_STREAM_ONLY"     // StreamSupport 仅非流式请求
+	ForceFormat                     = "force_format"         // ForceFormat 强制格式化为OpenAI格式
+	ChanelSettingProxy              = "proxy"                // Proxy 代理
+	ChannelSettingThinkingToContent = "thinking_to_content"  // ThinkingToContent
+	ChannelSettingStreamSupport     = "stream_support"       // StreamSupport 控制上游流式请求行为
+	StreamSupportNonStreamOnly      = "NON_STREAM_ONLY"      // StreamSupport 仅非流式请求
+	ChannelSettingOllamaNativeAPI   = "ollama_native_api"    // OllamaNativeAPI 使用 Ollama 原生 /api/chat 与 /api/generate 接口
+	ChannelSettingOllamaKeepAlive   = "ollama_keep_alive"    // OllamaKeepAlive 原生接口默认的 keep_alive
+	ChannelSettingOllamaOptions     = "ollama_options"       // OllamaOptions 原生接口默认的 options，如 num_ctx
+	ChannelSettingRealtimeEmulation = "realtime_emulation"   // RealtimeEmulation 实时接口改由 STT → 对话 → TTS 流水线模拟
+	ChannelSettingEmbeddingBatch    = "embedding_batch_size" // EmbeddingBatch 向量请求单次发往上游的最大输入条数
 )
@@ -23,4 +23,9 @@ const (
 	ContextKeyUserStatus       = "user_status"
 	ContextKeyUserEmail        = "user_email"
 	ContextKeyUserGroup        = "user_group"
+	ContextKeyModelDeprecated  = "model_deprecated" // 请求的模型已弃用
+	ContextKeyRetiredModel     = "retired_model"    // 请求的模型已退役，值为原模型名称
+	ContextKeyModelFallbacks   = "model_fallbacks"  // 尚未尝试的回退模型
+	ContextKeyFallbackFrom     = "fallback_from"    // 已回退到其他模型时为客户端请求的模型
+	ContextKeyHedgeAttempt     = "hedge_attempt"    // 对冲请求中的一次尝试
 )
@@ -0,0 +1,116 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditExportLimit 单次导出的最大记录数
+const auditExportLimit = 50000
+
+// recordAuditLog 记录一次管理操作。before 为 nil 表示新建，after 为 nil 表示删除，
+// 二者都为批量操作的参数摘要时，diff 中只会出现 after
+func recordAuditLog(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	model.RecordAuditLog(&model.AuditLog{
+		UserId:     c.GetInt("id"),
+		Username:   c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+		Diff:       service.BuildAuditDiff(before, after),
+		Ip:         c.ClientIP(),
+		RequestId:  c.GetString(common.RequestIdKey),
+	})
+}
+
+func parseAuditLogFilter(c *gin.Context) model.AuditLogFilter {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditLogFilter{
+		UserId:         userId,
+		Username:       c.Query("username"),
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		Keyword:        c.Query("keyword"),
+		RequestId:      c.Query("request_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	} else if pageSize > 100 {
+		pageSize = 100
+	}
+	auditLogs, total, err := model.SearchAuditLogs(parseAuditLogFilter(c), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     auditLogs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func ExportAuditLogs(c *gin.Context) {
+	auditLogs, err := model.ExportAuditLogs(parseAuditLogFilter(c), auditExportLimit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data, err := service.RenderAuditLogCSV(auditLogs)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-logs-%s.csv", time.Now().Format("20060102150405")))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
@@ -95,7 +95,7 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	}
 	cache.WriteContext(c)
 
-	c.Request.Header.Set("Authorization", "Bearer "+channel.Key)
+	c.Request.Header.Set("Authorization", "Bearer "+channel.GetKey())
 	c.Request.Header.Set("Content-Type", "application/json")
 	c.Set("channel", channel.Type)
 	c.Set("base_url", channel.GetBaseURL())
@@ -25,6 +25,7 @@ import (
 	"veloera/common"
 	"veloera/middleware"
 	"veloera/model"
+	"veloera/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -151,6 +152,10 @@ func FetchUpstreamModels(c *gin.Context) {
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
+	if channel.Type == common.ChannelTypeOllama {
+		fetchOllamaModels(c, channel, baseURL)
+		return
+	}
 	url := fmt.Sprintf("%s/v1/models", baseURL)
 
 	if strings.HasSuffix(baseURL, "/chat/completions") {
@@ -163,7 +168,7 @@ func FetchUpstreamModels(c *gin.Context) {
 	if channel.Type == common.ChannelTypeGitHub {
 		url = strings.Replace(baseURL, "/inference", "/catalog/models", 1)
 	}
-	key := strings.Split(channel.Key, ",")[0]
+	key := strings.Split(channel.GetKey(), ",")[0]
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -221,6 +226,7 @@ func FixChannelsAbilities(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.fix_abilities", model.AuditTargetChannel, "", nil, gin.H{"fixed": count})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -365,10 +371,12 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 密钥只写不读，仅返回脱敏后的值
+	channel.Key = service.MaskChannelKey(channel.Key)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    channel, // The key will be included in the response
+		"data":    channel,
 	})
 	return
 }
@@ -419,6 +427,14 @@ func AddChannel(c *gin.Context) {
 		}
 	}
 
+	if err := checkSecretReference(c, channel.Key); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	err = channel.Insert() // 使用 Insert 方法替代 InsertChannel
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -428,6 +444,8 @@ func AddChannel(c *gin.Context) {
 		return
 	}
 
+	recordAuditLog(c, "channel.create", model.AuditTargetChannel, channel.Id, nil, channel)
+
 	// refresh prefix cache for the groups this channel belongs to
 	middleware.RefreshPrefixChannelsCache(channel.Group)
 
@@ -440,6 +458,7 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -449,6 +468,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.delete", model.AuditTargetChannel, id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -465,6 +485,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.delete_disabled", model.AuditTargetChannel, "", nil, gin.H{"deleted": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -501,6 +522,7 @@ func DisableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.tag_disable", model.AuditTargetChannel, "tag:"+channelTag.Tag, nil, gin.H{"status": common.ChannelStatusManuallyDisabled})
 	if channels, err := model.GetChannelsByTag(channelTag.Tag, false); err == nil {
 		groupSet := make(map[string]struct{})
 		for _, ch := range channels {
@@ -540,6 +562,7 @@ func EnableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.tag_enable", model.AuditTargetChannel, "tag:"+channelTag.Tag, nil, gin.H{"status": common.ChannelStatusEnabled})
 	if channels, err := model.GetChannelsByTag(channelTag.Tag, false); err == nil {
 		groupSet := make(map[string]struct{})
 		for _, ch := range channels {
@@ -578,6 +601,7 @@ func EditTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	before := tagChannelsSnapshot(channelTag.Tag)
 	err = model.EditChannelByTag(channelTag.Tag, channelTag.NewTag, channelTag.ModelMapping, channelTag.Models, channelTag.Groups, channelTag.Priority, channelTag.Weight)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -586,6 +610,11 @@ func EditTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	newTag := channelTag.Tag
+	if channelTag.NewTag != nil && *channelTag.NewTag != "" {
+		newTag = *channelTag.NewTag
+	}
+	recordAuditLog(c, "channel.tag_edit", model.AuditTargetChannel, "tag:"+channelTag.Tag, before, tagChannelsSnapshot(newTag))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -593,6 +622,19 @@ func EditTagChannels(c *gin.Context) {
 	return
 }
 
+// tagChannelsSnapshot 以渠道 id 为键记录同一标签下的全部渠道，用于审计批量编辑前后的差异
+func tagChannelsSnapshot(tag string) map[string]*model.Channel {
+	snapshot := make(map[string]*model.Channel)
+	channels, err := model.GetChannelsByTag(tag, false)
+	if err != nil {
+		return snapshot
+	}
+	for _, channel := range channels {
+		snapshot[strconv.Itoa(channel.Id)] = channel
+	}
+	return snapshot
+}
+
 type ChannelBatch struct {
 	Ids []int   `json:"ids"`
 	Tag *string `json:"tag"`
@@ -616,6 +658,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.batch_delete", model.AuditTargetChannel, "", nil, gin.H{"ids": channelBatch.Ids})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -655,6 +698,22 @@ func UpdateChannel(c *gin.Context) {
 			}
 		}
 	}
+	origin, _ := model.GetChannelById(channel.Id, true)
+	// 提交的是展示用的脱敏值时视为未修改，保留原密钥
+	if origin != nil && channel.Key != "" && channel.Key == service.MaskChannelKey(origin.Key) {
+		channel.Key = ""
+	}
+	// 原样提交已保存的引用视为未修改
+	if origin != nil && channel.Key == origin.Key {
+		channel.Key = ""
+	}
+	if err := checkSecretReference(c, channel.Key); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -663,9 +722,13 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil {
+		recordAuditLog(c, "channel.update", model.AuditTargetChannel, channel.Id, origin, updated)
+	}
 
 	// refresh prefix cache as channel configuration may change
 	middleware.RefreshPrefixChannelsCache(channel.Group)
+	channel.Key = service.MaskChannelKey(channel.Key)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -777,6 +840,7 @@ func BatchSetChannelTag(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "channel.batch_tag", model.AuditTargetChannel, "", nil, gin.H{"ids": channelBatch.Ids, "tag": channelBatch.Tag})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,171 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+	"veloera/relay/channel/ollama"
+	"veloera/relay/helper"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ollamaHttpClient 按渠道的代理设置返回 HTTP 客户端，timeout 为 false 时不限制请求时长
+func ollamaHttpClient(channel *model.Channel, timeout bool) (*http.Client, error) {
+	client := service.GetHttpClient()
+	if proxy, ok := channel.GetSetting()[constant.ChanelSettingProxy].(string); ok && proxy != "" {
+		proxyClient, err := service.NewProxyHttpClient(proxy)
+		if err != nil {
+			return nil, err
+		}
+		client = proxyClient
+	}
+	if !timeout {
+		// 拉取模型耗时较长，只随管理员断开连接而取消
+		client = &http.Client{Transport: client.Transport}
+	}
+	return client, nil
+}
+
+func ollamaBaseURL(channel *model.Channel) string {
+	if channel.GetBaseURL() != "" {
+		return channel.GetBaseURL()
+	}
+	return common.ChannelBaseURLs[channel.Type]
+}
+
+// fetchOllamaModels 通过 /api/tags 获取 Ollama 本地模型，data 保持与其他渠道一致的模型名列表，models 附带模型详情
+func fetchOllamaModels(c *gin.Context, channel *model.Channel, baseURL string) {
+	client, err := ollamaHttpClient(channel, true)
+	if err == nil {
+		var models []ollama.OllamaModel
+		models, err = ollama.FetchTags(c.Request.Context(), client, baseURL, strings.Split(channel.GetKey(), ",")[0])
+		if err == nil {
+			ids := make([]string, 0, len(models))
+			for _, m := range models {
+				ids = append(ids, m.Name)
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": "",
+				"data":    ids,
+				"models":  models,
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+type ollamaPullRequest struct {
+	Model        string `json:"model"`
+	AddToChannel bool   `json:"add_to_channel"` // 拉取成功后将模型加入渠道的模型列表
+}
+
+// ollamaPullEvent 推送给管理员的拉取进度
+type ollamaPullEvent struct {
+	ollama.OllamaPullProgress
+	Percent float64 `json:"percent,omitempty"`
+	Done    bool    `json:"done,omitempty"`
+}
+
+// PullOllamaModel 在 Ollama 渠道所在主机上拉取模型，以 SSE 推送进度
+func PullOllamaModel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var req ollamaPullRequest
+	if err = c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Model) == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模型名称不能为空",
+		})
+		return
+	}
+	req.Model = strings.TrimSpace(req.Model)
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if channel.Type != common.ChannelTypeOllama {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅 Ollama 渠道支持拉取模型",
+		})
+		return
+	}
+	client, err := ollamaHttpClient(channel, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	helper.SetEventStreamHeaders(c)
+	key := strings.Split(channel.GetKey(), ",")[0]
+	err = ollama.PullModel(c.Request.Context(), client, ollamaBaseURL(channel), key, req.Model, func(progress ollama.OllamaPullProgress) error {
+		event := ollamaPullEvent{OllamaPullProgress: progress}
+		if progress.Total > 0 {
+			event.Percent = float64(progress.Completed) * 100 / float64(progress.Total)
+		}
+		return helper.ObjectData(c, event)
+	})
+	if err == nil && req.AddToChannel {
+		err = addModelToChannel(channel, req.Model)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to pull ollama model %s on channel #%d: %s", req.Model, channel.Id, err.Error()))
+		_ = helper.ObjectData(c, ollamaPullEvent{OllamaPullProgress: ollama.OllamaPullProgress{Error: err.Error()}, Done: true})
+	} else {
+		_ = helper.ObjectData(c, ollamaPullEvent{OllamaPullProgress: ollama.OllamaPullProgress{Status: "success"}, Percent: 100, Done: true})
+	}
+	helper.Done(c)
+}
+
+func addModelToChannel(channel *model.Channel, modelName string) error {
+	models := channel.GetModels()
+	if common.StringsContains(models, modelName) {
+		return nil
+	}
+	channel.Models = strings.Join(append(models, modelName), ",")
+	if err := channel.Update(); err != nil {
+		return errors.New("模型已拉取，但更新渠道模型列表失败：" + err.Error())
+	}
+	return nil
+}
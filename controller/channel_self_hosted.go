@@ -0,0 +1,38 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSelfHostedStatus 返回自建推理渠道各副本最近一次采集的健康与负载状态
+func GetSelfHostedStatus(c *gin.Context) {
+	replicas := service.GetSelfHostedReplicas()
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].ChannelId < replicas[j].ChannelId
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    replicas,
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configImportMaxSize 导入配置文件的大小上限
+const configImportMaxSize = 32 << 20
+
+// hasRequestPermissions 在路由权限之外，按请求参数追加校验权限
+func hasRequestPermissions(c *gin.Context, permissions ...string) bool {
+	user, err := model.GetUserCache(c.GetInt("id"))
+	if err != nil {
+		return false
+	}
+	return model.HasPermissions(c.GetInt("role"), user.RoleName, permissions...)
+}
+
+// ExportConfig 导出声明式配置，secrets 为 plain 或 encrypt 时需要渠道与选项的写权限
+func ExportConfig(c *gin.Context) {
+	format := c.DefaultQuery("format", "yaml")
+	if format != "yaml" && format != "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的导出格式",
+		})
+		return
+	}
+	secrets := c.DefaultQuery("secrets", service.ConfigSecretsOmit)
+	if !service.IsValidConfigSecretsMode(secrets) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的密钥导出方式",
+		})
+		return
+	}
+	if secrets == service.ConfigSecretsPlain || secrets == service.ConfigSecretsEncrypt {
+		if !hasRequestPermissions(c, common.PermissionChannelsWrite, common.PermissionOptionsWrite) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "导出密钥需要渠道与系统设置的写权限",
+			})
+			return
+		}
+	}
+	cfg, err := service.ExportDeclarativeConfig(secrets)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data, err := service.MarshalDeclarativeConfig(cfg, format)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	contentType := "application/yaml; charset=utf-8"
+	if format == "json" {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=veloera-config-%s.%s", time.Now().Format("20060102150405"), format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportConfig 导入声明式配置，请求体为 YAML 或 JSON。dry_run=true 时只返回差异，prune=true 时删除配置中不存在的渠道和套餐
+func ImportConfig(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, configImportMaxSize))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cfg, err := service.ParseDeclarativeConfig(data)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "配置解析失败：" + err.Error(),
+		})
+		return
+	}
+	if cfg.HasSecretReferences() && c.GetInt("role") < common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅超级管理员可以导入包含 env:// 或 file:// 密钥引用的配置",
+		})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	prune := c.Query("prune") == "true"
+	// 删除套餐会退还用户剩余额度，与单独删除套餐的接口保持相同的权限要求
+	if prune && !dryRun && !hasRequestPermissions(c, common.PermissionBillingRefund) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "prune 需要退款权限",
+		})
+		return
+	}
+	result, err := service.ReconcileDeclarativeConfig(cfg, dryRun, prune)
+	if !dryRun && result != nil && result.Applied > 0 {
+		applied := make([]string, 0, result.Applied)
+		for _, change := range result.Changes[:result.Applied] {
+			applied = append(applied, fmt.Sprintf("%s %s %s", change.Action, change.Kind, change.Name))
+		}
+		recordAuditLog(c, "config.import", model.AuditTargetConfig, "", nil, gin.H{"prune": prune, "changes": applied})
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data":    result,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    result,
+	})
+}
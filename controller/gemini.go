@@ -93,16 +93,7 @@ func ListGeminiModels(c *gin.Context) {
 	response := dto.GeminiModelListResponse{Models: make([]dto.GeminiModel, 0, len(models))}
 
 	for _, name := range models {
-		response.Models = append(response.Models, dto.GeminiModel{
-			Name:                       "models/" + name,
-			BaseModelID:                name,
-			Version:                    "v1beta",
-			DisplayName:                name,
-			Description:                "",
-			InputTokenLimit:            32768,
-			OutputTokenLimit:           8192,
-			SupportedGenerationMethods: []string{"generateContent", "streamGenerateContent"},
-		})
+		response.Models = append(response.Models, buildGeminiModel(name))
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -140,16 +131,34 @@ func RetrieveGeminiModel(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.GeminiModel{
-		Name:                       "models/" + modelName,
-		BaseModelID:                modelName,
+	c.JSON(http.StatusOK, buildGeminiModel(modelName))
+}
+
+// buildGeminiModel 生成 Gemini 格式的模型信息，模型目录中登记的名称与 token 上限优先于默认值
+func buildGeminiModel(name string) dto.GeminiModel {
+	geminiModel := dto.GeminiModel{
+		Name:                       "models/" + name,
+		BaseModelID:                name,
 		Version:                    "v1beta",
-		DisplayName:                modelName,
+		DisplayName:                name,
 		Description:                "",
 		InputTokenLimit:            32768,
 		OutputTokenLimit:           8192,
 		SupportedGenerationMethods: []string{"generateContent", "streamGenerateContent"},
-	})
+	}
+	if catalog, ok := model.GetModelCatalog(name); ok {
+		if catalog.DisplayName != "" {
+			geminiModel.DisplayName = catalog.DisplayName
+		}
+		geminiModel.Description = catalog.Description
+		if catalog.ContextWindow > 0 {
+			geminiModel.InputTokenLimit = catalog.ContextWindow
+		}
+		if catalog.MaxOutputTokens > 0 {
+			geminiModel.OutputTokenLimit = catalog.MaxOutputTokens
+		}
+	}
+	return geminiModel
 }
 
 func respondGeminiError(c *gin.Context, status int, message string) {
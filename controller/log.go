@@ -221,6 +221,7 @@ func DeleteHistoryLogs(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "log.delete_history", model.AuditTargetLog, "", nil, gin.H{"target_timestamp": targetTimestamp, "deleted": count})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -228,3 +229,51 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+func GetLogArchives(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p <= 0 {
+		p = 1
+	}
+	if pageSize < 1 {
+		pageSize = common.ItemsPerPage
+	}
+	archives, total, err := model.GetLogArchives((p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     archives,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// ArchiveLogs 立即归档所有已关闭的日志分区
+func ArchiveLogs(c *gin.Context) {
+	count, err := model.ArchiveClosedLogPartitions()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data":    count,
+		})
+		return
+	}
+	recordAuditLog(c, "log.archive", model.AuditTargetLog, "", nil, gin.H{"archived": count})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
@@ -144,16 +144,6 @@ func GetUnreadCount(c *gin.Context) {
 
 // GetAllMessages retrieves all messages with search and filter capabilities for admin users
 func GetAllMessages(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	// Parse pagination parameters
 	p, _ := strconv.Atoi(c.Query("p"))
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
@@ -219,16 +209,6 @@ func GetAllMessages(c *gin.Context) {
 
 // GetMessage retrieves a specific message by ID for admin users
 func GetMessage(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	messageId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -278,16 +258,6 @@ func GetMessage(c *gin.Context) {
 
 // CreateMessage creates and sends a new message to specified users
 func CreateMessage(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	var req dto.CreateMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -337,6 +307,12 @@ func CreateMessage(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "message.create", model.AuditTargetMessage, message.Id, nil, gin.H{
+		"title":    message.Title,
+		"content":  message.Content,
+		"format":   message.Format,
+		"user_ids": req.UserIds,
+	})
 
 	// Get message statistics for response
 	stats, err := model.GetMessageStats(message.Id)
@@ -369,16 +345,6 @@ func CreateMessage(c *gin.Context) {
 
 // UpdateMessage updates an existing message
 func UpdateMessage(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	messageId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -419,6 +385,8 @@ func UpdateMessage(c *gin.Context) {
 		return
 	}
 
+	before := *message
+
 	// Update message fields
 	message.Title = req.Title
 	message.Content = req.Content
@@ -434,6 +402,7 @@ func UpdateMessage(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "message.update", model.AuditTargetMessage, message.Id, before, message)
 
 	// Get message statistics for response
 	stats, err := model.GetMessageStats(messageId)
@@ -466,16 +435,6 @@ func UpdateMessage(c *gin.Context) {
 
 // DeleteMessage deletes a message and all associated user message records
 func DeleteMessage(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	messageId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -504,6 +463,7 @@ func DeleteMessage(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "message.delete", model.AuditTargetMessage, message.Id, message, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -513,16 +473,6 @@ func DeleteMessage(c *gin.Context) {
 
 // SearchMessages searches messages with keyword and date range filters for admin users
 func SearchMessages(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	// Parse pagination parameters
 	p, _ := strconv.Atoi(c.Query("p"))
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
@@ -590,16 +540,6 @@ func SearchMessages(c *gin.Context) {
 
 // GetMessageRecipients retrieves all recipients for a specific message
 func GetMessageRecipients(c *gin.Context) {
-	// Check admin authorization
-	role := c.GetInt("role")
-	if role < common.RoleAdminUser {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Access denied: admin privileges required",
-		})
-		return
-	}
-
 	messageId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -366,12 +366,32 @@ func ListModels(c *gin.Context) {
 		}
 	}
 
+	for i := range userOpenAiModels {
+		userOpenAiModels[i] = withModelCatalog(userOpenAiModels[i])
+	}
+
 	c.JSON(200, gin.H{
 		"success": true,
 		"data":    userOpenAiModels,
 	})
 }
 
+// withModelCatalog 附加模型目录中登记的元数据，带前缀的模型按 Root 查找
+func withModelCatalog(aiModel dto.OpenAIModels) dto.OpenAIModels {
+	catalog, ok := model.GetModelCatalog(aiModel.Id)
+	if !ok && aiModel.Root != "" {
+		catalog, ok = model.GetModelCatalog(aiModel.Root)
+	}
+	if !ok {
+		return aiModel
+	}
+	aiModel.ModelMetadata = catalog.ToMetadata()
+	if catalog.Provider != "" {
+		aiModel.OwnedBy = catalog.Provider
+	}
+	return aiModel
+}
+
 func ChannelListModels(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"success": true,
@@ -414,7 +434,7 @@ func RetrieveModel(c *gin.Context) {
 				if aiModel, ok := openAIModelsMap[baseModelId]; ok {
 					modelCopy := aiModel
 					modelCopy.Id = modelId // Use the prefixed model ID
-					c.JSON(200, modelCopy)
+					c.JSON(200, withModelCatalog(modelCopy))
 					return
 				}
 			}
@@ -423,7 +443,18 @@ func RetrieveModel(c *gin.Context) {
 
 	// No prefix found or base model doesn't exist, try the original model ID
 	if aiModel, ok := openAIModelsMap[modelId]; ok {
-		c.JSON(200, aiModel)
+		c.JSON(200, withModelCatalog(aiModel))
+	} else if _, ok := model.GetModelCatalog(modelId); ok {
+		// 仅在模型目录中登记的模型
+		c.JSON(200, withModelCatalog(dto.OpenAIModels{
+			Id:         modelId,
+			Object:     "model",
+			Created:    1626777600,
+			OwnedBy:    "custom",
+			Permission: getPermission(),
+			Root:       modelId,
+			Parent:     nil,
+		}))
 	} else {
 		openAIError := dto.OpenAIError{
 			Message: fmt.Sprintf("The model '%s' does not exist", modelId),
@@ -0,0 +1,238 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllModelCatalogs(c *gin.Context) {
+	catalogs, err := model.GetAllModelCatalogs(c.Query("keyword"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    catalogs,
+	})
+}
+
+func GetModelCatalog(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	catalog, err := model.GetModelCatalogById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    catalog,
+	})
+}
+
+func AddModelCatalog(c *gin.Context) {
+	var catalog model.ModelCatalog
+	if err := c.ShouldBindJSON(&catalog); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	catalog.Id = 0
+	if err := catalog.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if _, ok := model.GetModelCatalog(catalog.ModelName); ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该模型已在目录中",
+		})
+		return
+	}
+	if err := catalog.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "model_catalog.create", model.AuditTargetModelCatalog, catalog.ModelName, nil, catalog)
+	if catalog.GetLifecycle() != model.ModelLifecycleActive {
+		notifyModelLifecycleAsync(&catalog, c.GetInt("id"))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    catalog,
+	})
+}
+
+func UpdateModelCatalog(c *gin.Context) {
+	var catalog model.ModelCatalog
+	if err := c.ShouldBindJSON(&catalog); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	origin, err := model.GetModelCatalogById(catalog.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := catalog.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if existing, ok := model.GetModelCatalog(catalog.ModelName); ok && existing.Id != catalog.Id {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该模型已在目录中",
+		})
+		return
+	}
+	if err := catalog.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "model_catalog.update", model.AuditTargetModelCatalog, catalog.ModelName, origin, catalog)
+	// 从可用转为弃用或退役时通知最近使用过该模型的用户
+	if origin.GetLifecycle() == model.ModelLifecycleActive && catalog.GetLifecycle() != model.ModelLifecycleActive {
+		notifyModelLifecycleAsync(&catalog, c.GetInt("id"))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    catalog,
+	})
+}
+
+func DeleteModelCatalog(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	catalog, err := model.GetModelCatalogById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := catalog.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "model_catalog.delete", model.AuditTargetModelCatalog, catalog.ModelName, catalog, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func notifyModelLifecycleAsync(catalog *model.ModelCatalog, operatorId int) {
+	notified := *catalog
+	gopool.Go(func() {
+		count, err := service.NotifyModelLifecycle(&notified, operatorId)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to notify users of model %s: %s", notified.ModelName, err.Error()))
+			return
+		}
+		common.SysLog(fmt.Sprintf("notified %d users of model %s lifecycle change", count, notified.ModelName))
+	})
+}
+
+// NotifyModelCatalogUsers 手动向最近使用过已弃用/已退役模型的用户重新发送通知
+func NotifyModelCatalogUsers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	catalog, err := model.GetModelCatalogById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	count, err := service.NotifyModelLifecycle(catalog, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "model_catalog.notify", model.AuditTargetModelCatalog, catalog.ModelName, nil, gin.H{"users": count})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    gin.H{"users": count},
+	})
+}
@@ -49,6 +49,7 @@ func UpdateGlobalModelMapping(c *gin.Context) {
 		return
 	}
 	
+	before := optionAuditValue(service.GlobalModelMappingToJSONString())
 	if err := service.UpdateGlobalModelMapping(&mapping); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -56,6 +57,7 @@ func UpdateGlobalModelMapping(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "model_mapping.update", model.AuditTargetModelMapping, "global", before, optionAuditValue(service.GlobalModelMappingToJSONString()))
 	
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -104,6 +106,7 @@ func UpdateModelMappingConfig(c *gin.Context) {
 	}
 	
 	// 更新配置
+	before := optionAuditValue(service.GlobalModelMappingToJSONString())
 	if err := service.UpdateGlobalModelMappingFromJSONString(string(jsonStr)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -111,6 +114,7 @@ func UpdateModelMappingConfig(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "model_mapping.update", model.AuditTargetModelMapping, "global", before, optionAuditValue(service.GlobalModelMappingToJSONString()))
 	
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
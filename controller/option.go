@@ -19,10 +19,10 @@ package controller
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 	"veloera/common"
 	"veloera/model"
 	"veloera/setting"
+	"veloera/setting/model_setting"
 	"veloera/setting/operation_setting"
 	"veloera/setting/system_setting"
 
@@ -33,7 +33,8 @@ func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	common.OptionMapRWMutex.Lock()
 	for k, v := range common.OptionMap {
-		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "Key") {
+		// 密钥类选项只写不读
+		if common.IsSecretOptionKey(k) {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -135,6 +136,33 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ModelPricingRules":
+		err = operation_setting.CheckPricingRules(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "moderation.default_policy", "moderation.group_policies", "moderation.timeout_seconds":
+		err = model_setting.CheckModerationOption(option.Key, option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "request_guard.default_policy", "request_guard.group_policies", "request_guard.injection_patterns":
+		err = model_setting.CheckRequestGuardOption(option.Key, option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "ReverseProxyProvider":
 		if option.Value != "nginx" && option.Value != "cloudflare" {
 			c.JSON(http.StatusOK, gin.H{
@@ -145,6 +173,18 @@ func UpdateOption(c *gin.Context) {
 		}
 
 	}
+	if common.IsSecretOptionKey(option.Key) {
+		if err := checkSecretReference(c, option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	common.OptionMapRWMutex.RLock()
+	originValue, existed := common.OptionMap[option.Key]
+	common.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -153,6 +193,11 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	var before map[string]any
+	if existed {
+		before = map[string]any{option.Key: optionAuditValue(originValue)}
+	}
+	recordAuditLog(c, "option.update", model.AuditTargetOption, option.Key, before, map[string]any{option.Key: optionAuditValue(option.Value)})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -160,6 +205,15 @@ func UpdateOption(c *gin.Context) {
 	return
 }
 
+// optionAuditValue 将 JSON 对象形式的配置值展开，使审计 diff 精确到其中发生变化的条目
+func optionAuditValue(value string) any {
+	object := make(map[string]any)
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return value
+	}
+	return object
+}
+
 // ValidateFallbackPricing validates fallback pricing configuration before saving
 func ValidateFallbackPricing(c *gin.Context) {
 	var config operation_setting.FallbackPricingConfig
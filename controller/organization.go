@@ -0,0 +1,746 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+	"veloera/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orgInvitationValidDuration 邀请链接的有效期
+const orgInvitationValidDuration = 7 * 24 * time.Hour
+
+// getRequestOrgMember 解析路径中的组织 id 并返回当前用户的成员信息，失败时直接写出响应
+func getRequestOrgMember(c *gin.Context, requireManager bool) (*model.OrgMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的组织 id",
+		})
+		return nil, false
+	}
+	member, err := model.GetOrgMember(orgId, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	if requireManager && !member.CanManage() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅组织所有者或管理员可以执行此操作",
+		})
+		return nil, false
+	}
+	return member, true
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+}
+
+func CreateOrganization(c *gin.Context) {
+	org := model.Organization{}
+	if err := c.ShouldBindJSON(&org); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" || len(org.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织名称不能为空且长度不能超过 64",
+		})
+		return
+	}
+	if err := model.CreateOrganization(&org, c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+func GetOrganization(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	memberCount, _ := model.GetOrgMemberCount(org.Id)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"organization": org,
+			"member":       member,
+			"member_count": memberCount,
+		},
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, true)
+	if !ok {
+		return
+	}
+	req := model.Organization{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织名称不能为空且长度不能超过 64",
+		})
+		return
+	}
+	// 状态只能由系统管理员修改
+	org.Name = req.Name
+	org.Description = req.Description
+	if err := org.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+func DeleteOrganization(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	if member.Role != model.OrgRoleOwner {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅组织所有者可以删除组织",
+		})
+		return
+	}
+	if err := model.DeleteOrganization(member.OrgId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type orgFundRequest struct {
+	Quota int `json:"quota"`
+}
+
+// FundOrganization 成员将个人余额划入组织额度池
+func FundOrganization(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	req := orgFundRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if err := model.FundOrganization(member.OrgId, member.UserId, req.Quota); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(member.UserId, model.LogTypeManage, fmt.Sprintf("向组织 %d 划转额度 %s", member.OrgId, common.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrgMembers(member.OrgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+}
+
+type orgMemberUpdateRequest struct {
+	UserId     int    `json:"user_id"`
+	Role       string `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+	ResetUsed  bool   `json:"reset_used"`
+}
+
+// UpdateOrganizationMember 调整成员角色、消费上限或清零已用额度。
+// 所有者角色不可转让，管理员的任免只能由所有者操作
+func UpdateOrganizationMember(c *gin.Context) {
+	operator, ok := getRequestOrgMember(c, true)
+	if !ok {
+		return
+	}
+	req := orgMemberUpdateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if req.QuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "消费上限不能为负数",
+		})
+		return
+	}
+	target, err := model.GetOrgMember(operator.OrgId, req.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = target.Role
+	}
+	if !model.IsValidOrgRole(req.Role) || (req.Role == model.OrgRoleOwner) != (target.Role == model.OrgRoleOwner) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的成员角色",
+		})
+		return
+	}
+	if operator.Role != model.OrgRoleOwner && (target.Role != model.OrgRoleMember || req.Role != model.OrgRoleMember) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅组织所有者可以管理管理员",
+		})
+		return
+	}
+	target.Role = req.Role
+	target.QuotaLimit = req.QuotaLimit
+	if err := model.UpdateOrgMember(target, req.ResetUsed); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    target,
+	})
+}
+
+// RemoveOrganizationMember 移出成员，成员也可以通过该接口退出组织
+func RemoveOrganizationMember(c *gin.Context) {
+	operator, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	target, err := model.GetOrgMember(operator.OrgId, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if target.Role == model.OrgRoleOwner {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织所有者不能被移出，如需解散请删除组织",
+		})
+		return
+	}
+	if target.UserId != operator.UserId {
+		if !operator.CanManage() || (operator.Role != model.OrgRoleOwner && target.Role != model.OrgRoleMember) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权移出该成员",
+			})
+			return
+		}
+	}
+	if err := model.RemoveOrgMember(target.OrgId, target.UserId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func CreateOrganizationInvitation(c *gin.Context) {
+	operator, ok := getRequestOrgMember(c, true)
+	if !ok {
+		return
+	}
+	invitation := model.OrgInvitation{}
+	if err := c.ShouldBindJSON(&invitation); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if err := common.Validate.Var(invitation.Email, "required,email"); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的邮箱地址",
+		})
+		return
+	}
+	if invitation.Role == "" {
+		invitation.Role = model.OrgRoleMember
+	}
+	if invitation.Role != model.OrgRoleMember && invitation.Role != model.OrgRoleAdmin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的成员角色",
+		})
+		return
+	}
+	if invitation.Role == model.OrgRoleAdmin && operator.Role != model.OrgRoleOwner {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅组织所有者可以邀请管理员",
+		})
+		return
+	}
+	if invitation.QuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "消费上限不能为负数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(operator.OrgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	invitation.Id = 0
+	invitation.OrgId = org.Id
+	invitation.InviterId = operator.UserId
+	invitation.ExpiredTime = time.Now().Add(orgInvitationValidDuration).Unix()
+	if err := model.CreateOrgInvitation(&invitation); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	link := fmt.Sprintf("%s/org/invitation?code=%s", setting.ServerAddress, invitation.Code)
+	subject := fmt.Sprintf("%s组织邀请", common.SystemName)
+	content := fmt.Sprintf("<p>您好，%s 邀请您加入%s上的组织「%s」。</p>"+
+		"<p>点击 <a href='%s'>此处</a> 登录并接受邀请，接受邀请的账户需绑定此邮箱。</p>"+
+		"<p>如果链接无法点击，请尝试点击下面的链接或将其复制到浏览器中打开：<br> %s </p>"+
+		"<p>邀请 %d 天内有效，如果不认识邀请人，请忽略。</p>",
+		c.GetString("username"), common.SystemName, org.Name, link, link, int(orgInvitationValidDuration.Hours()/24))
+	if err := common.SendEmail(subject, invitation.Email, content); err != nil {
+		// 邀请已创建，被邀请人仍可在站内查看并接受
+		common.SysError("failed to send organization invitation email: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "邀请已创建，但邮件发送失败：" + err.Error(),
+			"data":    invitation,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitation,
+	})
+}
+
+func GetOrganizationInvitations(c *gin.Context) {
+	operator, ok := getRequestOrgMember(c, true)
+	if !ok {
+		return
+	}
+	invitations, err := model.GetOrgInvitations(operator.OrgId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitations,
+	})
+}
+
+func RevokeOrganizationInvitation(c *gin.Context) {
+	operator, ok := getRequestOrgMember(c, true)
+	if !ok {
+		return
+	}
+	invitationId, _ := strconv.Atoi(c.Param("invitation_id"))
+	if err := model.RevokeOrgInvitation(operator.OrgId, invitationId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetSelfOrganizationInvitations 列出发给当前用户绑定邮箱的待处理邀请
+func GetSelfOrganizationInvitations(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	invitations, err := model.GetPendingOrgInvitationsByEmail(user.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	items := make([]gin.H, 0, len(invitations))
+	for _, invitation := range invitations {
+		orgName := ""
+		if org, err := model.GetOrganizationById(invitation.OrgId); err == nil {
+			orgName = org.Name
+		}
+		items = append(items, gin.H{
+			"id":           invitation.Id,
+			"org_id":       invitation.OrgId,
+			"org_name":     orgName,
+			"role":         invitation.Role,
+			"quota_limit":  invitation.QuotaLimit,
+			"code":         invitation.Code,
+			"expired_time": invitation.ExpiredTime,
+			"created_time": invitation.CreatedTime,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    items,
+	})
+}
+
+type orgInvitationAcceptRequest struct {
+	Code string `json:"code"`
+}
+
+func AcceptOrganizationInvitation(c *gin.Context) {
+	req := orgInvitationAcceptRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	member, err := model.AcceptOrgInvitation(req.Code, user)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+}
+
+// GetOrganizationTokens 所有者和管理员可查看全部组织令牌，普通成员只能查看自己的
+func GetOrganizationTokens(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	size, _ := strconv.Atoi(c.Query("size"))
+	if p < 0 {
+		p = 0
+	}
+	if size <= 0 {
+		size = common.ItemsPerPage
+	} else if size > 100 {
+		size = 100
+	}
+	userId := member.UserId
+	if member.CanManage() {
+		userId, _ = strconv.Atoi(c.Query("user_id"))
+	}
+	tokens, total, err := model.GetOrgTokens(member.OrgId, userId, p*size, size)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 其他成员的令牌不返回完整密钥
+	for _, token := range tokens {
+		if token.UserId != member.UserId {
+			token.Key = service.MaskSecret(token.Key)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items": tokens,
+			"total": total,
+		},
+	})
+}
+
+// GetOrganizationUsageReport 按成员与模型汇总组织令牌的用量，依赖数据看板（quota_data）
+func GetOrganizationUsageReport(c *gin.Context) {
+	member, ok := getRequestOrgMember(c, false)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if endTimestamp == 0 {
+		endTimestamp = time.Now().Unix()
+	}
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 30*24*3600
+	}
+	reports, err := model.GetOrgUsageReport(member.OrgId, startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !member.CanManage() {
+		own := make([]*model.OrgUsageReport, 0)
+		for _, report := range reports {
+			if report.UserId == member.UserId {
+				own = append(own, report)
+			}
+		}
+		reports = own
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    reports,
+	})
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	size, _ := strconv.Atoi(c.Query("size"))
+	if p < 0 {
+		p = 0
+	}
+	if size <= 0 {
+		size = common.ItemsPerPage
+	} else if size > 100 {
+		size = 100
+	}
+	orgs, total, err := model.GetAllOrganizations(c.Query("keyword"), p*size, size)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items": orgs,
+			"total": total,
+		},
+	})
+}
+
+type orgAdminUpdateRequest struct {
+	Id     int  `json:"id"`
+	Quota  *int `json:"quota"`
+	Status int  `json:"status"`
+}
+
+// AdminUpdateOrganization 系统管理员调整组织额度池或启用、禁用组织
+func AdminUpdateOrganization(c *gin.Context) {
+	req := orgAdminUpdateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(req.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	before := *org
+	if req.Quota != nil {
+		if *req.Quota < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "额度不能为负数",
+			})
+			return
+		}
+		if err := model.SetOrganizationQuota(org.Id, *req.Quota); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		org.Quota = *req.Quota
+	}
+	if req.Status == model.OrgStatusEnabled || req.Status == model.OrgStatusDisabled {
+		org.Status = req.Status
+		if err := org.Update(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	recordAuditLog(c, "organization.update", model.AuditTargetOrganization, org.Id, before, org)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
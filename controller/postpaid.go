@@ -0,0 +1,225 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type billingModeRequest struct {
+	Id          int `json:"id"`
+	BillingMode int `json:"billing_mode"`
+	CreditLimit int `json:"credit_limit"`
+}
+
+type createSettlementRequest struct {
+	Period string `json:"period"`
+	UserId int    `json:"user_id"`
+}
+
+type settleRequest struct {
+	Remark string `json:"remark"`
+}
+
+// UpdateUserBillingMode 管理员切换用户预付费/后付费模式
+func UpdateUserBillingMode(c *gin.Context) {
+	req := billingModeRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(req.Id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !canManageUser(c, user.Role, user.RoleName) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权更新同权限等级或更高权限等级的用户信息",
+		})
+		return
+	}
+	if err := model.SetUserBillingMode(req.Id, req.BillingMode, req.CreditLimit); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "user.billing_mode", model.AuditTargetUser, user.Id,
+		gin.H{"billing_mode": user.BillingMode, "credit_limit": user.CreditLimit},
+		gin.H{"billing_mode": req.BillingMode, "credit_limit": req.CreditLimit})
+	if req.BillingMode == common.UserBillingModePostpaid {
+		model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("管理员将账户设置为后付费，授信额度 %s", common.LogQuota(req.CreditLimit)))
+	} else if user.BillingMode != req.BillingMode {
+		model.RecordLog(user.Id, model.LogTypeManage, "管理员将账户设置为预付费")
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func getSettlementPage(c *gin.Context) (p int, pageSize int) {
+	p, _ = strconv.Atoi(c.Query("p"))
+	pageSize, _ = strconv.Atoi(c.Query("page_size"))
+	if p <= 0 {
+		p = 1
+	}
+	if pageSize < 1 {
+		pageSize = common.ItemsPerPage
+	}
+	return p, pageSize
+}
+
+// GetSelfPostpaidSettlements 获取当前用户的结算单
+func GetSelfPostpaidSettlements(c *gin.Context) {
+	p, pageSize := getSettlementPage(c)
+	status, _ := strconv.Atoi(c.Query("status"))
+	settlements, total, err := model.GetPostpaidSettlements(c.GetInt("id"), status, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     settlements,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetAllPostpaidSettlements 管理员查看结算单
+func GetAllPostpaidSettlements(c *gin.Context) {
+	p, pageSize := getSettlementPage(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	status, _ := strconv.Atoi(c.Query("status"))
+	settlements, total, err := model.GetPostpaidSettlements(userId, status, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     settlements,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// CreatePostpaidSettlements 管理员手动生成结算单，未指定用户时为所有后付费账户生成
+func CreatePostpaidSettlements(c *gin.Context) {
+	req := createSettlementRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	start, end, err := model.ParseStatementPeriod(req.Period)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if end > common.GetTimestamp() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "账期尚未结束，无法结算",
+		})
+		return
+	}
+	count := 0
+	if req.UserId != 0 {
+		if _, err = model.CreatePostpaidSettlement(req.UserId, start, end); err == nil {
+			count = 1
+		}
+	} else {
+		count, err = model.RunPostpaidSettlement(start, end)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "settlement.create", model.AuditTargetSettlement, req.Period, nil, gin.H{"period": req.Period, "user_id": req.UserId, "count": count})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+// SettlePostpaidSettlement 管理员确认结算单已还款
+func SettlePostpaidSettlement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	req := settleRequest{}
+	_ = c.ShouldBindJSON(&req)
+	settlement, err := model.SettlePostpaidSettlement(id, req.Remark)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "settlement.settle", model.AuditTargetSettlement, id, nil, settlement)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    settlement,
+	})
+}
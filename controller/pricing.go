@@ -25,7 +25,16 @@ import (
 )
 
 func GetPricing(c *gin.Context) {
-	pricing := model.GetPricing()
+	// 复制一份再附加模型目录的元数据，避免修改共享的定价缓存
+	pricing := append([]model.Pricing(nil), model.GetPricing()...)
+	for i := range pricing {
+		if catalog, ok := model.GetModelCatalog(pricing[i].ModelName); ok {
+			pricing[i].ModelMetadata = catalog.ToMetadata()
+			if catalog.Provider != "" {
+				pricing[i].OwnerBy = catalog.Provider
+			}
+		}
+	}
 	userId, exists := c.Get("id")
 	usableGroup := map[string]string{}
 	groupRatio := map[string]float64{}
@@ -135,6 +144,7 @@ func enhancePricingWithPrefixes(pricing []model.Pricing, group string) []model.P
 
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := operation_setting.DefaultModelRatio2JSONString()
+	originStr := operation_setting.ModelRatio2JSONString()
 	err := model.UpdateOption("ModelRatio", defaultStr)
 	if err != nil {
 		c.JSON(200, gin.H{
@@ -143,6 +153,8 @@ func ResetModelRatio(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "option.reset_model_ratio", model.AuditTargetOption, "ModelRatio",
+		map[string]any{"ModelRatio": optionAuditValue(originStr)}, map[string]any{"ModelRatio": optionAuditValue(defaultStr)})
 	err = operation_setting.UpdateModelRatioByJSONString(defaultStr)
 	if err != nil {
 		c.JSON(200, gin.H{
@@ -222,6 +222,15 @@ func AddRedemption(c *gin.Context) {
 			keys = append(keys, key)
 		}
 	}
+	recordAuditLog(c, "redemption.create", model.AuditTargetRedemption, redemption.Name, nil, gin.H{
+		"name":        redemption.Name,
+		"quota":       redemption.Quota,
+		"is_gift":     redemption.IsGift,
+		"max_uses":    redemption.MaxUses,
+		"valid_from":  redemption.ValidFrom,
+		"valid_until": redemption.ValidUntil,
+		"count":       len(keys),
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -233,6 +242,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetRedemptionById(id)
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -241,6 +251,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "redemption.delete", model.AuditTargetRedemption, id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -267,6 +278,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	before := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
@@ -284,6 +296,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "redemption.update", model.AuditTargetRedemption, cleanRedemption.Id, before, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -338,6 +351,7 @@ func DeleteRedemptionsByName(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "redemption.delete_by_name", model.AuditTargetRedemption, name, nil, gin.H{"name": name, "deleted": count})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -377,6 +391,7 @@ func BatchDisableRedemptions(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "redemption.batch_disable", model.AuditTargetRedemption, "", nil, gin.H{"ids": requestData.Ids, "disabled": count})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -395,6 +410,7 @@ func DeleteDisabledRedemptions(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "redemption.delete_disabled", model.AuditTargetRedemption, "", nil, gin.H{"deleted": count})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
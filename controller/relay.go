@@ -24,6 +24,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"veloera/common"
 	"veloera/dto"
@@ -64,7 +65,12 @@ func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 		err = relay.TextHelper(c)
 	}
 
-	if err != nil && common.LogErrorEnabled { // If error log is enabled
+	// 内容审核与请求防护拦截的请求始终记录，便于处理申诉
+	// 对冲请求中落败的一方被主动取消，不记录错误日志
+	if err != nil && relaycommon.IsHedgeLost(c) {
+		return err
+	}
+	if err != nil && (common.LogErrorEnabled || err.Error.Code == "content_moderation_blocked" || err.Error.Code == "request_guard_blocked") { // If error log is enabled
 		// 保存错误日志到mysql中
 		userId := c.GetInt("id")
 		tokenName := c.GetString("token_name")
@@ -79,6 +85,9 @@ func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 		other["channel_id"] = channelId
 		other["channel_name"] = c.GetString("channel_name")
 		other["channel_type"] = c.GetInt("channel_type")
+		if records, ok := c.Get("moderation_records"); ok {
+			other["moderation"] = records
+		}
 
 		model.RecordErrorLog(c, userId, channelId, modelName, tokenName, err.Error.Message, tokenId, 0, false, userGroup, other)
 	}
@@ -106,6 +115,46 @@ func Relay(c *gin.Context) {
 	autoRetryCount := model_setting.GetAutoRetryCount()
 	maxRetries := autoRetryCount
 
+	for {
+		openaiErr = relayWithRetry(c, relayMode, group, originalModel, maxRetries)
+		if openaiErr == nil {
+			return
+		}
+		// 首选模型的渠道均失败或超出上下文长度时切换到回退链中的下一个模型
+		if !shouldFallbackModel(c, openaiErr) {
+			break
+		}
+		if _, ok := middleware.NextFallbackModel(c); !ok {
+			break
+		}
+		originalModel = c.GetString("original_model")
+	}
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		common.LogInfo(c, retryLogStr)
+	}
+
+	if openaiErr != nil {
+		if openaiErr.StatusCode == http.StatusTooManyRequests {
+			common.LogError(c, fmt.Sprintf("origin 429 error: %s", openaiErr.Error.Message))
+			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
+		}
+		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		if c.GetString("relay_format") == relaycommon.RelayFormatGemini {
+			geminiErr := service.OpenAIErrorToGeminiResponse(openaiErr)
+			c.JSON(openaiErr.StatusCode, geminiErr)
+		} else {
+			c.JSON(openaiErr.StatusCode, gin.H{
+				"error": openaiErr.Error,
+			})
+		}
+	}
+}
+
+// relayWithRetry 使用当前模型转发请求，失败时按自动重试配置在其他渠道上重试
+func relayWithRetry(c *gin.Context, relayMode int, group string, originalModel string, maxRetries int) *dto.OpenAIErrorWithStatusCode {
+	var openaiErr *dto.OpenAIErrorWithStatusCode
 	for i := 0; i <= maxRetries; i++ {
 		// 如果启用了强制切换渠道，且不是第一次尝试，则增加重试索引以获取不同渠道
 		retryIndex := i
@@ -117,12 +166,16 @@ func Relay(c *gin.Context) {
 		if err != nil {
 			common.LogError(c, err.Error())
 			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+			return openaiErr
 		}
 
 		// 记录响应前的状态，用于检测空回复
 		c.Set("response_written", false)
-		openaiErr = relayRequest(c, relayMode, channel)
+		if i == 0 && shouldHedge(c, relayMode) {
+			openaiErr = relayHedged(c, relayMode, channel, group, originalModel)
+		} else {
+			openaiErr = relayRequest(c, relayMode, channel)
+		}
 
 		// 检测空回复的情况
 		if openaiErr == nil {
@@ -137,7 +190,7 @@ func Relay(c *gin.Context) {
 				)
 				common.LogWarn(c, fmt.Sprintf("detected empty response from channel #%d, will retry", channel.Id))
 			} else {
-				return // 成功处理请求，直接返回
+				return nil // 成功处理请求，直接返回
 			}
 		}
 
@@ -147,27 +200,7 @@ func Relay(c *gin.Context) {
 			break
 		}
 	}
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		common.LogInfo(c, retryLogStr)
-	}
-
-	if openaiErr != nil {
-		if openaiErr.StatusCode == http.StatusTooManyRequests {
-			common.LogError(c, fmt.Sprintf("origin 429 error: %s", openaiErr.Error.Message))
-			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
-		}
-		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
-		if c.GetString("relay_format") == relaycommon.RelayFormatGemini {
-			geminiErr := service.OpenAIErrorToGeminiResponse(openaiErr)
-			c.JSON(openaiErr.StatusCode, geminiErr)
-		} else {
-			c.JSON(openaiErr.StatusCode, gin.H{
-				"error": openaiErr.Error,
-			})
-		}
-	}
+	return openaiErr
 }
 
 var upgrader = websocket.Upgrader{
@@ -238,21 +271,57 @@ func RelayClaude(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var claudeErr *dto.ClaudeErrorWithStatusCode
 
+	for {
+		var openaiErr *dto.OpenAIErrorWithStatusCode
+		claudeErr, openaiErr = claudeWithRetry(c, group, originalModel)
+		if claudeErr == nil {
+			return
+		}
+		// 首选模型的渠道均失败或超出上下文长度时切换到回退链中的下一个模型
+		if !shouldFallbackModel(c, openaiErr) {
+			break
+		}
+		if _, ok := middleware.NextFallbackModel(c); !ok {
+			break
+		}
+		originalModel = c.GetString("original_model")
+	}
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		common.LogInfo(c, retryLogStr)
+	}
+
+	if claudeErr != nil {
+		claudeErr.Error.Message = common.MessageWithRequestId(claudeErr.Error.Message, requestId)
+		c.JSON(claudeErr.StatusCode, gin.H{
+			"type":  "error",
+			"error": claudeErr.Error,
+		})
+	}
+}
+
+// claudeWithRetry 使用当前模型转发 Claude 格式请求并在其他渠道上重试，
+// 同时返回转换后的 OpenAI 格式错误供回退判断使用
+func claudeWithRetry(c *gin.Context, group string, originalModel string) (*dto.ClaudeErrorWithStatusCode, *dto.OpenAIErrorWithStatusCode) {
+	var claudeErr *dto.ClaudeErrorWithStatusCode
+	var openaiErr *dto.OpenAIErrorWithStatusCode
 	for i := 0; i <= common.RetryTimes; i++ {
 		channel, err := getChannel(c, group, originalModel, i)
 		if err != nil {
 			common.LogError(c, err.Error())
 			claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
 			break
 		}
 
 		claudeErr = claudeRequest(c, channel)
 
 		if claudeErr == nil {
-			return // 成功处理请求，直接返回
+			return nil, nil // 成功处理请求，直接返回
 		}
 
-		openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
+		openaiErr = service.ClaudeErrorToOpenAIError(claudeErr)
 
 		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
 
@@ -260,19 +329,10 @@ func RelayClaude(c *gin.Context) {
 			break
 		}
 	}
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		common.LogInfo(c, retryLogStr)
-	}
-
-	if claudeErr != nil {
-		claudeErr.Error.Message = common.MessageWithRequestId(claudeErr.Error.Message, requestId)
-		c.JSON(claudeErr.StatusCode, gin.H{
-			"type":  "error",
-			"error": claudeErr.Error,
-		})
+	if openaiErr != nil {
+		openaiErr.LocalError = claudeErr.LocalError
 	}
+	return claudeErr, openaiErr
 }
 
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
@@ -320,10 +380,23 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
 	}
+	channel = service.SelectSelfHostedReplica(channel, group, originalModel, usedChannelIds(c)...)
 	middleware.SetupContextForSelectedChannel(c, channel, originalModel)
 	return channel, nil
 }
 
+// usedChannelIds 返回本次请求已尝试过的渠道
+func usedChannelIds(c *gin.Context) []int {
+	useChannel := c.GetStringSlice("use_channel")
+	ids := make([]int, 0, len(useChannel))
+	for _, id := range useChannel {
+		if channelId, err := strconv.Atoi(id); err == nil {
+			ids = append(ids, channelId)
+		}
+	}
+	return ids
+}
+
 func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -410,6 +483,45 @@ func shouldRetryWithAutoConfig(c *gin.Context, openaiErr *dto.OpenAIErrorWithSta
 	return true
 }
 
+// shouldFallbackModel 判断当前模型失败后是否应切换到回退模型：
+// 已向客户端输出内容或指定了渠道时不回退；超出上下文长度、无可用渠道及可重试的上游错误会回退
+func shouldFallbackModel(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode) bool {
+	if openaiErr == nil || !middleware.HasModelFallback(c) {
+		return false
+	}
+	if c.Writer.Written() {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	if isContextLengthError(openaiErr) {
+		return true
+	}
+	switch openaiErr.Error.Code {
+	case "get_channel_failed", "empty_response":
+		return true
+	}
+	if openaiErr.LocalError {
+		return false
+	}
+	return shouldRetryWithAutoConfig(c, openaiErr, 1)
+}
+
+// isContextLengthError 识别本地上下文窗口校验与各家上游返回的上下文超长错误
+func isContextLengthError(openaiErr *dto.OpenAIErrorWithStatusCode) bool {
+	if openaiErr.Error.Code == "context_length_exceeded" {
+		return true
+	}
+	message := strings.ToLower(openaiErr.Error.Message)
+	for _, keyword := range []string{"context_length_exceeded", "maximum context length", "context window", "prompt is too long", "input is too long"} {
+		if strings.Contains(message, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
 func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
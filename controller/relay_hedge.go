@@ -0,0 +1,250 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/middleware"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/service"
+	"veloera/setting/model_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeChannelPickAttempts 在每个优先级内随机挑选对冲渠道的次数
+const hedgeChannelPickAttempts = 5
+
+var errHedgeLost = errors.New("hedged request lost")
+
+// hedgeWriter 对冲尝试的响应写入器：首次写出时争夺胜出权，胜者直通客户端，落败方的输出被丢弃
+type hedgeWriter struct {
+	target      gin.ResponseWriter
+	attempt     *relaycommon.HedgeAttempt
+	header      http.Header
+	won         bool
+	closeNotify chan bool
+}
+
+func newHedgeWriter(ctx context.Context, target gin.ResponseWriter, attempt *relaycommon.HedgeAttempt) *hedgeWriter {
+	w := &hedgeWriter{
+		target:      target,
+		attempt:     attempt,
+		header:      make(http.Header),
+		closeNotify: make(chan bool, 1),
+	}
+	context.AfterFunc(ctx, func() {
+		w.closeNotify <- true
+	})
+	return w
+}
+
+func (w *hedgeWriter) claim() bool {
+	if w.won {
+		return true
+	}
+	if !w.attempt.Claim() {
+		return false
+	}
+	w.won = true
+	for k, v := range w.header {
+		w.target.Header()[k] = v
+	}
+	return true
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.won {
+		return w.target.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(statusCode int) {
+	if w.claim() {
+		w.target.WriteHeader(statusCode)
+	}
+}
+
+func (w *hedgeWriter) Write(p []byte) (int, error) {
+	if !w.claim() {
+		return 0, errHedgeLost
+	}
+	return w.target.Write(p)
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.won {
+		w.target.Flush()
+	}
+}
+
+func (w *hedgeWriter) CloseNotify() <-chan bool {
+	return w.closeNotify
+}
+
+// hedgeResult 一次对冲尝试的结果
+type hedgeResult struct {
+	attempt *relaycommon.HedgeAttempt
+	sub     *gin.Context
+	channel *model.Channel
+	err     *dto.OpenAIErrorWithStatusCode
+}
+
+// shouldHedge 请求对冲仅用于对话类接口，且需分组或令牌开启
+func shouldHedge(c *gin.Context, relayMode int) bool {
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeResponses:
+	default:
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return model_setting.ShouldHedge(c.GetString("group"), c.GetBool("token_hedging_enabled"))
+}
+
+// relayHedged 向 channel 转发请求，若在延迟时间内未输出首字节，则向另一个渠道发出相同请求，
+// 先输出首字节的一方胜出并直通客户端，落败方被取消且不计费
+func relayHedged(c *gin.Context, relayMode int, channel *model.Channel, group string, originalModel string) *dto.OpenAIErrorWithStatusCode {
+	addUsedChannel(c, channel.Id)
+	requestBody, _ := common.GetRequestBody(c)
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	state := relaycommon.NewHedgeState(model_setting.GetHedgingDelay())
+	results := make(chan hedgeResult, 2)
+	start := func(selected *model.Channel, setup bool) *gin.Context {
+		attemptCtx, attemptCancel := context.WithCancel(ctx)
+		attempt := state.NewAttempt(selected.Id, attemptCancel)
+		sub := newHedgeContext(c, attemptCtx, attempt, requestBody)
+		if setup {
+			middleware.SetupContextForSelectedChannel(sub, selected, originalModel)
+		}
+		gopool.Go(func() {
+			results <- hedgeResult{attempt: attempt, sub: sub, channel: selected, err: relayHandler(sub, relayMode)}
+		})
+		return sub
+	}
+	primary := start(channel, false)
+	pending := 1
+
+	timer := time.NewTimer(model_setting.GetHedgingDelay())
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		return finishHedge(c, result)
+	case <-state.Decided():
+	case <-timer.C:
+		hedgeChannel := selectHedgeChannel(group, originalModel, channel.Id)
+		if hedgeChannel == nil {
+			break
+		}
+		select {
+		case <-state.Decided():
+			// 首个渠道恰好开始输出，无需再发出对冲请求
+		default:
+			addUsedChannel(c, hedgeChannel.Id)
+			useChannel := c.GetStringSlice("use_channel")
+			primary.Set("use_channel", useChannel)
+			start(hedgeChannel, true).Set("use_channel", useChannel)
+			pending++
+			common.LogInfo(c, fmt.Sprintf("hedging request to channel #%d after %s without first byte from channel #%d",
+				hedgeChannel.Id, model_setting.GetHedgingDelay(), channel.Id))
+		}
+	}
+
+	// 两个尝试都失败时优先返回首个渠道的错误，它由调用方按常规流程处理
+	var primaryFailed, hedgeFailed *hedgeResult
+	for ; pending > 0; pending-- {
+		result := <-results
+		// 胜出后已向客户端输出了内容，或未输出内容但成功完成，均以该尝试为准
+		if result.attempt.Won() || result.err == nil && result.attempt.Claim() {
+			return finishHedge(c, result)
+		}
+		if result.attempt.Lost() {
+			continue
+		}
+		if result.attempt.Index == 0 {
+			primaryFailed = &result
+		} else {
+			go processChannelError(c, result.channel.Id, result.channel.Type, result.channel.Name, result.channel.GetAutoBan(), result.err)
+			hedgeFailed = &result
+		}
+	}
+	if primaryFailed != nil {
+		return finishHedge(c, *primaryFailed)
+	}
+	if hedgeFailed != nil {
+		return finishHedge(c, *hedgeFailed)
+	}
+	return service.OpenAIErrorWrapperLocal(errHedgeLost, "hedge_failed", http.StatusInternalServerError)
+}
+
+// finishHedge 将选定尝试的上下文写回主请求，供重试与空回复检测使用
+func finishHedge(c *gin.Context, result hedgeResult) *dto.OpenAIErrorWithStatusCode {
+	useChannel := c.GetStringSlice("use_channel")
+	for k, v := range result.sub.Keys {
+		if k == constant.ContextKeyHedgeAttempt {
+			continue
+		}
+		c.Set(k, v)
+	}
+	c.Set("use_channel", useChannel)
+	return result.err
+}
+
+// newHedgeContext 为对冲尝试构造独立的 gin 上下文，继承主请求的上下文信息与请求体
+func newHedgeContext(c *gin.Context, ctx context.Context, attempt *relaycommon.HedgeAttempt, requestBody []byte) *gin.Context {
+	sub, _ := gin.CreateTestContext(newHedgeWriter(ctx, c.Writer, attempt))
+	sub.Request = c.Request.Clone(ctx)
+	sub.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	sub.Params = c.Params
+	for k, v := range c.Keys {
+		sub.Set(k, v)
+	}
+	sub.Set(constant.ContextKeyHedgeAttempt, attempt)
+	return sub
+}
+
+// selectHedgeChannel 为对冲请求选择与首个渠道不同的渠道，找不到时返回 nil
+func selectHedgeChannel(group string, modelName string, excludeId int) *model.Channel {
+	for retry := 0; retry < 2; retry++ {
+		for i := 0; i < hedgeChannelPickAttempts; i++ {
+			channel, err := model.CacheGetRandomSatisfiedChannel(group, modelName, retry)
+			if err != nil || channel == nil {
+				break
+			}
+			if channel.Id != excludeId {
+				return service.SelectSelfHostedReplica(channel, group, modelName, excludeId)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	relaycommon "veloera/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestHedgeWriters(t *testing.T, n int) (*httptest.ResponseRecorder, []*hedgeWriter) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	state := relaycommon.NewHedgeState(time.Second)
+	writers := make([]*hedgeWriter, 0, n)
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		attempt := state.NewAttempt(i+1, cancel)
+		writers = append(writers, newHedgeWriter(ctx, c.Writer, attempt))
+	}
+	return recorder, writers
+}
+
+func TestHedgeWriterClaim(t *testing.T) {
+	recorder, writers := newTestHedgeWriters(t, 2)
+	primary, hedge := writers[0], writers[1]
+
+	primary.Header().Set("X-Attempt", "primary")
+	hedge.Header().Set("X-Attempt", "hedge")
+	hedge.Header().Set("X-Hedge-Only", "1")
+	if recorder.Header().Get("X-Attempt") != "" {
+		t.Fatal("headers must not reach the client before an attempt wins")
+	}
+
+	hedge.WriteHeader(201)
+	if _, err := hedge.Write([]byte("hedge")); err != nil {
+		t.Fatalf("winner Write() error = %v", err)
+	}
+	hedge.Flush()
+	if _, err := primary.Write([]byte("primary")); !errors.Is(err, errHedgeLost) {
+		t.Errorf("loser Write() error = %v, want errHedgeLost", err)
+	}
+	primary.WriteHeader(500)
+	primary.Header().Set("X-Late", "1")
+
+	if recorder.Code != 201 {
+		t.Errorf("status = %d, want 201", recorder.Code)
+	}
+	if got := recorder.Body.String(); got != "hedge" {
+		t.Errorf("body = %q, want %q", got, "hedge")
+	}
+	if got := recorder.Header().Get("X-Attempt"); got != "hedge" {
+		t.Errorf("X-Attempt = %q, want hedge", got)
+	}
+	if recorder.Header().Get("X-Hedge-Only") != "1" {
+		t.Error("winner headers set before the claim should be copied to the client")
+	}
+	if recorder.Header().Get("X-Late") != "" {
+		t.Error("loser headers must not reach the client")
+	}
+	if !recorder.Flushed {
+		t.Error("winner Flush() should flush the client response")
+	}
+	select {
+	case <-primary.CloseNotify():
+	case <-time.After(time.Second):
+		t.Error("loser should be notified to close once the other attempt wins")
+	}
+	select {
+	case <-hedge.CloseNotify():
+		t.Error("winner must not be notified to close")
+	default:
+	}
+}
+
+func TestHedgeWriterRace(t *testing.T) {
+	tests := []struct {
+		attempts int
+		writes   int
+	}{
+		{2, 1},
+		{2, 50},
+		{8, 20},
+		{32, 5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d attempts", tt.attempts), func(t *testing.T) {
+			recorder, writers := newTestHedgeWriters(t, tt.attempts)
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				winners []int
+			)
+			ready := make(chan struct{})
+			for i, w := range writers {
+				wg.Add(1)
+				go func(i int, w *hedgeWriter) {
+					defer wg.Done()
+					<-ready
+					written := 0
+					for j := 0; j < tt.writes; j++ {
+						if _, err := w.Write([]byte(fmt.Sprintf("%d;", i))); err != nil {
+							if !errors.Is(err, errHedgeLost) {
+								t.Errorf("attempt %d Write() error = %v", i, err)
+							}
+							break
+						}
+						written++
+					}
+					if written > 0 {
+						mu.Lock()
+						winners = append(winners, i)
+						mu.Unlock()
+					}
+				}(i, w)
+			}
+			close(ready)
+			wg.Wait()
+
+			if len(winners) != 1 {
+				t.Fatalf("winners = %v, want exactly one", winners)
+			}
+			want := strings.Repeat(fmt.Sprintf("%d;", winners[0]), tt.writes)
+			if got := recorder.Body.String(); got != want {
+				t.Errorf("body = %q, want only the winner's output %q", got, want)
+			}
+			for i, w := range writers {
+				if w.attempt.Won() != (i == winners[0]) {
+					t.Errorf("attempt %d Won() = %v", i, w.attempt.Won())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9_\-]{1,64}$`)
+
+type roleRequest struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// canManageUser 判断当前操作者能否管理拥有 role/roleName 的用户。
+// 超级管理员不受限制，其余操作者的有效权限必须严格包含目标用户的有效权限，
+// 这样持有 users:manage 的自定义角色也能管理权限更少的用户，却无法管理或授予超出自身的权限
+func canManageUser(c *gin.Context, role int, roleName string) bool {
+	if c.GetInt("role") == common.RoleRootUser {
+		return true
+	}
+	if role >= common.RoleRootUser {
+		return false
+	}
+	return model.CanManagePermissions(requestPermissions(c), model.GetRolePermissions(role, roleName))
+}
+
+// canGrantPermissions 非超级管理员只能创建或修改权限不超出自身的角色
+func canGrantPermissions(c *gin.Context, permissions []string) bool {
+	if c.GetInt("role") == common.RoleRootUser {
+		return true
+	}
+	return model.PermissionsCover(requestPermissions(c), permissions)
+}
+
+// requestPermissions 返回当前操作者的有效权限
+func requestPermissions(c *gin.Context) []string {
+	operator, err := model.GetUserCache(c.GetInt("id"))
+	if err != nil {
+		return nil
+	}
+	return model.GetRolePermissions(c.GetInt("role"), operator.RoleName)
+}
+
+func roleView(role *model.Role) gin.H {
+	return gin.H{
+		"id":           role.Id,
+		"name":         role.Name,
+		"display_name": role.DisplayName,
+		"description":  role.Description,
+		"permissions":  role.GetPermissions(),
+		"builtin":      role.Builtin,
+		"created_time": role.CreatedTime,
+		"updated_time": role.UpdatedTime,
+	}
+}
+
+func GetAllRoles(c *gin.Context) {
+	roles, err := model.GetAllRoles()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data := make([]gin.H, 0, len(roles))
+	for _, role := range roles {
+		data = append(data, roleView(role))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
+
+func GetAllPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    common.AllPermissions,
+	})
+}
+
+func GetRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	role, err := model.GetRoleById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roleView(role),
+	})
+}
+
+func AddRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "角色名称只能包含小写字母、数字、下划线和连字符，长度不超过 64",
+		})
+		return
+	}
+	if _, err := model.GetRoleByName(req.Name); err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "角色名称已存在",
+		})
+		return
+	}
+	if !canGrantPermissions(c, req.Permissions) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权授予超出自身的权限",
+		})
+		return
+	}
+	role := model.Role{
+		Name:        req.Name,
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+	}
+	if err := role.SetPermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := role.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "role.create", model.AuditTargetRole, role.Name, nil, roleView(&role))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roleView(&role),
+	})
+}
+
+func UpdateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	role, err := model.GetRoleById(req.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !canGrantPermissions(c, role.GetPermissions()) || !canGrantPermissions(c, req.Permissions) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权授予超出自身的权限",
+		})
+		return
+	}
+	before := roleView(role)
+	role.DisplayName = req.DisplayName
+	role.Description = req.Description
+	if err := role.SetPermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := role.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "role.update", model.AuditTargetRole, role.Name, before, roleView(role))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roleView(role),
+	})
+}
+
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	role, err := model.GetRoleById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := role.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "role.delete", model.AuditTargetRole, role.Name, roleView(role), nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type updateUserRoleRequest struct {
+	Id       int    `json:"id"`
+	RoleName string `json:"role_name"`
+}
+
+// UpdateUserRole 为用户分配角色，role_name 为空时回退到用户等级对应的内置角色
+func UpdateUserRole(c *gin.Context) {
+	var req updateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(req.Id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !canManageUser(c, user.Role, user.RoleName) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权更新同权限等级或更高权限等级的用户信息",
+		})
+		return
+	}
+	if req.RoleName != "" && !canManageUser(c, user.Role, req.RoleName) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权分配不低于自身权限的角色",
+		})
+		return
+	}
+	if user.Role == common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "超级管理员始终拥有全部权限，无需分配角色",
+		})
+		return
+	}
+	if err := model.UpdateUserRoleName(user.Id, req.RoleName); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAuditLog(c, "user.role", model.AuditTargetUser, user.Id, gin.H{"role_name": user.RoleName}, gin.H{"role_name": req.RoleName})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetSelfPermissions 返回当前用户的有效权限，供前端决定可见的管理菜单
+func GetSelfPermissions(c *gin.Context) {
+	user, err := model.GetUserCache(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"role":        c.GetInt("role"),
+			"role_name":   user.RoleName,
+			"permissions": model.GetRolePermissions(c.GetInt("role"), user.RoleName),
+		},
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRoleTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.User{}, &model.Role{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldRedis := model.DB, common.RedisEnabled
+	model.DB = db
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		model.DB = oldDB
+		common.RedisEnabled = oldRedis
+	})
+}
+
+func TestCanGrantPermissions(t *testing.T) {
+	setupRoleTestDB(t)
+	auditor := &model.Role{Name: "auditor"}
+	if err := auditor.SetPermissions([]string{"logs:*", common.PermissionUsersRead}); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	users := []*model.User{
+		{Id: 1, Username: "root", Role: common.RoleRootUser, AffCode: "r1"},
+		{Id: 2, Username: "admin", Role: common.RoleAdminUser, AffCode: "r2"},
+		{Id: 3, Username: "auditor", Role: common.RoleCommonUser, RoleName: "auditor", AffCode: "r3"},
+		{Id: 4, Username: "common", Role: common.RoleCommonUser, AffCode: "r4"},
+	}
+	for _, user := range users {
+		if err := model.DB.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		userId      int
+		role        int
+		permissions []string
+		want        bool
+	}{
+		{"root grants all", 1, common.RoleRootUser, []string{common.PermissionAll}, true},
+		{"admin grants own permissions", 2, common.RoleAdminUser, []string{common.PermissionChannelsRead, common.PermissionUsersManage}, true},
+		{"admin grants roles:manage", 2, common.RoleAdminUser, []string{common.PermissionRolesManage}, false},
+		{"admin grants options:write", 2, common.RoleAdminUser, []string{common.PermissionOptionsWrite}, false},
+		{"admin grants all", 2, common.RoleAdminUser, []string{common.PermissionAll}, false},
+		{"admin grants partially covered set", 2, common.RoleAdminUser, []string{common.PermissionLogsRead, common.PermissionAuditRead}, false},
+		{"custom role grants covered by wildcard", 3, common.RoleCommonUser, []string{common.PermissionLogsDelete, common.PermissionLogsContent}, true},
+		{"custom role grants its wildcard", 3, common.RoleCommonUser, []string{"logs:*"}, true},
+		{"custom role grants outside wildcard", 3, common.RoleCommonUser, []string{common.PermissionBillingRead}, false},
+		{"common user grants nothing", 4, common.RoleCommonUser, []string{}, true},
+		{"common user grants logs:read", 4, common.RoleCommonUser, []string{common.PermissionLogsRead}, false},
+		{"unknown user grants users:read", 99, common.RoleAdminUser, []string{common.PermissionUsersRead}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("id", tt.userId)
+			c.Set("role", tt.role)
+			if got := canGrantPermissions(c, tt.permissions); got != tt.want {
+				t.Errorf("canGrantPermissions(%v) = %v, want %v", tt.permissions, got, tt.want)
+			}
+		})
+	}
+}
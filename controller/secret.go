@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkSecretReference 外部密钥引用会读取服务器上的环境变量或文件，只允许超级管理员保存，且必须在允许范围内
+func checkSecretReference(c *gin.Context, value string) error {
+	if !common.IsSecretReference(value) {
+		return nil
+	}
+	if c.GetInt("role") < common.RoleRootUser {
+		return errors.New("仅超级管理员可以使用 env:// 或 file:// 密钥引用")
+	}
+	return common.ValidateSecretReference(value)
+}
+
+// GetSecretStatus 查看渠道密钥与敏感选项的加密存储情况
+func GetSecretStatus(c *gin.Context) {
+	status, err := model.GetSecretStatus()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    status,
+	})
+}
+
+// RotateSecrets 用当前主密钥重新加密明文或旧主密钥加密的密钥，旧主密钥需保留在 SECRET_ENCRYPTION_OLD_KEYS 中直至完成
+func RotateSecrets(c *gin.Context) {
+	rotated, err := model.RotateSecrets()
+	if rotated > 0 {
+		recordAuditLog(c, "secret.rotate", model.AuditTargetSecret, "", nil, gin.H{"rotated": rotated})
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    gin.H{"rotated": rotated},
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeStatement(c *gin.Context, statement *model.BillingStatement, format string) {
+	switch format {
+	case "csv":
+		data, err := service.RenderStatementCSV(statement)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", service.StatementFileName(statement, "csv")))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", service.StatementFileName(statement, "pdf")))
+		c.Data(http.StatusOK, "application/pdf", service.RenderStatementPDF(statement))
+	default:
+		subtotal, tax, total := service.StatementTotals(statement)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data": gin.H{
+				"statement": statement,
+				"subtotal":  subtotal,
+				"tax":       tax,
+				"total":     total,
+			},
+		})
+	}
+}
+
+// GetSelfStatement 获取当前用户的月度对账单，format 可选 json / csv / pdf
+func GetSelfStatement(c *gin.Context) {
+	start, end, err := model.ParseStatementPeriod(c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if start > time.Now().Unix() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "账期尚未开始",
+		})
+		return
+	}
+	statement, err := model.GenerateUserStatement(c.GetInt("id"), start, end)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	writeStatement(c, statement, c.Query("format"))
+}
+
+// ExportStatements 管理员批量导出指定账期内所有活跃用户的对账单（zip 压缩包）
+func ExportStatements(c *gin.Context) {
+	start, end, err := model.ParseStatementPeriod(c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "pdf" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "导出格式仅支持 csv 或 pdf",
+		})
+		return
+	}
+	// 整个账期的归档只读取一遍，按用户聚合后供每份对账单复用
+	archived, err := model.LoadStatementArchiveUsage(start, end, 0)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userIds, err := model.GetStatementUserIds(start, end, archived)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 压缩包直接写入响应，开始写入后出错只能记录日志并中断连接
+	period := time.Unix(start, 0).Format("2006-01")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statements-%s.zip", period))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	statements := make([]*model.BillingStatement, 0, len(userIds))
+	zw := zip.NewWriter(c.Writer)
+	for _, userId := range userIds {
+		statement, err := model.GenerateUserStatementWithArchive(userId, start, end, archived)
+		if err != nil {
+			// 用户可能已被硬删除，跳过
+			continue
+		}
+		statements = append(statements, statement)
+		var data []byte
+		if format == "pdf" {
+			data = service.RenderStatementPDF(statement)
+		} else if data, err = service.RenderStatementCSV(statement); err != nil {
+			abortStatementExport(c, err)
+			return
+		}
+		f, err := zw.Create(service.StatementFileName(statement, format))
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if err != nil {
+			abortStatementExport(c, err)
+			return
+		}
+	}
+	summary, err := service.RenderStatementSummaryCSV(statements)
+	if err == nil {
+		var f io.Writer
+		if f, err = zw.Create("summary.csv"); err == nil {
+			_, err = f.Write(summary)
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		abortStatementExport(c, err)
+	}
+}
+
+// abortStatementExport 响应已开始写入，无法再返回 JSON 错误，记录日志后停止写入，客户端会得到不完整的压缩包
+func abortStatementExport(c *gin.Context, err error) {
+	common.SysError("failed to export statements: " + err.Error())
+	c.Abort()
+}
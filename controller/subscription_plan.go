@@ -22,24 +22,47 @@ import (
 	"strings"
 	"veloera/common"
 	"veloera/model"
+	"veloera/setting"
 
 	"github.com/gin-gonic/gin"
 )
 
 type upsertSubscriptionPlanRequest struct {
-	Id           int    `json:"id"`
-	Name         string `json:"name"`
-	Description  string `json:"description"`
-	Price        int    `json:"price"`
-	TotalQuota   int    `json:"total_quota"`
-	DailyQuota   int    `json:"daily_quota"`
-	DurationDays int    `json:"duration_days"`
-	Status       int    `json:"status"`
-	SortOrder    int    `json:"sort_order"`
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Price         int    `json:"price"`
+	TotalQuota    int    `json:"total_quota"`
+	DailyQuota    int    `json:"daily_quota"`
+	DurationDays  int    `json:"duration_days"`
+	Models        string `json:"models"`
+	AllowedGroups string `json:"allowed_groups"`
+	Status        int    `json:"status"`
+	SortOrder     int    `json:"sort_order"`
 }
 
 type purchaseSubscriptionPlanRequest struct {
-	PlanId int `json:"plan_id"`
+	PlanId    int  `json:"plan_id"`
+	AutoRenew bool `json:"auto_renew"`
+}
+
+type planAutoRenewRequest struct {
+	AutoRenew bool `json:"auto_renew"`
+}
+
+// normalizePlanList 去除逗号分隔列表中的空白与重复项
+func normalizePlanList(s string) string {
+	items := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		items = append(items, item)
+	}
+	return strings.Join(items, ",")
 }
 
 func PurchaseSubscriptionPlanNotAllowed(c *gin.Context) {
@@ -72,6 +95,16 @@ func validateSubscriptionPlanRequest(req *upsertSubscriptionPlanRequest) string
 	if req.Status != model.SubscriptionPlanStatusEnabled && req.Status != model.SubscriptionPlanStatusDisabled {
 		return "套餐状态不合法"
 	}
+	req.Models = normalizePlanList(req.Models)
+	req.AllowedGroups = normalizePlanList(req.AllowedGroups)
+	if len(req.AllowedGroups) > 255 {
+		return "套餐分组长度不能超过255个字符"
+	}
+	for _, group := range strings.Split(req.AllowedGroups, ",") {
+		if group != "" && !setting.ContainsGroupRatio(group) {
+			return "分组 " + group + " 不存在"
+		}
+	}
 	return ""
 }
 
@@ -122,6 +155,54 @@ func GetUserPlanOrders(c *gin.Context) {
 	})
 }
 
+// GetUserPlanDailyStatus 获取当前用户当日套餐额度使用情况
+func GetUserPlanDailyStatus(c *gin.Context) {
+	status, err := model.GetUserSubscriptionDailyStatus(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    status,
+	})
+}
+
+// UpdateUserPlanOrderAutoRenew 开启或关闭套餐订单的自动续费
+func UpdateUserPlanOrderAutoRenew(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订单ID不合法",
+		})
+		return
+	}
+	req := planAutoRenewRequest{}
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = model.SetUserPlanOrderAutoRenew(c.GetInt("id"), id, req.AutoRenew); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
 func PurchaseSubscriptionPlan(c *gin.Context) {
 	req := purchaseSubscriptionPlanRequest{}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -139,7 +220,7 @@ func PurchaseSubscriptionPlan(c *gin.Context) {
 		return
 	}
 
-	order, err := model.PurchaseSubscriptionPlan(c.GetInt("id"), req.PlanId)
+	order, err := model.PurchaseSubscriptionPlan(c.GetInt("id"), req.PlanId, req.AutoRenew)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -188,14 +269,16 @@ func AdminCreateSubscriptionPlan(c *gin.Context) {
 	}
 
 	plan := &model.SubscriptionPlan{
-		Name:         req.Name,
-		Description:  req.Description,
-		Price:        req.Price,
-		TotalQuota:   req.TotalQuota,
-		DailyQuota:   req.DailyQuota,
-		DurationDays: req.DurationDays,
-		Status:       req.Status,
-		SortOrder:    req.SortOrder,
+		Name:          req.Name,
+		Description:   req.Description,
+		Price:         req.Price,
+		TotalQuota:    req.TotalQuota,
+		DailyQuota:    req.DailyQuota,
+		DurationDays:  req.DurationDays,
+		Models:        req.Models,
+		AllowedGroups: req.AllowedGroups,
+		Status:        req.Status,
+		SortOrder:     req.SortOrder,
 	}
 	if err := plan.Insert(); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -204,6 +287,7 @@ func AdminCreateSubscriptionPlan(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "plan.create", model.AuditTargetPlan, plan.Id, nil, plan)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -244,12 +328,15 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 		return
 	}
 
+	before := *plan
 	plan.Name = req.Name
 	plan.Description = req.Description
 	plan.Price = req.Price
 	plan.TotalQuota = req.TotalQuota
 	plan.DailyQuota = req.DailyQuota
 	plan.DurationDays = req.DurationDays
+	plan.Models = req.Models
+	plan.AllowedGroups = req.AllowedGroups
 	plan.Status = req.Status
 	plan.SortOrder = req.SortOrder
 
@@ -260,6 +347,7 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "plan.update", model.AuditTargetPlan, plan.Id, before, plan)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -276,6 +364,7 @@ func AdminDeleteSubscriptionPlan(c *gin.Context) {
 		})
 		return
 	}
+	origin, _ := model.GetSubscriptionPlanById(id)
 	if err = model.DeleteSubscriptionPlanById(id); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -283,6 +372,7 @@ func AdminDeleteSubscriptionPlan(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "plan.delete", model.AuditTargetPlan, id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
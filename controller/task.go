@@ -127,7 +127,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	if adaptor == nil {
 		return errors.New("adaptor not found")
 	}
-	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.Key, map[string]any{
+	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.GetKey(), map[string]any{
 		"ids": taskIds,
 	})
 	if err != nil {
@@ -175,7 +175,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			} else {
 				quota := task.Quota
 				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
+					err = model.RefundTaskQuota(task.UserId, task.OrgId, quota)
 					if err != nil {
 						common.LogError(ctx, "fail to increase user quota: "+err.Error())
 					}
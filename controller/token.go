@@ -139,6 +139,16 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.OrgId != 0 {
+		// 组织令牌从组织额度池扣费，只有组织成员可以创建
+		if _, err := model.GetOrgAvailableQuota(token.OrgId, c.GetInt("id")); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -165,6 +175,8 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		OrgId:              token.OrgId,
+		HedgingEnabled:     token.HedgingEnabled && canEnableTokenHedging(c),
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -181,6 +193,15 @@ func AddToken(c *gin.Context) {
 	return
 }
 
+// canEnableTokenHedging 对冲会向第二个渠道重复发起请求，落败请求的上游费用由站点承担，
+// 因此只有具备计费管理权限的管理员才能为令牌开启，普通用户只能通过管理员配置的分组启用
+func canEnableTokenHedging(c *gin.Context) bool {
+	if c.GetInt("role") == common.RoleRootUser {
+		return true
+	}
+	return model.PermissionsCover(requestPermissions(c), []string{common.PermissionBillingManage})
+}
+
 func DeleteToken(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt("id")
@@ -258,6 +279,10 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		// 普通用户提交的对冲开关被忽略，保留原值
+		if canEnableTokenHedging(c) {
+			cleanToken.HedgingEnabled = token.HedgingEnabled
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
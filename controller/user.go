@@ -356,8 +356,7 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, user.Role, user.RoleName) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权获取同级或更高等级用户的信息",
@@ -633,15 +632,14 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, originUser.Role, originUser.RoleName) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
 		})
 		return
 	}
-	if myRole <= updatedUser.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, updatedUser.Role, originUser.RoleName) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权将其他用户权限等级提升到大于等于自己的权限等级",
@@ -659,6 +657,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if editedUser, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		if updatePassword {
+			// 查询时未取出密码，仅标记密码已被修改
+			editedUser.Password = "changed"
+		}
+		recordAuditLog(c, "user.update", model.AuditTargetUser, updatedUser.Id, originUser, editedUser)
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
@@ -733,8 +738,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	if !canManageUser(c, originUser.Role, originUser.RoleName) || originUser.Role == common.RoleRootUser {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权删除同权限等级或更高权限等级的用户",
@@ -749,6 +753,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "user.delete", model.AuditTargetUser, id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -820,6 +825,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAuditLog(c, "user.create", model.AuditTargetUser, cleanUser.Id, nil, cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -857,8 +863,9 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, user.Role, user.RoleName) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
@@ -933,6 +940,22 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	if req.Action == "promote" || req.Action == "demote" {
+		// 升降级后回到新等级对应的内置角色，避免原自定义角色继续生效
+		if err := model.UpdateUserRoleName(user.Id, ""); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		user.RoleName = ""
+	}
+	if req.Action == "delete" {
+		recordAuditLog(c, "user.delete", model.AuditTargetUser, user.Id, originUser, nil)
+	} else {
+		recordAuditLog(c, "user."+req.Action, model.AuditTargetUser, user.Id, originUser, user)
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -22,6 +22,8 @@ type AudioRequest struct {
 	Voice          string  `json:"voice"`
 	Speed          float64 `json:"speed,omitempty"`
 	ResponseFormat string  `json:"response_format,omitempty"`
+	StreamFormat   string  `json:"stream_format,omitempty"` // audio 为分块音频流，sse 为 speech.audio.delta 事件流
+	Instructions   string  `json:"instructions,omitempty"`
 }
 
 type AudioResponse struct {
@@ -47,4 +49,5 @@ type Segment struct {
 	AvgLogprob       float64 `json:"avg_logprob"`
 	CompressionRatio float64 `json:"compression_ratio"`
 	NoSpeechProb     float64 `json:"no_speech_prob"`
+	Speaker          string  `json:"speaker,omitempty"` // 说话人分离模型返回的说话人标识
 }
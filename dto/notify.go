@@ -29,6 +29,7 @@ const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypeCreditLimit   = "credit_limit"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
@@ -39,4 +39,27 @@ type OpenAIModels struct {
 	Permission []OpenAIModelPermission `json:"permission"`
 	Root       string                  `json:"root"`
 	Parent     *string                 `json:"parent"`
+	// 模型目录中登记的元数据，未登记的模型不输出这些字段
+	*ModelMetadata
+}
+
+// ModelMetadata 模型目录对外展示的元数据，用于 /v1/models 与定价接口
+type ModelMetadata struct {
+	DisplayName      string             `json:"display_name,omitempty"`
+	Description      string             `json:"description,omitempty"`
+	ContextWindow    int                `json:"context_window,omitempty"`
+	MaxOutputTokens  int                `json:"max_output_tokens,omitempty"`
+	InputModalities  []string           `json:"input_modalities,omitempty"`
+	OutputModalities []string           `json:"output_modalities,omitempty"`
+	Capabilities     *ModelCapabilities `json:"capabilities,omitempty"`
+	DeprecationDate  int64              `json:"deprecation_date,omitempty"`
+	ReplacementModel string             `json:"replacement_model,omitempty"`
+	Lifecycle        string             `json:"lifecycle,omitempty"`
+	SunsetDate       int64              `json:"sunset_date,omitempty"`
+}
+
+type ModelCapabilities struct {
+	Tools     bool `json:"tools"`
+	Vision    bool `json:"vision"`
+	Reasoning bool `json:"reasoning"`
 }
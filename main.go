@@ -101,12 +101,46 @@ func main() {
 	constant.InitEnv()
 	// Initialize options
 	model.InitOptionMap()
+	// 配置了落库加密主密钥时，由主节点加密历史明文并把旧主密钥加密的数据迁移到新主密钥
+	if common.SecretEncryptionEnabled() && common.IsMasterNode {
+		rotated, err := model.RotateSecrets()
+		if err != nil {
+			common.FatalLog("failed to encrypt secrets: " + err.Error())
+		}
+		if rotated > 0 {
+			common.SysLog(fmt.Sprintf("re-encrypted %d secrets with the current key", rotated))
+		}
+	}
+	if common.IsMasterNode {
+		if _, err := model.SyncChannelKeyHashes(); err != nil {
+			common.SysError("failed to sync channel key hashes: " + err.Error())
+		}
+	}
+	// Initialize role permissions
+	model.InitRoleCache()
+	go model.SyncRoleCache(common.SyncFrequency)
+	// Initialize model catalog
+	model.InitModelCatalogCache()
+	go model.SyncModelCatalogCache(common.SyncFrequency)
 
 	// Initialize global model mapping service
 	if err := service.InitializeModelMappingService(); err != nil {
 		common.SysError("failed to initialize model mapping service: " + err.Error())
 	}
 
+	// 声明式配置：导出后直接退出；启动时同步仅在主节点执行，避免多个节点重复创建
+	if *common.ExportConfig != "" {
+		if err := service.ExportConfigFile(*common.ExportConfig, *common.ExportSecrets); err != nil {
+			common.FatalLog("failed to export config: " + err.Error())
+		}
+		os.Exit(0)
+	}
+	if *common.ConfigFile != "" && common.IsMasterNode {
+		if err := service.ReconcileConfigFile(*common.ConfigFile, *common.ConfigPrune); err != nil {
+			common.FatalLog("failed to reconcile config: " + err.Error())
+		}
+	}
+
 	if common.RedisEnabled {
 		// for compatibility with old versions
 		common.MemoryCacheEnabled = true
@@ -120,10 +154,24 @@ func main() {
 		go model.SyncOptions(common.SyncFrequency)
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
+	// 多节点通过 Redis 发布订阅即时广播缓存变更，上面的轮询同步仅作兜底；未启用 Redis 时不订阅
+	model.RegisterCacheEventHandlers()
+	middleware.RegisterCacheEventHandlers()
+	go common.SubscribeCacheEvents()
 
 	// 数据看板
 	go model.UpdateQuotaData()
 
+	// 自建推理服务的负载与健康采集，各节点独立维护
+	go service.StartSelfHostedMonitor()
+
+	if common.IsMasterNode {
+		go model.AutoPostpaidSettlement()
+		go model.AutoRenewUserPlanOrders()
+		go model.AutoArchiveLogs()
+		go model.AutoCleanChatContents()
+	}
+
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
 		if err != nil {
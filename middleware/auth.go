@@ -37,7 +37,7 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -132,6 +132,25 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if len(permissions) > 0 {
+		userCache, err := model.GetUserCache(id.(int))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，读取用户角色失败",
+			})
+			c.Abort()
+			return
+		}
+		if !model.HasPermissions(role.(int), userCache.RoleName, permissions...) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，缺少权限 " + strings.Join(permissions, ", "),
+			})
+			c.Abort()
+			return
+		}
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -169,6 +188,13 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth 要求登录用户的角色同时拥有全部指定权限，不再限制旧的整数等级
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permissions...)
+	}
+}
+
 func WssAuth(c *gin.Context) {
 
 }
@@ -263,6 +289,8 @@ func TokenAuth() func(c *gin.Context) {
 		}
 		c.Set("allow_ips", token.GetIpLimitsMap())
 		c.Set("token_group", token.Group)
+		c.Set("token_org_id", token.OrgId)
+		c.Set("token_hedging_enabled", token.HedgingEnabled)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set("specific_channel_id", parts[1])
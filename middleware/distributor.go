@@ -17,6 +17,7 @@
 package middleware
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -36,7 +37,9 @@ import (
 )
 
 type ModelRequest struct {
-	Model string `json:"model"`
+	Model     string          `json:"model"`
+	Models    json.RawMessage `json:"models,omitempty"`    // 客户端给出的模型回退链，首个为首选模型
+	Fallbacks json.RawMessage `json:"fallbacks,omitempty"` // 客户端给出的回退模型扩展字段
 }
 
 // Cache for storing channels by prefix
@@ -95,9 +98,15 @@ func ResetChannelKeyIndex(channelId int) {
 	delete(channelKeysHash, channelId)
 }
 
-// RefreshPrefixChannelsCache refreshes prefix cache for one or multiple groups.
+// RefreshPrefixChannelsCache refreshes prefix cache for one or multiple groups
+// on this node and asks the other nodes to do the same.
 // Groups should be a comma separated string, empty entries are ignored.
 func RefreshPrefixChannelsCache(groups string) {
+	refreshPrefixChannelsCacheGroups(groups)
+	common.PublishCacheEvent(common.CacheEventPrefixCache, groups)
+}
+
+func refreshPrefixChannelsCacheGroups(groups string) {
 	for _, g := range strings.Split(groups, ",") {
 		g = strings.TrimSpace(g)
 		if g == "" {
@@ -107,6 +116,24 @@ func RefreshPrefixChannelsCache(groups string) {
 	}
 }
 
+// expirePrefixChannelsCache marks every group as expired so the next lookup reloads it
+func expirePrefixChannelsCache() {
+	prefixChannelsMutex.Lock()
+	defer prefixChannelsMutex.Unlock()
+	prefixChannelsCacheExpiry = make(map[string]int64)
+}
+
+// RegisterCacheEventHandlers keeps the prefix cache in step with channel changes made on other nodes
+func RegisterCacheEventHandlers() {
+	common.RegisterCacheEventHandler(common.CacheEventPrefixCache, refreshPrefixChannelsCacheGroups)
+	common.RegisterCacheEventHandler(common.CacheEventChannel, func(string) {
+		expirePrefixChannelsCache()
+	})
+	common.RegisterCacheEventHandler(common.CacheEventChannelStatus, func(string) {
+		expirePrefixChannelsCache()
+	})
+}
+
 // refreshPrefixChannelsCache refreshes the prefix channels cache for a given group
 func refreshPrefixChannelsCache(group string) map[string][]*model.Channel {
 	var channels []*model.Channel
@@ -217,13 +244,20 @@ func Distribute() func(c *gin.Context) {
 			abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
 			return
 		}
+		if shouldSelectChannel && !ok {
+			setupModelFallbacks(c, modelRequest)
+		}
 		userGroup := c.GetString(constant.ContextKeyUserGroup)
 		tokenGroup := c.GetString("token_group")
 		if tokenGroup != "" {
 			// check common.UserUsableGroups[userGroup]
 			if _, ok := setting.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("令牌分组 %s 已被禁用", tokenGroup))
-				return
+				// 套餐可以授予额外的分组使用权
+				granted, err := model.UserPlanGrantsGroup(c.GetInt("id"), tokenGroup)
+				if err != nil || !granted {
+					abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("令牌分组 %s 已被禁用", tokenGroup))
+					return
+				}
 			}
 			// check group in common.GroupRatio
 			if !setting.ContainsGroupRatio(tokenGroup) {
@@ -270,6 +304,31 @@ func Distribute() func(c *gin.Context) {
 			c.Set("virtual_model_actual", actualModel)
 		}
 
+		// 模型生命周期：已弃用的模型附带提示，已退役的模型改用后继模型选择渠道，避免上游 404 浪费重试
+		if shouldSelectChannel {
+			modelRequest.Model, err = applyModelLifecycle(c, modelRequest.Model)
+			if err != nil {
+				if nextFallbackModel(c) {
+					return
+				}
+				abortWithOpenAiMessage(c, http.StatusGone, err.Error())
+				return
+			}
+		}
+
+		// 套餐专属模型仅对持有相应生效套餐的用户开放
+		if shouldSelectChannel && model.IsPlanRestrictedModel(modelRequest.Model) {
+			allowed, err := model.UserPlanAllowsModel(c.GetInt("id"), modelRequest.Model)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "查询套餐信息失败")
+				return
+			}
+			if !allowed {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("模型 %s 仅对订阅相应套餐的用户开放", modelRequest.Model))
+				return
+			}
+		}
+
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
@@ -316,8 +375,14 @@ func Distribute() func(c *gin.Context) {
 					channel, err = selectChannelByPrefix(userGroup, modelPrefix, modelRequest.Model)
 				} else {
 					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+					if err == nil {
+						channel = service.SelectSelfHostedReplica(channel, userGroup, modelRequest.Model)
+					}
 				}
 
+				if (err != nil || channel == nil) && nextFallbackModel(c) {
+					return
+				}
 				if err != nil {
 					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, originalModel)
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
@@ -341,6 +406,50 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// nextFallbackModel 首选模型不可用时改用回退链中的模型继续处理请求，没有可用的回退模型时返回 false
+func nextFallbackModel(c *gin.Context) bool {
+	if _, ok := NextFallbackModel(c); !ok {
+		return false
+	}
+	c.Set(constant.ContextKeyRequestStartTime, time.Now())
+	c.Next()
+	return true
+}
+
+// applyModelLifecycle 按模型目录的生命周期处理请求的模型，返回用于选择渠道的模型名称
+func applyModelLifecycle(c *gin.Context, modelName string) (string, error) {
+	catalog, lifecycle := model.GetModelLifecycle(modelName)
+	switch lifecycle {
+	case model.ModelLifecycleDeprecated:
+		c.Set(constant.ContextKeyModelDeprecated, true)
+		setModelDeprecationHeaders(c, catalog, catalog.ReplacementModel)
+	case model.ModelLifecycleRetired:
+		successor, _ := model.ResolveModelSuccessor(modelName)
+		if successor == "" {
+			return "", fmt.Errorf("模型 %s 已下线", modelName)
+		}
+		c.Set(constant.ContextKeyRetiredModel, modelName)
+		setModelDeprecationHeaders(c, catalog, successor)
+		return successor, nil
+	}
+	return modelName, nil
+}
+
+// setModelDeprecationHeaders 按 RFC 9745 / RFC 8594 设置 Deprecation 与 Sunset 响应头，并给出后继模型
+func setModelDeprecationHeaders(c *gin.Context, catalog *model.ModelCatalog, successor string) {
+	if catalog.DeprecationDate > 0 {
+		c.Header("Deprecation", fmt.Sprintf("@%d", catalog.DeprecationDate))
+	} else {
+		c.Header("Deprecation", "true")
+	}
+	if catalog.SunsetDate > 0 {
+		c.Header("Sunset", time.Unix(catalog.SunsetDate, 0).UTC().Format(http.TimeFormat))
+	}
+	if successor != "" {
+		c.Header("X-Model-Successor", successor)
+	}
+}
+
 func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	var modelRequest ModelRequest
 	shouldSelectChannel := true
@@ -467,18 +576,20 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
 
+	// env:// 与 file:// 引用在此解析为实际密钥
+	key := channel.GetKey()
 	// 如果key包含逗号，使用轮询方式选择一个key
 	// 对于渠道类型41，不处理逗号分隔的多key机制
 	if channel.Type == 41 {
-		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
-	} else if strings.Contains(channel.Key, ",") {
-		keys := strings.Split(channel.Key, ",")
+		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	} else if strings.Contains(key, ",") {
+		keys := strings.Split(key, ",")
 
 		// Get current index for this channel using round-robin
 		channelKeysMutex.Lock()
 
 		// Check if keys have changed by comparing with stored hash
-		currentHash := common.GetMD5Hash(channel.Key)
+		currentHash := common.GetMD5Hash(key)
 		storedHash, hashExists := channelKeysHash[channel.Id]
 
 		// Reset index if keys have changed or index doesn't exist
@@ -503,7 +614,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 
 		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(selectedKey)))
 	} else {
-		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	}
 
 	c.Set("base_url", channel.GetBaseURL())
@@ -0,0 +1,253 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+	relayconstant "veloera/relay/constant"
+	"veloera/service"
+	"veloera/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportsModelFallback 仅对模型写在 JSON 请求体中的对话类接口启用模型回退，切换模型时改写请求体即可
+func supportsModelFallback(c *gin.Context) bool {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/v1/messages") {
+		return !strings.HasPrefix(path, "/v1/messages/count_tokens")
+	}
+	if strings.HasPrefix(path, "/v1beta/") || c.Param("model") != "" {
+		return false
+	}
+	switch relayconstant.Path2RelayMode(path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeResponses:
+		return true
+	}
+	return false
+}
+
+// parseClientFallbacks 解析客户端通过 models 数组或 fallbacks 扩展字段给出的回退模型，格式不符时忽略
+func parseClientFallbacks(modelRequest *ModelRequest) []string {
+	var fallbacks []string
+	var models []string
+	if len(modelRequest.Models) > 0 && json.Unmarshal(modelRequest.Models, &models) == nil {
+		fallbacks = append(fallbacks, models...)
+	}
+	var extra []string
+	if len(modelRequest.Fallbacks) > 0 && json.Unmarshal(modelRequest.Fallbacks, &extra) == nil {
+		fallbacks = append(fallbacks, extra...)
+	}
+	return fallbacks
+}
+
+// setupModelFallbacks 确定请求的首选模型并记录回退链，客户端指定的回退优先于管理员配置。
+// 客户端给出回退时会从请求体中移除扩展字段，避免透传到上游
+func setupModelFallbacks(c *gin.Context, modelRequest *ModelRequest) {
+	if !supportsModelFallback(c) {
+		return
+	}
+	settings := model_setting.GetModelFallbackSettings()
+	var clientFallbacks []string
+	if settings.ClientFallbackEnabled {
+		clientFallbacks = parseClientFallbacks(modelRequest)
+	}
+	if modelRequest.Model == "" && len(clientFallbacks) > 0 {
+		modelRequest.Model = clientFallbacks[0]
+		clientFallbacks = clientFallbacks[1:]
+		c.Set("prefixed_model", modelRequest.Model)
+	}
+	if modelRequest.Model == "" {
+		return
+	}
+	chain := clientFallbacks
+	if len(chain) == 0 {
+		chain = model_setting.GetModelFallbackChain(modelRequest.Model)
+	}
+
+	fallbacks := make([]string, 0, len(chain))
+	seen := map[string]bool{modelRequest.Model: true}
+	for _, name := range chain {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		fallbacks = append(fallbacks, name)
+	}
+	if settings.MaxFallbacks >= 0 && len(fallbacks) > settings.MaxFallbacks {
+		fallbacks = fallbacks[:settings.MaxFallbacks]
+	}
+	if len(fallbacks) > 0 {
+		c.Set(constant.ContextKeyModelFallbacks, fallbacks)
+	}
+	if len(modelRequest.Models) > 0 || len(modelRequest.Fallbacks) > 0 {
+		if err := rewriteRequestModel(c, modelRequest.Model); err != nil {
+			common.LogError(c, fmt.Sprintf("rewrite request model failed: %s", err.Error()))
+		}
+	}
+}
+
+// rewriteRequestModel 将缓存的请求体中的模型替换为 modelName，并移除回退扩展字段
+func rewriteRequestModel(c *gin.Context, modelName string) error {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(requestBody, &body); err != nil {
+		return err
+	}
+	modelJson, err := json.Marshal(modelName)
+	if err != nil {
+		return err
+	}
+	body["model"] = modelJson
+	delete(body, "models")
+	delete(body, "fallbacks")
+	requestBody, err = json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, requestBody)
+	return nil
+}
+
+// HasModelFallback 请求是否还有可尝试的回退模型
+func HasModelFallback(c *gin.Context) bool {
+	return len(c.GetStringSlice(constant.ContextKeyModelFallbacks)) > 0
+}
+
+// NextFallbackModel 依次尝试回退链中的模型，切换到第一个可用的模型并为其选择渠道。
+// 回退模型同样受令牌模型限制、套餐专属模型与生命周期约束，不满足的模型直接跳过
+func NextFallbackModel(c *gin.Context) (*model.Channel, bool) {
+	fallbacks := c.GetStringSlice(constant.ContextKeyModelFallbacks)
+	for len(fallbacks) > 0 {
+		modelName := fallbacks[0]
+		fallbacks = fallbacks[1:]
+		c.Set(constant.ContextKeyModelFallbacks, fallbacks)
+
+		channel, err := switchToFallbackModel(c, modelName)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("skip fallback model %s: %s", modelName, err.Error()))
+			continue
+		}
+		common.LogInfo(c, fmt.Sprintf("fallback to model %s (channel #%d)", modelName, channel.Id))
+		return channel, true
+	}
+	return nil, false
+}
+
+func switchToFallbackModel(c *gin.Context, modelName string) (*model.Channel, error) {
+	if !tokenAllowsModel(c, modelName) {
+		return nil, errors.New("令牌无权访问该模型")
+	}
+	group := c.GetString("group")
+
+	// 与首选模型一致地处理前缀路由与虚拟模型映射
+	channelModel := modelName
+	modelPrefix := ""
+	for prefix := range getPrefixChannels(group) {
+		if prefix != "" && strings.HasPrefix(modelName, prefix) {
+			modelPrefix = prefix
+			channelModel = strings.TrimPrefix(modelName, prefix)
+			break
+		}
+	}
+	actualModel, err := service.GetActualModel(channelModel)
+	if err != nil {
+		return nil, err
+	}
+	virtualModelMapped := actualModel != channelModel
+	virtualModelOriginal := channelModel
+	channelModel = actualModel
+
+	c.Set(constant.ContextKeyModelDeprecated, false)
+	c.Set(constant.ContextKeyRetiredModel, "")
+	for _, header := range []string{"Deprecation", "Sunset", "X-Model-Successor"} {
+		c.Writer.Header().Del(header)
+	}
+	channelModel, err = applyModelLifecycle(c, channelModel)
+	if err != nil {
+		return nil, err
+	}
+	if model.IsPlanRestrictedModel(channelModel) {
+		allowed, err := model.UserPlanAllowsModel(c.GetInt("id"), channelModel)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, errors.New("模型仅对订阅相应套餐的用户开放")
+		}
+	}
+
+	var channel *model.Channel
+	if modelPrefix != "" {
+		channel, err = selectChannelByPrefix(group, modelPrefix, channelModel)
+	} else {
+		channel, err = model.CacheGetRandomSatisfiedChannel(group, channelModel, 0)
+		if err == nil && channel != nil {
+			channel = service.SelectSelfHostedReplica(channel, group, channelModel)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, errors.New("无可用渠道")
+	}
+	if err := rewriteRequestModel(c, modelName); err != nil {
+		return nil, err
+	}
+
+	if c.GetString(constant.ContextKeyFallbackFrom) == "" {
+		c.Set(constant.ContextKeyFallbackFrom, c.GetString("prefixed_model"))
+	}
+	c.Set("prefixed_model", modelName)
+	c.Set("virtual_model_mapped", virtualModelMapped)
+	c.Set("virtual_model_original", virtualModelOriginal)
+	c.Set("virtual_model_actual", actualModel)
+	c.Header("X-Served-Model", modelName)
+	SetupContextForSelectedChannel(c, channel, channelModel)
+	return channel, nil
+}
+
+// tokenAllowsModel 检查令牌的模型限制是否允许访问 modelName
+func tokenAllowsModel(c *gin.Context, modelName string) bool {
+	if !c.GetBool("token_model_limit_enabled") {
+		return true
+	}
+	tokenModelLimit, ok := c.Get("token_model_limit")
+	if !ok {
+		return false
+	}
+	limit, ok := tokenModelLimit.(map[string]bool)
+	if !ok || limit == nil {
+		return false
+	}
+	_, ok = limit[modelName]
+	return ok
+}
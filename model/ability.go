@@ -188,6 +188,10 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 }
 
 func (channel *Channel) AddAbilities() error {
+	return channel.addAbilities(DB)
+}
+
+func (channel *Channel) addAbilities(tx *gorm.DB) error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
 	abilities := make([]Ability, 0, len(models_))
@@ -209,7 +213,7 @@ func (channel *Channel) AddAbilities() error {
 		return nil
 	}
 	for _, chunk := range lo.Chunk(abilities, 50) {
-		err := DB.Create(&chunk).Error
+		err := tx.Create(&chunk).Error
 		if err != nil {
 			return err
 		}
@@ -353,5 +357,6 @@ func FixAbility() (int, error) {
 		}
 	}
 	InitChannelCache()
+	common.PublishCacheEvent(common.CacheEventChannel, "")
 	return count, nil
 }
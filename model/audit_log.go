@@ -0,0 +1,122 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"veloera/common"
+
+	"gorm.io/gorm"
+)
+
+// 审计对象类型
+const (
+	AuditTargetChannel      = "channel"
+	AuditTargetOption       = "option"
+	AuditTargetUser         = "user"
+	AuditTargetRedemption   = "redemption"
+	AuditTargetModelMapping = "model_mapping"
+	AuditTargetRole         = "role"
+	AuditTargetPlan         = "plan"
+	AuditTargetSettlement   = "settlement"
+	AuditTargetMessage      = "message"
+	AuditTargetLog          = "log"
+	AuditTargetOrganization = "organization"
+	AuditTargetConfig       = "config"
+	AuditTargetSecret       = "secret"
+	AuditTargetModelCatalog = "model_catalog"
+)
+
+// AuditLog 记录管理员对配置与账户的每一次变更，Diff 中的敏感字段已脱敏
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Username   string `json:"username" gorm:"type:varchar(64);index"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(128);index:idx_audit_target"`
+	Diff       string `json:"diff" gorm:"type:text"`
+	Ip         string `json:"ip" gorm:"type:varchar(64)"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);index"`
+}
+
+type AuditLogFilter struct {
+	UserId         int
+	Username       string
+	Action         string
+	TargetType     string
+	TargetId       string
+	Keyword        string
+	RequestId      string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func RecordAuditLog(auditLog *AuditLog) {
+	if auditLog.CreatedAt == 0 {
+		auditLog.CreatedAt = common.GetTimestamp()
+	}
+	if err := DB.Create(auditLog).Error; err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+func (filter *AuditLogFilter) apply(tx *gorm.DB) *gorm.DB {
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("username = ?", filter.Username)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		tx = tx.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		tx = tx.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.RequestId != "" {
+		tx = tx.Where("request_id = ?", filter.RequestId)
+	}
+	if filter.Keyword != "" {
+		tx = tx.Where("diff LIKE ?", "%"+filter.Keyword+"%")
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	return tx
+}
+
+func SearchAuditLogs(filter AuditLogFilter, startIdx int, num int) (auditLogs []*AuditLog, total int64, err error) {
+	tx := filter.apply(DB.Model(&AuditLog{}))
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&auditLogs).Error
+	return auditLogs, total, err
+}
+
+// ExportAuditLogs 按时间倒序导出，limit 用于防止一次导出过多记录
+func ExportAuditLogs(filter AuditLogFilter, limit int) (auditLogs []*AuditLog, err error) {
+	err = filter.apply(DB.Model(&AuditLog{})).Order("id desc").Limit(limit).Find(&auditLogs).Error
+	return auditLogs, err
+}
@@ -151,6 +151,33 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	return nil, errors.New("channel not found")
 }
 
+// CacheGetChannelsByTag 返回分组下支持该模型且属于同一标签的已启用渠道
+func CacheGetChannelsByTag(group string, model string, tag string) []*Channel {
+	var result []*Channel
+	if !common.MemoryCacheEnabled {
+		channels, err := GetChannelsByTag(tag, false)
+		if err != nil {
+			return nil
+		}
+		for _, channel := range channels {
+			if channel.Status == common.ChannelStatusEnabled &&
+				common.StringsContains(strings.Split(channel.Group, ","), group) &&
+				common.StringsContains(channel.GetModels(), model) {
+				result = append(result, channel)
+			}
+		}
+		return result
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	for _, channel := range group2model2channels[group][model] {
+		if channel.GetTag() == tag && channel.Status == common.ChannelStatusEnabled {
+			result = append(result, channel)
+		}
+	}
+	return result
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
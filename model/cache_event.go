@@ -0,0 +1,119 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"veloera/common"
+)
+
+// channelCacheReloadSignal 合并短时间内的多次渠道变更，避免反复全量加载
+var channelCacheReloadSignal = make(chan struct{}, 1)
+
+func requestChannelCacheReload() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	select {
+	case channelCacheReloadSignal <- struct{}{}:
+	default:
+	}
+}
+
+func runChannelCacheReloader() {
+	for range channelCacheReloadSignal {
+		InitChannelCache()
+	}
+}
+
+// notifyChannelsChanged 在渠道配置变更后刷新本节点缓存并通知其他节点
+func notifyChannelsChanged() {
+	requestChannelCacheReload()
+	common.PublishCacheEvent(common.CacheEventChannel, "")
+}
+
+// NotifyChannelsChanged 供事务外的调用方在提交后刷新渠道缓存
+func NotifyChannelsChanged() {
+	notifyChannelsChanged()
+}
+
+func notifyChannelStatusChanged(id int, status int) {
+	requestChannelCacheReload()
+	common.PublishCacheEvent(common.CacheEventChannelStatus, fmt.Sprintf("%d:%d", id, status))
+}
+
+func reloadOptionFromDatabase(key string) {
+	option := Option{}
+	if err := DB.First(&option, Option{Key: key}).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to reload option %s: %s", key, err.Error()))
+		return
+	}
+	value, err := decryptOptionValue(&option)
+	if err != nil {
+		common.SysError(err.Error())
+		return
+	}
+	if err := updateOptionMap(option.Key, value); err != nil {
+		common.SysError("failed to update option map: " + err.Error())
+	}
+}
+
+// RegisterCacheEventHandlers 注册其他节点广播的缓存事件的处理函数，处理函数只更新本节点，不再转发
+func RegisterCacheEventHandlers() {
+	go runChannelCacheReloader()
+
+	common.RegisterCacheEventHandler(common.CacheEventChannel, func(string) {
+		requestChannelCacheReload()
+	})
+	common.RegisterCacheEventHandler(common.CacheEventChannelStatus, func(payload string) {
+		parts := strings.SplitN(payload, ":", 2)
+		if len(parts) == 2 {
+			id, _ := strconv.Atoi(parts[0])
+			status, _ := strconv.Atoi(parts[1])
+			CacheUpdateChannelStatus(id, status)
+		}
+		requestChannelCacheReload()
+	})
+	common.RegisterCacheEventHandler(common.CacheEventOption, reloadOptionFromDatabase)
+	common.RegisterCacheEventHandler(common.CacheEventModelMapping, func(string) {
+		reloadOptionFromDatabase("global_model_mapping")
+		_ = ReloadModelMapping()
+	})
+	// 令牌与用户缓存本就存放在 Redis 中，这里再删除一次是为了覆盖其他节点在变更提交前读到旧数据并回填缓存的情况
+	common.RegisterCacheEventHandler(common.CacheEventToken, func(payload string) {
+		if err := common.RedisHDelObj(fmt.Sprintf("token:%s", payload)); err != nil {
+			common.SysError("failed to delete token cache: " + err.Error())
+		}
+	})
+	common.RegisterCacheEventHandler(common.CacheEventUser, func(payload string) {
+		userId, err := strconv.Atoi(payload)
+		if err != nil {
+			return
+		}
+		if err := deleteUserCache(userId); err != nil {
+			common.SysError("failed to delete user cache: " + err.Error())
+		}
+	})
+	common.RegisterCacheEventHandler(common.CacheEventRole, func(string) {
+		InitRoleCache()
+	})
+	common.RegisterCacheEventHandler(common.CacheEventModelCatalog, func(string) {
+		InitModelCatalogCache()
+	})
+}
@@ -28,7 +28,8 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:secret"`
+	KeyHash            string  `json:"-" gorm:"type:varchar(64);index"` // 密钥的 HMAC，加密存储后用于按密钥搜索
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -131,15 +132,20 @@ func GetChannelsByTag(tag string, idSort bool) ([]*Channel, error) {
 	return channels, err
 }
 
+// GetEnabledChannelsByType 返回指定类型的已启用渠道，包含密钥
+func GetEnabledChannelsByType(channelType int) ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Where("type = ? AND status = ?", channelType, common.ChannelStatusEnabled).Find(&channels).Error
+	return channels, err
+}
+
 // buildWhereClause 构造通用的WHERE子句和参数
 func buildWhereClause(keyword string, group string, model string) (string, []interface{}) {
-	keyCol := "`key`"
 	groupCol := "`group`"
 	modelsCol := "`models`"
 
 	// 如果是 PostgreSQL，使用双引号
 	if common.UsingPostgreSQL {
-		keyCol = `"key"`
 		groupCol = `"group"`
 		modelsCol = `"models"`
 	}
@@ -154,11 +160,11 @@ func buildWhereClause(keyword string, group string, model string) (string, []int
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause = "(id = ? OR name LIKE ? OR key_hash = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", channelKeyHash(keyword), "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause = "(id = ? OR name LIKE ? OR key_hash = ?) AND " + modelsCol + " LIKE ?"
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", channelKeyHash(keyword), "%"+model+"%")
 	}
 	return whereClause, args
 }
@@ -257,6 +263,7 @@ func BatchInsertChannels(channels []Channel) error {
 			return err
 		}
 	}
+	notifyChannelsChanged()
 	return nil
 }
 
@@ -277,6 +284,7 @@ func BatchDeleteChannels(ids []int) error {
 	}
 	// 提交事务
 	tx.Commit()
+	notifyChannelsChanged()
 	return err
 }
 
@@ -322,9 +330,18 @@ func (channel *Channel) Insert() error {
 		return err
 	}
 	err = channel.AddAbilities()
+	notifyChannelsChanged()
 	return err
 }
 
+// InsertTx 在事务中创建渠道及其能力，提交后需调用 NotifyChannelsChanged 刷新缓存
+func (channel *Channel) InsertTx(tx *gorm.DB) error {
+	if err := tx.Create(channel).Error; err != nil {
+		return err
+	}
+	return channel.addAbilities(tx)
+}
+
 func (channel *Channel) Update() error {
 	var err error
 	err = DB.Model(channel).Updates(channel).Error
@@ -333,9 +350,21 @@ func (channel *Channel) Update() error {
 	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities(nil)
+	notifyChannelsChanged()
 	return err
 }
 
+// UpdateTx 在事务中更新渠道及其能力，提交后需调用 NotifyChannelsChanged 刷新缓存
+func (channel *Channel) UpdateTx(tx *gorm.DB) error {
+	if err := tx.Model(channel).Updates(channel).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(channel).First(channel, "id = ?", channel.Id).Error; err != nil {
+		return err
+	}
+	return channel.UpdateAbilities(tx)
+}
+
 func (channel *Channel) UpdateResponseTime(responseTime int64) {
 	err := DB.Model(channel).Select("response_time", "test_time").Updates(Channel{
 		TestTime:     common.GetTimestamp(),
@@ -363,9 +392,18 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
+	notifyChannelsChanged()
 	return err
 }
 
+// DeleteTx 在事务中删除渠道及其能力，提交后需调用 NotifyChannelsChanged 刷新缓存
+func (channel *Channel) DeleteTx(tx *gorm.DB) error {
+	if err := tx.Delete(channel).Error; err != nil {
+		return err
+	}
+	return tx.Where("channel_id = ?", channel.Id).Delete(&Ability{}).Error
+}
+
 var channelStatusLock sync.Mutex
 
 func UpdateChannelStatusById(id int, status int, reason string) bool {
@@ -416,6 +454,7 @@ func UpdateChannelStatusById(id int, status int, reason string) bool {
 			return false
 		}
 	}
+	notifyChannelStatusChanged(id, status)
 	return true
 }
 
@@ -425,6 +464,7 @@ func EnableChannelByTag(tag string) error {
 		return err
 	}
 	err = UpdateAbilityStatusByTag(tag, true)
+	notifyChannelsChanged()
 	return err
 }
 
@@ -434,6 +474,7 @@ func DisableChannelByTag(tag string) error {
 		return err
 	}
 	err = UpdateAbilityStatusByTag(tag, false)
+	notifyChannelsChanged()
 	return err
 }
 
@@ -484,6 +525,7 @@ func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *
 			return err
 		}
 	}
+	notifyChannelsChanged()
 	return nil
 }
 
@@ -504,11 +546,17 @@ func updateChannelUsedQuota(id int, quota int) {
 
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
+	if result.RowsAffected > 0 {
+		notifyChannelsChanged()
+	}
 	return result.RowsAffected, result.Error
 }
 
 func DeleteDisabledChannel() (int64, error) {
 	result := DB.Where("status = ? or status = ?", common.ChannelStatusAutoDisabled, common.ChannelStatusManuallyDisabled).Delete(&Channel{})
+	if result.RowsAffected > 0 {
+		notifyChannelsChanged()
+	}
 	return result.RowsAffected, result.Error
 }
 
@@ -653,5 +701,9 @@ func BatchSetChannelTag(ids []int, tag *string) error {
 	}
 
 	// 提交事务
-	return tx.Commit().Error
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	notifyChannelsChanged()
+	return nil
 }
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"fmt"
+	"time"
+	"veloera/common"
+	"veloera/setting/system_setting"
+)
+
+// ChatContent 加密留存的对话内容，与计费日志分开存储并独立清理
+type ChatContent struct {
+	Id         int    `json:"id"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Username   string `json:"username" gorm:"type:varchar(64);default:''"`
+	TokenId    int    `json:"token_id" gorm:"default:0"`
+	ChannelId  int    `json:"channel_id" gorm:"default:0"`
+	ModelName  string `json:"model_name" gorm:"type:varchar(128);index;default:''"`
+	Group      string `json:"group" gorm:"type:varchar(64);default:''"`
+	Redactions int    `json:"redactions" gorm:"default:0"` // 脱敏替换的次数
+	Encrypted  bool   `json:"encrypted" gorm:"default:true"`
+	KeyId      string `json:"key_id" gorm:"type:varchar(16);default:''"`
+	WrappedKey string `json:"-" gorm:"type:text"`
+	Content    string `json:"-" gorm:"type:text"` // 加密时为密文（base64），否则为 JSON 明文
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (content *ChatContent) Insert() error {
+	if content.CreatedAt == 0 {
+		content.CreatedAt = common.GetTimestamp()
+	}
+	return LOG_DB.Create(content).Error
+}
+
+func GetChatContentById(id int) (*ChatContent, error) {
+	content := &ChatContent{}
+	err := LOG_DB.Where("id = ?", id).First(content).Error
+	return content, err
+}
+
+// GetChatContents 查询留存记录列表，不包含内容本身
+func GetChatContents(userId int, requestId string, modelName string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (contents []*ChatContent, total int64, err error) {
+	tx := LOG_DB.Model(&ChatContent{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if requestId != "" {
+		tx = tx.Where("request_id = ?", requestId)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("content", "wrapped_key").Order("id desc").Limit(num).Offset(startIdx).Find(&contents).Error
+	return contents, total, err
+}
+
+func DeleteChatContentsBefore(targetTimestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&ChatContent{})
+	return result.RowsAffected, result.Error
+}
+
+// AutoCleanChatContents 按留存天数定期清理对话内容
+func AutoCleanChatContents() {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysLog(fmt.Sprintf("AutoCleanChatContents panic: %v", r))
+		}
+	}()
+	for {
+		retentionDays := system_setting.GetChatContentSettings().RetentionDays
+		if retentionDays > 0 {
+			target := time.Now().AddDate(0, 0, -retentionDays).Unix()
+			count, err := DeleteChatContentsBefore(target)
+			if err != nil {
+				common.SysError("failed to clean chat contents: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired chat contents", count))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
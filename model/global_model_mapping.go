@@ -23,6 +23,8 @@ import (
 	"sync"
 
 	"veloera/common"
+
+	"gorm.io/gorm"
 )
 
 // 全局变量
@@ -119,22 +121,28 @@ func GlobalModelMappingToJSONString() string {
 
 // UpdateGlobalModelMappingFromJSONString 从JSON字符串更新全局模型映射配置
 func UpdateGlobalModelMappingFromJSONString(jsonStr string) error {
+	mapping, err := parseGlobalModelMapping(jsonStr)
+	if err != nil {
+		return err
+	}
+	return UpdateGlobalModelMapping(mapping)
+}
+
+func parseGlobalModelMapping(jsonStr string) (*GlobalModelMapping, error) {
 	if jsonStr == "" || jsonStr == "{}" {
 		// 如果配置为空，使用默认配置
-		defaultMapping := &GlobalModelMapping{
+		return &GlobalModelMapping{
 			Mapping: make(map[string][]ModelMappingItem),
-		}
-		return UpdateGlobalModelMapping(defaultMapping)
+		}, nil
 	}
 
 	// 解析JSON配置
 	var mapping GlobalModelMapping
 	if err := json.Unmarshal([]byte(jsonStr), &mapping); err != nil {
 		common.SysError(fmt.Sprintf("Failed to parse global model mapping configuration: %v", err))
-		return err
+		return nil, err
 	}
-
-	return UpdateGlobalModelMapping(&mapping)
+	return &mapping, nil
 }
 
 // UpdateGlobalModelMapping 更新全局模型映射配置
@@ -142,28 +150,61 @@ func UpdateGlobalModelMapping(mapping *GlobalModelMapping) error {
 	ModelMappingMutex.Lock()
 	defer ModelMappingMutex.Unlock()
 
+	value, err := saveGlobalModelMapping(DB, mapping)
+	if err != nil {
+		return err
+	}
+	return applyGlobalModelMapping(mapping, value)
+}
+
+// SaveGlobalModelMappingTx 校验并在事务中保存全局模型映射，返回的函数需在事务提交后调用以生效
+func SaveGlobalModelMappingTx(tx *gorm.DB, jsonStr string) (func() error, error) {
+	mapping, err := parseGlobalModelMapping(jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	value, err := saveGlobalModelMapping(tx, mapping)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		ModelMappingMutex.Lock()
+		defer ModelMappingMutex.Unlock()
+		return applyGlobalModelMapping(mapping, value)
+	}, nil
+}
+
+func saveGlobalModelMapping(tx *gorm.DB, mapping *GlobalModelMapping) (string, error) {
 	// 验证配置格式
 	if err := ValidateModelMapping(mapping); err != nil {
-		return err
+		return "", err
 	}
 
 	// 序列化配置为JSON
 	jsonData, err := json.Marshal(mapping)
 	if err != nil {
 		common.SysError(fmt.Sprintf("Failed to serialize global model mapping configuration: %v", err))
-		return err
+		return "", err
 	}
 
 	// 保存配置到数据库
-	if err := UpdateOption("global_model_mapping", string(jsonData)); err != nil {
+	if err := SaveOptionTx(tx, "global_model_mapping", string(jsonData)); err != nil {
 		common.SysError(fmt.Sprintf("Failed to save global model mapping configuration to the database.: %v", err))
-		return err
+		return "", err
 	}
+	return string(jsonData), nil
+}
 
+// applyGlobalModelMapping 更新内存中的映射并通知其他节点，调用方需持有 ModelMappingMutex
+func applyGlobalModelMapping(mapping *GlobalModelMapping, value string) error {
+	if err := RefreshOption("global_model_mapping", value); err != nil {
+		return err
+	}
 	globalModelMapping = mapping
 
 	// 重置轮询计数器
 	roundRobinCounter.ClearAllCounters()
+	common.PublishCacheEvent(common.CacheEventModelMapping, "")
 
 	common.SysLog("Global model mapping configuration updated successfully")
 	return nil
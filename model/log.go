@@ -188,8 +188,9 @@ func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens in
 		common.LogError(c, "failed to record log: "+err.Error())
 	}
 	if common.DataExportEnabled {
+		orgId := c.GetInt("token_org_id")
 		gopool.Go(func() {
-			LogQuotaData(userId, username, modelName, quota, common.GetTimestamp(), promptTokens+completionTokens)
+			LogQuotaData(userId, orgId, username, modelName, quota, common.GetTimestamp(), promptTokens+completionTokens)
 		})
 	}
 }
@@ -232,6 +233,33 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 		return nil, 0, err
 	}
 
+	// 查询范围覆盖已归档分区时，在线日志之后接续归档中的日志
+	readArchives, err := shouldReadLogArchives(startTimestamp)
+	if err != nil {
+		return nil, 0, err
+	}
+	if readArchives {
+		archiveIdx := startIdx - int(total)
+		if archiveIdx < 0 {
+			archiveIdx = 0
+		}
+		archived, archivedTotal, err := SearchArchivedLogs(LogArchiveFilter{
+			LogType:        logType,
+			StartTimestamp: startTimestamp,
+			EndTimestamp:   endTimestamp,
+			ModelName:      modelName,
+			Username:       username,
+			TokenName:      tokenName,
+			Channel:        channel,
+			Group:          group,
+		}, archiveIdx, num-len(logs))
+		if err != nil {
+			return nil, 0, err
+		}
+		total += archivedTotal
+		logs = append(logs, archived...)
+	}
+
 	channelIds := make([]int, 0)
 	channelMap := make(map[int]string)
 	for _, log := range logs {
@@ -398,3 +426,12 @@ func DeleteOldLog(targetTimestamp int64) (int64, error) {
 	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&Log{})
 	return result.RowsAffected, result.Error
 }
+
+// GetRecentModelUserIds 返回指定时间以来调用过该模型的用户
+func GetRecentModelUserIds(modelName string, since int64) ([]int, error) {
+	var userIds []int
+	err := LOG_DB.Model(&Log{}).
+		Where("type = ? AND model_name = ? AND created_at >= ?", LogTypeConsume, modelName, since).
+		Distinct("user_id").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
@@ -0,0 +1,495 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/setting/system_setting"
+)
+
+// LogArchive 已归档的日志分区，日志按服务器时区的自然月分区。
+// 分区只是 logs 单表上按 created_at 划分的逻辑范围，并未拆分为按月滚动的物理表；
+// 在线表的行数由归档后删除来控制，GetAllLogs、SumUsedQuota 等查询仍作用于同一张 logs 表
+type LogArchive struct {
+	Id          int    `json:"id"`
+	Period      string `json:"period" gorm:"type:varchar(7);index"` // 2006-01
+	PeriodStart int64  `json:"period_start" gorm:"bigint;index"`
+	PeriodEnd   int64  `json:"period_end" gorm:"bigint;index"`
+	Storage     string `json:"storage" gorm:"type:varchar(16)"`
+	ObjectKey   string `json:"object_key" gorm:"type:varchar(255)"`
+	RowCount    int64  `json:"row_count" gorm:"bigint"`
+	MinLogId    int    `json:"min_log_id"`
+	MaxLogId    int    `json:"max_log_id"`
+	Size        int64  `json:"size" gorm:"bigint"`
+	Checksum    string `json:"checksum" gorm:"type:varchar(64)"` // 压缩文件的 sha256
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// LogArchiveFilter 读取归档日志时的过滤条件，与 GetAllLogs 的参数一致
+type LogArchiveFilter struct {
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+	Group          string
+	UserId         int
+}
+
+// GetLogArchiveStore 根据配置创建归档存储
+func GetLogArchiveStore() (common.ObjectStore, error) {
+	return getLogArchiveStore(system_setting.GetLogArchiveSettings().Storage)
+}
+
+// getLogArchiveStore 创建指定类型的归档存储。读取归档时按归档记录中的类型选择存储，
+// 切换存储类型后旧归档仍可读取，前提是原存储的目录或存储桶配置未被清除
+func getLogArchiveStore(storage string) (common.ObjectStore, error) {
+	settings := system_setting.GetLogArchiveSettings()
+	switch storage {
+	case "", "local":
+		if settings.LocalDir == "" {
+			return nil, errors.New("日志归档目录未配置")
+		}
+		return &common.LocalObjectStore{Dir: settings.LocalDir}, nil
+	case "s3":
+		return &common.S3ObjectStore{
+			Endpoint:        settings.S3Endpoint,
+			Region:          settings.S3Region,
+			Bucket:          settings.S3Bucket,
+			AccessKeyId:     settings.S3AccessKeyId,
+			SecretAccessKey: settings.S3SecretAccessKey,
+			PathStyle:       settings.S3PathStyle,
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的日志归档存储类型 %s", storage)
+	}
+}
+
+func logPartitionStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// logArchiveCutoff 返回归档的截止时间，早于该时间的完整分区可以归档
+func logArchiveCutoff() time.Time {
+	retainMonths := system_setting.GetLogArchiveSettings().RetainMonths
+	if retainMonths < 0 {
+		retainMonths = 0
+	}
+	return logPartitionStart(time.Now()).AddDate(0, -retainMonths, 0)
+}
+
+// ArchiveClosedLogPartitions 归档所有已关闭（早于保留期）的日志分区，返回归档的行数
+func ArchiveClosedLogPartitions() (int64, error) {
+	store, err := GetLogArchiveStore()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := logArchiveCutoff()
+	var oldest int64
+	err = LOG_DB.Model(&Log{}).Where("created_at < ?", cutoff.Unix()).
+		Select("COALESCE(MIN(created_at), 0)").Scan(&oldest).Error
+	if err != nil || oldest == 0 {
+		return 0, err
+	}
+	var total int64
+	for start := logPartitionStart(time.Unix(oldest, 0)); start.Before(cutoff); start = start.AddDate(0, 1, 0) {
+		archive, err := archiveLogPartition(store, start, start.AddDate(0, 1, 0))
+		if err != nil {
+			return total, fmt.Errorf("archive %s: %w", start.Format("2006-01"), err)
+		}
+		if archive != nil {
+			total += archive.RowCount
+		}
+	}
+	return total, nil
+}
+
+// deleteArchivedLogs 分批删除已登记归档的 id 范围内的在线日志，可重复执行
+func deleteArchivedLogs(archive *LogArchive, batchSize int) error {
+	for {
+		var ids []int
+		err := LOG_DB.Model(&Log{}).
+			Where("created_at >= ? AND created_at < ? AND id >= ? AND id <= ?", archive.PeriodStart, archive.PeriodEnd, archive.MinLogId, archive.MaxLogId).
+			Limit(batchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err = LOG_DB.Where("id IN ?", ids).Delete(&Log{}).Error; err != nil {
+			return err
+		}
+	}
+}
+
+// archiveLogPartition 将一个分区导出为 gzip 压缩的 JSONL 并上传，成功后从数据库中删除。
+// 分区已归档后又写入的迟到日志会生成新的归档对象。
+func archiveLogPartition(store common.ObjectStore, start time.Time, end time.Time) (*LogArchive, error) {
+	settings := system_setting.GetLogArchiveSettings()
+	batchSize := settings.BatchSize
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+	// 先补完上次中断的删除，已归档 id 范围内的行不会被重复导出
+	var existing []*LogArchive
+	if err := LOG_DB.Where("period_start = ?", start.Unix()).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, archived := range existing {
+		if err := deleteArchivedLogs(archived, batchSize); err != nil {
+			return nil, err
+		}
+	}
+	tmp, err := os.CreateTemp("", "veloera-logs-*.jsonl.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, hash))
+	encoder := json.NewEncoder(gz)
+	archive := &LogArchive{
+		Period:      start.Format("2006-01"),
+		PeriodStart: start.Unix(),
+		PeriodEnd:   end.Unix(),
+		Storage:     settings.Storage,
+	}
+	lastId := 0
+	for {
+		var logs []*Log
+		err = LOG_DB.Where("created_at >= ? AND created_at < ? AND id > ?", archive.PeriodStart, archive.PeriodEnd, lastId).
+			Order("id asc").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			if err = encoder.Encode(log); err != nil {
+				return nil, err
+			}
+			if archive.MinLogId == 0 {
+				archive.MinLogId = log.Id
+			}
+			archive.MaxLogId = log.Id
+			archive.RowCount++
+		}
+		if len(logs) < batchSize {
+			break
+		}
+		lastId = logs[len(logs)-1].Id
+	}
+	if archive.RowCount == 0 {
+		return nil, nil
+	}
+	if err = gz.Close(); err != nil {
+		return nil, err
+	}
+	archive.Size, err = tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	archive.Checksum = hex.EncodeToString(hash.Sum(nil))
+	archive.CreatedTime = common.GetTimestamp()
+	archive.ObjectKey = path.Join(settings.Prefix, start.Format("2006"),
+		fmt.Sprintf("logs-%s-%d-%d.jsonl.gz", archive.Period, archive.MinLogId, archive.MaxLogId))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	if err = store.Put(ctx, archive.ObjectKey, tmp, archive.Size); err != nil {
+		return nil, err
+	}
+	if err = LOG_DB.Create(archive).Error; err != nil {
+		return nil, err
+	}
+	// 上传与登记成功后再分批删除，删除中断时下次归档前会先补完删除
+	if err = deleteArchivedLogs(archive, batchSize); err != nil {
+		return nil, err
+	}
+	common.SysLog(fmt.Sprintf("archived %d logs of %s to %s", archive.RowCount, archive.Period, archive.ObjectKey))
+	return archive, nil
+}
+
+// AutoArchiveLogs 定期归档已关闭的日志分区
+func AutoArchiveLogs() {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysLog(fmt.Sprintf("AutoArchiveLogs panic: %v", r))
+		}
+	}()
+	for {
+		if system_setting.GetLogArchiveSettings().Enabled {
+			if _, err := ArchiveClosedLogPartitions(); err != nil {
+				common.SysError("failed to archive logs: " + err.Error())
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func GetLogArchives(startIdx int, num int) (archives []*LogArchive, total int64, err error) {
+	if err = LOG_DB.Model(&LogArchive{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = LOG_DB.Order("period_start desc, id desc").Limit(num).Offset(startIdx).Find(&archives).Error
+	return archives, total, err
+}
+
+// scanArchivedLogs 流式解压并逐行解析归档文件，不在内存中保留整个分区，fn 返回 false 时提前结束
+func scanArchivedLogs(archive *LogArchive, fn func(log *Log) bool) error {
+	store, err := getLogArchiveStore(archive.Storage)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	body, err := store.Get(ctx, archive.ObjectKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		log := &Log{}
+		if err = json.Unmarshal(scanner.Bytes(), log); err != nil {
+			return err
+		}
+		if !fn(log) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// likePattern 将 SQL LIKE 模式转换为正则表达式
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// logArchiveMatcher 按过滤条件匹配归档中的日志，时间范围为闭区间，与 GetAllLogs 一致
+func logArchiveMatcher(filter LogArchiveFilter) func(log *Log) bool {
+	var modelPattern *regexp.Regexp
+	if filter.ModelName != "" {
+		modelPattern = likePattern(filter.ModelName)
+	}
+	return func(log *Log) bool {
+		if filter.UserId != 0 && log.UserId != filter.UserId {
+			return false
+		}
+		if filter.LogType != LogTypeUnknown && log.Type != filter.LogType {
+			return false
+		}
+		if filter.StartTimestamp != 0 && log.CreatedAt < filter.StartTimestamp {
+			return false
+		}
+		if filter.EndTimestamp != 0 && log.CreatedAt > filter.EndTimestamp {
+			return false
+		}
+		if modelPattern != nil && !modelPattern.MatchString(log.ModelName) {
+			return false
+		}
+		if filter.Username != "" && log.Username != filter.Username {
+			return false
+		}
+		if filter.TokenName != "" && log.TokenName != filter.TokenName {
+			return false
+		}
+		if filter.Channel != 0 && log.ChannelId != filter.Channel {
+			return false
+		}
+		if filter.Group != "" && log.Group != filter.Group {
+			return false
+		}
+		return true
+	}
+}
+
+// getOverlappingLogArchives 返回与时间范围重叠的归档分区，按 id 从新到旧排列
+func getOverlappingLogArchives(startTimestamp int64, endTimestamp int64) (archives []*LogArchive, err error) {
+	tx := LOG_DB.Model(&LogArchive{})
+	if startTimestamp != 0 {
+		tx = tx.Where("period_end > ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("period_start <= ?", endTimestamp)
+	}
+	err = tx.Order("max_log_id desc").Find(&archives).Error
+	return archives, err
+}
+
+// 归档分区的匹配行数缓存，翻页时只需重新读取包含当前页的分区
+const logArchiveCountCacheSize = 256
+
+var (
+	logArchiveCountLock  sync.Mutex
+	logArchiveCountCache = make(map[string]int)
+)
+
+func countArchivedLogs(archive *LogArchive, filter LogArchiveFilter, match func(log *Log) bool) (int, error) {
+	key := fmt.Sprintf("%d:%+v", archive.Id, filter)
+	logArchiveCountLock.Lock()
+	count, ok := logArchiveCountCache[key]
+	logArchiveCountLock.Unlock()
+	if ok {
+		return count, nil
+	}
+	err := scanArchivedLogs(archive, func(log *Log) bool {
+		if match(log) {
+			count++
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	logArchiveCountLock.Lock()
+	if len(logArchiveCountCache) >= logArchiveCountCacheSize {
+		logArchiveCountCache = make(map[string]int)
+	}
+	logArchiveCountCache[key] = count
+	logArchiveCountLock.Unlock()
+	return count, nil
+}
+
+// SearchArchivedLogs 分页查找与时间范围重叠的归档日志，结果按 id 倒序，返回当前页与匹配总数。
+// 归档文件按 id 正序写入，先统计各分区的匹配行数，再只读取包含当前页的分区，内存占用与页大小相当。
+func SearchArchivedLogs(filter LogArchiveFilter, startIdx int, num int) ([]*Log, int64, error) {
+	archives, err := getOverlappingLogArchives(filter.StartTimestamp, filter.EndTimestamp)
+	if err != nil {
+		return nil, 0, err
+	}
+	match := logArchiveMatcher(filter)
+	counts := make([]int, len(archives))
+	var total int64
+	for i, archive := range archives {
+		if counts[i], err = countArchivedLogs(archive, filter, match); err != nil {
+			return nil, 0, fmt.Errorf("read archive %s: %w", archive.ObjectKey, err)
+		}
+		total += int64(counts[i])
+	}
+
+	result := make([]*Log, 0)
+	skip := startIdx
+	for i, archive := range archives {
+		if len(result) >= num {
+			break
+		}
+		if skip >= counts[i] {
+			skip -= counts[i]
+			continue
+		}
+		// 倒序的第 [skip, skip+want) 行对应正序的第 [count-skip-want, count-skip) 行
+		want := min(num-len(result), counts[i]-skip)
+		from, to := counts[i]-skip-want, counts[i]-skip
+		page := make([]*Log, 0, want)
+		index := 0
+		err = scanArchivedLogs(archive, func(log *Log) bool {
+			if !match(log) {
+				return true
+			}
+			if index >= from {
+				page = append(page, log)
+			}
+			index++
+			return index < to
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("read archive %s: %w", archive.ObjectKey, err)
+		}
+		sort.Slice(page, func(a, b int) bool {
+			return page[a].Id > page[b].Id
+		})
+		result = append(result, page...)
+		skip = 0
+	}
+	return result, total, nil
+}
+
+// ScanArchivedLogs 逐条遍历 [start, end) 内已归档的日志，供对账单、结算等需要完整账期数据的统计使用
+func ScanArchivedLogs(start int64, end int64, fn func(log *Log)) error {
+	archives, err := getOverlappingLogArchives(start, end-1)
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		err = scanArchivedLogs(archive, func(log *Log) bool {
+			if log.CreatedAt >= start && log.CreatedAt < end {
+				fn(log)
+			}
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("read archive %s: %w", archive.ObjectKey, err)
+		}
+	}
+	return nil
+}
+
+// shouldReadLogArchives 仅在显式指定了早于在线分区的起始时间时读取归档，避免普通查询下载归档文件
+func shouldReadLogArchives(startTimestamp int64) (bool, error) {
+	if !system_setting.GetLogArchiveSettings().TransparentRead || startTimestamp == 0 {
+		return false, nil
+	}
+	var count int64
+	if err := LOG_DB.Model(&LogArchive{}).Where("period_end > ?", startTimestamp).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -265,15 +265,26 @@ func migrateDB() error {
 		&RedemptionLog{},
 		&Ability{},
 		&Log{},
+		&LogArchive{},
+		&ChatContent{},
 		&Midjourney{},
 		&TopUp{},
 		&SubscriptionPlan{},
 		&UserPlanOrder{},
+		&SubscriptionDailyUsage{},
 		&QuotaData{},
 		&Task{},
 		&Setup{},
 		&Message{},
 		&UserMessage{},
+		&PostpaidSettlement{},
+		&Role{},
+		&AuditLog{},
+		&Organization{},
+		&OrgMember{},
+		&OrgInvitation{},
+		&OrgFunding{},
+		&ModelCatalog{},
 	}
 
 	for _, model := range modelsToMigrate {
@@ -288,13 +299,17 @@ func migrateDB() error {
 		}
 	}
 
+	if err := seedBuiltinRoles(); err != nil {
+		return err
+	}
+
 	common.SysLog("database migrated")
 	return nil
 }
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &LogArchive{}, &ChatContent{}); err != nil {
 		return err
 	}
 
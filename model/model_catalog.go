@@ -0,0 +1,327 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/dto"
+)
+
+// 模型生命周期状态
+const (
+	ModelLifecycleActive     = "active"
+	ModelLifecycleDeprecated = "deprecated" // 仍可调用，响应附带弃用提示
+	ModelLifecycleRetired    = "retired"    // 不再调用，请求转发到后继模型
+)
+
+// 后继模型可能也已退役，沿链查找的最大深度
+const maxModelSuccessorDepth = 8
+
+// 模型目录允许登记的输入/输出模态
+var ModelModalities = []string{"text", "image", "audio", "video", "file"}
+
+// ModelCatalog 管理员维护的模型元数据，按模型名称匹配，未登记的模型沿用原有默认展示
+type ModelCatalog struct {
+	Id                int    `json:"id"`
+	ModelName         string `json:"model_name" gorm:"type:varchar(255);uniqueIndex"`
+	DisplayName       string `json:"display_name" gorm:"type:varchar(255)"`
+	Provider          string `json:"provider" gorm:"type:varchar(64)"`
+	Description       string `json:"description" gorm:"type:text"`
+	ContextWindow     int    `json:"context_window" gorm:"default:0"`            // 上下文窗口（tokens），0 表示未知，不做校验
+	MaxOutputTokens   int    `json:"max_output_tokens" gorm:"default:0"`         // 单次最大输出（tokens），0 表示未知
+	InputModalities   string `json:"input_modalities" gorm:"type:varchar(255)"`  // 逗号分隔，如 text,image
+	OutputModalities  string `json:"output_modalities" gorm:"type:varchar(255)"` // 逗号分隔
+	SupportsTools     bool   `json:"supports_tools" gorm:"default:false"`
+	SupportsVision    bool   `json:"supports_vision" gorm:"default:false"`
+	SupportsReasoning bool   `json:"supports_reasoning" gorm:"default:false"`
+	DeprecationDate   int64  `json:"deprecation_date" gorm:"bigint;default:0"`   // 计划弃用的时间戳，0 表示未计划
+	ReplacementModel  string `json:"replacement_model" gorm:"type:varchar(255)"` // 后继模型，退役后请求转发到该模型
+	Lifecycle         string `json:"lifecycle" gorm:"type:varchar(16);default:'active'"`
+	SunsetDate        int64  `json:"sunset_date" gorm:"bigint;default:0"`   // 下线时间戳，到期后视为已退役，0 表示未计划
+	NotifiedTime      int64  `json:"notified_time" gorm:"bigint;default:0"` // 最近一次向用户发送弃用通知的时间
+	CreatedTime       int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime       int64  `json:"updated_time" gorm:"bigint"`
+}
+
+var (
+	modelCatalogs     = make(map[string]*ModelCatalog)
+	modelCatalogsLock sync.RWMutex
+)
+
+func splitModalities(value string) []string {
+	var modalities []string
+	for _, modality := range strings.Split(value, ",") {
+		modality = strings.TrimSpace(modality)
+		if modality != "" {
+			modalities = append(modalities, modality)
+		}
+	}
+	return modalities
+}
+
+func (catalog *ModelCatalog) GetInputModalities() []string {
+	return splitModalities(catalog.InputModalities)
+}
+
+func (catalog *ModelCatalog) GetOutputModalities() []string {
+	return splitModalities(catalog.OutputModalities)
+}
+
+// GetLifecycle 返回当前生效的生命周期：到达下线时间视为已退役，到达弃用时间视为已弃用
+func (catalog *ModelCatalog) GetLifecycle() string {
+	now := common.GetTimestamp()
+	switch {
+	case catalog.Lifecycle == ModelLifecycleRetired, catalog.SunsetDate > 0 && now >= catalog.SunsetDate:
+		return ModelLifecycleRetired
+	case catalog.Lifecycle == ModelLifecycleDeprecated, catalog.DeprecationDate > 0 && now >= catalog.DeprecationDate:
+		return ModelLifecycleDeprecated
+	}
+	return ModelLifecycleActive
+}
+
+// ToMetadata 转换为对外展示的元数据
+func (catalog *ModelCatalog) ToMetadata() *dto.ModelMetadata {
+	return &dto.ModelMetadata{
+		DisplayName:      catalog.DisplayName,
+		Description:      catalog.Description,
+		ContextWindow:    catalog.ContextWindow,
+		MaxOutputTokens:  catalog.MaxOutputTokens,
+		InputModalities:  catalog.GetInputModalities(),
+		OutputModalities: catalog.GetOutputModalities(),
+		Capabilities: &dto.ModelCapabilities{
+			Tools:     catalog.SupportsTools,
+			Vision:    catalog.SupportsVision,
+			Reasoning: catalog.SupportsReasoning,
+		},
+		DeprecationDate:  catalog.DeprecationDate,
+		ReplacementModel: catalog.ReplacementModel,
+		Lifecycle:        catalog.GetLifecycle(),
+		SunsetDate:       catalog.SunsetDate,
+	}
+}
+
+// Validate 校验并规范化目录条目
+func (catalog *ModelCatalog) Validate() error {
+	catalog.ModelName = strings.TrimSpace(catalog.ModelName)
+	catalog.ReplacementModel = strings.TrimSpace(catalog.ReplacementModel)
+	if catalog.ModelName == "" {
+		return errors.New("模型名称不能为空")
+	}
+	if len(catalog.ModelName) > 255 {
+		return fmt.Errorf("模型名称过长: %s", catalog.ModelName)
+	}
+	if catalog.ContextWindow < 0 || catalog.MaxOutputTokens < 0 {
+		return errors.New("上下文窗口与最大输出不能为负数")
+	}
+	if catalog.ContextWindow > 0 && catalog.MaxOutputTokens > catalog.ContextWindow {
+		return errors.New("最大输出不能超过上下文窗口")
+	}
+	if catalog.ReplacementModel == catalog.ModelName {
+		return errors.New("替代模型不能是模型本身")
+	}
+	switch catalog.Lifecycle {
+	case "":
+		catalog.Lifecycle = ModelLifecycleActive
+	case ModelLifecycleActive, ModelLifecycleDeprecated, ModelLifecycleRetired:
+	default:
+		return fmt.Errorf("未知的生命周期状态: %s", catalog.Lifecycle)
+	}
+	if catalog.SunsetDate < 0 || catalog.DeprecationDate < 0 {
+		return errors.New("弃用与下线时间不能为负数")
+	}
+	for _, field := range []*string{&catalog.InputModalities, &catalog.OutputModalities} {
+		modalities := splitModalities(*field)
+		for _, modality := range modalities {
+			if !common.StringsContains(ModelModalities, modality) {
+				return fmt.Errorf("不支持的模态: %s", modality)
+			}
+		}
+		*field = strings.Join(modalities, ",")
+	}
+	return nil
+}
+
+func GetAllModelCatalogs(keyword string) ([]*ModelCatalog, error) {
+	var catalogs []*ModelCatalog
+	query := DB.Order("model_name asc")
+	if keyword != "" {
+		query = query.Where("model_name LIKE ? OR display_name LIKE ? OR provider LIKE ?",
+			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	err := query.Find(&catalogs).Error
+	return catalogs, err
+}
+
+func GetModelCatalogById(id int) (*ModelCatalog, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var catalog ModelCatalog
+	err := DB.First(&catalog, "id = ?", id).Error
+	return &catalog, err
+}
+
+func (catalog *ModelCatalog) Insert() error {
+	now := common.GetTimestamp()
+	catalog.CreatedTime = now
+	catalog.UpdatedTime = now
+	if err := DB.Create(catalog).Error; err != nil {
+		return err
+	}
+	setModelCatalogCache(catalog)
+	common.PublishCacheEvent(common.CacheEventModelCatalog, "")
+	return nil
+}
+
+// Update 更新全部字段，模型名称修改时同步替换缓存中的旧条目
+func (catalog *ModelCatalog) Update() error {
+	origin, err := GetModelCatalogById(catalog.Id)
+	if err != nil {
+		return err
+	}
+	catalog.CreatedTime = origin.CreatedTime
+	catalog.NotifiedTime = origin.NotifiedTime
+	catalog.UpdatedTime = common.GetTimestamp()
+	if err = DB.Save(catalog).Error; err != nil {
+		return err
+	}
+	if origin.ModelName != catalog.ModelName {
+		deleteModelCatalogCache(origin.ModelName)
+	}
+	setModelCatalogCache(catalog)
+	common.PublishCacheEvent(common.CacheEventModelCatalog, "")
+	return nil
+}
+
+func (catalog *ModelCatalog) Delete() error {
+	if err := DB.Delete(catalog).Error; err != nil {
+		return err
+	}
+	deleteModelCatalogCache(catalog.ModelName)
+	common.PublishCacheEvent(common.CacheEventModelCatalog, "")
+	return nil
+}
+
+func setModelCatalogCache(catalog *ModelCatalog) {
+	cached := *catalog
+	modelCatalogsLock.Lock()
+	defer modelCatalogsLock.Unlock()
+	modelCatalogs[cached.ModelName] = &cached
+}
+
+func deleteModelCatalogCache(modelName string) {
+	modelCatalogsLock.Lock()
+	defer modelCatalogsLock.Unlock()
+	delete(modelCatalogs, modelName)
+}
+
+func InitModelCatalogCache() {
+	catalogs, err := GetAllModelCatalogs("")
+	if err != nil {
+		common.SysError("failed to load model catalog: " + err.Error())
+		return
+	}
+	newModelCatalogs := make(map[string]*ModelCatalog, len(catalogs))
+	for _, catalog := range catalogs {
+		newModelCatalogs[catalog.ModelName] = catalog
+	}
+	modelCatalogsLock.Lock()
+	modelCatalogs = newModelCatalogs
+	modelCatalogsLock.Unlock()
+}
+
+func SyncModelCatalogCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		common.SysLog("syncing model catalog from database")
+		InitModelCatalogCache()
+	}
+}
+
+// GetModelCatalog 从缓存中查找模型的目录条目，返回副本
+func GetModelCatalog(modelName string) (*ModelCatalog, bool) {
+	modelCatalogsLock.RLock()
+	defer modelCatalogsLock.RUnlock()
+	catalog, ok := modelCatalogs[modelName]
+	if !ok {
+		return nil, false
+	}
+	cached := *catalog
+	return &cached, true
+}
+
+// GetModelMetadata 返回模型的展示元数据，未登记时返回 nil
+func GetModelMetadata(modelName string) *dto.ModelMetadata {
+	catalog, ok := GetModelCatalog(modelName)
+	if !ok {
+		return nil
+	}
+	return catalog.ToMetadata()
+}
+
+// GetModelLifecycle 返回模型当前的生命周期，未登记的模型视为 active
+func GetModelLifecycle(modelName string) (*ModelCatalog, string) {
+	catalog, ok := GetModelCatalog(modelName)
+	if !ok {
+		return nil, ModelLifecycleActive
+	}
+	return catalog, catalog.GetLifecycle()
+}
+
+// ResolveModelSuccessor 为已退役的模型沿后继链找到第一个未退役的模型，
+// 模型未退役时返回 false；已退役但没有可用后继时返回空字符串与 true
+func ResolveModelSuccessor(modelName string) (string, bool) {
+	catalog, lifecycle := GetModelLifecycle(modelName)
+	if lifecycle != ModelLifecycleRetired {
+		return "", false
+	}
+	visited := map[string]bool{modelName: true}
+	for i := 0; i < maxModelSuccessorDepth; i++ {
+		successor := catalog.ReplacementModel
+		if successor == "" || visited[successor] {
+			return "", true
+		}
+		visited[successor] = true
+		catalog, lifecycle = GetModelLifecycle(successor)
+		if lifecycle != ModelLifecycleRetired {
+			return successor, true
+		}
+	}
+	return "", true
+}
+
+// MarkModelCatalogNotified 记录发送弃用通知的时间
+func MarkModelCatalogNotified(id int) error {
+	now := common.GetTimestamp()
+	err := DB.Model(&ModelCatalog{}).Where("id = ?", id).Update("notified_time", now).Error
+	if err != nil {
+		return err
+	}
+	modelCatalogsLock.Lock()
+	for _, catalog := range modelCatalogs {
+		if catalog.Id == id {
+			catalog.NotifiedTime = now
+		}
+	}
+	modelCatalogsLock.Unlock()
+	return nil
+}
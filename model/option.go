@@ -24,6 +24,8 @@ import (
 	"veloera/setting"
 	"veloera/setting/config"
 	"veloera/setting/operation_setting"
+
+	"gorm.io/gorm"
 )
 
 type Option struct {
@@ -129,6 +131,7 @@ func InitOptionMap() {
 	common.OptionMap["ModelRatio"] = operation_setting.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = operation_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = operation_setting.CacheRatio2JSONString()
+	common.OptionMap["ModelPricingRules"] = operation_setting.PricingRules2JSONString()
 	common.OptionMap["GroupRatio"] = setting.GroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
 	common.OptionMap["CompletionRatio"] = operation_setting.CompletionRatio2JSONString()
@@ -150,6 +153,7 @@ func InitOptionMap() {
 	common.OptionMap["SelfUseModeEnabled"] = strconv.FormatBool(operation_setting.SelfUseModeEnabled)
 	common.OptionMap["ModelRequestRateLimitEnabled"] = strconv.FormatBool(setting.ModelRequestRateLimitEnabled)
 	common.OptionMap["CheckSensitiveOnPromptEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnPromptEnabled)
+	common.OptionMap["CheckSensitiveOnCompletionEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnCompletionEnabled)
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(setting.StopOnSensitiveEnabled)
 	common.OptionMap["SafeCheckExemptEnabled"] = strconv.FormatBool(setting.SafeCheckExemptEnabled)
 	common.OptionMap["SafeCheckExemptGroup"] = setting.SafeCheckExemptGroup
@@ -188,7 +192,12 @@ func InitOptionMap() {
 func loadOptionsFromDatabase() {
 	options, _ := AllOption()
 	for _, option := range options {
-		err := updateOptionMap(option.Key, option.Value)
+		value, err := decryptOptionValue(option)
+		if err != nil {
+			common.SysError(err.Error())
+			continue
+		}
+		err = updateOptionMap(option.Key, value)
 		if err != nil {
 			common.SysError("failed to update option map: " + err.Error())
 		}
@@ -205,24 +214,46 @@ func SyncOptions(frequency int) {
 
 func UpdateOption(key string, value string) error {
 	// Save to database first
+	if err := SaveOptionTx(DB, key, value); err != nil {
+		return err
+	}
+	return RefreshOption(key, value)
+}
+
+// SaveOptionTx 只在事务中写入选项，提交后需调用 RefreshOption 更新内存并通知其他节点
+func SaveOptionTx(tx *gorm.DB, key string, value string) error {
 	option := Option{
 		Key: key,
 	}
 	// https://gorm.io/docs/update.html#Save-All-Fields
-	DB.FirstOrCreate(&option, Option{Key: key})
-	option.Value = value
+	if err := tx.FirstOrCreate(&option, Option{Key: key}).Error; err != nil {
+		return err
+	}
+	storedValue, err := encryptOptionValue(key, value)
+	if err != nil {
+		return err
+	}
+	option.Value = storedValue
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
-	DB.Save(&option)
-	// Update OptionMap
-	return updateOptionMap(key, value)
+	return tx.Save(&option).Error
+}
+
+// RefreshOption 更新内存中的 OptionMap 并广播缓存事件
+func RefreshOption(key string, value string) error {
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	common.PublishCacheEvent(common.CacheEventOption, key)
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
 	common.OptionMapRWMutex.Lock()
 	defer common.OptionMapRWMutex.Unlock()
 	common.OptionMap[key] = value
+	value = resolveOptionValue(key, value)
 
 	// 检查是否是模型配置 - 使用更规范的方式处理
 	if handleConfigUpdate(key, value) {
@@ -324,6 +355,8 @@ func updateOptionMap(key string, value string) (err error) {
 			operation_setting.SelfUseModeEnabled = boolValue
 		case "CheckSensitiveOnPromptEnabled":
 			setting.CheckSensitiveOnPromptEnabled = boolValue
+		case "CheckSensitiveOnCompletionEnabled":
+			setting.CheckSensitiveOnCompletionEnabled = boolValue
 		case "ModelRequestRateLimitEnabled":
 			setting.ModelRequestRateLimitEnabled = boolValue
 		case "StopOnSensitiveEnabled":
@@ -444,6 +477,8 @@ func updateOptionMap(key string, value string) (err error) {
 		err = operation_setting.UpdateModelPriceByJSONString(value)
 	case "CacheRatio":
 		err = operation_setting.UpdateCacheRatioByJSONString(value)
+	case "ModelPricingRules":
+		err = operation_setting.UpdatePricingRulesByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	//case "ChatLink":
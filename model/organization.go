@@ -0,0 +1,594 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"veloera/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrgStatusEnabled  = 1
+	OrgStatusDisabled = 2
+)
+
+// 组织内成员角色
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+const (
+	OrgInvitationPending  = 1
+	OrgInvitationAccepted = 2
+	OrgInvitationRevoked  = 3
+)
+
+// Organization 组织拥有独立的额度池，成员使用组织令牌时从额度池扣费
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	OwnerId     int    `json:"owner_id" gorm:"index"`
+	Quota       int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// OrgMember QuotaLimit 为成员可从额度池累计消费的上限，0 表示不限；UsedQuota 可由管理员清零以开始新的周期
+type OrgMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_member"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_member;index"`
+	Role        string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit  int    `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+type OrgInvitation struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"index"`
+	Email       string `json:"email" gorm:"type:varchar(64);index"`
+	Role        string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit  int    `json:"quota_limit" gorm:"type:int;default:0"`
+	Code        string `json:"-" gorm:"type:char(32);uniqueIndex"`
+	InviterId   int    `json:"inviter_id"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	ExpiredTime int64  `json:"expired_time" gorm:"bigint"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// OrgFunding 记录每个用户累计划入组织额度池的额度，与成员关系独立保存，成员被移出后仍保留，用于删除组织时按比例退款
+type OrgFunding struct {
+	Id          int   `json:"id"`
+	OrgId       int   `json:"org_id" gorm:"uniqueIndex:idx_org_funding"`
+	UserId      int   `json:"user_id" gorm:"uniqueIndex:idx_org_funding;index"`
+	Quota       int   `json:"quota" gorm:"type:int;default:0"`
+	UpdatedTime int64 `json:"updated_time" gorm:"bigint"`
+}
+
+// UserOrganization 用户所在组织及其在组织内的角色
+type UserOrganization struct {
+	Organization
+	Role       string `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+	MemberUsed int    `json:"member_used_quota"`
+}
+
+type OrgMemberDetail struct {
+	OrgMember
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+}
+
+// OrgUsageReport 按成员与模型汇总的组织用量，数据来自 quota_data
+type OrgUsageReport struct {
+	UserId    int    `json:"user_id" gorm:"column:user_id"`
+	Username  string `json:"username"`
+	ModelName string `json:"model_name"`
+	Count     int    `json:"count"`
+	Quota     int    `json:"quota"`
+	TokenUsed int    `json:"token_used"`
+}
+
+func IsValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+// CanManage 组织所有者和管理员可以管理成员、邀请与额度
+func (member *OrgMember) CanManage() bool {
+	return member.Role == OrgRoleOwner || member.Role == OrgRoleAdmin
+}
+
+func CreateOrganization(org *Organization, ownerId int) error {
+	now := common.GetTimestamp()
+	org.OwnerId = ownerId
+	org.Quota = 0
+	org.UsedQuota = 0
+	org.Status = OrgStatusEnabled
+	org.CreatedTime = now
+	org.UpdatedTime = now
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrgMember{
+			OrgId:       org.Id,
+			UserId:      ownerId,
+			Role:        OrgRoleOwner,
+			CreatedTime: now,
+		}).Error
+	})
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetUserOrganizations(userId int) ([]*UserOrganization, error) {
+	var orgs []*UserOrganization
+	err := DB.Table("organizations").
+		Select("organizations.*, org_members.role AS role, org_members.quota_limit AS quota_limit, org_members.used_quota AS member_used").
+		Joins("JOIN org_members ON org_members.org_id = organizations.id").
+		Where("org_members.user_id = ?", userId).
+		Order("organizations.id asc").
+		Scan(&orgs).Error
+	return orgs, err
+}
+
+func GetAllOrganizations(keyword string, startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func (org *Organization) Update() error {
+	org.UpdatedTime = common.GetTimestamp()
+	return DB.Model(&Organization{}).Where("id = ?", org.Id).Updates(map[string]interface{}{
+		"name":         org.Name,
+		"description":  org.Description,
+		"status":       org.Status,
+		"updated_time": org.UpdatedTime,
+	}).Error
+}
+
+// orgPoolRefunds 按各用户的累计划转额度分配额度池余额：额度池未被消耗完时每人最多退回自己划入的额度，
+// 已被消耗时按划转比例分摊；剩余部分（管理员直接调整的额度与取整误差）退回所有者
+func orgPoolRefunds(pool int, ownerId int, fundings []OrgFunding) map[int]int {
+	refunds := make(map[int]int)
+	if pool <= 0 {
+		return refunds
+	}
+	total := 0
+	for _, funding := range fundings {
+		if funding.Quota > 0 {
+			total += funding.Quota
+		}
+	}
+	base := total
+	if pool > base {
+		base = pool
+	}
+	remaining := pool
+	for _, funding := range fundings {
+		if funding.Quota <= 0 || funding.UserId == ownerId {
+			continue
+		}
+		refund := int(int64(pool) * int64(funding.Quota) / int64(base))
+		if refund <= 0 {
+			continue
+		}
+		refunds[funding.UserId] += refund
+		remaining -= refund
+	}
+	if remaining > 0 {
+		refunds[ownerId] += remaining
+	}
+	return refunds
+}
+
+// DeleteOrganization 删除组织，额度池剩余额度按划转比例退回各出资用户，组织令牌一并禁用
+func DeleteOrganization(id int) error {
+	var refunds map[int]int
+	var tokenKeys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var org Organization
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&org, "id = ?", id).Error; err != nil {
+			return err
+		}
+		var fundings []OrgFunding
+		if err := tx.Where("org_id = ?", id).Order("id asc").Find(&fundings).Error; err != nil {
+			return err
+		}
+		refunds = orgPoolRefunds(org.Quota, org.OwnerId, fundings)
+		for userId, refund := range refunds {
+			if err := tx.Model(&User{}).Where("id = ?", userId).
+				Update("quota", gorm.Expr("quota + ?", refund)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&Token{}).Where("org_id = ?", id).Pluck("key", &tokenKeys).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Token{}).Where("org_id = ?", id).Update("status", common.TokenStatusDisabled).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("org_id = ?", id).Delete(&OrgInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("org_id = ?", id).Delete(&OrgMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("org_id = ?", id).Delete(&OrgFunding{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&org).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateTokenCaches(tokenKeys)
+	for userId, refund := range refunds {
+		userId, refund := userId, refund
+		gopool.Go(func() {
+			if cacheErr := cacheIncrUserQuota(userId, int64(refund)); cacheErr != nil {
+				common.SysError("failed to increase user quota: " + cacheErr.Error())
+			}
+		})
+		RecordLog(userId, LogTypeSystem, fmt.Sprintf("组织 %d 已删除，退回额度池余额 %s", id, common.LogQuota(refund)))
+	}
+	return nil
+}
+
+func GetOrgMember(orgId int, userId int) (*OrgMember, error) {
+	var member OrgMember
+	err := DB.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("不是该组织的成员")
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrgMembers(orgId int) ([]*OrgMemberDetail, error) {
+	var members []*OrgMemberDetail
+	err := DB.Table("org_members").
+		Select("org_members.*, users.username AS username, users.display_name AS display_name, users.email AS email").
+		Joins("LEFT JOIN users ON users.id = org_members.user_id").
+		Where("org_members.org_id = ?", orgId).
+		Order("org_members.id asc").
+		Scan(&members).Error
+	return members, err
+}
+
+func GetOrgMemberCount(orgId int) (int64, error) {
+	var count int64
+	err := DB.Model(&OrgMember{}).Where("org_id = ?", orgId).Count(&count).Error
+	return count, err
+}
+
+// UpdateOrgMember 更新成员角色与消费上限，resetUsed 为 true 时清零已用额度
+func UpdateOrgMember(member *OrgMember, resetUsed bool) error {
+	updates := map[string]interface{}{
+		"role":        member.Role,
+		"quota_limit": member.QuotaLimit,
+	}
+	if resetUsed {
+		updates["used_quota"] = 0
+		member.UsedQuota = 0
+	}
+	return DB.Model(&OrgMember{}).Where("id = ?", member.Id).Updates(updates).Error
+}
+
+// RemoveOrgMember 移出成员并禁用其在该组织下的令牌
+func RemoveOrgMember(orgId int, userId int) error {
+	var tokenKeys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		tokens := tx.Model(&Token{}).Where("org_id = ? AND user_id = ?", orgId, userId)
+		if err := tokens.Session(&gorm.Session{}).Pluck("key", &tokenKeys).Error; err != nil {
+			return err
+		}
+		if err := tokens.Session(&gorm.Session{}).Update("status", common.TokenStatusDisabled).Error; err != nil {
+			return err
+		}
+		return tx.Where("org_id = ? AND user_id = ?", orgId, userId).Delete(&OrgMember{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateTokenCaches(tokenKeys)
+	return nil
+}
+
+// FundOrganization 成员将个人余额划入组织额度池
+func FundOrganization(orgId int, userId int, amount int) error {
+	if amount <= 0 {
+		return errors.New("额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var quota int
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&User{}).
+			Where("id = ?", userId).Select("quota").Take(&quota).Error; err != nil {
+			return err
+		}
+		if quota < amount {
+			return fmt.Errorf("个人余额不足，当前余额：%s", common.FormatQuota(quota))
+		}
+		if err := tx.Model(&User{}).Where("id = ?", userId).
+			Update("quota", gorm.Expr("quota - ?", amount)).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("组织不存在")
+		}
+		// 记录出资额度，删除组织时据此退款
+		var funding OrgFunding
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("org_id = ? AND user_id = ?", orgId, userId).Take(&funding).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&OrgFunding{
+				OrgId:       orgId,
+				UserId:      userId,
+				Quota:       amount,
+				UpdatedTime: common.GetTimestamp(),
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&OrgFunding{}).Where("id = ?", funding.Id).Updates(map[string]interface{}{
+			"quota":        gorm.Expr("quota + ?", amount),
+			"updated_time": common.GetTimestamp(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	gopool.Go(func() {
+		if cacheErr := cacheDecrUserQuota(userId, int64(amount)); cacheErr != nil {
+			common.SysError("failed to decrease user quota: " + cacheErr.Error())
+		}
+	})
+	return nil
+}
+
+// SetOrganizationQuota 系统管理员直接调整组织额度池
+func SetOrganizationQuota(orgId int, quota int) error {
+	return DB.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+		"quota":        quota,
+		"updated_time": common.GetTimestamp(),
+	}).Error
+}
+
+func orgMemberRemaining(member *OrgMember) (remaining int, limited bool) {
+	if member.QuotaLimit <= 0 {
+		return 0, false
+	}
+	return member.QuotaLimit - member.UsedQuota, true
+}
+
+// GetOrgAvailableQuota 返回成员当前可从组织额度池消费的额度，受额度池余额与成员上限共同约束
+func GetOrgAvailableQuota(orgId int, userId int) (int, error) {
+	org, err := GetOrganizationById(orgId)
+	if err != nil {
+		return 0, err
+	}
+	if org.Status != OrgStatusEnabled {
+		return 0, errors.New("组织已被禁用")
+	}
+	member, err := GetOrgMember(orgId, userId)
+	if err != nil {
+		return 0, err
+	}
+	available := org.Quota
+	if remaining, limited := orgMemberRemaining(member); limited && remaining < available {
+		available = remaining
+	}
+	return available, nil
+}
+
+// ConsumeOrgQuota 与 ConsumeUserQuota 对应，从组织额度池扣费并累计成员用量
+func ConsumeOrgQuota(orgId int, userId int, amount int) (err error) {
+	if amount < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	if amount == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var org Organization
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&org, "id = ?", orgId).Error; err != nil {
+			return err
+		}
+		if org.Status != OrgStatusEnabled {
+			return errors.New("组织已被禁用")
+		}
+		var member OrgMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error; err != nil {
+			return errors.New("不是该组织的成员")
+		}
+		if org.Quota < amount {
+			return fmt.Errorf("organization quota is not enough, organization quota: %s, need quota: %s", common.FormatQuota(org.Quota), common.FormatQuota(amount))
+		}
+		if remaining, limited := orgMemberRemaining(&member); limited && remaining < amount {
+			return fmt.Errorf("organization member spend cap reached, remaining: %s, need quota: %s", common.FormatQuota(remaining), common.FormatQuota(amount))
+		}
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", amount),
+			"used_quota": gorm.Expr("used_quota + ?", amount),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OrgMember{}).Where("id = ?", member.Id).
+			Update("used_quota", gorm.Expr("used_quota + ?", amount)).Error
+	})
+}
+
+// RestoreOrgQuota 退回 ConsumeOrgQuota 扣除的额度，成员已被移出时只退回额度池
+func RestoreOrgQuota(orgId int, userId int, amount int) error {
+	if amount < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	if amount == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota + ?", amount),
+			"used_quota": gorm.Expr("used_quota - ?", amount),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OrgMember{}).Where("org_id = ? AND user_id = ?", orgId, userId).
+			Update("used_quota", gorm.Expr("used_quota - ?", amount)).Error
+	})
+}
+
+func CreateOrgInvitation(invitation *OrgInvitation) error {
+	invitation.Email = strings.ToLower(strings.TrimSpace(invitation.Email))
+	var count int64
+	err := DB.Model(&OrgInvitation{}).
+		Where("org_id = ? AND email = ? AND status = ? AND expired_time > ?", invitation.OrgId, invitation.Email, OrgInvitationPending, common.GetTimestamp()).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该邮箱已有待接受的邀请")
+	}
+	invitation.Code = common.GetUUID()
+	invitation.Status = OrgInvitationPending
+	invitation.CreatedTime = common.GetTimestamp()
+	return DB.Create(invitation).Error
+}
+
+func GetOrgInvitations(orgId int) ([]*OrgInvitation, error) {
+	var invitations []*OrgInvitation
+	err := DB.Where("org_id = ?", orgId).Order("id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func GetPendingOrgInvitationsByEmail(email string) ([]*OrgInvitation, error) {
+	var invitations []*OrgInvitation
+	if email == "" {
+		return invitations, nil
+	}
+	err := DB.Where("email = ? AND status = ? AND expired_time > ?", strings.ToLower(email), OrgInvitationPending, common.GetTimestamp()).
+		Order("id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func RevokeOrgInvitation(orgId int, id int) error {
+	result := DB.Model(&OrgInvitation{}).Where("id = ? AND org_id = ? AND status = ?", id, orgId, OrgInvitationPending).
+		Update("status", OrgInvitationRevoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("邀请不存在或已处理")
+	}
+	return nil
+}
+
+// AcceptOrgInvitation 接受邀请，要求接受者的邮箱与邀请邮箱一致
+func AcceptOrgInvitation(code string, user *User) (*OrgMember, error) {
+	var member *OrgMember
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var invitation OrgInvitation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&invitation).Error; err != nil {
+			return errors.New("邀请不存在")
+		}
+		if invitation.Status != OrgInvitationPending || invitation.ExpiredTime <= common.GetTimestamp() {
+			return errors.New("邀请已失效")
+		}
+		if user.Email == "" || !strings.EqualFold(user.Email, invitation.Email) {
+			return errors.New("邀请邮箱与当前账户绑定的邮箱不一致")
+		}
+		var count int64
+		if err := tx.Model(&OrgMember{}).Where("org_id = ? AND user_id = ?", invitation.OrgId, user.Id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("已经是该组织的成员")
+		}
+		member = &OrgMember{
+			OrgId:       invitation.OrgId,
+			UserId:      user.Id,
+			Role:        invitation.Role,
+			QuotaLimit:  invitation.QuotaLimit,
+			CreatedTime: common.GetTimestamp(),
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OrgInvitation{}).Where("id = ?", invitation.Id).Update("status", OrgInvitationAccepted).Error
+	})
+	return member, err
+}
+
+// GetOrgTokens 列出组织令牌，userId 为 0 时返回所有成员的令牌
+func GetOrgTokens(orgId int, userId int, startIdx int, num int) (tokens []*Token, total int64, err error) {
+	tx := DB.Model(&Token{}).Where("org_id = ?", orgId)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, total, err
+}
+
+func GetOrgUsageReport(orgId int, startTime int64, endTime int64) (reports []*OrgUsageReport, err error) {
+	err = DB.Table("quota_data").
+		Select("user_id, username, model_name, sum(count) as count, sum(quota) as quota, sum(token_used) as token_used").
+		Where("org_id = ? AND created_at >= ? AND created_at <= ?", orgId, startTime, endTime).
+		Group("user_id, username, model_name").
+		Order("quota desc").
+		Scan(&reports).Error
+	return reports, err
+}
@@ -0,0 +1,376 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"veloera/common"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PostpaidSettlementStatusPending = 1
+	PostpaidSettlementStatusSettled = 2
+)
+
+// PostpaidSettlement 后付费账户的账期结算记录
+type PostpaidSettlement struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_settlement_user_period,priority:1;not null"`
+	PeriodStart int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_settlement_user_period,priority:2"`
+	PeriodEnd   int64  `json:"period_end" gorm:"bigint"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`   // 账期内消费额度
+	Balance     int    `json:"balance" gorm:"type:int;default:0"`      // 结算时余额，负数表示透支
+	CreditLimit int    `json:"credit_limit" gorm:"type:int;default:0"` // 结算时的授信额度
+	PaidQuota   int    `json:"paid_quota" gorm:"type:int;default:0"`   // 账期内充值及兑换额度
+	AmountDue   int    `json:"amount_due" gorm:"type:int;default:0"`   // 应还额度，即账期内消费超出充值的部分
+	Restored    int    `json:"restored" gorm:"type:int;default:0"`     // 结清时实际恢复的透支额度
+	Status      int    `json:"status" gorm:"type:int;default:1;index"`
+	SettledTime int64  `json:"settled_time" gorm:"bigint"`
+	Remark      string `json:"remark" gorm:"type:varchar(255)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+// SetUserBillingMode 切换用户的预付费/后付费模式并设置授信额度
+func SetUserBillingMode(userId int, billingMode int, creditLimit int) error {
+	if billingMode != common.UserBillingModePrepaid && billingMode != common.UserBillingModePostpaid {
+		return errors.New("计费模式不合法")
+	}
+	if creditLimit < 0 {
+		return errors.New("授信额度不能为负数")
+	}
+	if billingMode == common.UserBillingModePrepaid {
+		creditLimit = 0
+	}
+	var user User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", userId).
+			Take(&user).Error; err != nil {
+			return errors.New("用户不存在")
+		}
+		if billingMode == common.UserBillingModePrepaid && user.Quota < 0 {
+			return fmt.Errorf("该用户仍有未结清的透支额度 %s，无法切换为预付费", common.LogQuota(-user.Quota))
+		}
+		if billingMode == common.UserBillingModePostpaid && user.Quota < -creditLimit {
+			return errors.New("授信额度不能低于当前已透支额度")
+		}
+		user.BillingMode = billingMode
+		user.CreditLimit = creditLimit
+		return tx.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+			"billing_mode": billingMode,
+			"credit_limit": creditLimit,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := refreshUserCache(user); err != nil {
+		common.SysError("failed to update user cache: " + err.Error())
+	}
+	return nil
+}
+
+// postpaidPeriodAmount 用户在账期内的消费与充值额度
+type postpaidPeriodAmount struct {
+	UsedQuota int
+	PaidQuota int
+}
+
+type postpaidUserQuota struct {
+	UserId int `gorm:"column:user_id"`
+	Quota  int `gorm:"column:quota"`
+}
+
+// loadPostpaidPeriodAmounts 统计账期 [start, end) 内各用户的消费与充值额度，结果只取决于账期内的记录。
+// 每个数据源按用户分组查询一次，归档也只读取一遍；userId 为 0 时统计所有用户
+func loadPostpaidPeriodAmounts(start int64, end int64, userId int) (map[int]*postpaidPeriodAmount, error) {
+	amounts := make(map[int]*postpaidPeriodAmount)
+	amountOf := func(id int) *postpaidPeriodAmount {
+		amount := amounts[id]
+		if amount == nil {
+			amount = &postpaidPeriodAmount{}
+			amounts[id] = amount
+		}
+		return amount
+	}
+	byUser := func(tx *gorm.DB, column string) *gorm.DB {
+		if userId != 0 {
+			return tx.Where(column+" = ?", userId)
+		}
+		return tx
+	}
+
+	var used []postpaidUserQuota
+	err := byUser(LOG_DB.Table("logs"), "user_id").
+		Select("user_id, COALESCE(sum(quota), 0) as quota").
+		Where("type = ? and created_at >= ? and created_at < ?", LogTypeConsume, start, end).
+		Group("user_id").
+		Scan(&used).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range used {
+		amountOf(row.UserId).UsedQuota += row.Quota
+	}
+	err = ScanArchivedLogs(start, end, func(log *Log) {
+		if log.Type == LogTypeConsume && (userId == 0 || log.UserId == userId) {
+			amountOf(log.UserId).UsedQuota += log.Quota
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 充值与兑换的口径与 getStatementCredits 一致
+	var topUps []struct {
+		UserId int
+		Amount int64
+	}
+	err = byUser(DB.Model(&TopUp{}), "user_id").
+		Select("user_id, amount").
+		Where("status = ? and create_time >= ? and create_time < ?", "success", start, end).
+		Scan(&topUps).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range topUps {
+		amountOf(topUp.UserId).PaidQuota += int(float64(topUp.Amount) * common.QuotaPerUnit)
+	}
+	var redeemed []postpaidUserQuota
+	err = byUser(DB.Unscoped().Model(&Redemption{}), "used_user_id").
+		Select("used_user_id as user_id, COALESCE(sum(quota), 0) as quota").
+		Where("used_user_id <> 0 and is_gift = ? and redeemed_time >= ? and redeemed_time < ?", false, start, end).
+		Group("used_user_id").
+		Scan(&redeemed).Error
+	if err != nil {
+		return nil, err
+	}
+	var gifts []postpaidUserQuota
+	err = byUser(DB.Table("redemption_logs"), "redemption_logs.user_id").
+		Select("redemption_logs.user_id as user_id, COALESCE(sum(redemptions.quota), 0) as quota").
+		Joins("left join redemptions on redemptions.id = redemption_logs.redemption_id").
+		Where("redemption_logs.used_time >= ? and redemption_logs.used_time < ?", start, end).
+		Group("redemption_logs.user_id").
+		Scan(&gifts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, rows := range [][]postpaidUserQuota{redeemed, gifts} {
+		for _, row := range rows {
+			amountOf(row.UserId).PaidQuota += row.Quota
+		}
+	}
+	return amounts, nil
+}
+
+// CreatePostpaidSettlement 为用户生成指定账期的结算单，同一账期重复调用返回已有记录
+func CreatePostpaidSettlement(userId int, start int64, end int64) (*PostpaidSettlement, error) {
+	existing, err := getPostpaidSettlement(userId, start)
+	if existing != nil || err != nil {
+		return existing, err
+	}
+	amounts, err := loadPostpaidPeriodAmounts(start, end, userId)
+	if err != nil {
+		return nil, err
+	}
+	return createPostpaidSettlement(userId, start, end, amounts[userId])
+}
+
+// getPostpaidSettlement 返回用户在该账期已生成的结算单，不存在时返回 nil
+func getPostpaidSettlement(userId int, start int64) (*PostpaidSettlement, error) {
+	var existing PostpaidSettlement
+	err := DB.Where("user_id = ? and period_start = ?", userId, start).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+func createPostpaidSettlement(userId int, start int64, end int64, amount *postpaidPeriodAmount) (*PostpaidSettlement, error) {
+	if amount == nil {
+		amount = &postpaidPeriodAmount{}
+	}
+	var user User
+	if err := DB.Select("id", "quota", "subscription_quota", "billing_mode", "credit_limit").
+		Where("id = ?", userId).Take(&user).Error; err != nil {
+		return nil, err
+	}
+	usedQuota, paidQuota := amount.UsedQuota, amount.PaidQuota
+	settlement := &PostpaidSettlement{
+		UserId:      userId,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		UsedQuota:   usedQuota,
+		PaidQuota:   paidQuota,
+		Balance:     user.Quota + user.SubscriptionQuota,
+		CreditLimit: user.CreditLimit,
+		Status:      PostpaidSettlementStatusPending,
+		CreatedTime: common.GetTimestamp(),
+	}
+	// 应还额度只计本账期的增量，避免跨账期累计的透支被重复计入
+	if usedQuota > paidQuota {
+		settlement.AmountDue = usedQuota - paidQuota
+	}
+	if settlement.AmountDue == 0 {
+		// 无需还款的账期直接标记为已结清
+		settlement.Status = PostpaidSettlementStatusSettled
+		settlement.SettledTime = settlement.CreatedTime
+	}
+	if err := DB.Create(settlement).Error; err != nil {
+		return nil, err
+	}
+	RecordLog(userId, LogTypeSystem, fmt.Sprintf("后付费账期 %s 结算：消费 %s，充值 %s，应还 %s",
+		time.Unix(start, 0).Format("2006-01"), common.LogQuota(usedQuota), common.LogQuota(paidQuota), common.LogQuota(settlement.AmountDue)))
+	return settlement, nil
+}
+
+// RunPostpaidSettlement 为所有后付费账户生成指定账期的结算单，账期数据在循环前统一统计一次
+func RunPostpaidSettlement(start int64, end int64) (count int, err error) {
+	var userIds []int
+	err = DB.Model(&User{}).Where("billing_mode = ?", common.UserBillingModePostpaid).Pluck("id", &userIds).Error
+	if err != nil {
+		return 0, err
+	}
+	var settledUserIds []int
+	err = DB.Model(&PostpaidSettlement{}).Where("period_start = ?", start).Pluck("user_id", &settledUserIds).Error
+	if err != nil {
+		return 0, err
+	}
+	settled := make(map[int]bool, len(settledUserIds))
+	for _, userId := range settledUserIds {
+		settled[userId] = true
+	}
+	pending := make([]int, 0, len(userIds))
+	for _, userId := range userIds {
+		if settled[userId] {
+			count++
+		} else {
+			pending = append(pending, userId)
+		}
+	}
+	// 定时任务每小时执行，所有结算单都已生成时不再读取归档
+	if len(pending) == 0 {
+		return count, nil
+	}
+	amounts, err := loadPostpaidPeriodAmounts(start, end, 0)
+	if err != nil {
+		return count, err
+	}
+	for _, userId := range pending {
+		if _, err := createPostpaidSettlement(userId, start, end, amounts[userId]); err != nil {
+			common.SysError(fmt.Sprintf("failed to create postpaid settlement for user %d: %s", userId, err.Error()))
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// AutoPostpaidSettlement 定期检查并生成上一自然月的结算单
+func AutoPostpaidSettlement() {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysLog(fmt.Sprintf("AutoPostpaidSettlement panic: %v", r))
+		}
+	}()
+	for {
+		if operation_setting.GetPostpaidSetting().AutoSettlementEnabled {
+			now := time.Now()
+			end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+			start := end.AddDate(0, -1, 0)
+			count, err := RunPostpaidSettlement(start.Unix(), end.Unix())
+			if err != nil {
+				common.SysError("failed to run postpaid settlement: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("postpaid settlement checked for %d users", count))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// SettlePostpaidSettlement 管理员确认收到还款，恢复用户透支额度
+// 恢复额度不超过用户当前的透支额度，透支已通过充值还清时仅标记为已结清
+func SettlePostpaidSettlement(id int, remark string) (*PostpaidSettlement, error) {
+	var settlement PostpaidSettlement
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).
+			Take(&settlement).Error; err != nil {
+			return errors.New("结算单不存在")
+		}
+		if settlement.Status != PostpaidSettlementStatusPending {
+			return errors.New("该结算单已结清")
+		}
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota").
+			Where("id = ?", settlement.UserId).
+			Take(&user).Error; err != nil {
+			return errors.New("用户不存在")
+		}
+		settlement.Restored = 0
+		if user.Quota < 0 && settlement.AmountDue > 0 {
+			settlement.Restored = min(settlement.AmountDue, -user.Quota)
+			if err := tx.Model(&User{}).Where("id = ?", settlement.UserId).
+				Update("quota", gorm.Expr("quota + ?", settlement.Restored)).Error; err != nil {
+				return err
+			}
+		}
+		settlement.Status = PostpaidSettlementStatusSettled
+		settlement.SettledTime = common.GetTimestamp()
+		settlement.Remark = remark
+		return tx.Model(&settlement).Select("status", "settled_time", "remark", "restored").Updates(&settlement).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if settlement.Restored > 0 {
+		gopool.Go(func() {
+			if cacheErr := cacheIncrUserQuota(settlement.UserId, int64(settlement.Restored)); cacheErr != nil {
+				common.SysError("failed to increase user quota cache: " + cacheErr.Error())
+			}
+		})
+	}
+	RecordLog(settlement.UserId, LogTypeManage, fmt.Sprintf("后付费账期 %s 已结清，应还 %s，恢复透支额度 %s",
+		time.Unix(settlement.PeriodStart, 0).Format("2006-01"), common.LogQuota(settlement.AmountDue), common.LogQuota(settlement.Restored)))
+	return &settlement, nil
+}
+
+func GetPostpaidSettlements(userId int, status int, startIdx int, num int) (settlements []*PostpaidSettlement, total int64, err error) {
+	tx := DB.Model(&PostpaidSettlement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != 0 {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&settlements).Error
+	return settlements, total, err
+}
@@ -20,17 +20,20 @@ import (
 	"sync"
 	"time"
 	"veloera/common"
+	"veloera/dto"
 	"veloera/setting/operation_setting"
 )
 
 type Pricing struct {
-	ModelName       string   `json:"model_name"`
-	QuotaType       int      `json:"quota_type"`
-	ModelRatio      float64  `json:"model_ratio"`
-	ModelPrice      float64  `json:"model_price"`
-	OwnerBy         string   `json:"owner_by"`
-	CompletionRatio float64  `json:"completion_ratio"`
-	EnableGroup     []string `json:"enable_groups,omitempty"`
+	ModelName       string                          `json:"model_name"`
+	QuotaType       int                             `json:"quota_type"`
+	ModelRatio      float64                         `json:"model_ratio"`
+	ModelPrice      float64                         `json:"model_price"`
+	OwnerBy         string                          `json:"owner_by"`
+	CompletionRatio float64                         `json:"completion_ratio"`
+	EnableGroup     []string                        `json:"enable_groups,omitempty"`
+	PricingRules    []operation_setting.PricingRule `json:"pricing_rules,omitempty"`
+	*dto.ModelMetadata
 }
 
 var (
@@ -78,8 +81,9 @@ func updatePricing() {
 	pricingMap = make([]Pricing, 0)
 	for model, groups := range modelGroupsMap {
 		pricing := Pricing{
-			ModelName:   model,
-			EnableGroup: groups,
+			ModelName:    model,
+			EnableGroup:  groups,
+			PricingRules: operation_setting.GetPricingRulesForModel(model),
 		}
 		modelPrice, findPrice := operation_setting.GetModelPriceWithFallback(model, false)
 		if findPrice {
@@ -0,0 +1,325 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"veloera/common"
+)
+
+// 内置角色名称，与 User.Role 的旧整数等级一一对应
+const (
+	RoleNameCommon = "common"
+	RoleNameAdmin  = "admin"
+	RoleNameRoot   = "root"
+)
+
+type Role struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	DisplayName string `json:"display_name" gorm:"type:varchar(64)"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Permissions string `json:"permissions" gorm:"type:text"` // JSON 数组
+	Builtin     bool   `json:"builtin" gorm:"default:false"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// builtinRoles 内置角色的初始权限，保持与原 AdminAuth/RootAuth 相同的访问范围
+var builtinRoles = []Role{
+	{
+		Name:        RoleNameCommon,
+		DisplayName: "普通用户",
+		Description: "无管理权限",
+	},
+	{
+		Name:        RoleNameAdmin,
+		DisplayName: "管理员",
+		Description: "可管理渠道、用户、日志、兑换码、套餐与消息，不含系统设置",
+	},
+	{
+		Name:        RoleNameRoot,
+		DisplayName: "超级管理员",
+		Description: "拥有全部权限",
+	},
+}
+
+var builtinRolePermissions = map[string][]string{
+	RoleNameCommon: {},
+	RoleNameAdmin: {
+		common.PermissionChannelsRead,
+		common.PermissionChannelsWrite,
+		common.PermissionUsersRead,
+		common.PermissionUsersManage,
+		common.PermissionLogsRead,
+		common.PermissionLogsDelete,
+		common.PermissionBillingRead,
+		common.PermissionBillingManage,
+		common.PermissionBillingRefund,
+		common.PermissionRedemptionsRead,
+		common.PermissionRedemptionsWrite,
+		common.PermissionPlansRead,
+		common.PermissionPlansWrite,
+		common.PermissionModelsRead,
+		common.PermissionModelsWrite,
+		common.PermissionMessagesRead,
+		common.PermissionMessagesWrite,
+		common.PermissionTasksRead,
+	},
+	RoleNameRoot: {common.PermissionAll},
+}
+
+var (
+	rolePermissions     = make(map[string][]string)
+	rolePermissionsLock sync.RWMutex
+)
+
+func (role *Role) GetPermissions() []string {
+	permissions := make([]string, 0)
+	if role.Permissions == "" {
+		return permissions
+	}
+	if err := json.Unmarshal([]byte(role.Permissions), &permissions); err != nil {
+		common.SysError(fmt.Sprintf("failed to unmarshal permissions of role %s: %s", role.Name, err.Error()))
+	}
+	return permissions
+}
+
+func (role *Role) SetPermissions(permissions []string) error {
+	for _, p := range permissions {
+		if !common.IsValidPermission(p) {
+			return fmt.Errorf("无效的权限：%s", p)
+		}
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = string(data)
+	return nil
+}
+
+// LegacyRoleName 返回旧整数等级对应的内置角色
+func LegacyRoleName(role int) string {
+	switch {
+	case role >= common.RoleRootUser:
+		return RoleNameRoot
+	case role >= common.RoleAdminUser:
+		return RoleNameAdmin
+	default:
+		return RoleNameCommon
+	}
+}
+
+// seedBuiltinRoles 补齐缺失的内置角色，已存在的不覆盖，以保留管理员的调整
+func seedBuiltinRoles() error {
+	for _, builtin := range builtinRoles {
+		var count int64
+		if err := DB.Model(&Role{}).Where("name = ?", builtin.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		role := builtin
+		role.Builtin = true
+		if err := role.SetPermissions(builtinRolePermissions[role.Name]); err != nil {
+			return err
+		}
+		if err := role.Insert(); err != nil {
+			return err
+		}
+		common.SysLog("created builtin role: " + role.Name)
+	}
+	return nil
+}
+
+func GetAllRoles() ([]*Role, error) {
+	var roles []*Role
+	err := DB.Order("builtin desc, id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetRoleById(id int) (*Role, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var role Role
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+func GetRoleByName(name string) (*Role, error) {
+	if name == "" {
+		return nil, errors.New("角色名称为空")
+	}
+	var role Role
+	err := DB.First(&role, "name = ?", name).Error
+	return &role, err
+}
+
+func (role *Role) Insert() error {
+	now := common.GetTimestamp()
+	role.CreatedTime = now
+	role.UpdatedTime = now
+	if err := DB.Create(role).Error; err != nil {
+		return err
+	}
+	setRolePermissionsCache(role.Name, role.GetPermissions())
+	common.PublishCacheEvent(common.CacheEventRole, "")
+	return nil
+}
+
+// Update 只更新展示信息与权限，名称一经创建不可修改；超级管理员角色的权限固定为全部
+func (role *Role) Update() error {
+	if role.Builtin && role.Name == RoleNameRoot {
+		if err := role.SetPermissions(builtinRolePermissions[RoleNameRoot]); err != nil {
+			return err
+		}
+	}
+	role.UpdatedTime = common.GetTimestamp()
+	err := DB.Model(&Role{}).Where("id = ?", role.Id).Updates(map[string]interface{}{
+		"display_name": role.DisplayName,
+		"description":  role.Description,
+		"permissions":  role.Permissions,
+		"updated_time": role.UpdatedTime,
+	}).Error
+	if err != nil {
+		return err
+	}
+	setRolePermissionsCache(role.Name, role.GetPermissions())
+	common.PublishCacheEvent(common.CacheEventRole, "")
+	return nil
+}
+
+func (role *Role) Delete() error {
+	if role.Builtin {
+		return errors.New("内置角色不可删除")
+	}
+	var count int64
+	if err := DB.Model(&User{}).Where("role_name = ?", role.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("仍有 %d 个用户使用该角色，请先调整这些用户的角色", count)
+	}
+	if err := DB.Delete(role).Error; err != nil {
+		return err
+	}
+	rolePermissionsLock.Lock()
+	delete(rolePermissions, role.Name)
+	rolePermissionsLock.Unlock()
+	common.PublishCacheEvent(common.CacheEventRole, "")
+	return nil
+}
+
+func setRolePermissionsCache(name string, permissions []string) {
+	rolePermissionsLock.Lock()
+	defer rolePermissionsLock.Unlock()
+	rolePermissions[name] = permissions
+}
+
+func InitRoleCache() {
+	roles, err := GetAllRoles()
+	if err != nil {
+		common.SysError("failed to load roles: " + err.Error())
+		return
+	}
+	newRolePermissions := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		newRolePermissions[role.Name] = role.GetPermissions()
+	}
+	rolePermissionsLock.Lock()
+	rolePermissions = newRolePermissions
+	rolePermissionsLock.Unlock()
+}
+
+func SyncRoleCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		common.SysLog("syncing roles from database")
+		InitRoleCache()
+	}
+}
+
+// GetRolePermissions 计算用户的有效权限：超级管理员始终拥有全部权限，
+// 未分配角色或角色已不存在时回退到旧整数等级对应的内置角色
+func GetRolePermissions(role int, roleName string) []string {
+	if role >= common.RoleRootUser {
+		return builtinRolePermissions[RoleNameRoot]
+	}
+	rolePermissionsLock.RLock()
+	defer rolePermissionsLock.RUnlock()
+	if roleName != "" {
+		if permissions, ok := rolePermissions[roleName]; ok {
+			return permissions
+		}
+	}
+	legacy := LegacyRoleName(role)
+	if permissions, ok := rolePermissions[legacy]; ok {
+		return permissions
+	}
+	return builtinRolePermissions[legacy]
+}
+
+// HasPermissions 判断用户是否同时拥有全部所需权限
+func HasPermissions(role int, roleName string, required ...string) bool {
+	return PermissionsCover(GetRolePermissions(role, roleName), required)
+}
+
+// PermissionsCover 判断已授予的权限是否覆盖 required 中的每一项
+func PermissionsCover(granted []string, required []string) bool {
+	for _, r := range required {
+		matched := false
+		for _, g := range granted {
+			if common.MatchPermission(g, r) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// CanManagePermissions 判断操作者能否管理拥有 target 权限的用户：
+// 操作者的权限必须严格包含目标权限，同权限或不可比较的用户互相不可管理
+func CanManagePermissions(operator []string, target []string) bool {
+	return PermissionsCover(operator, target) && !PermissionsCover(target, operator)
+}
+
+// UpdateUserRoleName 为用户分配角色，传入空字符串表示回退到旧整数等级对应的内置角色
+func UpdateUserRoleName(userId int, roleName string) error {
+	if roleName != "" {
+		if _, err := GetRoleByName(roleName); err != nil {
+			return errors.New("角色不存在")
+		}
+	}
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("role_name", roleName).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"veloera/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// SecretSerializer 字段级的落库加密：写入时用主密钥加密，读取时解密，内存中始终为明文或外部引用
+type SecretSerializer struct{}
+
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case nil:
+	default:
+		return fmt.Errorf("unsupported secret value type %T", dbValue)
+	}
+	plaintext, err := common.DecryptSecret(value)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", field.DBName, err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	return common.EncryptSecret(value)
+}
+
+// encryptOptionValue 敏感选项落库前加密，其余选项原样返回
+func encryptOptionValue(key string, value string) (string, error) {
+	if !common.IsSecretOptionKey(key) {
+		return value, nil
+	}
+	return common.EncryptSecret(value)
+}
+
+// decryptOptionValue 解密数据库中的选项值，明文存储的历史数据原样返回
+func decryptOptionValue(option *Option) (string, error) {
+	value, err := common.DecryptSecret(option.Value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt option %s: %w", option.Key, err)
+	}
+	return value, nil
+}
+
+// resolveOptionValue 敏感选项支持 env:// 与 file:// 引用，选项表中保留引用本身，生效值在加载时解析
+func resolveOptionValue(key string, value string) string {
+	if !common.IsSecretOptionKey(key) || !common.IsSecretReference(value) {
+		return value
+	}
+	resolved, err := common.ResolveSecret(value)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to resolve option %s: %s", key, err.Error()))
+		return ""
+	}
+	return resolved
+}
+
+// GetKey 返回请求上游时使用的渠道密钥，env:// 与 file:// 引用在每次使用时解析，便于外部轮换
+func (channel *Channel) GetKey() string {
+	if !common.IsSecretReference(channel.Key) {
+		return channel.Key
+	}
+	key, err := common.ResolveSecret(channel.Key)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to resolve key of channel #%d: %s", channel.Id, err.Error()))
+		return ""
+	}
+	return key
+}
+
+// channelKeyHash 密钥的 HMAC，密钥加密存储后无法直接比较，按密钥搜索渠道时比较该值
+func channelKeyHash(key string) string {
+	if key == "" {
+		return ""
+	}
+	return common.GenerateHMAC("channel-key:" + key)
+}
+
+// BeforeSave 写入密钥时同步更新其 HMAC
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	if channel.Key != "" {
+		tx.Statement.SetColumn("KeyHash", channelKeyHash(channel.Key))
+	}
+	return nil
+}
+
+// SyncChannelKeyHashes 为历史渠道补全密钥 HMAC；未配置 CRYPTO_SECRET 时 HMAC 密钥每次启动都会变化，需要重新计算
+func SyncChannelKeyHashes() (int, error) {
+	var channels []*Channel
+	if err := DB.Select("id", "key", "key_hash").Find(&channels).Error; err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, channel := range channels {
+		hash := channelKeyHash(channel.Key)
+		if hash == channel.KeyHash {
+			continue
+		}
+		if err := DB.Model(&Channel{}).Where("id = ?", channel.Id).UpdateColumn("key_hash", hash).Error; err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// SecretStatus 落库密钥的加密情况
+type SecretStatus struct {
+	EncryptionEnabled bool           `json:"encryption_enabled"`
+	PrimaryKeyId      string         `json:"primary_key_id"`
+	Plaintext         int            `json:"plaintext"`  // 明文存储（不含外部引用）
+	References        int            `json:"references"` // 明文存储的外部引用
+	Encrypted         map[string]int `json:"encrypted"`  // 按主密钥标识统计的加密数量
+	NeedsRotation     int            `json:"needs_rotation"`
+}
+
+type storedSecret struct {
+	Id    int
+	Key   string
+	Value string
+}
+
+func (s *SecretStatus) count(value string) {
+	if value == "" {
+		return
+	}
+	if common.IsEncryptedSecret(value) {
+		s.Encrypted[common.SecretKeyId(value)]++
+	} else if common.IsSecretReference(value) {
+		s.References++
+	} else {
+		s.Plaintext++
+	}
+	if common.SecretNeedsRotation(value) {
+		s.NeedsRotation++
+	}
+}
+
+// 直接读取数据库中的原始值，绕过序列化器的解密
+func getStoredChannelKeys() ([]storedSecret, error) {
+	var rows []storedSecret
+	err := DB.Table("channels").Select("id, " + keyCol + " as value").Scan(&rows).Error
+	return rows, err
+}
+
+func getStoredSecretOptions() ([]storedSecret, error) {
+	var options []*Option
+	if err := DB.Find(&options).Error; err != nil {
+		return nil, err
+	}
+	var rows []storedSecret
+	for _, option := range options {
+		if common.IsSecretOptionKey(option.Key) {
+			rows = append(rows, storedSecret{Key: option.Key, Value: option.Value})
+		}
+	}
+	return rows, nil
+}
+
+// GetSecretStatus 统计渠道密钥与敏感选项的存储状态
+func GetSecretStatus() (*SecretStatus, error) {
+	status := &SecretStatus{
+		EncryptionEnabled: common.SecretEncryptionEnabled(),
+		PrimaryKeyId:      common.SecretPrimaryKeyId(),
+		Encrypted:         make(map[string]int),
+	}
+	channels, err := getStoredChannelKeys()
+	if err != nil {
+		return nil, err
+	}
+	options, err := getStoredSecretOptions()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range channels {
+		status.count(row.Value)
+	}
+	for _, row := range options {
+		status.count(row.Value)
+	}
+	return status, nil
+}
+
+// RotateSecrets 用当前主密钥重新加密明文存储或使用旧主密钥加密的渠道密钥与敏感选项，返回更新的条数
+func RotateSecrets() (int, error) {
+	if !common.SecretEncryptionEnabled() {
+		return 0, fmt.Errorf("SECRET_ENCRYPTION_KEY is not configured")
+	}
+	rotate := func(value string) (string, error) {
+		plaintext, err := common.DecryptSecret(value)
+		if err != nil {
+			return "", err
+		}
+		return common.EncryptSecret(plaintext)
+	}
+	rotated := 0
+	channels, err := getStoredChannelKeys()
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range channels {
+		if !common.SecretNeedsRotation(row.Value) {
+			continue
+		}
+		encrypted, err := rotate(row.Value)
+		if err != nil {
+			return rotated, fmt.Errorf("channel #%d: %w", row.Id, err)
+		}
+		if err = DB.Table("channels").Where("id = ?", row.Id).Update("key", encrypted).Error; err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	options, err := getStoredSecretOptions()
+	if err != nil {
+		return rotated, err
+	}
+	for _, row := range options {
+		if !common.SecretNeedsRotation(row.Value) {
+			continue
+		}
+		encrypted, err := rotate(row.Value)
+		if err != nil {
+			return rotated, fmt.Errorf("option %s: %w", row.Key, err)
+		}
+		if err = DB.Model(&Option{}).Where(&Option{Key: row.Key}).Update("value", encrypted).Error; err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"veloera/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// StatementLine 对账单中按维度聚合的一行
+type StatementLine struct {
+	Name             string `json:"name"`
+	Count            int    `json:"count"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int    `json:"quota"`
+}
+
+// StatementCredit 对账周期内的充值或兑换记录
+type StatementCredit struct {
+	Time        int64   `json:"time"`
+	Source      string  `json:"source"` // topup, redemption, gift
+	Reference   string  `json:"reference"`
+	Quota       int     `json:"quota"`
+	Money       float64 `json:"money"`
+	Description string  `json:"description"`
+}
+
+// BillingStatement 用户月度对账单
+type BillingStatement struct {
+	UserId           int               `json:"user_id"`
+	Username         string            `json:"username"`
+	DisplayName      string            `json:"display_name"`
+	Email            string            `json:"email"`
+	Period           string            `json:"period"`
+	StartTime        int64             `json:"start_time"`
+	EndTime          int64             `json:"end_time"`
+	GeneratedAt      int64             `json:"generated_at"`
+	TotalQuota       int               `json:"total_quota"`
+	TotalCount       int               `json:"total_count"`
+	PromptTokens     int               `json:"prompt_tokens"`
+	CompletionTokens int               `json:"completion_tokens"`
+	TopUpQuota       int               `json:"topup_quota"`
+	RedemptionQuota  int               `json:"redemption_quota"`
+	ByModel          []StatementLine   `json:"by_model"`
+	ByToken          []StatementLine   `json:"by_token"`
+	ByGroup          []StatementLine   `json:"by_group"`
+	Credits          []StatementCredit `json:"credits"`
+}
+
+// ParseStatementPeriod 解析 YYYY-MM 格式的账期，返回 [start, end) 的时间戳
+func ParseStatementPeriod(period string) (start int64, end int64, err error) {
+	if period == "" {
+		// 默认上一个自然月
+		now := time.Now()
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		prev := first.AddDate(0, -1, 0)
+		return prev.Unix(), first.Unix(), nil
+	}
+	t, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return 0, 0, errors.New("账期格式不正确，应为 YYYY-MM")
+	}
+	return t.Unix(), t.AddDate(0, 1, 0).Unix(), nil
+}
+
+func sumStatementLines(userId int, start int64, end int64, column string) (lines []StatementLine, err error) {
+	err = LOG_DB.Table("logs").
+		Select(column+" as name, count(*) as count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("user_id = ? and type = ? and created_at >= ? and created_at < ?", userId, LogTypeConsume, start, end).
+		// column 可能是已加引号的保留字（如 group），按原样写入 GROUP BY，避免 gorm 再次加引号
+		Clauses(clause.GroupBy{Columns: []clause.Column{{Name: column, Raw: true}}}).
+		Order("quota desc").
+		Scan(&lines).Error
+	return lines, err
+}
+
+// addStatementLine 将一条日志累加到对应名称的行
+func addStatementLine(lines []StatementLine, name string, log *Log) []StatementLine {
+	for i := range lines {
+		if lines[i].Name == name {
+			lines[i].Count++
+			lines[i].PromptTokens += log.PromptTokens
+			lines[i].CompletionTokens += log.CompletionTokens
+			lines[i].Quota += log.Quota
+			return lines
+		}
+	}
+	return append(lines, StatementLine{
+		Name:             name,
+		Count:            1,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		Quota:            log.Quota,
+	})
+}
+
+// statementArchiveLines 单个用户在归档日志中的消费聚合
+type statementArchiveLines struct {
+	ByModel []StatementLine
+	ByToken []StatementLine
+	ByGroup []StatementLine
+}
+
+// StatementArchiveUsage 账期内已归档日志按用户的聚合结果，批量导出时整个账期只读取一遍归档
+type StatementArchiveUsage struct {
+	lines   map[int]*statementArchiveLines
+	userIds map[int]bool // 归档中有消费或充值日志的用户
+}
+
+// LoadStatementArchiveUsage 读取一遍 [start, end) 内的归档，按用户聚合消费日志，userId 为 0 时聚合所有用户
+func LoadStatementArchiveUsage(start int64, end int64, userId int) (*StatementArchiveUsage, error) {
+	usage := &StatementArchiveUsage{
+		lines:   make(map[int]*statementArchiveLines),
+		userIds: make(map[int]bool),
+	}
+	err := ScanArchivedLogs(start, end, func(log *Log) {
+		if userId != 0 && log.UserId != userId {
+			return
+		}
+		if log.Type == LogTypeConsume || log.Type == LogTypeTopup {
+			usage.userIds[log.UserId] = true
+		}
+		if log.Type != LogTypeConsume {
+			return
+		}
+		lines := usage.lines[log.UserId]
+		if lines == nil {
+			lines = &statementArchiveLines{}
+			usage.lines[log.UserId] = lines
+		}
+		lines.ByModel = addStatementLine(lines.ByModel, log.ModelName, log)
+		lines.ByToken = addStatementLine(lines.ByToken, log.TokenName, log)
+		lines.ByGroup = addStatementLine(lines.ByGroup, log.Group, log)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// mergeStatementLines 将归档中聚合的行合并进在线日志的聚合结果
+func mergeStatementLines(lines []StatementLine, archived []StatementLine) []StatementLine {
+	for _, line := range archived {
+		merged := false
+		for i := range lines {
+			if lines[i].Name == line.Name {
+				lines[i].Count += line.Count
+				lines[i].PromptTokens += line.PromptTokens
+				lines[i].CompletionTokens += line.CompletionTokens
+				lines[i].Quota += line.Quota
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			lines = append(lines, line)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Quota > lines[j].Quota
+	})
+	return lines
+}
+
+// mergeArchivedStatementLines 将账期内已归档的消费日志合并进对账单
+func mergeArchivedStatementLines(statement *BillingStatement, archived *StatementArchiveUsage) {
+	lines := archived.lines[statement.UserId]
+	if lines == nil {
+		return
+	}
+	statement.ByModel = mergeStatementLines(statement.ByModel, lines.ByModel)
+	statement.ByToken = mergeStatementLines(statement.ByToken, lines.ByToken)
+	statement.ByGroup = mergeStatementLines(statement.ByGroup, lines.ByGroup)
+}
+
+// sumStatementLinesFromQuotaData 当消费日志关闭时，按模型回退到数据看板的小时聚合数据
+func sumStatementLinesFromQuotaData(userId int, start int64, end int64) (lines []StatementLine, err error) {
+	err = DB.Table("quota_data").
+		Select("model_name as name, sum(count) as count, sum(token_used) as prompt_tokens, 0 as completion_tokens, sum(quota) as quota").
+		Where("user_id = ? and created_at >= ? and created_at < ?", userId, start, end).
+		Group("model_name").
+		Order("quota desc").
+		Scan(&lines).Error
+	return lines, err
+}
+
+func getStatementCredits(userId int, start int64, end int64) ([]StatementCredit, error) {
+	credits := make([]StatementCredit, 0)
+
+	var topUps []*TopUp
+	err := DB.Where("user_id = ? and status = ? and create_time >= ? and create_time < ?", userId, "success", start, end).
+		Order("create_time asc").Find(&topUps).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range topUps {
+		credits = append(credits, StatementCredit{
+			Time:        topUp.CreateTime,
+			Source:      "topup",
+			Reference:   topUp.TradeNo,
+			Quota:       int(float64(topUp.Amount) * common.QuotaPerUnit),
+			Money:       topUp.Money,
+			Description: "Online top-up",
+		})
+	}
+
+	var redemptions []*Redemption
+	err = DB.Unscoped().Where("used_user_id = ? and is_gift = ? and redeemed_time >= ? and redeemed_time < ?", userId, false, start, end).
+		Order("redeemed_time asc").Find(&redemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, redemption := range redemptions {
+		credits = append(credits, StatementCredit{
+			Time:        redemption.RedeemedTime,
+			Source:      "redemption",
+			Reference:   fmt.Sprintf("#%d", redemption.Id),
+			Quota:       redemption.Quota,
+			Description: redemption.Name,
+		})
+	}
+
+	var gifts []struct {
+		RedemptionId int
+		UsedTime     int64
+		Name         string
+		Quota        int
+	}
+	err = DB.Table("redemption_logs").
+		Select("redemption_logs.redemption_id, redemption_logs.used_time, redemptions.name, redemptions.quota").
+		Joins("left join redemptions on redemptions.id = redemption_logs.redemption_id").
+		Where("redemption_logs.user_id = ? and redemption_logs.used_time >= ? and redemption_logs.used_time < ?", userId, start, end).
+		Order("redemption_logs.used_time asc").
+		Scan(&gifts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, gift := range gifts {
+		credits = append(credits, StatementCredit{
+			Time:        gift.UsedTime,
+			Source:      "gift",
+			Reference:   fmt.Sprintf("#%d", gift.RedemptionId),
+			Quota:       gift.Quota,
+			Description: gift.Name,
+		})
+	}
+	return credits, nil
+}
+
+// GenerateUserStatement 根据日志与数据看板数据生成指定账期的对账单
+func GenerateUserStatement(userId int, start int64, end int64) (*BillingStatement, error) {
+	archived, err := LoadStatementArchiveUsage(start, end, userId)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateUserStatementWithArchive(userId, start, end, archived)
+}
+
+// GenerateUserStatementWithArchive 使用预先聚合的归档数据生成对账单，供批量导出复用同一份归档聚合
+func GenerateUserStatementWithArchive(userId int, start int64, end int64, archived *StatementArchiveUsage) (*BillingStatement, error) {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	statement := &BillingStatement{
+		UserId:      user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Period:      time.Unix(start, 0).Format("2006-01"),
+		StartTime:   start,
+		EndTime:     end,
+		GeneratedAt: common.GetTimestamp(),
+	}
+
+	if statement.ByModel, err = sumStatementLines(userId, start, end, "model_name"); err != nil {
+		return nil, err
+	}
+	if statement.ByToken, err = sumStatementLines(userId, start, end, "token_name"); err != nil {
+		return nil, err
+	}
+	if statement.ByGroup, err = sumStatementLines(userId, start, end, groupCol); err != nil {
+		return nil, err
+	}
+	mergeArchivedStatementLines(statement, archived)
+	if len(statement.ByModel) == 0 && !common.LogConsumeEnabled {
+		if statement.ByModel, err = sumStatementLinesFromQuotaData(userId, start, end); err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range statement.ByModel {
+		statement.TotalQuota += line.Quota
+		statement.TotalCount += line.Count
+		statement.PromptTokens += line.PromptTokens
+		statement.CompletionTokens += line.CompletionTokens
+	}
+
+	if statement.Credits, err = getStatementCredits(userId, start, end); err != nil {
+		return nil, err
+	}
+	for _, credit := range statement.Credits {
+		if credit.Source == "topup" {
+			statement.TopUpQuota += credit.Quota
+		} else {
+			statement.RedemptionQuota += credit.Quota
+		}
+	}
+	return statement, nil
+}
+
+// GetStatementUserIds 返回账期内有消费、充值或兑换记录的用户，archived 中有日志的用户一并计入
+func GetStatementUserIds(start int64, end int64, archived *StatementArchiveUsage) ([]int, error) {
+	var logUserIds []int
+	err := LOG_DB.Table("logs").
+		Where("type in ? and created_at >= ? and created_at < ?", []int{LogTypeConsume, LogTypeTopup}, start, end).
+		Distinct("user_id").
+		Pluck("user_id", &logUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	// 充值与兑换不一定写入日志，按 getStatementCredits 的数据源补齐只有入账记录的用户
+	var topUpUserIds []int
+	err = DB.Model(&TopUp{}).
+		Where("status = ? and create_time >= ? and create_time < ?", "success", start, end).
+		Distinct("user_id").
+		Pluck("user_id", &topUpUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var redemptionUserIds []int
+	err = DB.Unscoped().Model(&Redemption{}).
+		Where("used_user_id <> 0 and is_gift = ? and redeemed_time >= ? and redeemed_time < ?", false, start, end).
+		Distinct("used_user_id").
+		Pluck("used_user_id", &redemptionUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var giftUserIds []int
+	err = DB.Table("redemption_logs").
+		Where("used_time >= ? and used_time < ?", start, end).
+		Distinct("user_id").
+		Pluck("user_id", &giftUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	for _, ids := range [][]int{logUserIds, topUpUserIds, redemptionUserIds, giftUserIds} {
+		for _, id := range ids {
+			seen[id] = true
+		}
+	}
+	for id := range archived.userIds {
+		seen[id] = true
+	}
+	userIds := make([]int, 0, len(seen))
+	for id := range seen {
+		userIds = append(userIds, id)
+	}
+	sort.Ints(userIds)
+	return userIds, nil
+}
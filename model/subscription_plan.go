@@ -19,7 +19,9 @@ package model
 import (
 	"errors"
 	"fmt"
+	"time"
 	"veloera/common"
+	"veloera/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -37,34 +39,40 @@ const (
 )
 
 type SubscriptionPlan struct {
-	Id           int            `json:"id"`
-	Name         string         `json:"name" gorm:"type:varchar(64);index;not null"`
-	Description  string         `json:"description" gorm:"type:text"`
-	Price        int            `json:"price" gorm:"type:int;default:0"`         // Deducted from user.quota
-	TotalQuota   int            `json:"total_quota" gorm:"type:int;default:0"`   // Added to user.subscription_quota
-	DailyQuota   int            `json:"daily_quota" gorm:"type:int;default:0"`   // For display and future daily-limit enforcement
-	DurationDays int            `json:"duration_days" gorm:"type:int;default:0"` // 0 means no expiration
-	Status       int            `json:"status" gorm:"type:int;default:1;index"`
-	SortOrder    int            `json:"sort_order" gorm:"type:int;default:0;index"`
-	CreatedTime  int64          `json:"created_time" gorm:"bigint;index"`
-	UpdatedTime  int64          `json:"updated_time" gorm:"bigint"`
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Id            int            `json:"id"`
+	Name          string         `json:"name" gorm:"type:varchar(64);index;not null"`
+	Description   string         `json:"description" gorm:"type:text"`
+	Price         int            `json:"price" gorm:"type:int;default:0"`         // Deducted from user.quota
+	TotalQuota    int            `json:"total_quota" gorm:"type:int;default:0"`   // Added to user.subscription_quota
+	DailyQuota    int            `json:"daily_quota" gorm:"type:int;default:0"`   // Max subscription quota consumed per day, 0 means unlimited
+	DurationDays  int            `json:"duration_days" gorm:"type:int;default:0"` // 0 means no expiration
+	Models        string         `json:"models" gorm:"type:text"`                 // Comma separated models only available to holders of this plan
+	AllowedGroups string         `json:"allowed_groups" gorm:"type:varchar(255)"` // Comma separated token groups granted by this plan
+	Status        int            `json:"status" gorm:"type:int;default:1;index"`
+	SortOrder     int            `json:"sort_order" gorm:"type:int;default:0;index"`
+	CreatedTime   int64          `json:"created_time" gorm:"bigint;index"`
+	UpdatedTime   int64          `json:"updated_time" gorm:"bigint"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 }
 
 type UserPlanOrder struct {
-	Id           int            `json:"id"`
-	UserId       int            `json:"user_id" gorm:"index;not null"`
-	PlanId       int            `json:"plan_id" gorm:"index;not null"`
-	PlanName     string         `json:"plan_name" gorm:"type:varchar(64);not null"`
-	Price        int            `json:"price" gorm:"type:int;default:0"`
-	GrantedQuota int            `json:"granted_quota" gorm:"type:int;default:0"` // Added to user.subscription_quota on purchase
-	DailyQuota   int            `json:"daily_quota" gorm:"type:int;default:0"`
-	DurationDays int            `json:"duration_days" gorm:"type:int;default:0"`
-	StartTime    int64          `json:"start_time" gorm:"bigint;index"`
-	ExpireTime   int64          `json:"expire_time" gorm:"bigint;index"` // 0 means no expiration
-	Status       int            `json:"status" gorm:"type:int;default:1;index"`
-	CreatedTime  int64          `json:"created_time" gorm:"bigint;index"`
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Id            int            `json:"id"`
+	UserId        int            `json:"user_id" gorm:"index;not null"`
+	PlanId        int            `json:"plan_id" gorm:"index;not null"`
+	PlanName      string         `json:"plan_name" gorm:"type:varchar(64);not null"`
+	Price         int            `json:"price" gorm:"type:int;default:0"`
+	GrantedQuota  int            `json:"granted_quota" gorm:"type:int;default:0"` // Added to user.subscription_quota on purchase
+	DailyQuota    int            `json:"daily_quota" gorm:"type:int;default:0"`
+	DurationDays  int            `json:"duration_days" gorm:"type:int;default:0"`
+	StartTime     int64          `json:"start_time" gorm:"bigint;index"`
+	ExpireTime    int64          `json:"expire_time" gorm:"bigint;index"` // 0 means no expiration
+	Models        string         `json:"models" gorm:"type:text"`
+	AllowedGroups string         `json:"allowed_groups" gorm:"type:varchar(255)"`
+	AutoRenew     bool           `json:"auto_renew" gorm:"default:false"`
+	RenewedFrom   int            `json:"renewed_from" gorm:"type:int;default:0"` // Id of the order this one was renewed from
+	Status        int            `json:"status" gorm:"type:int;default:1;index"`
+	CreatedTime   int64          `json:"created_time" gorm:"bigint;index"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 }
 
 func GetAllSubscriptionPlans(includeDisabled bool) (plans []*SubscriptionPlan, err error) {
@@ -88,6 +96,15 @@ func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
 }
 
 func (plan *SubscriptionPlan) Insert() error {
+	err := plan.InsertTx(DB)
+	if err == nil {
+		invalidatePlanAccessCache()
+	}
+	return err
+}
+
+// InsertTx 在事务中创建套餐，提交后需调用 InvalidatePlanAccessCache
+func (plan *SubscriptionPlan) InsertTx(tx *gorm.DB) error {
 	if plan == nil {
 		return errors.New("套餐数据不合法")
 	}
@@ -97,21 +114,32 @@ func (plan *SubscriptionPlan) Insert() error {
 	if plan.Status != SubscriptionPlanStatusDisabled && plan.Status != SubscriptionPlanStatusEnabled {
 		plan.Status = SubscriptionPlanStatusEnabled
 	}
-	return DB.Create(plan).Error
+	return tx.Create(plan).Error
 }
 
 func (plan *SubscriptionPlan) Update() error {
+	err := plan.UpdateTx(DB)
+	if err == nil {
+		invalidatePlanAccessCache()
+	}
+	return err
+}
+
+// UpdateTx 在事务中更新套餐，提交后需调用 InvalidatePlanAccessCache
+func (plan *SubscriptionPlan) UpdateTx(tx *gorm.DB) error {
 	if plan == nil || plan.Id <= 0 {
 		return errors.New("套餐数据不合法")
 	}
 	plan.UpdatedTime = common.GetTimestamp()
-	return DB.Model(plan).Select(
+	return tx.Model(plan).Select(
 		"name",
 		"description",
 		"price",
 		"total_quota",
 		"daily_quota",
 		"duration_days",
+		"models",
+		"allowed_groups",
 		"status",
 		"sort_order",
 		"updated_time",
@@ -119,8 +147,23 @@ func (plan *SubscriptionPlan) Update() error {
 }
 
 func DeleteSubscriptionPlanById(id int) error {
+	var afterCommit func()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		afterCommit, err = DeleteSubscriptionPlanByIdTx(tx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	afterCommit()
+	return nil
+}
+
+// DeleteSubscriptionPlanByIdTx 在事务中删除套餐并退款，返回的函数需在事务提交后调用以刷新缓存和记录日志
+func DeleteSubscriptionPlanByIdTx(tx *gorm.DB, id int) (func(), error) {
 	if id <= 0 {
-		return errors.New("套餐ID不合法")
+		return nil, errors.New("套餐ID不合法")
 	}
 	type userPlanRefund struct {
 		UserId      int `gorm:"column:user_id"`
@@ -129,116 +172,202 @@ func DeleteSubscriptionPlanById(id int) error {
 	}
 	refunds := make([]userPlanRefund, 0)
 
-	err := DB.Transaction(func(tx *gorm.DB) error {
-		plan := SubscriptionPlan{Id: id}
+	plan := SubscriptionPlan{Id: id}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		Take(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("套餐不存在")
+		}
+		return nil, err
+	}
+
+	if err := tx.Model(&UserPlanOrder{}).
+		Select("user_id, COALESCE(SUM(price), 0) AS refund_quota, COALESCE(SUM(granted_quota), 0) AS clear_quota").
+		Where("plan_id = ?", id).
+		Group("user_id").
+		Scan(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range refunds {
+		refund := &refunds[i]
+		if refund.UserId <= 0 {
+			continue
+		}
+
+		var userSnapshot struct {
+			SubscriptionQuota int
+		}
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("id = ?", id).
-			Take(&plan).Error; err != nil {
+			Model(&User{}).
+			Where("id = ?", refund.UserId).
+			Select("subscription_quota").
+			Take(&userSnapshot).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return errors.New("套餐不存在")
+				refund.RefundQuota = 0
+				refund.ClearQuota = 0
+				continue
 			}
-			return err
+			return nil, err
 		}
 
-		if err := tx.Model(&UserPlanOrder{}).
-			Select("user_id, COALESCE(SUM(price), 0) AS refund_quota, COALESCE(SUM(granted_quota), 0) AS clear_quota").
-			Where("plan_id = ?", id).
-			Group("user_id").
-			Scan(&refunds).Error; err != nil {
-			return err
+		if refund.ClearQuota > userSnapshot.SubscriptionQuota {
+			refund.ClearQuota = userSnapshot.SubscriptionQuota
 		}
 
-		for i := range refunds {
-			refund := &refunds[i]
-			if refund.UserId <= 0 {
-				continue
-			}
+		updates := make(map[string]interface{}, 2)
+		if refund.RefundQuota > 0 {
+			updates["quota"] = gorm.Expr("quota + ?", refund.RefundQuota)
+		}
+		if refund.ClearQuota > 0 {
+			updates["subscription_quota"] = gorm.Expr("subscription_quota - ?", refund.ClearQuota)
+		}
+		if len(updates) == 0 {
+			continue
+		}
 
-			var userSnapshot struct {
-				SubscriptionQuota int
-			}
-			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-				Model(&User{}).
-				Where("id = ?", refund.UserId).
-				Select("subscription_quota").
-				Take(&userSnapshot).Error; err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					refund.RefundQuota = 0
-					refund.ClearQuota = 0
-					continue
-				}
-				return err
-			}
+		if err := tx.Model(&User{}).
+			Where("id = ?", refund.UserId).
+			Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
 
-			if refund.ClearQuota > userSnapshot.SubscriptionQuota {
-				refund.ClearQuota = userSnapshot.SubscriptionQuota
-			}
+	if err := tx.Where("plan_id = ?", id).Delete(&UserPlanOrder{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&SubscriptionPlan{}, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return func() {
+		invalidatePlanAccessCache()
 
-			updates := make(map[string]interface{}, 2)
+		for _, refund := range refunds {
+			if refund.UserId <= 0 {
+				continue
+			}
 			if refund.RefundQuota > 0 {
-				updates["quota"] = gorm.Expr("quota + ?", refund.RefundQuota)
+				userId := refund.UserId
+				incrQuota := refund.RefundQuota
+				gopool.Go(func() {
+					if cacheErr := cacheIncrUserQuota(userId, int64(incrQuota)); cacheErr != nil {
+						common.SysError("failed to refund user quota cache: " + cacheErr.Error())
+					}
+				})
 			}
 			if refund.ClearQuota > 0 {
-				updates["subscription_quota"] = gorm.Expr("subscription_quota - ?", refund.ClearQuota)
-			}
-			if len(updates) == 0 {
-				continue
+				userId := refund.UserId
+				decrQuota := refund.ClearQuota
+				gopool.Go(func() {
+					if cacheErr := cacheDecrUserSubscriptionQuota(userId, int64(decrQuota)); cacheErr != nil {
+						common.SysError("failed to clear user subscription quota cache: " + cacheErr.Error())
+					}
+				})
 			}
 
-			if err := tx.Model(&User{}).
-				Where("id = ?", refund.UserId).
-				Updates(updates).Error; err != nil {
-				return err
-			}
+			RecordLog(
+				refund.UserId,
+				LogTypeSystem,
+				fmt.Sprintf("套餐已被删除，系统自动退款 %s，并清除套餐余额 %s", common.LogQuota(refund.RefundQuota), common.LogQuota(refund.ClearQuota)),
+			)
 		}
+	}, nil
+}
 
-		if err := tx.Where("plan_id = ?", id).Delete(&UserPlanOrder{}).Error; err != nil {
-			return err
-		}
-		return tx.Delete(&SubscriptionPlan{}, "id = ?", id).Error
-	})
-	if err != nil {
+// MarkExpiredUserPlanOrders 处理用户已到期的套餐订单，开启自动续费的订单会先尝试续费
+func MarkExpiredUserPlanOrders(userId int) error {
+	return processExpiredUserPlanOrders(userId)
+}
+
+func processExpiredUserPlanOrders(userId int) error {
+	now := common.GetTimestamp()
+	tx := DB.Where("status = ? AND expire_time > 0 AND expire_time <= ?", UserPlanOrderStatusActive, now)
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	var orders []*UserPlanOrder
+	if err := tx.Order("expire_time asc").Find(&orders).Error; err != nil {
 		return err
 	}
-
-	for _, refund := range refunds {
-		if refund.UserId <= 0 {
+	for _, order := range orders {
+		expired := false
+		var renewed *SubscriptionPlan
+		var renewErr error
+		// 到期与续费在同一事务中完成：续费因数据库错误失败时整体回滚，订单保持有效并在下次处理时重试；
+		// 余额不足、套餐下架等业务原因导致的续费失败不会写入任何数据，此时仅提交到期
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			// 条件更新保证同一订单只会被一个节点处理
+			result := tx.Model(&UserPlanOrder{}).
+				Where("id = ? AND status = ?", order.Id, UserPlanOrderStatusActive).
+				Update("status", UserPlanOrderStatusExpired)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			expired = true
+			if !order.AutoRenew || !operation_setting.GetSubscriptionSetting().AutoRenewEnabled {
+				return nil
+			}
+			var err error
+			_, renewed, err = purchaseSubscriptionPlanTx(tx, order.UserId, order.PlanId, true, order.ExpireTime, order.Id)
+			var rejected *planPurchaseRejectedError
+			if errors.As(err, &rejected) {
+				renewErr = err
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			// 订单保持有效，下次处理时重试，不影响其他订单
+			common.SysError(fmt.Sprintf("failed to expire plan order %d: %s", order.Id, err.Error()))
 			continue
 		}
-		if refund.RefundQuota > 0 {
-			userId := refund.UserId
-			incrQuota := refund.RefundQuota
-			gopool.Go(func() {
-				if cacheErr := cacheIncrUserQuota(userId, int64(incrQuota)); cacheErr != nil {
-					common.SysError("failed to refund user quota cache: " + cacheErr.Error())
-				}
-			})
+		if !expired || !order.AutoRenew {
+			continue
 		}
-		if refund.ClearQuota > 0 {
-			userId := refund.UserId
-			decrQuota := refund.ClearQuota
-			gopool.Go(func() {
-				if cacheErr := cacheDecrUserSubscriptionQuota(userId, int64(decrQuota)); cacheErr != nil {
-					common.SysError("failed to clear user subscription quota cache: " + cacheErr.Error())
-				}
-			})
+		switch {
+		case renewed != nil:
+			afterSubscriptionPlanPurchased(order.UserId, renewed, order.Id)
+		case renewErr != nil:
+			RecordLog(order.UserId, LogTypeSystem, fmt.Sprintf("套餐 %s 自动续费失败：%s", order.PlanName, renewErr.Error()))
+		default:
+			RecordLog(order.UserId, LogTypeSystem, fmt.Sprintf("套餐 %s 已到期，系统未开启自动续费", order.PlanName))
 		}
-
-		RecordLog(
-			refund.UserId,
-			LogTypeSystem,
-			fmt.Sprintf("套餐已被删除，系统自动退款 %s，并清除套餐余额 %s", common.LogQuota(refund.RefundQuota), common.LogQuota(refund.ClearQuota)),
-		)
 	}
-
 	return nil
 }
 
-func MarkExpiredUserPlanOrders(userId int) error {
-	now := common.GetTimestamp()
-	return DB.Model(&UserPlanOrder{}).
-		Where("user_id = ? AND status = ? AND expire_time > 0 AND expire_time <= ?", userId, UserPlanOrderStatusActive, now).
-		Update("status", UserPlanOrderStatusExpired).Error
+// AutoRenewUserPlanOrders 定期处理所有到期套餐的续费与过期
+func AutoRenewUserPlanOrders() {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysLog(fmt.Sprintf("AutoRenewUserPlanOrders panic: %v", r))
+		}
+	}()
+	for {
+		if err := processExpiredUserPlanOrders(0); err != nil {
+			common.SysError("failed to process expired plan orders: " + err.Error())
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// SetUserPlanOrderAutoRenew 开启或关闭用户套餐订单的自动续费
+func SetUserPlanOrderAutoRenew(userId int, orderId int, autoRenew bool) error {
+	result := DB.Model(&UserPlanOrder{}).
+		Where("id = ? AND user_id = ? AND status = ? AND expire_time > 0", orderId, userId, UserPlanOrderStatusActive).
+		Update("auto_renew", autoRenew)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("订单不存在、已过期或为永久有效套餐")
+	}
+	return nil
 }
 
 func GetUserPlanOrders(userId int, startIdx int, num int) (orders []*UserPlanOrder, total int64, err error) {
@@ -258,89 +387,140 @@ func GetUserPlanOrders(userId int, startIdx int, num int) (orders []*UserPlanOrd
 	return orders, total, nil
 }
 
-func PurchaseSubscriptionPlan(userId int, planId int) (*UserPlanOrder, error) {
+func PurchaseSubscriptionPlan(userId int, planId int, autoRenew bool) (*UserPlanOrder, error) {
+	return purchaseSubscriptionPlan(userId, planId, autoRenew, 0, 0)
+}
+
+// planPurchaseRejectedError 购买条件不满足（套餐下架、余额不足等），返回该错误时事务中尚未写入任何数据
+type planPurchaseRejectedError struct {
+	message string
+}
+
+func (e *planPurchaseRejectedError) Error() string {
+	return e.message
+}
+
+func rejectPlanPurchase(message string) error {
+	return &planPurchaseRejectedError{message: message}
+}
+
+// purchaseSubscriptionPlan 扣除随用随付余额并创建套餐订单，
+// startTime 为 0 时从当前时间开始计算有效期，续费时从原订单到期时间开始，保证有效期连续
+func purchaseSubscriptionPlan(userId int, planId int, autoRenew bool, startTime int64, renewedFrom int) (*UserPlanOrder, error) {
+	var order *UserPlanOrder
+	var plan *SubscriptionPlan
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, plan, err = purchaseSubscriptionPlanTx(tx, userId, planId, autoRenew, startTime, renewedFrom)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	afterSubscriptionPlanPurchased(userId, plan, renewedFrom)
+	return order, nil
+}
+
+// purchaseSubscriptionPlanTx 在事务中完成扣费与建单，提交后需调用 afterSubscriptionPlanPurchased 更新缓存并记录日志
+func purchaseSubscriptionPlanTx(tx *gorm.DB, userId int, planId int, autoRenew bool, startTime int64, renewedFrom int) (*UserPlanOrder, *SubscriptionPlan, error) {
 	if userId <= 0 {
-		return nil, errors.New("用户ID不合法")
+		return nil, nil, rejectPlanPurchase("用户ID不合法")
 	}
 	if planId <= 0 {
-		return nil, errors.New("套餐ID不合法")
+		return nil, nil, rejectPlanPurchase("套餐ID不合法")
 	}
 
 	now := common.GetTimestamp()
 	var plan SubscriptionPlan
-	var order *UserPlanOrder
-
-	err := DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("id = ?", planId).
-			Take(&plan).Error; err != nil {
-			return errors.New("套餐不存在")
-		}
-		if plan.Status != SubscriptionPlanStatusEnabled {
-			return errors.New("套餐已下架")
-		}
-		if plan.Price < 0 {
-			return errors.New("套餐价格不合法")
-		}
-		if plan.TotalQuota <= 0 {
-			return errors.New("套餐额度不合法")
-		}
-		if plan.DurationDays < 0 {
-			return errors.New("套餐有效期不合法")
-		}
-
-		var userBalance struct {
-			Quota int
-		}
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Model(&User{}).
-			Where("id = ?", userId).
-			Select("quota").
-			Take(&userBalance).Error; err != nil {
-			return errors.New("用户不存在")
-		}
-		if userBalance.Quota < plan.Price {
-			return fmt.Errorf("随用随付余额不足，需要 %s", common.LogQuota(plan.Price))
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", planId).
+		Take(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, rejectPlanPurchase("套餐不存在")
 		}
+		return nil, nil, err
+	}
+	if plan.Status != SubscriptionPlanStatusEnabled {
+		return nil, nil, rejectPlanPurchase("套餐已下架")
+	}
+	if plan.Price < 0 {
+		return nil, nil, rejectPlanPurchase("套餐价格不合法")
+	}
+	if plan.TotalQuota <= 0 {
+		return nil, nil, rejectPlanPurchase("套餐额度不合法")
+	}
+	if plan.DurationDays < 0 {
+		return nil, nil, rejectPlanPurchase("套餐有效期不合法")
+	}
 
-		if plan.Price > 0 {
-			if err := tx.Model(&User{}).
-				Where("id = ?", userId).
-				Update("quota", gorm.Expr("quota - ?", plan.Price)).Error; err != nil {
-				return err
-			}
+	var userBalance struct {
+		Quota int
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Model(&User{}).
+		Where("id = ?", userId).
+		Select("quota").
+		Take(&userBalance).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, rejectPlanPurchase("用户不存在")
 		}
+		return nil, nil, err
+	}
+	if userBalance.Quota < plan.Price {
+		return nil, nil, rejectPlanPurchase(fmt.Sprintf("随用随付余额不足，需要 %s", common.LogQuota(plan.Price)))
+	}
 
+	if plan.Price > 0 {
 		if err := tx.Model(&User{}).
 			Where("id = ?", userId).
-			Update("subscription_quota", gorm.Expr("subscription_quota + ?", plan.TotalQuota)).Error; err != nil {
-			return err
+			Update("quota", gorm.Expr("quota - ?", plan.Price)).Error; err != nil {
+			return nil, nil, err
 		}
+	}
 
-		expireTime := int64(0)
-		if plan.DurationDays > 0 {
-			expireTime = now + int64(plan.DurationDays)*86400
-		}
+	if err := tx.Model(&User{}).
+		Where("id = ?", userId).
+		Update("subscription_quota", gorm.Expr("subscription_quota + ?", plan.TotalQuota)).Error; err != nil {
+		return nil, nil, err
+	}
 
-		order = &UserPlanOrder{
-			UserId:       userId,
-			PlanId:       plan.Id,
-			PlanName:     plan.Name,
-			Price:        plan.Price,
-			GrantedQuota: plan.TotalQuota,
-			DailyQuota:   plan.DailyQuota,
-			DurationDays: plan.DurationDays,
-			StartTime:    now,
-			ExpireTime:   expireTime,
-			Status:       UserPlanOrderStatusActive,
-			CreatedTime:  now,
-		}
-		return tx.Create(order).Error
-	})
-	if err != nil {
-		return nil, err
+	start := now
+	if startTime > 0 {
+		start = startTime
+	}
+	if start+int64(plan.DurationDays)*86400 <= now {
+		// 续费处理严重滞后时从当前时间重新计算，避免生成已过期的订单
+		start = now
+	}
+	expireTime := int64(0)
+	if plan.DurationDays > 0 {
+		expireTime = start + int64(plan.DurationDays)*86400
 	}
 
+	order := &UserPlanOrder{
+		UserId:        userId,
+		PlanId:        plan.Id,
+		PlanName:      plan.Name,
+		Price:         plan.Price,
+		GrantedQuota:  plan.TotalQuota,
+		DailyQuota:    plan.DailyQuota,
+		DurationDays:  plan.DurationDays,
+		StartTime:     start,
+		ExpireTime:    expireTime,
+		Models:        plan.Models,
+		AllowedGroups: plan.AllowedGroups,
+		AutoRenew:     autoRenew && plan.DurationDays > 0,
+		RenewedFrom:   renewedFrom,
+		Status:        UserPlanOrderStatusActive,
+		CreatedTime:   now,
+	}
+	if err := tx.Create(order).Error; err != nil {
+		return nil, nil, err
+	}
+	return order, &plan, nil
+}
+
+func afterSubscriptionPlanPurchased(userId int, plan *SubscriptionPlan, renewedFrom int) {
 	if plan.Price > 0 {
 		gopool.Go(func() {
 			if cacheErr := cacheDecrUserQuota(userId, int64(plan.Price)); cacheErr != nil {
@@ -356,10 +536,13 @@ func PurchaseSubscriptionPlan(userId int, planId int) (*UserPlanOrder, error) {
 		})
 	}
 
+	action := "购买"
+	if renewedFrom > 0 {
+		action = "自动续费"
+	}
 	RecordLog(
 		userId,
 		LogTypeTopup,
-		fmt.Sprintf("购买套餐 %s，支付 %s，获得积分额度 %s", plan.Name, common.LogQuota(plan.Price), common.LogQuota(plan.TotalQuota)),
+		fmt.Sprintf("%s套餐 %s，支付 %s，获得积分额度 %s", action, plan.Name, common.LogQuota(plan.Price), common.LogQuota(plan.TotalQuota)),
 	)
-	return order, nil
 }
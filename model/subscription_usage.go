@@ -0,0 +1,282 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+// SubscriptionDailyUsage 记录用户每日已消耗的套餐额度，用于每日额度限制
+type SubscriptionDailyUsage struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"uniqueIndex:idx_sub_daily_user_date,priority:1;not null"`
+	UsageDate string `json:"usage_date" gorm:"type:varchar(10);uniqueIndex:idx_sub_daily_user_date,priority:2"`
+	UsedQuota int    `json:"used_quota" gorm:"type:int;default:0"`
+}
+
+// SubscriptionDailyStatus 用户当日套餐额度使用情况
+type SubscriptionDailyStatus struct {
+	Date      string `json:"date"`
+	Limited   bool   `json:"limited"`
+	Limit     int    `json:"limit"`
+	Used      int    `json:"used"`
+	Remaining int    `json:"remaining"`
+}
+
+// subscriptionUsageDate 返回 t 所在的套餐用量日期，t 为零值时取当前时间
+func subscriptionUsageDate(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	loc := operation_setting.GetSubscriptionSetting().DailyResetLocation()
+	return t.In(loc).Format("2006-01-02")
+}
+
+func activeUserPlanOrders(tx *gorm.DB, userId int) (orders []*UserPlanOrder, err error) {
+	now := common.GetTimestamp()
+	err = tx.Where("user_id = ? AND status = ? AND start_time <= ? AND (expire_time = 0 OR expire_time > ?)",
+		userId, UserPlanOrderStatusActive, now, now).Find(&orders).Error
+	return orders, err
+}
+
+// userPlanDailyLimit 根据生效中的套餐计算每日额度上限，
+// 没有生效套餐或任一套餐不限每日额度时返回 limited=false
+func userPlanDailyLimit(tx *gorm.DB, userId int) (limit int, limited bool, err error) {
+	orders, err := activeUserPlanOrders(tx, userId)
+	if err != nil || len(orders) == 0 {
+		return 0, false, err
+	}
+	stackingMode := operation_setting.GetSubscriptionSetting().StackingMode
+	for _, order := range orders {
+		if order.DailyQuota <= 0 {
+			return 0, false, nil
+		}
+		if stackingMode == operation_setting.SubscriptionStackingMax {
+			if order.DailyQuota > limit {
+				limit = order.DailyQuota
+			}
+		} else {
+			limit += order.DailyQuota
+		}
+	}
+	return limit, true, nil
+}
+
+func getSubscriptionDailyUsed(tx *gorm.DB, userId int, date string) (used int, err error) {
+	err = tx.Model(&SubscriptionDailyUsage{}).
+		Where("user_id = ? AND usage_date = ?", userId, date).
+		Select("COALESCE(SUM(used_quota), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+// getSubscriptionDailyRemaining 返回 date 当日剩余可用的套餐额度
+func getSubscriptionDailyRemaining(tx *gorm.DB, userId int, date string) (remaining int, limited bool, err error) {
+	limit, limited, err := userPlanDailyLimit(tx, userId)
+	if err != nil || !limited {
+		return 0, false, err
+	}
+	used, err := getSubscriptionDailyUsed(tx, userId, date)
+	if err != nil {
+		return 0, false, err
+	}
+	remaining = limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true, nil
+}
+
+// addSubscriptionDailyUsage 累加 date 当日的套餐用量，调用方需已持有用户行锁。
+// 退还时应传入原扣费所在的日期，避免冲减其他日期的用量
+func addSubscriptionDailyUsage(tx *gorm.DB, userId int, date string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	query := tx.Model(&SubscriptionDailyUsage{}).Where("user_id = ? AND usage_date = ?", userId, date)
+	if delta < 0 {
+		// 防御性检查，退还额度超过当日记录的用量时不再冲减，避免出现负数
+		query = query.Where("used_quota >= ?", -delta)
+	}
+	result := query.Update("used_quota", gorm.Expr("used_quota + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 || delta < 0 {
+		return nil
+	}
+	return tx.Create(&SubscriptionDailyUsage{
+		UserId:    userId,
+		UsageDate: date,
+		UsedQuota: delta,
+	}).Error
+}
+
+// GetUserSubscriptionDailyStatus 获取用户当日套餐额度使用情况
+func GetUserSubscriptionDailyStatus(userId int) (*SubscriptionDailyStatus, error) {
+	if userId <= 0 {
+		return nil, errors.New("用户ID不合法")
+	}
+	status := &SubscriptionDailyStatus{Date: subscriptionUsageDate(time.Now())}
+	limit, limited, err := userPlanDailyLimit(DB, userId)
+	if err != nil {
+		return nil, err
+	}
+	used, err := getSubscriptionDailyUsed(DB, userId, status.Date)
+	if err != nil {
+		return nil, err
+	}
+	status.Limited = limited
+	status.Limit = limit
+	status.Used = used
+	if limited && limit > used {
+		status.Remaining = limit - used
+	}
+	return status, nil
+}
+
+// 套餐专属模型与分组，按 SyncFrequency 周期从数据库刷新
+var (
+	planAccessLock       sync.RWMutex
+	planRestrictedModels map[string]bool
+	planGrantedGroups    map[string]bool
+	planAccessLoadedAt   int64
+)
+
+func splitPlanList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func planListContains(s string, target string) bool {
+	for _, item := range splitPlanList(s) {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+func invalidatePlanAccessCache() {
+	planAccessLock.Lock()
+	planAccessLoadedAt = 0
+	planAccessLock.Unlock()
+}
+
+// InvalidatePlanAccessCache 供事务外的调用方在提交后刷新套餐访问缓存
+func InvalidatePlanAccessCache() {
+	invalidatePlanAccessCache()
+}
+
+func loadPlanAccess() {
+	planAccessLock.RLock()
+	fresh := planAccessLoadedAt > 0 && common.GetTimestamp()-planAccessLoadedAt < int64(common.SyncFrequency)
+	planAccessLock.RUnlock()
+	if fresh {
+		return
+	}
+	// 已下架的套餐仍需计入，持有旧订单的用户依然可以使用
+	var plans []*SubscriptionPlan
+	if err := DB.Select("id", "models", "allowed_groups").Find(&plans).Error; err != nil {
+		common.SysError("failed to load subscription plan access: " + err.Error())
+		return
+	}
+	models := make(map[string]bool)
+	groups := make(map[string]bool)
+	for _, plan := range plans {
+		for _, m := range splitPlanList(plan.Models) {
+			models[m] = true
+		}
+		for _, g := range splitPlanList(plan.AllowedGroups) {
+			groups[g] = true
+		}
+	}
+	planAccessLock.Lock()
+	planRestrictedModels = models
+	planGrantedGroups = groups
+	planAccessLoadedAt = common.GetTimestamp()
+	planAccessLock.Unlock()
+}
+
+// IsPlanRestrictedModel 判断模型是否为套餐专属模型
+func IsPlanRestrictedModel(modelName string) bool {
+	loadPlanAccess()
+	planAccessLock.RLock()
+	defer planAccessLock.RUnlock()
+	return planRestrictedModels[modelName]
+}
+
+// UserPlanAllowsModel 判断用户生效中的套餐是否包含该专属模型
+func UserPlanAllowsModel(userId int, modelName string) (bool, error) {
+	orders, err := activeUserPlanOrders(DB, userId)
+	if err != nil {
+		return false, err
+	}
+	for _, order := range orders {
+		if planListContains(order.Models, modelName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UserPlanGrantsGroup 判断用户生效中的套餐是否授予了该分组的使用权
+func UserPlanGrantsGroup(userId int, group string) (bool, error) {
+	loadPlanAccess()
+	planAccessLock.RLock()
+	granted := planGrantedGroups[group]
+	planAccessLock.RUnlock()
+	if !granted {
+		return false, nil
+	}
+	orders, err := activeUserPlanOrders(DB, userId)
+	if err != nil {
+		return false, err
+	}
+	for _, order := range orders {
+		if planListContains(order.AllowedGroups, group) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetUserPlanGroups 返回用户生效中的套餐授予的分组
+func GetUserPlanGroups(userId int) ([]string, error) {
+	orders, err := activeUserPlanOrders(DB, userId)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0)
+	for _, order := range orders {
+		groups = append(groups, splitPlanList(order.AllowedGroups)...)
+	}
+	return groups, nil
+}
@@ -43,6 +43,7 @@ type Task struct {
 	TaskID     string                `json:"task_id" gorm:"type:varchar(50);index"`  // 第三方id，不一定有/ song id\ Task id
 	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
 	UserId     int                   `json:"user_id" gorm:"index"`
+	OrgId      int                   `json:"org_id" gorm:"index;default:0"` // 组织令牌提交的任务从组织额度池扣费
 	ChannelId  int                   `json:"channel_id" gorm:"index"`
 	Quota      int                   `json:"quota"`
 	Action     string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
@@ -96,6 +97,7 @@ type SyncTaskQueryParams struct {
 func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.TaskRelayInfo) *Task {
 	t := &Task{
 		UserId:     relayInfo.UserId,
+		OrgId:      relayInfo.OrgId,
 		SubmitTime: time.Now().Unix(),
 		Status:     TaskStatusNotStart,
 		Progress:   "0%",
@@ -105,6 +107,14 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.TaskRelayIn
 	return t
 }
 
+// RefundTaskQuota 退回失败任务的额度，组织令牌提交的任务退回组织额度池
+func RefundTaskQuota(userId int, orgId int, quota int) error {
+	if orgId != 0 {
+		return RestoreOrgQuota(orgId, userId, quota)
+	}
+	return IncreaseUserQuota(userId, quota, false)
+}
+
 func TaskGetAllUserTask(userId int, startIdx int, num int, queryParams SyncTaskQueryParams) []*Task {
 	var tasks []*Task
 	var err error
@@ -46,6 +46,8 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	OrgId              int            `json:"org_id" gorm:"default:0;index"`        // 0 表示个人令牌，否则从组织额度池扣费
+	HedgingEnabled     bool           `json:"hedging_enabled" gorm:"default:false"` // 对该令牌的请求启用请求对冲
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -200,12 +202,13 @@ func (token *Token) Update() (err error) {
 				if err != nil {
 					common.SysError("failed to update token cache: " + err.Error())
 				}
+				publishTokenInvalidation(token.Key)
 			})
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
 		"rate_limit_enabled", "rate_limit_period", "rate_limit_count", "rate_limit_success",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "hedging_enabled").Updates(token).Error
 	return err
 }
 
@@ -232,6 +235,7 @@ func (token *Token) Delete() (err error) {
 				if err != nil {
 					common.SysError("failed to delete token cache: " + err.Error())
 				}
+				publishTokenInvalidation(token.Key)
 			})
 		}
 	}()
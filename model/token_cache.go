@@ -21,6 +21,8 @@ import (
 	"time"
 	"veloera/common"
 	"veloera/constant"
+
+	"github.com/bytedance/gopkg/util/gopool"
 )
 
 func cacheSetToken(token Token) error {
@@ -42,6 +44,26 @@ func cacheDeleteToken(key string) error {
 	return nil
 }
 
+// publishTokenInvalidation 通知其他节点删除令牌缓存，广播内容为令牌的 HMAC 而不是明文
+func publishTokenInvalidation(key string) {
+	common.PublishCacheEvent(common.CacheEventToken, common.GenerateHMAC(key))
+}
+
+// invalidateTokenCaches 批量更新令牌后删除其缓存并通知其他节点
+func invalidateTokenCaches(keys []string) {
+	if !common.RedisEnabled || len(keys) == 0 {
+		return
+	}
+	gopool.Go(func() {
+		for _, key := range keys {
+			if err := cacheDeleteToken(key); err != nil {
+				common.SysError("failed to delete token cache: " + err.Error())
+			}
+			publishTokenInvalidation(key)
+		}
+	})
+}
+
 func cacheIncrTokenQuota(key string, increment int64) error {
 	key = common.GenerateHMAC(key)
 	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFiledRemainQuota, increment)
@@ -37,8 +37,9 @@ type User struct {
 	Username          string         `json:"username" gorm:"unique;index" validate:"max=12"`
 	Password          string         `json:"password" gorm:"not null;" validate:"min=8,max=20"`
 	DisplayName       string         `json:"display_name" gorm:"index" validate:"max=20"`
-	Role              int            `json:"role" gorm:"type:int;default:1"`   // admin, common
-	Status            int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
+	Role              int            `json:"role" gorm:"type:int;default:1"`                     // admin, common
+	RoleName          string         `json:"role_name" gorm:"type:varchar(64);default:'';index"` // 细粒度角色，为空时按 Role 对应的内置角色授权
+	Status            int            `json:"status" gorm:"type:int;default:1"`                   // enabled, disabled
 	Email             string         `json:"email" gorm:"index" validate:"max=50"`
 	GitHubId          string         `json:"github_id" gorm:"column:github_id;index"`
 	OidcId            string         `json:"oidc_id" gorm:"column:oidc_id;index"`
@@ -60,7 +61,9 @@ type User struct {
 	LinuxDOId         string         `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	IDCFlareId        string         `json:"idc_flare_id" gorm:"column:idc_flare_id;index"`
 	Setting           string         `json:"setting" gorm:"type:text;column:setting"`
-	LastCheckInTime   *time.Time     `json:"last_check_in_time" gorm:"column:last_check_in_time"` // 上次签到时间
+	LastCheckInTime   *time.Time     `json:"last_check_in_time" gorm:"column:last_check_in_time"`        // 上次签到时间
+	BillingMode       int            `json:"billing_mode" gorm:"type:int;default:0;column:billing_mode"` // 0 预付费, 1 后付费（授信）
+	CreditLimit       int            `json:"credit_limit" gorm:"type:int;default:0;column:credit_limit"` // 后付费账户允许透支的额度
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -73,19 +76,40 @@ func (user *User) ToBaseUser() *UserBase {
 		Username:          user.Username,
 		Setting:           user.Setting,
 		Email:             user.Email,
+		BillingMode:       user.BillingMode,
+		CreditLimit:       user.CreditLimit,
+		RoleName:          user.RoleName,
 	}
 	return cache
 }
 
+// IsPostpaid 是否为后付费（授信）账户
+func (user *User) IsPostpaid() bool {
+	return user.BillingMode == common.UserBillingModePostpaid
+}
+
 type UserQuotaBalance struct {
 	Quota             int
 	SubscriptionQuota int
+	CreditLimit       int // 仅后付费账户有效，预付费账户恒为 0
 }
 
 func (b UserQuotaBalance) Total() int {
 	return b.Quota + b.SubscriptionQuota
 }
 
+// Available 返回当前仍可消费的额度，后付费账户包含剩余授信额度
+func (b UserQuotaBalance) Available() int {
+	return b.Total() + b.CreditLimit
+}
+
+func effectiveCreditLimit(billingMode int, creditLimit int) int {
+	if billingMode != common.UserBillingModePostpaid || creditLimit < 0 {
+		return 0
+	}
+	return creditLimit
+}
+
 func (user *User) GetAccessToken() string {
 	if user.AccessToken == nil {
 		return ""
@@ -490,7 +514,7 @@ func (user *User) Update(updatePassword bool) error {
 	}
 
 	// Update cache
-	return updateUserCache(*user)
+	return refreshUserCache(*user)
 }
 
 func (user *User) Edit(updatePassword bool) error {
@@ -519,7 +543,7 @@ func (user *User) Edit(updatePassword bool) error {
 	}
 
 	// Update cache
-	return updateUserCache(*user)
+	return refreshUserCache(*user)
 }
 
 func (user *User) Delete() error {
@@ -715,19 +739,29 @@ func GetUserQuotaBalance(id int, fromDB bool) (balance UserQuotaBalance, err err
 	}()
 	if !fromDB && common.RedisEnabled {
 		if cache, cacheErr := GetUserCache(id); cacheErr == nil {
-			return UserQuotaBalance{Quota: cache.Quota, SubscriptionQuota: cache.SubscriptionQuota}, nil
+			return UserQuotaBalance{
+				Quota:             cache.Quota,
+				SubscriptionQuota: cache.SubscriptionQuota,
+				CreditLimit:       effectiveCreditLimit(cache.BillingMode, cache.CreditLimit),
+			}, nil
 		}
 	}
 	fromDB = true
 	var result struct {
 		Quota             int
 		SubscriptionQuota int
+		BillingMode       int
+		CreditLimit       int
 	}
-	err = DB.Model(&User{}).Where("id = ?", id).Select("quota", "subscription_quota").Take(&result).Error
+	err = DB.Model(&User{}).Where("id = ?", id).Select("quota", "subscription_quota", "billing_mode", "credit_limit").Take(&result).Error
 	if err != nil {
 		return UserQuotaBalance{}, err
 	}
-	return UserQuotaBalance{Quota: result.Quota, SubscriptionQuota: result.SubscriptionQuota}, nil
+	return UserQuotaBalance{
+		Quota:             result.Quota,
+		SubscriptionQuota: result.SubscriptionQuota,
+		CreditLimit:       effectiveCreditLimit(result.BillingMode, result.CreditLimit),
+	}, nil
 }
 
 func GetUserQuota(id int, fromDB bool) (quota int, err error) {
@@ -738,6 +772,15 @@ func GetUserQuota(id int, fromDB bool) (quota int, err error) {
 	return balance.Total(), nil
 }
 
+// GetUserAvailableQuota 返回用户可消费额度，后付费账户包含剩余授信额度
+func GetUserAvailableQuota(id int, fromDB bool) (quota int, err error) {
+	balance, err := GetUserQuotaBalance(id, fromDB)
+	if err != nil {
+		return 0, err
+	}
+	return balance.Available(), nil
+}
+
 func GetUserUsedQuota(id int) (quota int, err error) {
 	err = DB.Model(&User{}).Where("id = ?", id).Select("used_quota").Find(&quota).Error
 	return quota, err
@@ -881,7 +924,8 @@ func DeltaUpdateUserQuota(id int, delta int) (err error) {
 	}
 }
 
-func ConsumeUserQuota(id int, amount int) (subscriptionUsed int, quotaUsed int, err error) {
+// ConsumeUserQuota 扣除用户额度，优先使用套餐额度；usageTime 为请求开始时间，套餐每日用量计入该时间所在的日期
+func ConsumeUserQuota(id int, amount int, usageTime time.Time) (subscriptionUsed int, quotaUsed int, err error) {
 	if amount < 0 {
 		return 0, 0, errors.New("quota 不能为负数！")
 	}
@@ -900,23 +944,39 @@ func ConsumeUserQuota(id int, amount int) (subscriptionUsed int, quotaUsed int,
 	var snapshot struct {
 		SubscriptionQuota int
 		Quota             int
+		BillingMode       int
+		CreditLimit       int
 	}
 	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&User{}).
 		Where("id = ?", id).
-		Select("subscription_quota", "quota").
+		Select("subscription_quota", "quota", "billing_mode", "credit_limit").
 		Take(&snapshot).Error
 	if err != nil {
 		return 0, 0, err
 	}
-	total := snapshot.SubscriptionQuota + snapshot.Quota
+	// 套餐额度受生效套餐的每日额度限制，超出部分从随用随付余额扣除
+	subscriptionAvailable := snapshot.SubscriptionQuota
+	if subscriptionAvailable > 0 {
+		remaining, limited, dailyErr := getSubscriptionDailyRemaining(tx, id, subscriptionUsageDate(usageTime))
+		if dailyErr != nil {
+			err = dailyErr
+			return 0, 0, err
+		}
+		if limited && remaining < subscriptionAvailable {
+			subscriptionAvailable = remaining
+		}
+	}
+	// 后付费账户允许 quota 透支到 -credit_limit
+	total := subscriptionAvailable + snapshot.Quota + effectiveCreditLimit(snapshot.BillingMode, snapshot.CreditLimit)
 	if total < amount {
 		err = fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", common.FormatQuota(total), common.FormatQuota(amount))
 		return 0, 0, err
 	}
 	subscriptionUsed = amount
-	if subscriptionUsed > snapshot.SubscriptionQuota {
-		subscriptionUsed = snapshot.SubscriptionQuota
+	if subscriptionUsed > subscriptionAvailable {
+		subscriptionUsed = subscriptionAvailable
 	}
+
 	quotaUsed = amount - subscriptionUsed
 	if subscriptionUsed > 0 {
 		err = tx.Model(&User{}).Where("id = ?", id).
@@ -924,6 +984,9 @@ func ConsumeUserQuota(id int, amount int) (subscriptionUsed int, quotaUsed int,
 		if err != nil {
 			return 0, 0, err
 		}
+		if err = addSubscriptionDailyUsage(tx, id, subscriptionUsageDate(usageTime), subscriptionUsed); err != nil {
+			return 0, 0, err
+		}
 	}
 	if quotaUsed > 0 {
 		err = tx.Model(&User{}).Where("id = ?", id).
@@ -953,7 +1016,8 @@ func ConsumeUserQuota(id int, amount int) (subscriptionUsed int, quotaUsed int,
 	return subscriptionUsed, quotaUsed, nil
 }
 
-func RestoreUserQuota(id int, subscriptionAmount int, quotaAmount int) (err error) {
+// RestoreUserQuota 退还用户额度，usageTime 需与扣费时传入 ConsumeUserQuota 的时间一致，以冲减原扣费日期的套餐用量
+func RestoreUserQuota(id int, subscriptionAmount int, quotaAmount int, usageTime time.Time) (err error) {
 	if subscriptionAmount < 0 || quotaAmount < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -975,6 +1039,9 @@ func RestoreUserQuota(id int, subscriptionAmount int, quotaAmount int) (err erro
 		if err != nil {
 			return err
 		}
+		if err = addSubscriptionDailyUsage(tx, id, subscriptionUsageDate(usageTime), -subscriptionAmount); err != nil {
+			return err
+		}
 	}
 	if quotaAmount > 0 {
 		err = tx.Model(&User{}).Where("id = ?", id).
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"strconv"
 	"time"
 	"veloera/common"
 	"veloera/constant"
@@ -37,6 +38,9 @@ type UserBase struct {
 	Status            int    `json:"status"`
 	Username          string `json:"username"`
 	Setting           string `json:"setting"`
+	BillingMode       int    `json:"billing_mode"`
+	CreditLimit       int    `json:"credit_limit"`
+	RoleName          string `json:"role_name"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -70,8 +74,19 @@ func getUserCacheKey(userId int) string {
 	return fmt.Sprintf("user:%d", userId)
 }
 
-// invalidateUserCache clears user cache
+// invalidateUserCache clears user cache and notifies other nodes
 func invalidateUserCache(userId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	if err := deleteUserCache(userId); err != nil {
+		return err
+	}
+	common.PublishCacheEvent(common.CacheEventUser, strconv.Itoa(userId))
+	return nil
+}
+
+func deleteUserCache(userId int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
@@ -91,6 +106,15 @@ func updateUserCache(user User) error {
 	)
 }
 
+// refreshUserCache 写入最新的用户缓存，并通知其他节点删除可能回填的旧缓存
+func refreshUserCache(user User) error {
+	if err := updateUserCache(user); err != nil {
+		return err
+	}
+	common.PublishCacheEvent(common.CacheEventUser, strconv.Itoa(user.Id))
+	return nil
+}
+
 // GetUserCache gets complete user cache from hash
 func GetUserCache(userId int) (userCache *UserBase, err error) {
 	var user *User
@@ -129,6 +153,9 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 		Username:          user.Username,
 		Setting:           user.Setting,
 		Email:             user.Email,
+		BillingMode:       user.BillingMode,
+		CreditLimit:       user.CreditLimit,
+		RoleName:          user.RoleName,
 	}
 
 	return userCache, nil
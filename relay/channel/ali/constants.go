@@ -19,6 +19,7 @@ package ali
 var ModelList = []string{
 	"qwen-turbo", "qwen-plus", "qwen-max", "qwen-max-longcontext",
 	"text-embedding-v1",
+	"qwen-tts",
 }
 
 var ChannelName = "ali"
@@ -113,3 +113,30 @@ type AliImageRequest struct {
 	} `json:"parameters,omitempty"`
 	ResponseFormat string `json:"response_format,omitempty"`
 }
+
+// AliTTSRequest qwen-tts 语音合成请求
+type AliTTSRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Text  string `json:"text"`
+		Voice string `json:"voice"`
+	} `json:"input"`
+}
+
+type AliTTSResponse struct {
+	Output struct {
+		Audio struct {
+			Data string `json:"data"`
+			Url  string `json:"url"`
+		} `json:"audio"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestId string `json:"request_id"`
+}
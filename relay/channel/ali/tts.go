@@ -0,0 +1,84 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package ali
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// qwen-tts 以 SSE 返回 24kHz 16 位单声道 PCM 分片
+const ttsSampleRate = 24000
+
+func oaiTTS2Ali(request dto.AudioRequest) (io.Reader, error) {
+	if err := service.CheckTTSFormat("pcm", request.ResponseFormat); err != nil {
+		return nil, err
+	}
+	aliRequest := AliTTSRequest{Model: request.Model}
+	aliRequest.Input.Text = request.Input
+	aliRequest.Input.Voice = operation_setting.MapTTSVoice("ali", request.Voice)
+	jsonData, err := json.Marshal(aliRequest)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(jsonData), nil
+}
+
+func aliTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, request dto.AudioRequest) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	defer resp.Body.Close()
+	writer := service.NewTTSWriter(c, request.ResponseFormat, request.StreamFormat, "pcm", ttsSampleRate)
+	usage := &dto.Usage{PromptTokens: info.PromptTokens, TotalTokens: info.PromptTokens}
+	err := service.ScanSSEData(resp.Body, func(data string) error {
+		var aliResponse AliTTSResponse
+		if err := json.Unmarshal([]byte(data), &aliResponse); err != nil {
+			return err
+		}
+		if aliResponse.Code != "" {
+			return fmt.Errorf("%s: %s", aliResponse.Code, aliResponse.Message)
+		}
+		if aliResponse.Usage.TotalTokens > 0 {
+			usage.PromptTokens = aliResponse.Usage.InputTokens
+			usage.CompletionTokens = aliResponse.Usage.OutputTokens
+			usage.TotalTokens = aliResponse.Usage.TotalTokens
+		}
+		if aliResponse.Output.Audio.Data == "" {
+			return nil
+		}
+		audio, err := base64.StdEncoding.DecodeString(aliResponse.Output.Audio.Data)
+		if err != nil {
+			return err
+		}
+		return writer.Write(audio)
+	})
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if err := writer.Close(usage); err != nil {
+		return service.OpenAIErrorWrapper(err, "write_audio_failed", http.StatusInternalServerError), nil
+	}
+	return nil, usage
+}
@@ -121,6 +121,10 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	} else {
 		client = service.GetHttpClient()
 	}
+	// 对冲请求落败时取消上下文以中止上游请求
+	if common.GetHedgeAttempt(c) != nil {
+		req = req.WithContext(c.Request.Context())
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -42,6 +42,8 @@ func stopReasonClaude2OpenAI(reason string) string {
 		return "max_tokens"
 	case "tool_use":
 		return "tool_calls"
+	case "refusal":
+		return "content_filter"
 	default:
 		return reason
 	}
@@ -810,6 +812,8 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 }
 
 func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, requestMode int) {
+	info.CaptureContent("output_content", claudeInfo.ResponseText.String())
+	service.ReviewDeliveredCompletion(c, info, claudeInfo.ResponseText.String())
 	if info.RelayFormat == relaycommon.RelayFormatClaude {
 		// 说明流模式建立失败，可能为官方出错
 		if claudeInfo.Usage.PromptTokens == 0 {
@@ -845,21 +849,129 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 		Usage:        &dto.Usage{},
 	}
 	var err *dto.OpenAIErrorWithStatusCode
+	var filter *service.StreamContentFilter
+	if requestMode == RequestModeMessage {
+		filter = service.NewStreamContentFilter(c, info)
+	}
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
-		err = HandleStreamResponseData(c, info, claudeInfo, data, requestMode)
-		if err != nil {
-			return false
+		events := []string{data}
+		stopped := false
+		if filter != nil {
+			events, stopped = filterClaudeStreamData(filter, data)
+		}
+		for _, event := range events {
+			err = HandleStreamResponseData(c, info, claudeInfo, event, requestMode)
+			if err != nil {
+				return false
+			}
 		}
-		return true
+		return !stopped
 	})
 	if err != nil {
 		return err, nil
 	}
+	if filter.Stopped() {
+		// 输出被截断，只按已下发的文本计费
+		claudeInfo.Usage.CompletionTokens, _ = service.CountTextToken(claudeInfo.ResponseText.String(), info.UpstreamModelName)
+		claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + claudeInfo.Usage.CompletionTokens
+	}
 
 	HandleStreamFinalResponse(c, info, claudeInfo, requestMode)
 	return nil, claudeInfo.Usage
 }
 
+// filterClaudeStreamData 经过流式过滤器处理一个 Claude 事件，返回需要依次处理的事件与是否终止输出
+func filterClaudeStreamData(filter *service.StreamContentFilter, data string) ([]string, bool) {
+	if strings.Contains(data, `"object":"chat.completion.chunk"`) {
+		return []string{data}, false
+	}
+	var claudeResponse dto.ClaudeResponse
+	if err := common.DecodeJsonStr(data, &claudeResponse); err != nil {
+		return []string{data}, false
+	}
+	index := claudeResponse.GetIndex()
+	switch claudeResponse.Type {
+	case "content_block_delta":
+		if claudeResponse.Delta == nil || claudeResponse.Delta.Text == nil {
+			return []string{data}, false
+		}
+		text := *claudeResponse.Delta.Text
+		release, stopped := filter.Push(index, text)
+		if stopped {
+			events := make([]string, 0, 4)
+			if release != "" {
+				events = append(events, claudeTextDeltaEvent(index, release))
+			}
+			stopReason := "refusal"
+			events = append(events,
+				marshalClaudeEvent(dto.ClaudeResponse{Type: "content_block_stop", Index: common.GetPointer(index)}),
+				marshalClaudeEvent(dto.ClaudeResponse{
+					Type:  "message_delta",
+					Delta: &dto.ClaudeMediaMessage{StopReason: &stopReason},
+					Usage: &dto.ClaudeUsage{},
+				}),
+				marshalClaudeEvent(dto.ClaudeResponse{Type: "message_stop"}),
+			)
+			return events, true
+		}
+		if release == "" {
+			return nil, false
+		}
+		if release == text {
+			return []string{data}, false
+		}
+		return []string{claudeTextDeltaEvent(index, release)}, false
+	case "content_block_stop":
+		if held := filter.Flush(index); held != "" {
+			return []string{claudeTextDeltaEvent(index, held), data}, false
+		}
+	case "message_delta", "message_stop":
+		events := make([]string, 0, 2)
+		for _, pendingIndex := range filter.PendingIndexes() {
+			events = append(events, claudeTextDeltaEvent(pendingIndex, filter.Flush(pendingIndex)))
+		}
+		return append(events, data), false
+	}
+	return []string{data}, false
+}
+
+func claudeTextDeltaEvent(index int, text string) string {
+	return marshalClaudeEvent(dto.ClaudeResponse{
+		Type:  "content_block_delta",
+		Index: common.GetPointer(index),
+		Delta: &dto.ClaudeMediaMessage{Type: "text_delta", Text: common.GetPointer(text)},
+	})
+}
+
+func marshalClaudeEvent(claudeResponse dto.ClaudeResponse) string {
+	data, _ := json.Marshal(claudeResponse)
+	return string(data)
+}
+
+// moderateClaudeResponse 非流式响应在下发前审核文本内容，返回响应是否被改写
+func moderateClaudeResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeResponse *dto.ClaudeResponse) bool {
+	if !service.ShouldModerateCompletion(info.Group) {
+		return false
+	}
+	moderated := false
+	for i := range claudeResponse.Content {
+		content := &claudeResponse.Content[i]
+		if content.Type != "text" || content.Text == nil {
+			continue
+		}
+		text, blocked := service.ModerateCompletion(c, info, *content.Text)
+		if text != *content.Text {
+			content.SetText(text)
+			moderated = true
+		}
+		if blocked {
+			claudeResponse.StopReason = "refusal"
+			moderated = true
+		}
+	}
+	return moderated
+}
+
 func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, data []byte, requestMode int) *dto.OpenAIErrorWithStatusCode {
 	var claudeResponse dto.ClaudeResponse
 	err := common.DecodeJson(data, &claudeResponse)
@@ -881,6 +993,19 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 	claudeInfo.Usage.TotalTokens = claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens
 	claudeInfo.Usage.PromptTokensDetails.CachedTokens = claudeResponse.Usage.CacheReadInputTokens
 	claudeInfo.Usage.PromptTokensDetails.CachedCreationTokens = claudeResponse.Usage.CacheCreationInputTokens
+	if common.LogChatContentEnabled {
+		var outputTexts []string
+		for _, content := range claudeResponse.Content {
+			if content.Type == "text" {
+				outputTexts = append(outputTexts, content.GetText())
+			}
+		}
+		if claudeResponse.Completion != "" {
+			outputTexts = append(outputTexts, claudeResponse.Completion)
+		}
+		info.CaptureContent("output_content", strings.Join(outputTexts, "\n"))
+	}
+	moderated := moderateClaudeResponse(c, info, &claudeResponse)
 	var responseData []byte
 	switch info.RelayFormat {
 	case relaycommon.RelayFormatOpenAI:
@@ -892,6 +1017,12 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 	case relaycommon.RelayFormatClaude:
 		responseData = data
+		if moderated {
+			responseData, err = json.Marshal(claudeResponse)
+			if err != nil {
+				return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+			}
+		}
 	}
 	c.Writer.Header().Set("Content-Type", "application/json")
 	c.Writer.WriteHeader(http.StatusOK)
@@ -26,6 +26,7 @@ import (
 	"veloera/dto"
 	"veloera/relay/channel"
 	relaycommon "veloera/relay/common"
+	"veloera/relay/constant"
 	"veloera/service"
 	"veloera/setting/model_setting"
 
@@ -35,6 +36,7 @@ import (
 )
 
 type Adaptor struct {
+	AudioRequest dto.AudioRequest
 }
 
 func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
@@ -44,8 +46,11 @@ func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dt
 }
 
 func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if info.RelayMode != constant.RelayModeAudioSpeech {
+		return nil, errors.New("not implemented")
+	}
+	a.AudioRequest = request
+	return ConvertTTSRequest(request)
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
@@ -181,6 +186,11 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayMode == constant.RelayModeAudioSpeech {
+		err, usage = GeminiTTSHandler(c, resp, info, a.AudioRequest)
+		return
+	}
+
 	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return GeminiImageHandler(c, resp, info)
 	}
@@ -181,3 +181,26 @@ type GeminiEmbeddingResponse struct {
 type ContentEmbedding struct {
 	Values []float64 `json:"values"`
 }
+
+// Gemini 语音合成请求，音频以 inlineData 返回
+type GeminiTTSRequest struct {
+	Contents         []GeminiChatContent       `json:"contents"`
+	GenerationConfig GeminiTTSGenerationConfig `json:"generationConfig"`
+}
+
+type GeminiTTSGenerationConfig struct {
+	ResponseModalities []string           `json:"responseModalities"`
+	SpeechConfig       GeminiSpeechConfig `json:"speechConfig"`
+}
+
+type GeminiSpeechConfig struct {
+	VoiceConfig GeminiVoiceConfig `json:"voiceConfig"`
+}
+
+type GeminiVoiceConfig struct {
+	PrebuiltVoiceConfig GeminiPrebuiltVoiceConfig `json:"prebuiltVoiceConfig"`
+}
+
+type GeminiPrebuiltVoiceConfig struct {
+	VoiceName string `json:"voiceName"`
+}
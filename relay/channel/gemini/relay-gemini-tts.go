@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package gemini
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini 语音合成输出 24kHz 16 位单声道 PCM
+const ttsSampleRate = 24000
+
+// ConvertTTSRequest 将 OpenAI 语音合成请求转为 Gemini 的音频输出请求，vertex 渠道复用
+func ConvertTTSRequest(request dto.AudioRequest) (io.Reader, error) {
+	if err := service.CheckTTSFormat("pcm", request.ResponseFormat); err != nil {
+		return nil, err
+	}
+	text := request.Input
+	if request.Instructions != "" {
+		// Gemini 通过自然语言控制语气
+		text = request.Instructions + ": " + request.Input
+	}
+	geminiRequest := GeminiTTSRequest{
+		Contents: []GeminiChatContent{{
+			Role:  "user",
+			Parts: []GeminiPart{{Text: text}},
+		}},
+		GenerationConfig: GeminiTTSGenerationConfig{
+			ResponseModalities: []string{"AUDIO"},
+			SpeechConfig: GeminiSpeechConfig{
+				VoiceConfig: GeminiVoiceConfig{
+					PrebuiltVoiceConfig: GeminiPrebuiltVoiceConfig{
+						VoiceName: operation_setting.MapTTSVoice("gemini", request.Voice),
+					},
+				},
+			},
+		},
+	}
+	jsonData, err := json.Marshal(geminiRequest)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(jsonData), nil
+}
+
+// GeminiTTSHandler 取出 inlineData 中的 PCM 音频，流式响应逐块输出
+func GeminiTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, request dto.AudioRequest) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	defer resp.Body.Close()
+	writer := service.NewTTSWriter(c, request.ResponseFormat, request.StreamFormat, "pcm", ttsSampleRate)
+	var usageMetadata GeminiUsageMetadata
+	handle := func(data []byte) error {
+		var geminiResponse GeminiChatResponse
+		if err := json.Unmarshal(data, &geminiResponse); err != nil {
+			return err
+		}
+		if geminiResponse.UsageMetadata.TotalTokenCount > 0 {
+			usageMetadata = geminiResponse.UsageMetadata
+		}
+		for _, candidate := range geminiResponse.Candidates {
+			for _, part := range candidate.Content.Parts {
+				if part.InlineData == nil || part.InlineData.Data == "" {
+					continue
+				}
+				audio, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+				if err != nil {
+					return err
+				}
+				if err := writer.Write(audio); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	var err error
+	if info.IsStream {
+		err = service.ScanSSEData(resp.Body, func(data string) error {
+			return handle([]byte(data))
+		})
+	} else {
+		var responseBody []byte
+		if responseBody, err = io.ReadAll(resp.Body); err == nil {
+			err = handle(responseBody)
+		}
+	}
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	usage := &dto.Usage{PromptTokens: info.PromptTokens, TotalTokens: info.PromptTokens}
+	if usageMetadata.TotalTokenCount > 0 {
+		usage.PromptTokens = usageMetadata.PromptTokenCount
+		usage.CompletionTokens = usageMetadata.CandidatesTokenCount
+		usage.TotalTokens = usageMetadata.TotalTokenCount
+	}
+	if err := writer.Close(usage); err != nil {
+		return service.OpenAIErrorWrapper(err, "write_audio_failed", http.StatusInternalServerError), nil
+	}
+	return nil, usage
+}
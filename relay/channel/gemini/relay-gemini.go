@@ -201,6 +201,28 @@ func extractGeminiOutputContent(info *relaycommon.RelayInfo, response *GeminiCha
 	}
 }
 
+// moderateGeminiResponse 非流式响应在下发前审核文本内容
+func moderateGeminiResponse(c *gin.Context, info *relaycommon.RelayInfo, response *GeminiChatResponse) {
+	if !service.ShouldModerateCompletion(info.Group) {
+		return
+	}
+	for i := range response.Candidates {
+		candidate := &response.Candidates[i]
+		for j := range candidate.Content.Parts {
+			part := &candidate.Content.Parts[j]
+			if part.Text == "" || part.Thought {
+				continue
+			}
+			text, blocked := service.ModerateCompletion(c, info, part.Text)
+			part.Text = text
+			if blocked {
+				finishReason := "SAFETY"
+				candidate.FinishReason = &finishReason
+			}
+		}
+	}
+}
+
 func extractGeminiStreamContent(info *relaycommon.RelayInfo, accumulatedContent string, accumulatedThinking string, accumulatedFunctionCalls []interface{}, accumulatedSafetyRatings []interface{}, accumulatedCodeExecutions []interface{}, multimodalSummary map[string]interface{}) {
 	if info.Other == nil {
 		info.Other = make(map[string]interface{})
@@ -919,6 +941,7 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 		"audio_count": 0,
 		"file_count":  0,
 	}
+	filter := service.NewStreamContentFilter(c, info)
 
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		var geminiResponse GeminiChatResponse
@@ -934,6 +957,12 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 			}
 			return false
 		}
+		modified, held, stopped := filterGeminiStreamResponse(filter, &geminiResponse)
+		if modified && info.RelayFormat == relaycommon.RelayFormatGemini {
+			if filtered, err := json.Marshal(geminiResponse); err == nil {
+				data = string(filtered)
+			}
+		}
 
 		for _, candidate := range geminiResponse.Candidates {
 			if len(candidate.SafetyRatings) > 0 {
@@ -990,13 +1019,16 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 			usage.CompletionTokens = geminiResponse.UsageMetadata.CandidatesTokenCount
 			usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
 		}
+		if held && geminiResponse.UsageMetadata.TotalTokenCount == 0 {
+			return true
+		}
 
 		if info.RelayFormat == relaycommon.RelayFormatGemini {
 			if err := helper.StringData(c, data); err != nil {
 				common.LogError(c, "error writing gemini stream chunk: "+err.Error())
 				return false
 			}
-			return true
+			return !stopped
 		}
 
 		response, isStop, hasImage := streamResponseGeminiChat2OpenAI(&geminiResponse)
@@ -1014,10 +1046,15 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 			response := helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, constant.FinishReasonStop)
 			helper.ObjectData(c, response)
 		}
-		return true
+		return !stopped
 	})
+	if filter.Stopped() {
+		// 输出被截断，只按已下发的文本计费
+		usage.CompletionTokens, _ = service.CountTextToken(accumulatedContent.String(), info.UpstreamModelName)
+	}
 
 	extractGeminiStreamContent(info, accumulatedContent.String(), accumulatedThinking.String(), accumulatedFunctionCalls, accumulatedSafetyRatings, accumulatedCodeExecutions, multimodalSummary)
+	service.ReviewDeliveredCompletion(c, info, accumulatedContent.String())
 
 	var response *dto.ChatCompletionsStreamResponse
 
@@ -1046,6 +1083,58 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 	return nil, usage
 }
 
+// filterGeminiStreamResponse 经过流式过滤器处理一个 Gemini 分片中的文本，
+// 返回分片是否被改写、文本是否全部被暂存以及是否终止输出
+func filterGeminiStreamResponse(filter *service.StreamContentFilter, geminiResponse *GeminiChatResponse) (modified bool, held bool, stopped bool) {
+	if filter == nil {
+		return false, false, false
+	}
+	held = true
+	for i := range geminiResponse.Candidates {
+		candidate := &geminiResponse.Candidates[i]
+		index := int(candidate.Index)
+		parts := make([]GeminiPart, 0, len(candidate.Content.Parts))
+		for _, part := range candidate.Content.Parts {
+			if part.Thought || part.Text == "" || stopped {
+				if !stopped {
+					parts = append(parts, part)
+				}
+				continue
+			}
+			release, stop := filter.Push(index, part.Text)
+			if release != part.Text {
+				modified = true
+			}
+			if stop {
+				stopped = true
+			}
+			if release != "" {
+				part.Text = release
+				parts = append(parts, part)
+			}
+		}
+		if stopped {
+			candidate.FinishReason = common.GetPointer("SAFETY")
+		} else if candidate.FinishReason != nil {
+			if rest := filter.Flush(index); rest != "" {
+				parts = append(parts, GeminiPart{Text: rest})
+				modified = true
+			}
+		}
+		if len(parts) != len(candidate.Content.Parts) {
+			modified = true
+		}
+		candidate.Content.Parts = parts
+		if len(parts) > 0 || candidate.FinishReason != nil {
+			held = false
+		}
+	}
+	if stopped {
+		modified = true
+	}
+	return modified, modified && held, stopped
+}
+
 func GeminiChatHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	extractGeminiInputContent(info)
 
@@ -1075,6 +1164,7 @@ func GeminiChatHandler(c *gin.Context, resp *http.Response, info *relaycommon.Re
 	}
 
 	extractGeminiOutputContent(info, &geminiResponse)
+	moderateGeminiResponse(c, info, &geminiResponse)
 	usage := buildGeminiUsage(&geminiResponse)
 
 	if info.RelayFormat == relaycommon.RelayFormatGemini {
@@ -24,6 +24,8 @@ var ModelList = []string{
 	"abab6-chat",
 	"abab5.5-chat",
 	"abab5.5s-chat",
+	"speech-02-hd",
+	"speech-02-turbo",
 }
 
 var ChannelName = "minimax"
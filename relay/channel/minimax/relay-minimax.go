@@ -19,8 +19,12 @@ package minimax
 import (
 	"fmt"
 	relaycommon "veloera/relay/common"
+	"veloera/relay/constant"
 )
 
 func GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == constant.RelayModeAudioSpeech {
+		return fmt.Sprintf("%s/v1/t2a_v2", info.BaseUrl), nil
+	}
 	return fmt.Sprintf("%s/v1/text/chatcompletion_v2", info.BaseUrl), nil
 }
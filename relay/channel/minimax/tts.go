@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package minimax
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// https://platform.minimaxi.com/document/T2A%20V2
+
+const ttsSampleRate = 24000
+
+// 流式响应中 status 为 2 的最后一条消息会重复携带完整音频
+const ttsStatusFinished = 2
+
+type TTSRequest struct {
+	Model        string          `json:"model"`
+	Text         string          `json:"text"`
+	Stream       bool            `json:"stream"`
+	VoiceSetting TTSVoiceSetting `json:"voice_setting"`
+	AudioSetting TTSAudioSetting `json:"audio_setting"`
+}
+
+type TTSVoiceSetting struct {
+	VoiceId string  `json:"voice_id"`
+	Speed   float64 `json:"speed"`
+}
+
+type TTSAudioSetting struct {
+	SampleRate int    `json:"sample_rate"`
+	Format     string `json:"format"`
+	Channel    int    `json:"channel"`
+}
+
+type TTSResponse struct {
+	Data *struct {
+		Audio  string `json:"audio"`
+		Status int    `json:"status"`
+	} `json:"data"`
+	ExtraInfo *struct {
+		UsageCharacters int `json:"usage_characters"`
+	} `json:"extra_info"`
+	BaseResp struct {
+		StatusCode int    `json:"status_code"`
+		StatusMsg  string `json:"status_msg"`
+	} `json:"base_resp"`
+}
+
+// ConvertTTSRequest 将 OpenAI 语音合成请求转为 t2a_v2 请求，返回上游输出的音频格式
+func ConvertTTSRequest(info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, string, error) {
+	// wav 不支持流式输出
+	supported := []string{"mp3", "pcm", "flac", "wav"}
+	if info.IsStream {
+		supported = supported[:3]
+	}
+	sourceFormat := service.PickTTSSourceFormat(request.ResponseFormat, supported...)
+	if err := service.CheckTTSFormat(sourceFormat, request.ResponseFormat); err != nil {
+		return nil, "", err
+	}
+	ttsRequest := TTSRequest{
+		Model:  request.Model,
+		Text:   request.Input,
+		Stream: info.IsStream,
+		VoiceSetting: TTSVoiceSetting{
+			VoiceId: operation_setting.MapTTSVoice(ChannelName, request.Voice),
+			Speed:   1.0,
+		},
+		AudioSetting: TTSAudioSetting{
+			SampleRate: ttsSampleRate,
+			Format:     sourceFormat,
+			Channel:    1,
+		},
+	}
+	if request.Speed > 0 {
+		ttsRequest.VoiceSetting.Speed = request.Speed
+	}
+	jsonData, err := json.Marshal(ttsRequest)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(jsonData), sourceFormat, nil
+}
+
+// TTSHandler 解码十六进制音频，流式响应逐块输出
+func TTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, request dto.AudioRequest, sourceFormat string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	defer resp.Body.Close()
+	writer := service.NewTTSWriter(c, request.ResponseFormat, request.StreamFormat, sourceFormat, ttsSampleRate)
+	usage := &dto.Usage{PromptTokens: info.PromptTokens, TotalTokens: info.PromptTokens}
+	handle := func(data []byte) error {
+		var ttsResponse TTSResponse
+		if err := json.Unmarshal(data, &ttsResponse); err != nil {
+			return err
+		}
+		if ttsResponse.BaseResp.StatusCode != 0 {
+			return fmt.Errorf("minimax tts error %d: %s", ttsResponse.BaseResp.StatusCode, ttsResponse.BaseResp.StatusMsg)
+		}
+		if ttsResponse.Data == nil || ttsResponse.Data.Audio == "" {
+			return nil
+		}
+		if info.IsStream && ttsResponse.Data.Status == ttsStatusFinished {
+			return nil
+		}
+		audio, err := hex.DecodeString(ttsResponse.Data.Audio)
+		if err != nil {
+			return err
+		}
+		return writer.Write(audio)
+	}
+	var err error
+	if info.IsStream {
+		err = service.ScanSSEData(resp.Body, func(data string) error {
+			return handle([]byte(data))
+		})
+	} else {
+		var responseBody []byte
+		if responseBody, err = io.ReadAll(resp.Body); err == nil {
+			err = handle(responseBody)
+		}
+	}
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if err := writer.Close(usage); err != nil {
+		return service.OpenAIErrorWrapper(err, "write_audio_failed", http.StatusInternalServerError), nil
+	}
+	return nil, usage
+}
@@ -54,6 +54,16 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	switch info.RelayMode {
 	case relayconstant.RelayModeEmbeddings:
 		return info.BaseUrl + "/api/embed", nil
+	case relayconstant.RelayModeChatCompletions:
+		if useNativeAPI(info) {
+			return info.BaseUrl + "/api/chat", nil
+		}
+		return relaycommon.GetFullRequestURL(info.BaseUrl, info.RequestURLPath, info.ChannelType), nil
+	case relayconstant.RelayModeCompletions:
+		if useNativeAPI(info) {
+			return info.BaseUrl + "/api/generate", nil
+		}
+		return relaycommon.GetFullRequestURL(info.BaseUrl, info.RequestURLPath, info.ChannelType), nil
 	default:
 		return relaycommon.GetFullRequestURL(info.BaseUrl, info.RequestURLPath, info.ChannelType), nil
 	}
@@ -69,6 +79,12 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if useNativeAPI(info) {
+		if info.RelayMode == relayconstant.RelayModeCompletions {
+			return requestOpenAI2OllamaGenerate(c, info, request)
+		}
+		return requestOpenAI2OllamaChat(c, info, request)
+	}
 	return requestOpenAI2Ollama(*request)
 }
 
@@ -90,6 +106,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if useNativeAPI(info) {
+		if info.IsStream {
+			err, usage = ollamaNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = ollamaNativeHandler(c, resp, info)
+		}
+		return
+	}
 	if info.IsStream {
 		err, usage = openai.OaiStreamHandler(c, resp, info)
 	} else {
@@ -109,3 +133,8 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+// SupportsOpenAIPassThrough 原生接口的请求结构与 OpenAI 不兼容，不能透传原始请求体
+func (a *Adaptor) SupportsOpenAIPassThrough(info *relaycommon.RelayInfo) bool {
+	return !useNativeAPI(info)
+}
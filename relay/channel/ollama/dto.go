@@ -16,7 +16,10 @@
 // along with this program. If not, see <https://www.gnu.org/licenses/>.
 package ollama
 
-import "veloera/dto"
+import (
+	"encoding/json"
+	"veloera/dto"
+)
 
 type OllamaRequest struct {
 	Model            string                `json:"model,omitempty"`
@@ -59,3 +62,112 @@ type OllamaEmbeddingResponse struct {
 	Model     string      `json:"model"`
 	Embedding [][]float64 `json:"embeddings,omitempty"`
 }
+
+// 以下为 Ollama 原生接口的请求与响应结构
+
+type OllamaChatMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"` // 不带 data: 前缀的 base64
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type OllamaToolCall struct {
+	Function OllamaToolCallFunction `json:"function"`
+}
+
+type OllamaToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type OllamaChatRequest struct {
+	Model     string                `json:"model"`
+	Messages  []OllamaChatMessage   `json:"messages"`
+	Tools     []dto.ToolCallRequest `json:"tools,omitempty"`
+	Format    any                   `json:"format,omitempty"`
+	Options   map[string]any        `json:"options,omitempty"`
+	Stream    bool                  `json:"stream"`
+	KeepAlive any                   `json:"keep_alive,omitempty"`
+	Think     any                   `json:"think,omitempty"`
+}
+
+type OllamaGenerateRequest struct {
+	Model     string         `json:"model"`
+	Prompt    string         `json:"prompt"`
+	Suffix    string         `json:"suffix,omitempty"`
+	Images    []string       `json:"images,omitempty"`
+	Format    any            `json:"format,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
+	Stream    bool           `json:"stream"`
+	KeepAlive any            `json:"keep_alive,omitempty"`
+	Think     any            `json:"think,omitempty"`
+}
+
+// OllamaNativeResponse 同时兼容 /api/chat（message）与 /api/generate（response）的响应
+type OllamaNativeResponse struct {
+	Model           string            `json:"model"`
+	CreatedAt       string            `json:"created_at"`
+	Message         OllamaChatMessage `json:"message"`
+	Response        string            `json:"response"`
+	Thinking        string            `json:"thinking"`
+	Done            bool              `json:"done"`
+	DoneReason      string            `json:"done_reason"`
+	PromptEvalCount int               `json:"prompt_eval_count"`
+	EvalCount       int               `json:"eval_count"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// OllamaCompletionResponse /api/generate 转换后的 OpenAI text_completion 响应
+type OllamaCompletionResponse struct {
+	Id      string                   `json:"id"`
+	Object  string                   `json:"object"`
+	Created int64                    `json:"created"`
+	Model   string                   `json:"model"`
+	Choices []OllamaCompletionChoice `json:"choices"`
+	Usage   *dto.Usage               `json:"usage,omitempty"`
+}
+
+type OllamaCompletionChoice struct {
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// OllamaModel /api/tags 返回的本地模型信息
+type OllamaModel struct {
+	Name       string             `json:"name"`
+	Model      string             `json:"model"`
+	ModifiedAt string             `json:"modified_at"`
+	Size       int64              `json:"size"`
+	Digest     string             `json:"digest"`
+	Details    OllamaModelDetails `json:"details"`
+}
+
+type OllamaModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+type OllamaPullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+// OllamaPullProgress /api/pull 流式返回的进度
+type OllamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,490 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package ollama
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/relay/helper"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useNativeAPI 渠道是否启用 Ollama 原生接口，仅对对话与文本补全生效
+func useNativeAPI(info *relaycommon.RelayInfo) bool {
+	native, _ := info.ChannelSetting[constant.ChannelSettingOllamaNativeAPI].(bool)
+	return native && (info.RelayMode == relayconstant.RelayModeChatCompletions || info.RelayMode == relayconstant.RelayModeCompletions)
+}
+
+// nativeParams OpenAI 请求结构之外、只有原生接口支持的参数
+type nativeParams struct {
+	KeepAlive any            `json:"keep_alive"`
+	Options   map[string]any `json:"options"`
+	Think     any            `json:"think"`
+}
+
+// readNativeParams 从原始请求体的顶层或 extra_body 中读取原生参数，顶层优先
+func readNativeParams(c *gin.Context) nativeParams {
+	var body struct {
+		nativeParams
+		ExtraBody *nativeParams `json:"extra_body"`
+	}
+	if raw, err := common.GetRequestBody(c); err == nil {
+		_ = json.Unmarshal(raw, &body)
+	}
+	params := body.nativeParams
+	if body.ExtraBody != nil {
+		if params.KeepAlive == nil {
+			params.KeepAlive = body.ExtraBody.KeepAlive
+		}
+		if params.Think == nil {
+			params.Think = body.ExtraBody.Think
+		}
+		for key, value := range body.ExtraBody.Options {
+			if params.Options == nil {
+				params.Options = make(map[string]any)
+			}
+			if _, ok := params.Options[key]; !ok {
+				params.Options[key] = value
+			}
+		}
+	}
+	return params
+}
+
+// buildNativeOptions 合并渠道默认 options、OpenAI 采样参数与请求中的 options，后者优先
+func buildNativeOptions(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest, params nativeParams) map[string]any {
+	options := make(map[string]any)
+	if defaults, ok := info.ChannelSetting[constant.ChannelSettingOllamaOptions].(map[string]interface{}); ok {
+		for key, value := range defaults {
+			options[key] = value
+		}
+	}
+	if request.Temperature != nil {
+		options["temperature"] = *request.Temperature
+	}
+	if request.TopP != 0 {
+		options["top_p"] = request.TopP
+	}
+	if request.TopK != 0 {
+		options["top_k"] = request.TopK
+	}
+	if request.Seed != 0 {
+		options["seed"] = int(request.Seed)
+	}
+	if request.FrequencyPenalty != 0 {
+		options["frequency_penalty"] = request.FrequencyPenalty
+	}
+	if request.PresencePenalty != 0 {
+		options["presence_penalty"] = request.PresencePenalty
+	}
+	if maxTokens := max(request.MaxTokens, request.MaxCompletionTokens); maxTokens > 0 {
+		options["num_predict"] = maxTokens
+	}
+	switch stop := request.Stop.(type) {
+	case string:
+		options["stop"] = []string{stop}
+	case []any:
+		options["stop"] = stop
+	}
+	for key, value := range params.Options {
+		options[key] = value
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+func nativeKeepAlive(info *relaycommon.RelayInfo, params nativeParams) any {
+	if params.KeepAlive != nil {
+		return params.KeepAlive
+	}
+	if keepAlive, ok := info.ChannelSetting[constant.ChannelSettingOllamaKeepAlive]; ok && keepAlive != "" {
+		return keepAlive
+	}
+	return nil
+}
+
+func nativeThink(request *dto.GeneralOpenAIRequest, params nativeParams) any {
+	if params.Think != nil {
+		return params.Think
+	}
+	if request.ReasoningEffort != "" {
+		return true
+	}
+	return nil
+}
+
+func nativeFormat(request *dto.GeneralOpenAIRequest) any {
+	if request.ResponseFormat == nil {
+		return nil
+	}
+	switch request.ResponseFormat.Type {
+	case "json_object":
+		return "json"
+	case "json_schema":
+		if request.ResponseFormat.JsonSchema != nil && request.ResponseFormat.JsonSchema.Schema != nil {
+			return request.ResponseFormat.JsonSchema.Schema
+		}
+		return "json"
+	}
+	return nil
+}
+
+// imageBase64 原生接口的 images 只接受不带前缀的 base64
+func imageBase64(url string) (string, error) {
+	if strings.HasPrefix(url, "http") {
+		fileData, err := service.GetFileBase64FromUrl(url)
+		if err != nil {
+			return "", err
+		}
+		return fileData.Base64Data, nil
+	}
+	if idx := strings.Index(url, "base64,"); strings.HasPrefix(url, "data:") && idx >= 0 {
+		return url[idx+len("base64,"):], nil
+	}
+	return url, nil
+}
+
+func requestOpenAI2OllamaChat(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*OllamaChatRequest, error) {
+	params := readNativeParams(c)
+	messages := make([]OllamaChatMessage, 0, len(request.Messages))
+	toolNames := make(map[string]string)
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		ollamaMessage := OllamaChatMessage{
+			Role:     message.Role,
+			Thinking: message.ReasoningContent,
+		}
+		if message.Role == "developer" {
+			ollamaMessage.Role = "system"
+		}
+		if message.IsStringContent() {
+			ollamaMessage.Content = message.StringContent()
+		} else {
+			var texts []string
+			for _, content := range message.ParseContent() {
+				switch content.Type {
+				case dto.ContentTypeText:
+					texts = append(texts, content.Text)
+				case dto.ContentTypeImageURL:
+					image, err := imageBase64(content.GetImageMedia().Url)
+					if err != nil {
+						return nil, err
+					}
+					ollamaMessage.Images = append(ollamaMessage.Images, image)
+				}
+			}
+			ollamaMessage.Content = strings.Join(texts, "\n")
+		}
+		for _, toolCall := range message.ParseToolCalls() {
+			toolNames[toolCall.ID] = toolCall.Function.Name
+			arguments := json.RawMessage(toolCall.Function.Arguments)
+			if !json.Valid(arguments) {
+				arguments = json.RawMessage("{}")
+			}
+			ollamaMessage.ToolCalls = append(ollamaMessage.ToolCalls, OllamaToolCall{
+				Function: OllamaToolCallFunction{Name: toolCall.Function.Name, Arguments: arguments},
+			})
+		}
+		if message.Role == "tool" {
+			ollamaMessage.ToolName = toolNames[message.ToolCallId]
+		}
+		messages = append(messages, ollamaMessage)
+	}
+	return &OllamaChatRequest{
+		Model:     request.Model,
+		Messages:  messages,
+		Tools:     request.Tools,
+		Format:    nativeFormat(request),
+		Options:   buildNativeOptions(info, request, params),
+		Stream:    request.Stream,
+		KeepAlive: nativeKeepAlive(info, params),
+		Think:     nativeThink(request, params),
+	}, nil
+}
+
+func requestOpenAI2OllamaGenerate(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*OllamaGenerateRequest, error) {
+	params := readNativeParams(c)
+	var prompt string
+	switch p := request.Prompt.(type) {
+	case string:
+		prompt = p
+	case []any:
+		if len(p) > 1 {
+			return nil, errors.New("ollama native api does not support batch prompts")
+		}
+		if len(p) == 1 {
+			prompt, _ = p[0].(string)
+		}
+	}
+	suffix, _ := request.Suffix.(string)
+	return &OllamaGenerateRequest{
+		Model:     request.Model,
+		Prompt:    prompt,
+		Suffix:    suffix,
+		Format:    nativeFormat(request),
+		Options:   buildNativeOptions(info, request, params),
+		Stream:    request.Stream,
+		KeepAlive: nativeKeepAlive(info, params),
+		Think:     nativeThink(request, params),
+	}, nil
+}
+
+func nativeFinishReason(response *OllamaNativeResponse) string {
+	if len(response.Message.ToolCalls) > 0 {
+		return constant.FinishReasonToolCalls
+	}
+	if response.DoneReason == "length" {
+		return constant.FinishReasonLength
+	}
+	return constant.FinishReasonStop
+}
+
+func nativeToolCalls(toolCalls []OllamaToolCall, stream bool) []dto.ToolCallResponse {
+	result := make([]dto.ToolCallResponse, 0, len(toolCalls))
+	for i, toolCall := range toolCalls {
+		call := dto.ToolCallResponse{
+			ID:   fmt.Sprintf("call_%s", common.GetUUID()),
+			Type: "function",
+			Function: dto.FunctionResponse{
+				Name:      toolCall.Function.Name,
+				Arguments: string(toolCall.Function.Arguments),
+			},
+		}
+		if stream {
+			call.SetIndex(i)
+		}
+		result = append(result, call)
+	}
+	return result
+}
+
+// nativeUsage 使用 prompt_eval_count 与 eval_count 计费；提示词命中缓存时 Ollama 不返回 prompt_eval_count，回退到本地估算
+func nativeUsage(info *relaycommon.RelayInfo, response *OllamaNativeResponse, responseText string) *dto.Usage {
+	usage := &dto.Usage{
+		PromptTokens:     response.PromptEvalCount,
+		CompletionTokens: response.EvalCount,
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	if usage.CompletionTokens == 0 && responseText != "" {
+		usage.CompletionTokens, _ = service.CountTextToken(responseText, info.UpstreamModelName)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+func ollamaNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var ollamaResponse OllamaNativeResponse
+	err = json.Unmarshal(responseBody, &ollamaResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if ollamaResponse.Error != "" {
+		return service.OpenAIErrorWrapper(errors.New(ollamaResponse.Error), "ollama_error", resp.StatusCode), nil
+	}
+
+	id := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	finishReason := nativeFinishReason(&ollamaResponse)
+	var fullResponse any
+	if info.RelayMode == relayconstant.RelayModeCompletions {
+		info.CaptureContent("output_content", ollamaResponse.Response)
+		usage := nativeUsage(info, &ollamaResponse, ollamaResponse.Response)
+		fullResponse = &OllamaCompletionResponse{
+			Id:      id,
+			Object:  "text_completion",
+			Created: common.GetTimestamp(),
+			Model:   info.UpstreamModelName,
+			Choices: []OllamaCompletionChoice{{Text: ollamaResponse.Response, FinishReason: &finishReason}},
+			Usage:   usage,
+		}
+		return writeNativeResponse(c, resp, fullResponse, usage)
+	}
+
+	content := ollamaResponse.Message.Content
+	usage := nativeUsage(info, &ollamaResponse, content)
+	info.CaptureContent("output_content", content)
+	if service.ShouldModerateCompletion(info.Group) {
+		moderated, blocked := service.ModerateCompletion(c, info, content)
+		content = moderated
+		if blocked {
+			finishReason = constant.FinishReasonContentFilter
+		}
+	}
+	message := dto.Message{Role: "assistant", ReasoningContent: ollamaResponse.Message.Thinking}
+	message.SetStringContent(content)
+	if len(ollamaResponse.Message.ToolCalls) > 0 {
+		message.SetToolCalls(nativeToolCalls(ollamaResponse.Message.ToolCalls, false))
+	}
+	fullResponse = &dto.OpenAITextResponse{
+		Id:      id,
+		Model:   info.UpstreamModelName,
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []dto.OpenAITextResponseChoice{{Message: message, FinishReason: finishReason}},
+		Usage:   *usage,
+	}
+	return writeNativeResponse(c, resp, fullResponse, usage)
+}
+
+func writeNativeResponse(c *gin.Context, resp *http.Response, fullResponse any, usage *dto.Usage) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	jsonResponse, err := json.Marshal(fullResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil, usage
+}
+
+// ollamaNativeStreamHandler 原生接口以 NDJSON 流式返回，逐行转换为 OpenAI 的 SSE 分片
+func ollamaNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	defer resp.Body.Close()
+	id := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdAt := common.GetTimestamp()
+	isCompletions := info.RelayMode == relayconstant.RelayModeCompletions
+	var filter *service.StreamContentFilter
+	if !isCompletions {
+		filter = service.NewStreamContentFilter(c, info)
+	}
+
+	sendChunk := func(content string, thinking string, toolCalls []OllamaToolCall, finishReason *string) {
+		var chunk any
+		if isCompletions {
+			chunk = &OllamaCompletionResponse{
+				Id:      id,
+				Object:  "text_completion",
+				Created: createdAt,
+				Model:   info.UpstreamModelName,
+				Choices: []OllamaCompletionChoice{{Text: content, FinishReason: finishReason}},
+			}
+		} else {
+			choice := dto.ChatCompletionsStreamResponseChoice{FinishReason: finishReason}
+			if content != "" {
+				choice.Delta.SetContentString(content)
+			}
+			if thinking != "" {
+				choice.Delta.SetReasoningContent(thinking)
+			}
+			if len(toolCalls) > 0 {
+				choice.Delta.ToolCalls = nativeToolCalls(toolCalls, true)
+			}
+			chunk = &dto.ChatCompletionsStreamResponse{
+				Id:      id,
+				Object:  "chat.completion.chunk",
+				Created: createdAt,
+				Model:   info.UpstreamModelName,
+				Choices: []dto.ChatCompletionsStreamResponseChoice{choice},
+			}
+		}
+		if err := helper.ObjectData(c, chunk); err != nil {
+			common.LogError(c, "send_stream_response_failed: "+err.Error())
+		}
+	}
+
+	var responseText strings.Builder
+	var last OllamaNativeResponse
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, helper.InitialScannerBufferSize), helper.MaxScannerBufferSize)
+	helper.SetEventStreamHeaders(c)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var chunk OllamaNativeResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			common.LogError(c, "error unmarshalling stream response: "+err.Error())
+			continue
+		}
+		if chunk.Error != "" {
+			common.LogError(c, "ollama stream error: "+chunk.Error)
+			break
+		}
+		info.SetFirstResponseTime()
+		last = chunk
+
+		content, thinking := chunk.Message.Content, chunk.Message.Thinking
+		if isCompletions {
+			content, thinking = chunk.Response, chunk.Thinking
+		}
+		release, stopped := filter.Push(0, content)
+		if stopped {
+			responseText.WriteString(release)
+			sendChunk(release, "", nil, common.GetPointer(constant.FinishReasonContentFilter))
+			break
+		}
+		if chunk.Done {
+			release += filter.Flush(0)
+		}
+		responseText.WriteString(release)
+		if release != "" || thinking != "" || len(chunk.Message.ToolCalls) > 0 {
+			sendChunk(release, thinking, chunk.Message.ToolCalls, nil)
+		}
+		if chunk.Done {
+			sendChunk("", "", nil, common.GetPointer(nativeFinishReason(&chunk)))
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		common.LogError(c, "error_scanning_stream_response: "+err.Error())
+	}
+
+	if filter.Stopped() {
+		// 输出被截断，只按已下发的文本计费
+		last.EvalCount = 0
+	}
+	usage := nativeUsage(info, &last, responseText.String())
+	info.CaptureContent("output_content", responseText.String())
+	if !isCompletions {
+		service.ReviewDeliveredCompletion(c, info, responseText.String())
+	}
+	if info.ShouldIncludeUsage {
+		response := helper.GenerateFinalUsageResponse(id, createdAt, info.UpstreamModelName, *usage)
+		if isCompletions {
+			response.Object = "text_completion"
+		}
+		if err := helper.ObjectData(c, response); err != nil {
+			common.LogError(c, "send final response failed: "+err.Error())
+		}
+	}
+	helper.Done(c)
+	return nil, usage
+}
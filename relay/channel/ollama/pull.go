@@ -0,0 +1,106 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// FetchTags 读取 Ollama 本地已有的模型
+func FetchTags(ctx context.Context, client *http.Client, baseURL string, key string) ([]OllamaModel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	var tags OllamaTagsResponse
+	if err = json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+// PullModel 在 Ollama 上拉取模型，每收到一条进度调用一次 onProgress，onProgress 返回错误时中止
+func PullModel(ctx context.Context, client *http.Client, baseURL string, key string, model string, onProgress func(progress OllamaPullProgress) error) error {
+	body, err := json.Marshal(OllamaPullRequest{Model: model, Stream: true})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("status code: %d, %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	succeeded := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var progress OllamaPullProgress
+		if err = json.Unmarshal([]byte(line), &progress); err != nil {
+			continue
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+		if progress.Status == "success" {
+			succeeded = true
+		}
+		if err = onProgress(progress); err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if !succeeded {
+		return errors.New("pull finished without success status")
+	}
+	return nil
+}
@@ -45,8 +45,10 @@ import (
 )
 
 type Adaptor struct {
-	ChannelType    int
-	ResponseFormat string
+	ChannelType     int
+	ResponseFormat  string
+	AudioRequest    dto.AudioRequest
+	TTSSourceFormat string
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
@@ -222,6 +224,12 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
 	a.ResponseFormat = request.ResponseFormat
 	if info.RelayMode == constant.RelayModeAudioSpeech {
+		if info.ChannelType == common.ChannelTypeMiniMax {
+			a.AudioRequest = request
+			reader, sourceFormat, err := minimax.ConvertTTSRequest(info, request)
+			a.TTSSourceFormat = sourceFormat
+			return reader, err
+		}
 		jsonData, err := json.Marshal(request)
 		if err != nil {
 			return nil, fmt.Errorf("error marshalling object: %w", err)
@@ -302,6 +310,10 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 	case constant.RelayModeRealtime:
 		err, usage = OpenaiRealtimeHandler(c, info)
 	case constant.RelayModeAudioSpeech:
+		if info.ChannelType == common.ChannelTypeMiniMax {
+			err, usage = minimax.TTSHandler(c, resp, info, a.AudioRequest, a.TTSSourceFormat)
+			break
+		}
 		err, usage = OpenaiTTSHandler(c, resp, info)
 	case constant.RelayModeAudioTranslation:
 		fallthrough
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
 	relayconstant "veloera/relay/constant"
@@ -203,3 +204,87 @@ func handleFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStream
 		}
 	}
 }
+
+// filterStreamData 经过流式过滤器处理一个 chat.completion.chunk，返回改写后的数据与是否终止输出；
+// 返回空字符串表示该分片的内容全部被暂存，无需下发
+func filterStreamData(filter *service.StreamContentFilter, data string) (string, bool) {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+		return data, false
+	}
+	modified := false
+	stopped := false
+	for i := range streamResponse.Choices {
+		choice := &streamResponse.Choices[i]
+		content := choice.Delta.GetContentString()
+		release, stop := filter.Push(choice.Index, content)
+		if stop {
+			stopped = true
+			choice.FinishReason = common.GetPointer(constant.FinishReasonContentFilter)
+		} else if choice.FinishReason != nil {
+			release += filter.Flush(choice.Index)
+		}
+		if release != content {
+			modified = true
+			if release == "" {
+				choice.Delta.Content = nil
+			} else {
+				choice.Delta.SetContentString(release)
+			}
+		}
+	}
+	if !modified {
+		return data, stopped
+	}
+	if !stopped && streamResponse.Usage == nil && isEmptyStreamResponse(&streamResponse) {
+		return "", false
+	}
+	filtered, err := json.Marshal(streamResponse)
+	if err != nil {
+		return data, stopped
+	}
+	return string(filtered), stopped
+}
+
+func isEmptyStreamResponse(streamResponse *dto.ChatCompletionsStreamResponse) bool {
+	for _, choice := range streamResponse.Choices {
+		if choice.Delta.GetContentString() != "" || choice.Delta.GetReasoningContent() != "" ||
+			choice.Delta.Role != "" || len(choice.Delta.ToolCalls) > 0 || choice.FinishReason != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// appendHeldContent 上游未正常结束时，将过滤器暂存的文本补到最后一个分片中
+func appendHeldContent(filter *service.StreamContentFilter, data string) string {
+	indexes := filter.PendingIndexes()
+	if len(indexes) == 0 || data == "" {
+		return data
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+		return data
+	}
+	for _, index := range indexes {
+		held := filter.Flush(index)
+		found := false
+		for i := range streamResponse.Choices {
+			if streamResponse.Choices[i].Index == index {
+				streamResponse.Choices[i].Delta.SetContentString(streamResponse.Choices[i].Delta.GetContentString() + held)
+				found = true
+				break
+			}
+		}
+		if !found {
+			choice := dto.ChatCompletionsStreamResponseChoice{Index: index}
+			choice.Delta.SetContentString(held)
+			streamResponse.Choices = append(streamResponse.Choices, choice)
+		}
+	}
+	filtered, err := json.Marshal(streamResponse)
+	if err != nil {
+		return data
+	}
+	return string(filtered)
+}
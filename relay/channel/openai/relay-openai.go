@@ -152,7 +152,20 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		lastStreamData string
 	)
 
+	// 流式输出过滤只作用于 chat completions 的文本内容
+	var filter *service.StreamContentFilter
+	if info.RelayMode == relayconstant.RelayModeChatCompletions {
+		filter = service.NewStreamContentFilter(c, info)
+	}
+
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		stopped := false
+		if filter != nil {
+			data, stopped = filterStreamData(filter, data)
+			if data == "" {
+				return true
+			}
+		}
 		if lastStreamData != "" {
 			err := handleStreamFormat(c, info, lastStreamData, forceFormat, thinkToContent)
 			if err != nil {
@@ -161,9 +174,15 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		}
 		lastStreamData = data
 		streamItems = append(streamItems, data)
-		return true
+		// 命中屏蔽词终止输出时断开上游，只按已下发的内容计费
+		return !stopped
 	})
 
+	if filter != nil && !filter.Stopped() && lastStreamData != "" {
+		lastStreamData = appendHeldContent(filter, lastStreamData)
+		streamItems[len(streamItems)-1] = lastStreamData
+	}
+
 	shouldSendLastResp := true
 	var lastStreamResponse dto.ChatCompletionsStreamResponse
 	err := common.DecodeJsonStr(lastStreamData, &lastStreamResponse)
@@ -262,6 +281,7 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	}
 
 	info.Other["output_content"] = responseText // 保存输出内容
+	service.ReviewDeliveredCompletion(c, info, responseText)
 
 	if common.IsEmptyOrWhitespace(responseText) && toolCount == 0 {
 		// 空回复或全是空格不计费，返回零使用量（而不是只设置CompletionTokens为0）
@@ -275,6 +295,10 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		return nil, zeroUsage
 	}
 
+	// 输出被过滤器终止时，上游的用量包含未下发的内容，改为按已下发的文本计算
+	if filter.Stopped() {
+		containStreamUsage = false
+	}
 	if !containStreamUsage {
 		usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
 		usage.CompletionTokens += toolCount * 7
@@ -385,6 +409,30 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 	}
 	info.Other["output_content"] = outputContent // 保存输出内容
 
+	// 非流式响应在下发前审核输出内容
+	if service.ShouldModerateCompletion(info.Group) {
+		moderated := false
+		for i := range simpleResponse.Choices {
+			choice := &simpleResponse.Choices[i]
+			content := choice.Message.StringContent()
+			moderatedContent, blocked := service.ModerateCompletion(c, info, content)
+			if moderatedContent != content {
+				choice.Message.SetStringContent(moderatedContent)
+				moderated = true
+			}
+			if blocked {
+				choice.FinishReason = constant.FinishReasonContentFilter
+				moderated = true
+			}
+		}
+		if moderated {
+			responseBody, err = json.Marshal(simpleResponse)
+			if err != nil {
+				return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+			}
+		}
+	}
+
 	switch info.RelayFormat {
 	case relaycommon.RelayFormatOpenAI:
 		break
@@ -413,8 +461,8 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 		common.SysError("error copying response body: " + err.Error())
 	}
 	resp.Body.Close()
-	// 检查响应是否为空或只包含空格
-	isEmptyResponse := true
+	// 检查响应是否为空或只包含空格，向量响应没有 choices 不参与判断
+	isEmptyResponse := info.RelayMode != relayconstant.RelayModeEmbeddings
 	for _, choice := range simpleResponse.Choices {
 		content := choice.Message.StringContent() + choice.Message.ReasoningContent + choice.Message.Reasoning
 		if !common.IsEmptyOrWhitespace(content) {
@@ -456,6 +504,9 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 }
 
 func OpenaiTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	if info.IsStream && info.RelayMode == relayconstant.RelayModeAudioSpeech {
+		return openaiTTSStreamHandler(c, resp, info)
+	}
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
@@ -492,6 +543,36 @@ func OpenaiTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	return nil, usage
 }
 
+// openaiTTSStreamHandler 上游的分块音频或 speech.audio.delta 事件流边收边发
+func openaiTTSStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(resp.StatusCode)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				return service.OpenAIErrorWrapper(writeErr, "copy_response_body_failed", http.StatusInternalServerError), nil
+			}
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		}
+	}
+	usage := &dto.Usage{}
+	usage.PromptTokens = info.PromptTokens
+	usage.TotalTokens = info.PromptTokens
+	return nil, usage
+}
+
 func OpenaiSTTHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, responseFormat string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	// count tokens by audio file duration
 	audioTokens, err := countAudioTokens(c)
@@ -524,6 +605,8 @@ func OpenaiSTTHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		return service.OpenAIErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError), nil
 	}
 	resp.Body.Close()
+	// 音频转写结果作为输出内容留存
+	info.CaptureContent("output_content", string(responseBody))
 
 	usage := &dto.Usage{}
 	usage.PromptTokens = audioTokens
@@ -577,6 +660,17 @@ func OpenaiResponsesHandler(c *gin.Context, resp *http.Response, info *relaycomm
 		common.SysError("error copying response body: " + err.Error())
 	}
 	resp.Body.Close()
+	if common.LogChatContentEnabled {
+		var outputTexts []string
+		for _, output := range responsesResponse.Output {
+			for _, content := range output.Content {
+				if content.Text != "" {
+					outputTexts = append(outputTexts, content.Text)
+				}
+			}
+		}
+		info.CaptureContent("output_content", strings.Join(outputTexts, "\n"))
+	}
 	// compute usage
 	usage := dto.Usage{}
 	usage.PromptTokens = responsesResponse.Usage.InputTokens
@@ -615,6 +709,7 @@ func OaiResponsesStreamHandler(c *gin.Context, resp *http.Response, info *relayc
 	})
 
 	helper.Done(c)
+	info.CaptureContent("output_content", responseTextBuilder.String())
 
 	if usage.CompletionTokens == 0 {
 		// 计算输出文本的 token 数量
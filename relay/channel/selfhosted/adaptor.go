@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package selfhosted
+
+import (
+	"fmt"
+	"veloera/dto"
+	"veloera/relay/channel/openai"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adaptor 自建推理服务（vLLM / TGI / llama.cpp）兼容 OpenAI 接口，
+// 在转发前根据采集到的最大上下文长度校验提示词并收紧 max_tokens
+type Adaptor struct {
+	openai.Adaptor
+}
+
+func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (any, error) {
+	if request != nil {
+		if err := fitContextLength(info, request); err != nil {
+			return nil, err
+		}
+	}
+	return a.Adaptor.ConvertOpenAIRequest(c, info, request)
+}
+
+// SupportsOpenAIPassThrough 已知上下文长度时需要改写 max_tokens，不能透传原始请求体
+func (a *Adaptor) SupportsOpenAIPassThrough(info *relaycommon.RelayInfo) bool {
+	return service.GetSelfHostedContextLength(info.ChannelId, info.UpstreamModelName) == 0
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func fitContextLength(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) error {
+	contextLength := service.GetSelfHostedContextLength(info.ChannelId, info.UpstreamModelName)
+	if contextLength <= 0 || info.PromptTokens <= 0 {
+		return nil
+	}
+	remaining := contextLength - info.PromptTokens
+	if remaining <= 0 {
+		return fmt.Errorf("prompt has %d tokens, exceeding the maximum context length %d of model %s", info.PromptTokens, contextLength, info.UpstreamModelName)
+	}
+	if request.MaxTokens > uint(remaining) {
+		request.MaxTokens = uint(remaining)
+	}
+	if request.MaxCompletionTokens > uint(remaining) {
+		request.MaxCompletionTokens = uint(remaining)
+	}
+	return nil
+}
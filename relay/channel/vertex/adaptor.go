@@ -30,6 +30,7 @@ import (
 	"veloera/relay/channel/gemini"
 	"veloera/relay/channel/openai"
 	relaycommon "veloera/relay/common"
+	"veloera/relay/constant"
 )
 
 const (
@@ -54,6 +55,7 @@ const anthropicVersion = "vertex-2023-10-16"
 type Adaptor struct {
 	RequestMode        int
 	AccountCredentials Credentials
+	AudioRequest       dto.AudioRequest
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
@@ -67,8 +69,11 @@ func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if a.RequestMode != RequestModeGemini || info.RelayMode != constant.RelayModeAudioSpeech {
+		return nil, errors.New("not implemented")
+	}
+	a.AudioRequest = request
+	return gemini.ConvertTTSRequest(request)
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
@@ -201,6 +206,10 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayMode == constant.RelayModeAudioSpeech {
+		err, usage = gemini.GeminiTTSHandler(c, resp, info, a.AudioRequest)
+		return
+	}
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
@@ -31,6 +31,8 @@ import (
 )
 
 type Adaptor struct {
+	AudioRequest    dto.AudioRequest
+	TTSSourceFormat string
 }
 
 func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
@@ -40,8 +42,13 @@ func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dt
 }
 
 func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if info.RelayMode != constant.RelayModeAudioSpeech {
+		return nil, errors.New("not implemented")
+	}
+	a.AudioRequest = request
+	reader, sourceFormat, err := oaiTTS2Volcengine(info, request)
+	a.TTSSourceFormat = sourceFormat
+	return reader, err
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
@@ -61,6 +68,8 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		return fmt.Sprintf("%s/api/v3/chat/completions", info.BaseUrl), nil
 	case constant.RelayModeEmbeddings:
 		return fmt.Sprintf("%s/api/v3/embeddings", info.BaseUrl), nil
+	case constant.RelayModeAudioSpeech:
+		return getTTSRequestURL(info), nil
 	default:
 	}
 	return "", fmt.Errorf("unsupported relay mode: %d", info.RelayMode)
@@ -68,6 +77,14 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
 	channel.SetupApiRequestHeader(info, c, req)
+	if info.RelayMode == constant.RelayModeAudioSpeech {
+		_, token, err := parseTTSKey(info.ApiKey)
+		if err != nil {
+			return err
+		}
+		req.Set("Authorization", "Bearer;"+token)
+		return nil
+	}
 	req.Set("Authorization", "Bearer "+info.ApiKey)
 	return nil
 }
@@ -106,6 +123,8 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		}
 	case constant.RelayModeEmbeddings:
 		err, usage = openai.OpenaiHandler(c, resp, info)
+	case constant.RelayModeAudioSpeech:
+		err, usage = volcengineTTSHandler(c, resp, info, a.AudioRequest, a.TTSSourceFormat)
 	}
 	return
 }
@@ -24,6 +24,7 @@ var ModelList = []string{
 	"Doubao-lite-32k",
 	"Doubao-lite-4k",
 	"Doubao-embedding",
+	"volcengine-tts",
 }
 
 var ChannelName = "volcengine"
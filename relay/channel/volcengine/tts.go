@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package volcengine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 语音合成走豆包语音（openspeech）接口，与方舟大模型使用不同的鉴权
+const ttsBaseURL = "https://openspeech.bytedance.com"
+
+const ttsSampleRate = 24000
+
+// ttsSuccessCode 语音合成成功的业务码
+const ttsSuccessCode = 3000
+
+type ttsRequest struct {
+	App struct {
+		AppId   string `json:"appid"`
+		Token   string `json:"token"`
+		Cluster string `json:"cluster"`
+	} `json:"app"`
+	User struct {
+		Uid string `json:"uid"`
+	} `json:"user"`
+	Audio struct {
+		VoiceType  string  `json:"voice_type"`
+		Encoding   string  `json:"encoding"`
+		SpeedRatio float64 `json:"speed_ratio"`
+		Rate       int     `json:"rate,omitempty"`
+	} `json:"audio"`
+	Request struct {
+		ReqId     string `json:"reqid"`
+		Text      string `json:"text"`
+		Operation string `json:"operation"`
+	} `json:"request"`
+}
+
+type ttsResponse struct {
+	ReqId   string `json:"reqid"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+// parseTTSKey 语音合成渠道密钥格式为 appid|access_token
+func parseTTSKey(key string) (string, string, error) {
+	appId, token, ok := strings.Cut(key, "|")
+	if !ok || appId == "" || token == "" {
+		return "", "", errors.New("语音合成的密钥格式应为 appid|access_token")
+	}
+	return appId, token, nil
+}
+
+func getTTSRequestURL(info *relaycommon.RelayInfo) string {
+	if strings.Contains(info.BaseUrl, "openspeech") {
+		return fmt.Sprintf("%s/api/v1/tts", info.BaseUrl)
+	}
+	return ttsBaseURL + "/api/v1/tts"
+}
+
+// oaiTTS2Volcengine 上游格式中 opus 对应 ogg_opus
+func oaiTTS2Volcengine(info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, string, error) {
+	appId, token, err := parseTTSKey(info.ApiKey)
+	if err != nil {
+		return nil, "", err
+	}
+	sourceFormat := service.PickTTSSourceFormat(request.ResponseFormat, "mp3", "wav", "pcm", "opus")
+	if err := service.CheckTTSFormat(sourceFormat, request.ResponseFormat); err != nil {
+		return nil, "", err
+	}
+	volcRequest := ttsRequest{}
+	volcRequest.App.AppId = appId
+	volcRequest.App.Token = token
+	volcRequest.App.Cluster = operation_setting.GetTTSSetting().VolcengineCluster
+	volcRequest.User.Uid = fmt.Sprintf("%d", info.UserId)
+	volcRequest.Audio.VoiceType = operation_setting.MapTTSVoice("volcengine", request.Voice)
+	volcRequest.Audio.Encoding = sourceFormat
+	if sourceFormat == "opus" {
+		volcRequest.Audio.Encoding = "ogg_opus"
+	}
+	if sourceFormat == "pcm" {
+		volcRequest.Audio.Rate = ttsSampleRate
+	}
+	volcRequest.Audio.SpeedRatio = 1.0
+	if request.Speed > 0 {
+		volcRequest.Audio.SpeedRatio = request.Speed
+	}
+	volcRequest.Request.ReqId = common.GetUUID()
+	volcRequest.Request.Text = request.Input
+	volcRequest.Request.Operation = "query"
+	jsonData, err := json.Marshal(volcRequest)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(jsonData), sourceFormat, nil
+}
+
+func volcengineTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, request dto.AudioRequest, sourceFormat string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	_ = resp.Body.Close()
+	var volcResponse ttsResponse
+	if err := json.Unmarshal(responseBody, &volcResponse); err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if volcResponse.Code != ttsSuccessCode {
+		return service.OpenAIErrorWrapper(fmt.Errorf("volcengine tts error %d: %s", volcResponse.Code, volcResponse.Message), "volcengine_tts_error", http.StatusInternalServerError), nil
+	}
+	audio, err := base64.StdEncoding.DecodeString(volcResponse.Data)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "decode_audio_failed", http.StatusInternalServerError), nil
+	}
+	usage := &dto.Usage{PromptTokens: info.PromptTokens, TotalTokens: info.PromptTokens}
+	writer := service.NewTTSWriter(c, request.ResponseFormat, request.StreamFormat, sourceFormat, ttsSampleRate)
+	if err := writer.Write(audio); err != nil {
+		return service.OpenAIErrorWrapper(err, "write_audio_failed", http.StatusInternalServerError), nil
+	}
+	if err := writer.Close(usage); err != nil {
+		return service.OpenAIErrorWrapper(err, "write_audio_failed", http.StatusInternalServerError), nil
+	}
+	return nil, usage
+}
@@ -86,6 +86,21 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		relayInfo.IsStream = true
 	}
 
+	if openaiErr := moderateClaudeRequest(c, textRequest, relayInfo); openaiErr != nil {
+		return service.OpenAIErrorToClaudeError(openaiErr)
+	}
+	if openaiErr := guardClaudeRequest(c, textRequest, relayInfo); openaiErr != nil {
+		return service.OpenAIErrorToClaudeError(openaiErr)
+	}
+
+	if common.LogChatContentEnabled {
+		messages := make([]interface{}, 0, len(textRequest.Messages))
+		for _, message := range textRequest.Messages {
+			messages = append(messages, message)
+		}
+		relayInfo.CaptureMessages(textRequest.System, messages)
+	}
+
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		return service.ClaudeErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
@@ -99,6 +114,11 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		return service.ClaudeErrorWrapperLocal(err, "count_token_messages_failed", http.StatusInternalServerError)
 	}
 
+	if err = helper.ContextWindowHelper(relayInfo, promptTokens, int(textRequest.MaxTokens)); err != nil {
+		return service.ClaudeErrorWrapperLocal(err, "context_length_exceeded", http.StatusBadRequest)
+	}
+
+	relayInfo.PricingFeatures = helper.ClaudePricingFeatures(textRequest)
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(textRequest.MaxTokens))
 	if err != nil {
 		return service.ClaudeErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
@@ -187,10 +207,32 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return service.OpenAIErrorToClaudeError(openaiErr)
 	}
+	priceData.ReapplyPricingRules(relayInfo, usage.(*dto.Usage))
 	service.PostClaudeConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
 	return nil
 }
 
+func moderateClaudeRequest(c *gin.Context, textRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	values := make([]*any, 0, len(textRequest.Messages)+1)
+	values = append(values, &textRequest.System)
+	for i := range textRequest.Messages {
+		values = append(values, &textRequest.Messages[i].Content)
+	}
+	_, openaiErr := service.ModerateStructuredContent(c, info, values...)
+	return openaiErr
+}
+
+// guardClaudeRequest 在发往上游前检测请求中的密钥与 tool_result 中的提示词注入
+func guardClaudeRequest(c *gin.Context, textRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	values := make([]*any, 0, len(textRequest.Messages)+1)
+	values = append(values, &textRequest.System)
+	for i := range textRequest.Messages {
+		values = append(values, &textRequest.Messages[i].Content)
+	}
+	_, openaiErr := service.GuardStructuredContent(c, info, values...)
+	return openaiErr
+}
+
 func getClaudePromptTokens(textRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) (int, error) {
 	var promptTokens int
 	var err error
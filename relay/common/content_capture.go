@@ -0,0 +1,46 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import "veloera/common"
+
+// CaptureContent 在开启对话内容留存时记录请求或响应内容，
+// 由 service.CaptureChatContent 统一脱敏、加密后写入留存表
+func (info *RelayInfo) CaptureContent(key string, value interface{}) {
+	if !common.LogChatContentEnabled || value == nil {
+		return
+	}
+	if info.Other == nil {
+		info.Other = make(map[string]interface{})
+	}
+	info.Other[key] = value
+}
+
+// CaptureMessages 将消息列表拆分为上下文与最后一条输入后记录
+func (info *RelayInfo) CaptureMessages(systemPrompt interface{}, messages []interface{}) {
+	if !common.LogChatContentEnabled {
+		return
+	}
+	if systemPrompt != nil && systemPrompt != "" {
+		info.CaptureContent("system_prompt", systemPrompt)
+	}
+	if len(messages) == 0 {
+		return
+	}
+	info.CaptureContent("context", messages[:len(messages)-1])
+	info.CaptureContent("input_content", messages[len(messages)-1])
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+	"veloera/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HedgeState 一次对冲请求的共享状态：最先输出首字节的尝试胜出，其余尝试随即被取消
+type HedgeState struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	start    time.Time
+	attempts []*HedgeAttempt
+	winner   *HedgeAttempt
+	decided  chan struct{}
+}
+
+// HedgeAttempt 对冲请求中向某个渠道发出的一次尝试
+type HedgeAttempt struct {
+	state     *HedgeState
+	Index     int
+	ChannelId int
+	startTime time.Time
+	firstByte time.Duration
+	cancel    context.CancelFunc
+}
+
+func NewHedgeState(delay time.Duration) *HedgeState {
+	return &HedgeState{
+		delay:   delay,
+		start:   time.Now(),
+		decided: make(chan struct{}),
+	}
+}
+
+// NewAttempt 登记一次新的尝试，cancel 用于在其落败时中止上游请求
+func (s *HedgeState) NewAttempt(channelId int, cancel context.CancelFunc) *HedgeAttempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt := &HedgeAttempt{
+		state:     s,
+		Index:     len(s.attempts),
+		ChannelId: channelId,
+		startTime: time.Now(),
+		cancel:    cancel,
+	}
+	s.attempts = append(s.attempts, attempt)
+	return attempt
+}
+
+// Decided 在决出胜者后关闭
+func (s *HedgeState) Decided() <-chan struct{} {
+	return s.decided
+}
+
+// Stats 返回记录在日志 admin_info 中的对冲统计
+func (s *HedgeState) Stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := make([]int, 0, len(s.attempts))
+	for _, attempt := range s.attempts {
+		channels = append(channels, attempt.ChannelId)
+	}
+	stats := map[string]interface{}{
+		"delay_ms": s.delay.Milliseconds(),
+		"fired":    len(s.attempts) > 1,
+		"channels": channels,
+	}
+	if s.winner != nil {
+		stats["winner_channel"] = s.winner.ChannelId
+		stats["winner_index"] = s.winner.Index
+		stats["first_byte_ms"] = s.winner.firstByte.Milliseconds()
+	}
+	return stats
+}
+
+// Claim 尝试赢得对冲，返回当前尝试是否为胜者。首次胜出时取消其余尝试
+func (a *HedgeAttempt) Claim() bool {
+	s := a.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.winner == nil {
+		s.winner = a
+		a.firstByte = time.Since(a.startTime)
+		close(s.decided)
+		for _, other := range s.attempts {
+			if other != a && other.cancel != nil {
+				other.cancel()
+			}
+		}
+	}
+	return s.winner == a
+}
+
+// Won 当前尝试已经胜出
+func (a *HedgeAttempt) Won() bool {
+	s := a.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.winner == a
+}
+
+// Lost 其他尝试已经胜出
+func (a *HedgeAttempt) Lost() bool {
+	s := a.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.winner != nil && s.winner != a
+}
+
+func (a *HedgeAttempt) State() *HedgeState {
+	return a.state
+}
+
+// GetHedgeAttempt 获取上下文所属的对冲尝试，非对冲请求返回 nil
+func GetHedgeAttempt(c *gin.Context) *HedgeAttempt {
+	value, ok := c.Get(constant.ContextKeyHedgeAttempt)
+	if !ok {
+		return nil
+	}
+	attempt, _ := value.(*HedgeAttempt)
+	return attempt
+}
+
+// IsHedgeLost 对冲请求中落败的一方不再输出响应，也不计费
+func IsHedgeLost(c *gin.Context) bool {
+	attempt := GetHedgeAttempt(c)
+	return attempt != nil && attempt.Lost()
+}
@@ -23,6 +23,7 @@ import (
 	"veloera/constant"
 	"veloera/dto"
 	relayconstant "veloera/relay/constant"
+	"veloera/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -66,6 +67,7 @@ type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
 	UserId            int
+	OrgId             int // 组织令牌从组织额度池扣费
 	Group             string
 	TokenUnlimited    bool
 	StartTime         time.Time
@@ -89,6 +91,10 @@ type RelayInfo struct {
 	SupportStreamOptions      bool
 	ShouldIncludeUsage        bool
 	IsModelMapped             bool
+	ModelDeprecated           bool   // 请求的模型已弃用，记录在日志中
+	RetiredModelName          string // 请求的模型已退役时为原模型名称
+	SuccessorModelName        string // 退役模型转发到的后继模型，按其价格计费
+	FallbackFromModel         string // 已回退到其他模型时为客户端请求的模型
 	ClientWs                  *websocket.Conn
 	TargetWs                  *websocket.Conn
 	InputAudioFormat          string
@@ -107,8 +113,12 @@ type RelayInfo struct {
 	RelayFormat               string
 	SendResponseCount         int
 	ChannelCreateTime         int64
-	PromptMessages            interface{}            // 保存请求的消息内容
-	Other                     map[string]interface{} // 用于存储额外信息，如输入输出内容
+	PromptMessages            interface{}                       // 保存请求的消息内容
+	Other                     map[string]interface{}            // 用于存储额外信息，如输入输出内容
+	PricingFeatures           operation_setting.PricingFeatures // 参与动态计价规则匹配的请求特性
+	AppliedPricingRules       []string                          // 本次请求命中的计价规则
+	ModerationRecords         []ModerationRecord                // 内容审核命中记录，写入日志
+	RequestRewritten          bool                              // 请求内容已在本地改写（审核替换、密钥遮盖），不能透传原始请求体
 	ThinkingContentInfo
 	*ClaudeConvertInfo
 	*RerankerInfo
@@ -214,6 +224,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		TokenId:           tokenId,
 		TokenKey:          tokenKey,
 		UserId:            userId,
+		OrgId:             c.GetInt("token_org_id"),
 		Group:             group,
 		TokenUnlimited:    tokenUnlimited,
 		StartTime:         startTime,
@@ -222,6 +233,9 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		UpstreamModelName: upstreamModelName, // Use the actual model name for upstream
 		//RecodeModelName:   c.GetString("original_model"),
 		IsModelMapped:     isVirtualModelMapped, // Mark if virtual model mapping occurred
+		ModelDeprecated:   c.GetBool(constant.ContextKeyModelDeprecated),
+		RetiredModelName:  c.GetString(constant.ContextKeyRetiredModel),
+		FallbackFromModel: c.GetString(constant.ContextKeyFallbackFrom),
 		ApiType:           apiType,
 		ApiVersion:        c.GetString("api_version"),
 		ApiKey:            strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
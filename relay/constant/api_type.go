@@ -49,6 +49,7 @@ const (
 	APITypeXinference
 	APITypeXai
 	APITypeGitHub
+	APITypeSelfHosted
 	APITypeDummy // this one is only for count, do not add any channel after this
 )
 
@@ -111,6 +112,8 @@ func ChannelType2APIType(channelType int) (int, bool) {
 		apiType = APITypeGitHub
 	case common.ChannelTypeXai:
 		apiType = APITypeXai
+	case common.ChannelTypeSelfHosted:
+		apiType = APITypeSelfHosted
 	}
 	if apiType == -1 {
 		return APITypeOpenAI, false
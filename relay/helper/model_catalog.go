@@ -0,0 +1,43 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package helper
+
+import (
+	"fmt"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+)
+
+// ContextWindowHelper 按模型目录登记的上下文窗口校验请求，超出时在调用上游之前拒绝。
+// 优先匹配映射后的上游模型，目录中未登记或未填写上下文窗口时不做校验
+func ContextWindowHelper(info *relaycommon.RelayInfo, promptTokens int, maxTokens int) error {
+	catalog, ok := model.GetModelCatalog(info.UpstreamModelName)
+	if !ok {
+		catalog, ok = model.GetModelCatalog(info.OriginModelName)
+	}
+	if !ok || catalog.ContextWindow <= 0 {
+		return nil
+	}
+	if maxTokens < 0 {
+		maxTokens = 0
+	}
+	if promptTokens+maxTokens > catalog.ContextWindow {
+		return fmt.Errorf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+			catalog.ContextWindow, promptTokens+maxTokens, promptTokens, maxTokens)
+	}
+	return nil
+}
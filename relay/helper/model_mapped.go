@@ -20,10 +20,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"veloera/model"
 	"veloera/relay/common"
 )
 
 func ModelMappedHelper(c *gin.Context, info *common.RelayInfo) error {
+	// 已退役的模型转发到后继模型。分发时通常已按后继模型选择渠道，
+	// 这里补上指定渠道等未经分发替换的情况
+	if info.RetiredModelName == "" {
+		if successor, retired := model.ResolveModelSuccessor(info.UpstreamModelName); retired {
+			if successor == "" {
+				return fmt.Errorf("模型 %s 已下线", info.UpstreamModelName)
+			}
+			info.RetiredModelName = info.UpstreamModelName
+			info.UpstreamModelName = successor
+		}
+	}
+	mappingKey := info.OriginModelName
+	if info.RetiredModelName != "" {
+		info.SuccessorModelName = info.UpstreamModelName
+		info.IsModelMapped = true
+		mappingKey = info.SuccessorModelName
+	}
+
 	// map model name
 	modelMapping := c.GetString("model_mapping")
 	if modelMapping != "" && modelMapping != "{}" {
@@ -32,8 +51,8 @@ func ModelMappedHelper(c *gin.Context, info *common.RelayInfo) error {
 		if err != nil {
 			return fmt.Errorf("unmarshal_model_mapping_failed")
 		}
-		if modelMap[info.OriginModelName] != "" {
-			info.UpstreamModelName = modelMap[info.OriginModelName]
+		if modelMap[mappingKey] != "" {
+			info.UpstreamModelName = modelMap[mappingKey]
 			info.IsModelMapped = true
 		}
 	}
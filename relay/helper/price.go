@@ -17,9 +17,13 @@
 package helper
 
 import (
+	"bytes"
 	"fmt"
+	"time"
+	"unicode/utf8"
 	"veloera/common"
 	constant2 "veloera/constant"
+	"veloera/dto"
 	relaycommon "veloera/relay/common"
 	"veloera/setting"
 	"veloera/setting/operation_setting"
@@ -36,10 +40,17 @@ type PriceData struct {
 	UsePrice               bool
 	CacheCreationRatio     float64
 	ShouldPreConsumedQuota int
+	AppliedPricingRules    []string
+	// 应用计价规则前的倍率与价格，结算时按实际提示词 token 数重新匹配档位
+	BaseModelRatio      float64
+	BaseCompletionRatio float64
+	BaseModelPrice      float64
+	PricingModelName    string
+	PricingTime         time.Time
 }
 
 func (p PriceData) ToSetting() string {
-	return fmt.Sprintf("ModelPrice: %f, ModelRatio: %f, CompletionRatio: %f, CacheRatio: %f, GroupRatio: %f, UsePrice: %t, CacheCreationRatio: %f, ShouldPreConsumedQuota: %d", p.ModelPrice, p.ModelRatio, p.CompletionRatio, p.CacheRatio, p.GroupRatio, p.UsePrice, p.CacheCreationRatio, p.ShouldPreConsumedQuota)
+	return fmt.Sprintf("ModelPrice: %f, ModelRatio: %f, CompletionRatio: %f, CacheRatio: %f, GroupRatio: %f, UsePrice: %t, CacheCreationRatio: %f, ShouldPreConsumedQuota: %d, AppliedPricingRules: %v", p.ModelPrice, p.ModelRatio, p.CompletionRatio, p.CacheRatio, p.GroupRatio, p.UsePrice, p.CacheCreationRatio, p.ShouldPreConsumedQuota, p.AppliedPricingRules)
 }
 
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, completionTokens int) (PriceData, error) {
@@ -56,6 +67,11 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		modelNameForPrice = info.UpstreamModelName
 		modelNameForRatio = info.UpstreamModelName
 	}
+	// 退役模型转发后始终按后继模型计费
+	if info.SuccessorModelName != "" {
+		modelNameForPrice = info.SuccessorModelName
+		modelNameForRatio = info.SuccessorModelName
+	}
 
 	modelPrice, usePrice := operation_setting.GetModelPriceWithFallback(modelNameForPrice, false)
 	groupRatio := setting.GetGroupRatio(info.Group)
@@ -64,6 +80,10 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var completionRatio float64
 	var cacheRatio float64
 	var cacheCreationRatio float64
+	var ruleResult operation_setting.PricingRuleResult
+	var pricingModelName string
+	var baseModelRatio, baseCompletionRatio, baseModelPrice float64
+	pricingTime := time.Now()
 	if !usePrice {
 		preConsumedTokens := common.PreConsumedQuota
 		if completionTokens != 0 {
@@ -86,11 +106,24 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		completionRatio = operation_setting.GetCompletionRatioWithFallback(modelNameForRatio)
 		cacheRatio, _ = operation_setting.GetCacheRatio(modelNameForRatio)
 		cacheCreationRatio, _ = operation_setting.GetCreateCacheRatio(modelNameForRatio)
+		// 提示词档位先按预估的提示词 token 数匹配，结算时再按实际用量重新匹配
+		pricingModelName = modelNameForRatio
+		baseModelRatio, baseCompletionRatio, baseModelPrice = modelRatio, completionRatio, modelPrice
+		ruleResult = operation_setting.ApplyPricingRules(pricingModelName, promptTokens, info.PricingFeatures, pricingTime,
+			modelRatio, completionRatio, modelPrice)
+		modelRatio = ruleResult.ModelRatio
+		completionRatio = ruleResult.CompletionRatio
 		ratio := modelRatio * groupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
+		pricingModelName = modelNameForPrice
+		baseModelRatio, baseCompletionRatio, baseModelPrice = modelRatio, completionRatio, modelPrice
+		ruleResult = operation_setting.ApplyPricingRules(pricingModelName, promptTokens, info.PricingFeatures, pricingTime,
+			modelRatio, completionRatio, modelPrice)
+		modelPrice = ruleResult.ModelPrice
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
 	}
+	info.AppliedPricingRules = ruleResult.Applied
 
 	priceData := PriceData{
 		ModelPrice:             modelPrice,
@@ -101,6 +134,12 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheRatio:             cacheRatio,
 		CacheCreationRatio:     cacheCreationRatio,
 		ShouldPreConsumedQuota: preConsumedQuota,
+		AppliedPricingRules:    ruleResult.Applied,
+		BaseModelRatio:         baseModelRatio,
+		BaseCompletionRatio:    baseCompletionRatio,
+		BaseModelPrice:         baseModelPrice,
+		PricingModelName:       pricingModelName,
+		PricingTime:            pricingTime,
 	}
 
 	if common.DebugEnabled {
@@ -110,6 +149,40 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	return priceData, nil
 }
 
+// ReapplyPricingRules 按上游返回的实际提示词 token 数重新匹配计价规则，时段仍按请求开始时判断，
+// 避免预估值与实际值落在不同档位时按错误的档位结算
+func (p *PriceData) ReapplyPricingRules(info *relaycommon.RelayInfo, usage *dto.Usage) {
+	if p.PricingModelName == "" || usage == nil {
+		return
+	}
+	result := operation_setting.ApplyPricingRules(p.PricingModelName, usage.PromptTokens, info.PricingFeatures, p.PricingTime,
+		p.BaseModelRatio, p.BaseCompletionRatio, p.BaseModelPrice)
+	if p.UsePrice {
+		p.ModelPrice = result.ModelPrice
+	} else {
+		p.ModelRatio = result.ModelRatio
+		p.CompletionRatio = result.CompletionRatio
+	}
+	p.AppliedPricingRules = result.Applied
+	info.AppliedPricingRules = result.Applied
+}
+
+// TTSCharacterPriceHelper 配置了字符单价的语音合成模型按输入字符数折算为按次价格
+func TTSCharacterPriceHelper(info *relaycommon.RelayInfo, input string) (PriceData, bool) {
+	pricePerMillion, ok := operation_setting.GetTTSCharacterPrice(info.OriginModelName)
+	if !ok {
+		return PriceData{}, false
+	}
+	groupRatio := setting.GetGroupRatio(info.Group)
+	modelPrice := pricePerMillion * float64(utf8.RuneCountInString(input)) / 1000000
+	return PriceData{
+		ModelPrice:             modelPrice,
+		GroupRatio:             groupRatio,
+		UsePrice:               true,
+		ShouldPreConsumedQuota: int(modelPrice * common.QuotaPerUnit * groupRatio),
+	}, true
+}
+
 func ContainPriceOrRatio(modelName string) bool {
 	_, ok := operation_setting.GetModelPriceWithFallback(modelName, false)
 	if ok {
@@ -121,3 +194,50 @@ func ContainPriceOrRatio(modelName string) bool {
 	}
 	return false
 }
+
+// OpenAIPricingFeatures 提取 OpenAI 格式请求中参与计价规则匹配的特性
+func OpenAIPricingFeatures(request *dto.GeneralOpenAIRequest) operation_setting.PricingFeatures {
+	features := operation_setting.PricingFeatures{
+		Tools:     len(request.Tools) > 0 || request.Functions != nil,
+		Reasoning: request.ReasoningEffort != "",
+	}
+	for i := range request.Messages {
+		for _, content := range request.Messages[i].ParseContent() {
+			if content.Type == dto.ContentTypeImageURL {
+				features.Images = true
+				return features
+			}
+		}
+	}
+	return features
+}
+
+// ClaudePricingFeatures 提取 Claude 格式请求中参与计价规则匹配的特性
+func ClaudePricingFeatures(request *dto.ClaudeRequest) operation_setting.PricingFeatures {
+	features := operation_setting.PricingFeatures{
+		Tools:     request.Tools != nil,
+		Reasoning: request.Thinking != nil && request.Thinking.Type == "enabled",
+	}
+	for i := range request.Messages {
+		if request.Messages[i].IsStringContent() {
+			continue
+		}
+		contents, _ := request.Messages[i].ParseContent()
+		for _, content := range contents {
+			if content.Type == "image" {
+				features.Images = true
+				return features
+			}
+		}
+	}
+	return features
+}
+
+// ResponsesPricingFeatures 提取 Responses 格式请求中参与计价规则匹配的特性
+func ResponsesPricingFeatures(request *dto.OpenAIResponsesRequest) operation_setting.PricingFeatures {
+	return operation_setting.PricingFeatures{
+		Tools:     len(request.Tools) > 0,
+		Images:    bytes.Contains(request.Input, []byte(`"input_image"`)),
+		Reasoning: request.Reasoning != nil && request.Reasoning.Effort != "",
+	}
+}
@@ -31,6 +31,10 @@ func shouldUsePassThrough(adaptor interface{}, info *relaycommon.RelayInfo) bool
 		return false
 	}
 
+	if info != nil && info.RequestRewritten {
+		return false
+	}
+
 	if adaptor == nil {
 		return false
 	}
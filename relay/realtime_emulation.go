@@ -0,0 +1,649 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+	"veloera/service"
+	"veloera/setting/model_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// shouldEmulateRealtime OpenAI/Azure 渠道直接桥接上游 websocket，其他渠道（或开启 realtime_emulation 的渠道）
+// 由网关以 语音识别 → 对话 → 语音合成 的流水线模拟 Realtime 协议
+func shouldEmulateRealtime(info *relaycommon.RelayInfo) bool {
+	if forced, ok := info.ChannelSetting[constant.ChannelSettingRealtimeEmulation].(bool); ok && forced {
+		return true
+	}
+	if !model_setting.GetRealtimeEmulationSettings().Enabled {
+		return false
+	}
+	return info.ChannelType != common.ChannelTypeOpenAI && info.ChannelType != common.ChannelTypeAzure
+}
+
+// realtimeTurnDetection 服务端 VAD 参数，与 OpenAI Realtime 的 turn_detection 一致
+type realtimeTurnDetection struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold"`
+	PrefixPaddingMs   int     `json:"prefix_padding_ms"`
+	SilenceDurationMs int     `json:"silence_duration_ms"`
+	CreateResponse    *bool   `json:"create_response,omitempty"`
+	InterruptResponse *bool   `json:"interrupt_response,omitempty"`
+}
+
+func (t *realtimeTurnDetection) normalize() {
+	if t.Threshold <= 0 {
+		t.Threshold = 0.5
+	}
+	if t.PrefixPaddingMs <= 0 {
+		t.PrefixPaddingMs = 300
+	}
+	if t.SilenceDurationMs <= 0 {
+		t.SilenceDurationMs = 500
+	}
+}
+
+type realtimeSessionView struct {
+	Id     string `json:"id"`
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	dto.RealtimeSession
+}
+
+// realtimeVADState 输入缓冲区上的语音检测进度，位置均以采样计
+type realtimeVADState struct {
+	speaking     bool
+	speechStart  int
+	silenceMs    int
+	processed    int
+	bufferOffset int64 // 缓冲区起点在整个会话音频流中的采样位置
+	itemId       string
+}
+
+type realtimeJob struct {
+	response bool
+	run      func(ctx context.Context)
+}
+
+type realtimeEmulator struct {
+	c        *gin.Context
+	info     *relaycommon.RelayInfo
+	ws       *websocket.Conn
+	keys     map[string]any
+	settings *model_setting.RealtimeEmulationSettings
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	writeLock sync.Mutex
+
+	lock           sync.Mutex
+	sessionId      string
+	session        dto.RealtimeSession
+	turnDetection  *realtimeTurnDetection
+	toolChoice     any
+	items          []*dto.RealtimeItem
+	audio          []byte // 尚未提交的输入音频，保持客户端格式
+	vad            realtimeVADState
+	queue          []realtimeJob
+	wake           chan struct{}
+	closed         bool
+	cancelResponse context.CancelFunc
+	workerDone     chan struct{}
+	usage          *dto.RealtimeUsage
+}
+
+func newRealtimeEmulator(c *gin.Context, info *relaycommon.RelayInfo) *realtimeEmulator {
+	settings := model_setting.GetRealtimeEmulationSettings()
+	keys := make(map[string]any, len(c.Keys))
+	for k, v := range c.Keys {
+		keys[k] = v
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	turnDetection := &realtimeTurnDetection{Type: "server_vad"}
+	turnDetection.normalize()
+	e := &realtimeEmulator{
+		c:          c,
+		info:       info,
+		ws:         info.ClientWs,
+		keys:       keys,
+		settings:   settings,
+		ctx:        ctx,
+		cancel:     cancel,
+		sessionId:  newRealtimeId("sess"),
+		wake:       make(chan struct{}, 1),
+		workerDone: make(chan struct{}),
+		usage:      &dto.RealtimeUsage{},
+	}
+	e.session = dto.RealtimeSession{
+		Modalities:        []string{"text", "audio"},
+		Voice:             settings.DefaultVoice,
+		InputAudioFormat:  info.InputAudioFormat,
+		OutputAudioFormat: info.OutputAudioFormat,
+		InputAudioTranscription: dto.InputAudioTranscription{
+			Model: settings.STTModel,
+		},
+		Tools:       []dto.RealTimeTool{},
+		ToolChoice:  "auto",
+		Temperature: 0.8,
+	}
+	e.setTurnDetection(turnDetection)
+	return e
+}
+
+func newRealtimeId(prefix string) string {
+	return prefix + "_" + common.GetRandomString(20)
+}
+
+// realtimeEmulationHandler 以客户端 websocket 驱动模拟会话，直到客户端断开，返回累计用量
+func realtimeEmulationHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.RealtimeUsage) {
+	if info.ClientWs == nil {
+		return service.OpenAIErrorWrapper(fmt.Errorf("invalid websocket connection"), "invalid_connection", http.StatusBadRequest), nil
+	}
+	if GetAdaptor(info.ApiType) == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", info.ApiType), "invalid_api_type", http.StatusBadRequest), nil
+	}
+	info.IsStream = true
+	e := newRealtimeEmulator(c, info)
+	gopool.Go(e.worker)
+	e.sendEvent(dto.RealtimeEventTypeSessionCreated, gin.H{"session": e.sessionView()})
+
+	for {
+		_, message, err := e.ws.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				common.LogError(c, "realtime emulation: error reading from client: "+err.Error())
+			}
+			break
+		}
+		if err := e.handleClientEvent(message); err != nil {
+			e.sendError("invalid_request_error", err.Error())
+		}
+	}
+	e.close()
+	return nil, e.usage
+}
+
+func (e *realtimeEmulator) sessionView() realtimeSessionView {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return realtimeSessionView{
+		Id:              e.sessionId,
+		Object:          "realtime.session",
+		Model:           e.info.OriginModelName,
+		RealtimeSession: e.session,
+	}
+}
+
+func (e *realtimeEmulator) sendEvent(eventType string, fields gin.H) {
+	if fields == nil {
+		fields = gin.H{}
+	}
+	fields["type"] = eventType
+	fields["event_id"] = newRealtimeId("event")
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+	_ = helper.WssObject(e.c, e.ws, fields)
+}
+
+func (e *realtimeEmulator) sendError(errorType string, message string) {
+	e.sendEvent(dto.RealtimeEventTypeError, gin.H{
+		"error": dto.OpenAIError{
+			Type:    errorType,
+			Message: message,
+		},
+	})
+}
+
+func (e *realtimeEmulator) handleClientEvent(message []byte) error {
+	var event struct {
+		Type    string            `json:"type"`
+		Session json.RawMessage   `json:"session"`
+		Item    *dto.RealtimeItem `json:"item"`
+		ItemId  string            `json:"item_id"`
+		Audio   string            `json:"audio"`
+	}
+	if err := json.Unmarshal(message, &event); err != nil {
+		return fmt.Errorf("invalid event: %w", err)
+	}
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if err := e.updateSession(event.Session); err != nil {
+			return err
+		}
+		e.sendEvent(dto.RealtimeEventTypeSessionUpdated, gin.H{"session": e.sessionView()})
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return fmt.Errorf("invalid audio: %w", err)
+		}
+		e.lock.Lock()
+		e.audio = append(e.audio, audio...)
+		e.detectSpeech()
+		e.lock.Unlock()
+	case "input_audio_buffer.commit":
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		if len(e.audio) == 0 {
+			return errors.New("input audio buffer is empty")
+		}
+		audio := e.audio
+		itemId := e.vad.itemId
+		if itemId == "" {
+			itemId = newRealtimeId("item")
+		}
+		e.resetAudioBuffer()
+		e.commitAudio(audio, itemId, false)
+	case "input_audio_buffer.clear":
+		e.lock.Lock()
+		e.resetAudioBuffer()
+		e.lock.Unlock()
+		e.sendEvent("input_audio_buffer.cleared", nil)
+	case dto.RealtimeEventTypeConversationCreate:
+		return e.createItem(event.Item)
+	case "conversation.item.delete":
+		e.lock.Lock()
+		found := false
+		for i, item := range e.items {
+			if item.Id == event.ItemId {
+				e.items = append(e.items[:i], e.items[i+1:]...)
+				found = true
+				break
+			}
+		}
+		e.lock.Unlock()
+		if !found {
+			return fmt.Errorf("item %s not found", event.ItemId)
+		}
+		e.sendEvent("conversation.item.deleted", gin.H{"item_id": event.ItemId})
+	case dto.RealtimeEventTypeResponseCreate:
+		e.lock.Lock()
+		e.enqueueResponse()
+		e.lock.Unlock()
+	case "response.cancel":
+		e.lock.Lock()
+		e.cancelActiveResponse()
+		e.lock.Unlock()
+	default:
+		return fmt.Errorf("unsupported event type: %s", event.Type)
+	}
+	return nil
+}
+
+// updateSession 只覆盖客户端提供的字段，未提供的字段保持原值
+func (e *realtimeEmulator) updateSession(raw json.RawMessage) error {
+	fields := make(map[string]json.RawMessage)
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return fmt.Errorf("invalid session: %w", err)
+		}
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	session := e.session
+	turnDetection := e.turnDetection
+	toolChoice := e.toolChoice
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "modalities":
+			err = json.Unmarshal(value, &session.Modalities)
+		case "instructions":
+			err = json.Unmarshal(value, &session.Instructions)
+		case "voice":
+			err = json.Unmarshal(value, &session.Voice)
+		case "input_audio_format":
+			err = json.Unmarshal(value, &session.InputAudioFormat)
+		case "output_audio_format":
+			err = json.Unmarshal(value, &session.OutputAudioFormat)
+		case "input_audio_transcription":
+			var transcription *dto.InputAudioTranscription
+			if err = json.Unmarshal(value, &transcription); err == nil && transcription != nil {
+				session.InputAudioTranscription = *transcription
+			}
+		case "turn_detection":
+			turnDetection = nil
+			err = json.Unmarshal(value, &turnDetection)
+		case "tools":
+			err = json.Unmarshal(value, &session.Tools)
+		case "tool_choice":
+			var choice any
+			if err = json.Unmarshal(value, &choice); err == nil {
+				session.ToolChoice, toolChoice = convertRealtimeToolChoice(choice)
+			}
+		case "temperature":
+			err = json.Unmarshal(value, &session.Temperature)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid session.%s: %w", key, err)
+		}
+	}
+	if session.InputAudioFormat != e.session.InputAudioFormat {
+		// 输入格式变化后旧缓冲区无法继续解码
+		e.resetAudioBuffer()
+	}
+	e.session = session
+	e.toolChoice = toolChoice
+	e.setTurnDetection(turnDetection)
+	e.info.InputAudioFormat = common.GetStringIfEmpty(session.InputAudioFormat, "pcm16")
+	e.info.OutputAudioFormat = common.GetStringIfEmpty(session.OutputAudioFormat, "pcm16")
+	e.info.RealtimeTools = session.Tools
+	return nil
+}
+
+func (e *realtimeEmulator) setTurnDetection(turnDetection *realtimeTurnDetection) {
+	if turnDetection != nil {
+		turnDetection.normalize()
+	}
+	e.turnDetection = turnDetection
+	e.session.TurnDetection = turnDetection
+}
+
+// convertRealtimeToolChoice 将 Realtime 的 tool_choice 转换为对话接口格式
+func convertRealtimeToolChoice(choice any) (string, any) {
+	switch v := choice.(type) {
+	case string:
+		return v, v
+	case map[string]any:
+		if name, ok := v["name"].(string); ok && name != "" {
+			return "function", gin.H{"type": "function", "function": gin.H{"name": name}}
+		}
+	}
+	return "auto", nil
+}
+
+func (e *realtimeEmulator) createItem(item *dto.RealtimeItem) error {
+	if item == nil {
+		return errors.New("item is required")
+	}
+	switch item.Type {
+	case "message", "function_call", "function_call_output":
+	default:
+		return fmt.Errorf("unsupported item type: %s", item.Type)
+	}
+	if item.Id == "" {
+		item.Id = newRealtimeId("item")
+	}
+	item.Status = "completed"
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	previous := e.lastItemId()
+	e.items = append(e.items, item)
+	e.sendEvent(dto.RealtimeEventConversationItemCreated, gin.H{"previous_item_id": previous, "item": item})
+	// 消息中携带的音频需要先转写才能进入对话上下文
+	for i, content := range item.Content {
+		if content.Type == "input_audio" && content.Audio != "" && content.Transcript == "" {
+			audio, err := base64.StdEncoding.DecodeString(content.Audio)
+			if err != nil {
+				return fmt.Errorf("invalid audio: %w", err)
+			}
+			item.Content[i].Audio = ""
+			e.enqueueTranscription(item, i, audio)
+		}
+	}
+	return nil
+}
+
+// lastItemId 调用方需持有 e.lock
+func (e *realtimeEmulator) lastItemId() string {
+	if len(e.items) == 0 {
+		return ""
+	}
+	return e.items[len(e.items)-1].Id
+}
+
+// resetAudioBuffer 调用方需持有 e.lock
+func (e *realtimeEmulator) resetAudioBuffer() {
+	bytesPerSample, _ := realtimeAudioLayout(e.info.InputAudioFormat)
+	e.vad.bufferOffset += int64(len(e.audio) / bytesPerSample)
+	e.audio = nil
+	e.vad.speaking = false
+	e.vad.processed = 0
+	e.vad.silenceMs = 0
+	e.vad.itemId = ""
+}
+
+func realtimeAudioLayout(format string) (bytesPerSample int, sampleRate int) {
+	switch format {
+	case "g711_ulaw", "g711_alaw":
+		return 1, 8000
+	default:
+		return 2, 24000
+	}
+}
+
+// detectSpeech 以 20ms 为一帧计算能量，检测语音起止；语音结束后自动提交缓冲区。调用方需持有 e.lock
+func (e *realtimeEmulator) detectSpeech() {
+	turnDetection := e.turnDetection
+	if turnDetection == nil {
+		return
+	}
+	format := e.info.InputAudioFormat
+	bytesPerSample, sampleRate := realtimeAudioLayout(format)
+	frame := sampleRate / 50
+	threshold := e.settings.VADEnergyThreshold * turnDetection.Threshold / 0.5
+	toMs := func(sample int) int64 {
+		return (e.vad.bufferOffset + int64(sample)) * 1000 / int64(sampleRate)
+	}
+
+	for e.vad.processed+frame <= len(e.audio)/bytesPerSample {
+		start := e.vad.processed
+		samples, _ := service.DecodeRealtimeAudio(e.audio[start*bytesPerSample:(start+frame)*bytesPerSample], format)
+		e.vad.processed += frame
+		loud := service.AudioRMS(samples) >= threshold
+
+		if !e.vad.speaking {
+			if !loud {
+				continue
+			}
+			e.vad.speaking = true
+			e.vad.silenceMs = 0
+			e.vad.speechStart = start - turnDetection.PrefixPaddingMs*sampleRate/1000
+			if e.vad.speechStart < 0 {
+				e.vad.speechStart = 0
+			}
+			e.vad.itemId = newRealtimeId("item")
+			e.sendEvent("input_audio_buffer.speech_started", gin.H{
+				"audio_start_ms": toMs(e.vad.speechStart),
+				"item_id":        e.vad.itemId,
+			})
+			if turnDetection.InterruptResponse == nil || *turnDetection.InterruptResponse {
+				e.cancelActiveResponse()
+			}
+			continue
+		}
+		if loud {
+			e.vad.silenceMs = 0
+			continue
+		}
+		e.vad.silenceMs += 20
+		if e.vad.silenceMs < turnDetection.SilenceDurationMs {
+			continue
+		}
+
+		end := e.vad.processed
+		itemId := e.vad.itemId
+		e.sendEvent("input_audio_buffer.speech_stopped", gin.H{
+			"audio_end_ms": toMs(end),
+			"item_id":      itemId,
+		})
+		segment := append([]byte(nil), e.audio[e.vad.speechStart*bytesPerSample:end*bytesPerSample]...)
+		e.audio = append([]byte(nil), e.audio[end*bytesPerSample:]...)
+		e.vad.bufferOffset += int64(end)
+		e.vad.processed = 0
+		e.vad.speaking = false
+		e.vad.itemId = ""
+		createResponse := turnDetection.CreateResponse == nil || *turnDetection.CreateResponse
+		e.commitAudio(segment, itemId, createResponse)
+	}
+
+	// 未在说话时只保留前置填充所需的音频，避免缓冲区无限增长
+	if !e.vad.speaking {
+		keep := turnDetection.PrefixPaddingMs * sampleRate / 1000
+		if drop := e.vad.processed - keep; drop > 0 {
+			e.audio = append([]byte(nil), e.audio[drop*bytesPerSample:]...)
+			e.vad.processed -= drop
+			e.vad.bufferOffset += int64(drop)
+		}
+	}
+}
+
+// commitAudio 将一段输入音频作为用户消息加入对话，并排队转写与生成回复。调用方需持有 e.lock
+func (e *realtimeEmulator) commitAudio(audio []byte, itemId string, createResponse bool) {
+	previous := e.lastItemId()
+	e.sendEvent("input_audio_buffer.committed", gin.H{"previous_item_id": previous, "item_id": itemId})
+	item := &dto.RealtimeItem{
+		Id:      itemId,
+		Type:    "message",
+		Status:  "completed",
+		Role:    "user",
+		Content: []dto.RealtimeContent{{Type: "input_audio"}},
+	}
+	e.items = append(e.items, item)
+	e.sendEvent(dto.RealtimeEventConversationItemCreated, gin.H{"previous_item_id": previous, "item": item})
+	e.enqueueTranscription(item, 0, audio)
+	if createResponse {
+		e.enqueueResponse()
+	}
+}
+
+// enqueueTranscription 调用方需持有 e.lock
+func (e *realtimeEmulator) enqueueTranscription(item *dto.RealtimeItem, contentIndex int, audio []byte) {
+	e.enqueue(realtimeJob{run: func(ctx context.Context) {
+		e.transcribe(ctx, item, contentIndex, audio)
+	}})
+}
+
+// enqueueResponse 调用方需持有 e.lock
+func (e *realtimeEmulator) enqueueResponse() {
+	e.enqueue(realtimeJob{response: true, run: e.createResponse})
+}
+
+// enqueue 调用方需持有 e.lock
+func (e *realtimeEmulator) enqueue(job realtimeJob) {
+	if e.closed {
+		return
+	}
+	e.queue = append(e.queue, job)
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancelActiveResponse 调用方需持有 e.lock
+func (e *realtimeEmulator) cancelActiveResponse() {
+	if e.cancelResponse != nil {
+		e.cancelResponse()
+	}
+}
+
+// worker 按顺序执行转写与回复任务，保证回复总能看到之前消息的转写结果
+func (e *realtimeEmulator) worker() {
+	defer close(e.workerDone)
+	for {
+		e.lock.Lock()
+		if len(e.queue) == 0 {
+			closed := e.closed
+			e.lock.Unlock()
+			if closed {
+				return
+			}
+			<-e.wake
+			continue
+		}
+		job := e.queue[0]
+		e.queue = e.queue[1:]
+		ctx, cancel := context.WithCancel(e.ctx)
+		if job.response {
+			e.cancelResponse = cancel
+		}
+		e.lock.Unlock()
+
+		job.run(ctx)
+
+		e.lock.Lock()
+		e.cancelResponse = nil
+		e.lock.Unlock()
+		cancel()
+	}
+}
+
+func (e *realtimeEmulator) close() {
+	e.lock.Lock()
+	e.closed = true
+	e.queue = nil
+	e.lock.Unlock()
+	e.cancel()
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	<-e.workerDone
+}
+
+// consume 按本轮用量预扣费，额度不足时结束会话
+func (e *realtimeEmulator) consume(usage *dto.RealtimeUsage) {
+	if usage.TotalTokens == 0 {
+		return
+	}
+	e.lock.Lock()
+	e.usage.TotalTokens += usage.TotalTokens
+	e.usage.InputTokens += usage.InputTokens
+	e.usage.OutputTokens += usage.OutputTokens
+	e.usage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	e.usage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	e.usage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	e.usage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+	e.lock.Unlock()
+	if err := service.PreWssConsumeQuota(e.c, e.info, usage); err != nil {
+		common.LogError(e.c, "realtime emulation: error consume usage: "+err.Error())
+		e.sendError("insufficient_quota", err.Error())
+		e.writeLock.Lock()
+		_ = e.ws.Close()
+		e.writeLock.Unlock()
+	}
+}
+
+// realtimeItemText 取出消息中可作为对话上下文的文本，音频内容使用转写结果
+func realtimeItemText(item *dto.RealtimeItem) string {
+	parts := make([]string, 0, len(item.Content))
+	for _, content := range item.Content {
+		text := content.Text
+		if text == "" {
+			text = content.Transcript
+		}
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
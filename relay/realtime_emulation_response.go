@@ -0,0 +1,687 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"unicode"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/middleware"
+	"veloera/model"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// realtimeAudioChunkMs 每个 response.audio.delta 事件携带的音频时长
+const realtimeAudioChunkMs = 500
+
+// realtimeStreamWriter 接收对话阶段适配器写出的 OpenAI SSE 数据，逐条回调 data 内容
+type realtimeStreamWriter struct {
+	header      http.Header
+	pending     []byte
+	onData      func(data string)
+	closeNotify chan bool
+}
+
+func newRealtimeStreamWriter(ctx context.Context, onData func(data string)) *realtimeStreamWriter {
+	w := &realtimeStreamWriter{
+		header:      make(http.Header),
+		onData:      onData,
+		closeNotify: make(chan bool, 1),
+	}
+	context.AfterFunc(ctx, func() {
+		w.closeNotify <- true
+	})
+	return w
+}
+
+func (w *realtimeStreamWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *realtimeStreamWriter) WriteHeader(int) {}
+
+func (w *realtimeStreamWriter) Flush() {}
+
+func (w *realtimeStreamWriter) CloseNotify() <-chan bool {
+	return w.closeNotify
+}
+
+func (w *realtimeStreamWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.pending[:idx]))
+		w.pending = w.pending[idx+1:]
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data != "" && data != "[DONE]" {
+			w.onData(data)
+		}
+	}
+	return len(p), nil
+}
+
+// stageContext 为流水线中的一次子请求构造独立的 gin 上下文，继承用户、令牌与当前渠道信息
+func (e *realtimeEmulator) stageContext(ctx context.Context, w http.ResponseWriter, path string, body io.Reader, contentType string) *gin.Context {
+	return newSubRequestContext(ctx, e.keys, e.c.Request.Header, w, path, body, contentType)
+}
+
+// audioStageContext 为语音识别或合成阶段按模型重新选择渠道
+func (e *realtimeEmulator) audioStageContext(ctx context.Context, w http.ResponseWriter, path string, body io.Reader, contentType string, modelName string) (*gin.Context, *relaycommon.RelayInfo, channel.Adaptor, error) {
+	selected, err := model.CacheGetRandomSatisfiedChannel(e.info.Group, modelName, 0)
+	if err != nil || selected == nil {
+		return nil, nil, nil, fmt.Errorf("当前分组 %s 下对于模型 %s 无可用渠道", e.info.Group, modelName)
+	}
+	sub := e.stageContext(ctx, w, path, body, contentType)
+	// 清除对话渠道遗留的模型与渠道信息
+	for _, key := range []string{"prefixed_model", "virtual_model_original", "virtual_model_actual", "model_prefix", "channel_organization", "api_version"} {
+		sub.Set(key, "")
+	}
+	sub.Set("virtual_model_mapped", false)
+	middleware.SetupContextForSelectedChannel(sub, selected, modelName)
+	info := relaycommon.GenRelayInfo(sub)
+	if err := helper.ModelMappedHelper(sub, info); err != nil {
+		return nil, nil, nil, err
+	}
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return nil, nil, nil, fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+	return sub, info, adaptor, nil
+}
+
+// runSTT 将 WAV 音频交给语音识别模型，返回转写文本
+func (e *realtimeEmulator) runSTT(ctx context.Context, modelName string, wav []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", modelName)
+	_ = writer.WriteField("response_format", "json")
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(wav); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+
+	recorder := httptest.NewRecorder()
+	sub, info, adaptor, err := e.audioStageContext(ctx, recorder, "/v1/audio/transcriptions", &body, writer.FormDataContentType(), modelName)
+	if err != nil {
+		return "", err
+	}
+	if err = sub.Request.ParseMultipartForm(32 << 20); err != nil {
+		return "", err
+	}
+	requestBody, err := adaptor.ConvertAudioRequest(sub, info, dto.AudioRequest{Model: info.UpstreamModelName, ResponseFormat: "json"})
+	if err != nil {
+		return "", err
+	}
+	resp, stop, err := doSubRequest(ctx, sub, info, adaptor, requestBody)
+	if err != nil {
+		return "", err
+	}
+	defer stop()
+	if _, openaiErr := adaptor.DoResponse(sub, resp, info); openaiErr != nil {
+		return "", errors.New(openaiErr.Error.Message)
+	}
+	var result dto.AudioResponse
+	if err = json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		return "", fmt.Errorf("invalid transcription response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// runTTS 合成一段文本，返回 16 位采样与采样率
+func (e *realtimeEmulator) runTTS(ctx context.Context, text string, voice string) ([]int16, int, error) {
+	recorder := httptest.NewRecorder()
+	sub, info, adaptor, err := e.audioStageContext(ctx, recorder, "/v1/audio/speech", nil, "application/json", e.settings.TTSModel)
+	if err != nil {
+		return nil, 0, err
+	}
+	requestBody, err := adaptor.ConvertAudioRequest(sub, info, dto.AudioRequest{
+		Model:          info.UpstreamModelName,
+		Input:          text,
+		Voice:          voice,
+		ResponseFormat: "pcm",
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, stop, err := doSubRequest(ctx, sub, info, adaptor, requestBody)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer stop()
+	if _, openaiErr := adaptor.DoResponse(sub, resp, info); openaiErr != nil {
+		return nil, 0, errors.New(openaiErr.Error.Message)
+	}
+	contentType := recorder.Header().Get("Content-Type")
+	if strings.Contains(contentType, "mpeg") || strings.Contains(contentType, "ogg") || strings.Contains(contentType, "aac") {
+		return nil, 0, fmt.Errorf("speech model %s returned %s instead of pcm", e.settings.TTSModel, contentType)
+	}
+	pcm, sampleRate := service.ExtractWavPCM(recorder.Body.Bytes())
+	if sampleRate == 0 {
+		sampleRate = 24000
+	}
+	return service.PCM16BytesToSamples(pcm), sampleRate, nil
+}
+
+type realtimeChatResult struct {
+	toolCalls    []dto.ToolCallResponse
+	promptTokens int
+	usage        *dto.Usage
+}
+
+// runChat 通过当前渠道的适配器以流式对话生成回复，文本增量经 onText 回调
+func (e *realtimeEmulator) runChat(ctx context.Context, request *dto.GeneralOpenAIRequest, onText func(delta string)) (*realtimeChatResult, error) {
+	result := &realtimeChatResult{}
+	writer := newRealtimeStreamWriter(ctx, func(data string) {
+		if ctx.Err() != nil {
+			return
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return
+		}
+		for _, choice := range chunk.Choices {
+			if delta := choice.Delta.GetContentString(); delta != "" {
+				onText(delta)
+			}
+			for i, toolCall := range choice.Delta.ToolCalls {
+				index := i
+				if toolCall.Index != nil {
+					index = *toolCall.Index
+				}
+				for len(result.toolCalls) <= index {
+					result.toolCalls = append(result.toolCalls, dto.ToolCallResponse{})
+				}
+				current := &result.toolCalls[index]
+				if toolCall.ID != "" {
+					current.ID = toolCall.ID
+				}
+				if toolCall.Function.Name != "" {
+					current.Function.Name = toolCall.Function.Name
+				}
+				current.Function.Arguments += toolCall.Function.Arguments
+			}
+		}
+	})
+	sub := e.stageContext(ctx, writer, "/v1/chat/completions", nil, "application/json")
+	info := relaycommon.GenRelayInfo(sub)
+	info.UpstreamModelName = e.info.UpstreamModelName
+	info.IsStream = true
+	request.Model = info.UpstreamModelName
+	if promptTokens, err := service.CountTokenMessages(info, request.Messages, request.Model, true); err == nil {
+		info.SetPromptTokens(promptTokens)
+		result.promptTokens = promptTokens
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return nil, fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(sub, info, request)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, err
+	}
+	resp, stop, err := doSubRequest(ctx, sub, info, adaptor, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	usage, openaiErr := adaptor.DoResponse(sub, resp, info)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if openaiErr != nil {
+		return nil, errors.New(openaiErr.Error.Message)
+	}
+	result.usage, _ = usage.(*dto.Usage)
+	return result, nil
+}
+
+// transcribe 转写用户音频并按音频时长计费
+func (e *realtimeEmulator) transcribe(ctx context.Context, item *dto.RealtimeItem, contentIndex int, audio []byte) {
+	e.lock.Lock()
+	format := e.info.InputAudioFormat
+	modelName := common.GetStringIfEmpty(e.session.InputAudioTranscription.Model, e.settings.STTModel)
+	e.lock.Unlock()
+
+	samples, sampleRate := service.DecodeRealtimeAudio(audio, format)
+	transcript, err := e.runSTT(ctx, modelName, service.PCM16ToWav(samples, sampleRate))
+	if err != nil {
+		if ctx.Err() == nil {
+			common.LogError(e.c, "realtime emulation: transcription failed: "+err.Error())
+			e.sendEvent("conversation.item.input_audio_transcription.failed", gin.H{
+				"item_id":       item.Id,
+				"content_index": contentIndex,
+				"error":         dto.OpenAIError{Type: "transcription_error", Message: err.Error()},
+			})
+		}
+		return
+	}
+	e.lock.Lock()
+	item.Content[contentIndex].Transcript = transcript
+	e.lock.Unlock()
+	e.sendEvent("conversation.item.input_audio_transcription.completed", gin.H{
+		"item_id":       item.Id,
+		"content_index": contentIndex,
+		"transcript":    transcript,
+	})
+
+	audioTokens, _ := service.CountAudioTokenInput(base64.StdEncoding.EncodeToString(audio), format)
+	e.consume(&dto.RealtimeUsage{
+		TotalTokens:       audioTokens,
+		InputTokens:       audioTokens,
+		InputTokenDetails: dto.InputTokenDetails{AudioTokens: audioTokens},
+	})
+}
+
+// buildChatRequest 将会话配置与对话条目转换为对话请求，调用方需持有 e.lock
+func (e *realtimeEmulator) buildChatRequest() *dto.GeneralOpenAIRequest {
+	messages := make([]dto.Message, 0, len(e.items)+1)
+	if e.session.Instructions != "" {
+		message := dto.Message{Role: "system"}
+		message.SetStringContent(e.session.Instructions)
+		messages = append(messages, message)
+	}
+	var pendingCalls []dto.ToolCallRequest
+	flushCalls := func() {
+		if len(pendingCalls) == 0 {
+			return
+		}
+		// 与紧邻的助手文本合并为同一条消息
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" && len(messages[last].ToolCalls) == 0 {
+			messages[last].SetToolCalls(pendingCalls)
+			pendingCalls = nil
+			return
+		}
+		message := dto.Message{Role: "assistant"}
+		message.SetNullContent()
+		message.SetToolCalls(pendingCalls)
+		messages = append(messages, message)
+		pendingCalls = nil
+	}
+	for _, item := range e.items {
+		switch item.Type {
+		case "function_call":
+			name := ""
+			if item.Name != nil {
+				name = *item.Name
+			}
+			pendingCalls = append(pendingCalls, dto.ToolCallRequest{
+				ID:       item.CallId,
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: name, Arguments: item.Arguments},
+			})
+		case "function_call_output":
+			flushCalls()
+			message := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			message.SetStringContent(item.Output)
+			messages = append(messages, message)
+		case "message":
+			flushCalls()
+			text := realtimeItemText(item)
+			if text == "" {
+				continue
+			}
+			message := dto.Message{Role: common.GetStringIfEmpty(item.Role, "user")}
+			message.SetStringContent(text)
+			messages = append(messages, message)
+		}
+	}
+	flushCalls()
+
+	request := &dto.GeneralOpenAIRequest{
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: &dto.StreamOptions{IncludeUsage: true},
+	}
+	if e.session.Temperature > 0 {
+		temperature := e.session.Temperature
+		request.Temperature = &temperature
+	}
+	if len(e.session.Tools) > 0 {
+		for _, tool := range e.session.Tools {
+			request.Tools = append(request.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+		request.ToolChoice = e.toolChoice
+	}
+	return request
+}
+
+// realtimeResponseState 一次回复中助手消息的输出进度
+type realtimeResponseState struct {
+	e           *realtimeEmulator
+	ctx         context.Context
+	responseId  string
+	voice       string
+	audio       bool
+	item        *dto.RealtimeItem
+	outputIndex int
+	output      []*dto.RealtimeItem
+	transcript  strings.Builder
+	unspoken    string
+	audioTokens int
+	ttsFailed   bool
+}
+
+func (r *realtimeResponseState) ensureMessageItem() {
+	if r.item != nil {
+		return
+	}
+	r.e.info.SetFirstResponseTime()
+	contentType := "text"
+	if r.audio {
+		contentType = "audio"
+	}
+	r.item = &dto.RealtimeItem{
+		Id:      newRealtimeId("item"),
+		Type:    "message",
+		Status:  "in_progress",
+		Role:    "assistant",
+		Content: []dto.RealtimeContent{},
+	}
+	r.outputIndex = len(r.output)
+	r.output = append(r.output, r.item)
+	r.e.lock.Lock()
+	previous := r.e.lastItemId()
+	r.e.items = append(r.e.items, r.item)
+	r.e.lock.Unlock()
+	r.e.sendEvent("response.output_item.added", gin.H{"response_id": r.responseId, "output_index": r.outputIndex, "item": r.item})
+	r.e.sendEvent(dto.RealtimeEventConversationItemCreated, gin.H{"previous_item_id": previous, "item": r.item})
+	r.e.sendEvent("response.content_part.added", gin.H{
+		"response_id":   r.responseId,
+		"item_id":       r.item.Id,
+		"output_index":  r.outputIndex,
+		"content_index": 0,
+		"part":          dto.RealtimeContent{Type: contentType},
+	})
+}
+
+func (r *realtimeResponseState) onText(delta string) {
+	r.ensureMessageItem()
+	r.transcript.WriteString(delta)
+	eventType := "response.text.delta"
+	if r.audio {
+		eventType = dto.RealtimeEventResponseAudioTranscriptionDelta
+	}
+	r.e.sendEvent(eventType, gin.H{
+		"response_id":   r.responseId,
+		"item_id":       r.item.Id,
+		"output_index":  r.outputIndex,
+		"content_index": 0,
+		"delta":         delta,
+	})
+	if !r.audio {
+		return
+	}
+	r.unspoken += delta
+	speak, rest := splitSpeakableText(r.unspoken)
+	if speak != "" {
+		r.unspoken = rest
+		r.speak(speak)
+	}
+}
+
+// speak 逐句合成语音并以 response.audio.delta 下发
+func (r *realtimeResponseState) speak(text string) {
+	if r.ttsFailed || r.ctx.Err() != nil || strings.TrimSpace(text) == "" {
+		return
+	}
+	samples, sampleRate, err := r.e.runTTS(r.ctx, text, r.voice)
+	if err != nil {
+		if r.ctx.Err() == nil {
+			// 合成失败时继续以文本输出，避免整轮回复中断
+			r.ttsFailed = true
+			common.LogError(r.e.c, "realtime emulation: speech synthesis failed: "+err.Error())
+			r.e.sendError("server_error", "speech synthesis failed: "+err.Error())
+		}
+		return
+	}
+	format := r.e.info.OutputAudioFormat
+	audio := service.EncodeRealtimeAudio(samples, sampleRate, format)
+	bytesPerSample, outputRate := realtimeAudioLayout(format)
+	chunkSize := outputRate * bytesPerSample * realtimeAudioChunkMs / 1000
+	for start := 0; start < len(audio); start += chunkSize {
+		if r.ctx.Err() != nil {
+			return
+		}
+		end := start + chunkSize
+		if end > len(audio) {
+			end = len(audio)
+		}
+		chunk := base64.StdEncoding.EncodeToString(audio[start:end])
+		tokens, _ := service.CountAudioTokenOutput(chunk, format)
+		r.audioTokens += tokens
+		r.e.sendEvent(dto.RealtimeEventResponseAudioDelta, gin.H{
+			"response_id":   r.responseId,
+			"item_id":       r.item.Id,
+			"output_index":  r.outputIndex,
+			"content_index": 0,
+			"delta":         chunk,
+		})
+	}
+}
+
+// finishMessage 结束助手消息，被打断时只保留已输出的转写
+func (r *realtimeResponseState) finishMessage(status string) {
+	if r.item == nil {
+		return
+	}
+	if status == "completed" {
+		r.speak(r.unspoken)
+	}
+	transcript := r.transcript.String()
+	content := dto.RealtimeContent{Type: "text", Text: transcript}
+	if r.audio {
+		content = dto.RealtimeContent{Type: "audio", Transcript: transcript}
+	}
+	ids := gin.H{"response_id": r.responseId, "item_id": r.item.Id, "output_index": r.outputIndex, "content_index": 0}
+	withIds := func(extra gin.H) gin.H {
+		fields := gin.H{}
+		for k, v := range ids {
+			fields[k] = v
+		}
+		for k, v := range extra {
+			fields[k] = v
+		}
+		return fields
+	}
+	if r.audio {
+		r.e.sendEvent("response.audio.done", withIds(nil))
+		r.e.sendEvent("response.audio_transcript.done", withIds(gin.H{"transcript": transcript}))
+	} else {
+		r.e.sendEvent("response.text.done", withIds(gin.H{"text": transcript}))
+	}
+	r.e.sendEvent("response.content_part.done", withIds(gin.H{"part": content}))
+
+	r.e.lock.Lock()
+	r.item.Status = status
+	r.item.Content = []dto.RealtimeContent{content}
+	r.e.lock.Unlock()
+	r.e.sendEvent("response.output_item.done", gin.H{"response_id": r.responseId, "output_index": r.outputIndex, "item": r.item})
+}
+
+func (r *realtimeResponseState) addFunctionCall(toolCall dto.ToolCallResponse) {
+	name := toolCall.Function.Name
+	callId := common.GetStringIfEmpty(toolCall.ID, newRealtimeId("call"))
+	item := &dto.RealtimeItem{
+		Id:        newRealtimeId("item"),
+		Type:      "function_call",
+		Status:    "completed",
+		Name:      &name,
+		CallId:    callId,
+		Arguments: toolCall.Function.Arguments,
+		Content:   []dto.RealtimeContent{},
+	}
+	outputIndex := len(r.output)
+	r.output = append(r.output, item)
+	r.e.lock.Lock()
+	previous := r.e.lastItemId()
+	r.e.items = append(r.e.items, item)
+	r.e.lock.Unlock()
+	r.e.sendEvent("response.output_item.added", gin.H{"response_id": r.responseId, "output_index": outputIndex, "item": item})
+	r.e.sendEvent(dto.RealtimeEventConversationItemCreated, gin.H{"previous_item_id": previous, "item": item})
+	r.e.sendEvent(dto.RealtimeEventResponseFunctionCallArgumentsDelta, gin.H{
+		"response_id":  r.responseId,
+		"item_id":      item.Id,
+		"output_index": outputIndex,
+		"call_id":      callId,
+		"delta":        item.Arguments,
+	})
+	r.e.sendEvent(dto.RealtimeEventResponseFunctionCallArgumentsDone, gin.H{
+		"response_id":  r.responseId,
+		"item_id":      item.Id,
+		"output_index": outputIndex,
+		"call_id":      callId,
+		"name":         name,
+		"arguments":    item.Arguments,
+	})
+	r.e.sendEvent("response.output_item.done", gin.H{"response_id": r.responseId, "output_index": outputIndex, "item": item})
+}
+
+// createResponse 执行一轮 对话 → 语音合成，并按文本与音频用量计费
+func (e *realtimeEmulator) createResponse(ctx context.Context) {
+	e.lock.Lock()
+	request := e.buildChatRequest()
+	voice := common.GetStringIfEmpty(e.session.Voice, e.settings.DefaultVoice)
+	audio := len(e.session.Modalities) == 0
+	for _, modality := range e.session.Modalities {
+		if modality == "audio" {
+			audio = true
+		}
+	}
+	e.lock.Unlock()
+
+	state := &realtimeResponseState{
+		e:          e,
+		ctx:        ctx,
+		responseId: newRealtimeId("resp"),
+		voice:      voice,
+		audio:      audio,
+	}
+	e.sendEvent("response.created", gin.H{"response": gin.H{
+		"id":     state.responseId,
+		"object": "realtime.response",
+		"status": "in_progress",
+		"output": []any{},
+	}})
+
+	result, err := e.runChat(ctx, request, state.onText)
+	status := "completed"
+	statusDetails := gin.H(nil)
+	switch {
+	case ctx.Err() != nil:
+		status = "cancelled"
+		statusDetails = gin.H{"type": "cancelled", "reason": "turn_detected"}
+	case err != nil:
+		status = "failed"
+		statusDetails = gin.H{"type": "failed", "error": dto.OpenAIError{Type: "server_error", Message: err.Error()}}
+		common.LogError(e.c, "realtime emulation: response failed: "+err.Error())
+	}
+	state.finishMessage(status)
+	if status == "completed" && result != nil {
+		for _, toolCall := range result.toolCalls {
+			state.addFunctionCall(toolCall)
+		}
+	}
+
+	usage := &dto.RealtimeUsage{}
+	if result != nil && result.usage != nil {
+		usage.InputTokens = result.usage.PromptTokens
+		usage.InputTokenDetails.TextTokens = result.usage.PromptTokens
+		usage.InputTokenDetails.CachedTokens = result.usage.PromptTokensDetails.CachedTokens
+		usage.OutputTokenDetails.TextTokens = result.usage.CompletionTokens
+	} else if result != nil && state.transcript.Len() > 0 {
+		// 被打断时上游用量缺失，按已输出文本估算
+		usage.InputTokens = result.promptTokens
+		usage.InputTokenDetails.TextTokens = result.promptTokens
+		usage.OutputTokenDetails.TextTokens, _ = service.CountTextToken(state.transcript.String(), e.info.UpstreamModelName)
+	}
+	usage.OutputTokenDetails.AudioTokens = state.audioTokens
+	usage.OutputTokens = usage.OutputTokenDetails.TextTokens + usage.OutputTokenDetails.AudioTokens
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+
+	e.sendEvent(dto.RealtimeEventTypeResponseDone, gin.H{"response": gin.H{
+		"id":             state.responseId,
+		"object":         "realtime.response",
+		"status":         status,
+		"status_details": statusDetails,
+		"output":         state.output,
+		"usage":          usage,
+	}})
+	e.consume(usage)
+}
+
+// splitSpeakableText 在最后一个句末标点处切分，返回可以送去合成的完整句子与剩余文本
+func splitSpeakableText(text string) (string, string) {
+	runes := []rune(text)
+	cut := -1
+	for i, r := range runes {
+		switch r {
+		case '。', '！', '？', '；', '\n':
+			cut = i + 1
+		case '.', '!', '?', ';':
+			// 英文标点后需跟空白，避免在小数点或缩写处断句
+			if i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
+				cut = i + 1
+			}
+		}
+	}
+	if cut <= 0 {
+		return "", text
+	}
+	return string(runes[:cut]), string(runes[cut:])
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/service"
+	"veloera/setting/model_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// audioPipelineChunk 一个待转写的分片，时间均为原音频中的秒数
+type audioPipelineChunk struct {
+	start    float64
+	length   float64
+	keepFrom float64 // 重叠区域按中点划分，落在 [keepFrom, keepTo) 内的分段归属该分片
+	keepTo   float64
+	filename string
+	load     func() ([]byte, error)
+}
+
+// shouldUseAudioPipeline 转写与翻译请求在开启音频流水线后由网关处理格式与切分
+func shouldUseAudioPipeline(info *relaycommon.RelayInfo) bool {
+	if info.RelayMode != relayconstant.RelayModeAudioTranscription && info.RelayMode != relayconstant.RelayModeAudioTranslation {
+		return false
+	}
+	return model_setting.GetAudioPipelineSettings().Enabled
+}
+
+// audioPipelineHelper 转码、切分长音频并分片转写，拼接结果后按 response_format 输出，按实际音频时长计费
+func audioPipelineHelper(c *gin.Context, info *relaycommon.RelayInfo, request *dto.AudioRequest) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	settings := model_setting.GetAudioPipelineSettings()
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(errors.New("file is required"), "invalid_audio_request", http.StatusBadRequest)
+	}
+	tempPath, size, err := saveAudioToTemp(fileHeader)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "save_audio_failed", http.StatusInternalServerError)
+	}
+	defer os.Remove(tempPath)
+
+	file, err := os.Open(tempPath)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "save_audio_failed", http.StatusInternalServerError)
+	}
+	defer file.Close()
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(file, header)
+	format := service.DetectAudioFormat(header[:n])
+
+	var wavInfo *service.WavInfo
+	var duration float64
+	if format == "wav" {
+		if wavInfo, err = service.ParseWavHeader(file, size); err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "invalid_audio_file", http.StatusBadRequest)
+		}
+		duration = wavInfo.Duration()
+	} else if duration, err = common.GetAudioDuration(c.Request.Context(), tempPath); err != nil {
+		common.LogWarn(c, fmt.Sprintf("get audio duration failed: %s", err.Error()))
+		duration = 0
+	}
+	if settings.MaxDurationSeconds > 0 && duration > float64(settings.MaxDurationSeconds) {
+		return nil, service.OpenAIErrorWrapperLocal(fmt.Errorf("音频时长 %.0f 秒超过上限 %d 秒", duration, settings.MaxDurationSeconds), "audio_too_long", http.StatusBadRequest)
+	}
+
+	ffmpegAvailable := service.FFmpegAvailable(settings.FFmpegPath)
+	needTranscode := !model_setting.IsAudioPassthroughFormat(format)
+	needSplit := duration > float64(settings.ChunkSeconds) || (settings.UpstreamMaxBytes > 0 && size > settings.UpstreamMaxBytes)
+	var chunks []*audioPipelineChunk
+	switch {
+	case !needTranscode && !needSplit:
+		chunks = []*audioPipelineChunk{{
+			length:   duration,
+			keepTo:   math.Inf(1),
+			filename: fileHeader.Filename,
+			load: func() ([]byte, error) {
+				return os.ReadFile(tempPath)
+			},
+		}}
+	case ffmpegAvailable:
+		if needSplit && duration <= 0 {
+			return nil, service.OpenAIErrorWrapperLocal(errors.New("无法获取音频时长，不能切分"), "invalid_audio_file", http.StatusBadRequest)
+		}
+		chunks = planAudioChunks(duration, settings, func(start, length float64) ([]byte, error) {
+			return service.TranscodeAudioSegment(c.Request.Context(), settings.FFmpegPath, tempPath, start, length)
+		})
+	case wavInfo != nil && wavInfo.Decodable():
+		chunks = planAudioChunks(duration, settings, func(start, length float64) ([]byte, error) {
+			return service.ReadWavSegment(file, wavInfo, start, length)
+		})
+	default:
+		if format == "" {
+			format = "unknown"
+		}
+		return nil, service.OpenAIErrorWrapperLocal(fmt.Errorf("音频格式 %s 需要转码或切分，但服务器未安装 ffmpeg", format), "unsupported_audio_format", http.StatusBadRequest)
+	}
+
+	// 各分片的说话人标识彼此独立，无法在拼接时对齐，需要切分的音频不支持说话人分离
+	upstreamFormats := []string{"verbose_json", "json"}
+	if request.ResponseFormat == "diarized_json" {
+		if len(chunks) > 1 {
+			return nil, service.OpenAIErrorWrapperLocal(errors.New("音频需要切分转写，各分片的说话人无法对齐，不支持 diarized_json，请缩短音频或调大分片时长"), "diarization_not_supported", http.StatusBadRequest)
+		}
+		upstreamFormats = []string{"diarized_json"}
+	}
+
+	// 适配器在主协程中初始化，分片协程只读 info
+	adaptors := make([]channel.Adaptor, len(chunks))
+	for i := range chunks {
+		adaptors[i] = GetAdaptor(info.ApiType)
+		adaptors[i].Init(info)
+	}
+	keys := make(map[string]any, len(c.Keys))
+	for k, v := range c.Keys {
+		keys[k] = v
+	}
+	fields := url.Values{}
+	for key, values := range c.Request.MultipartForm.Value {
+		if key == "model" || key == "response_format" {
+			continue
+		}
+		fields[key] = values
+	}
+
+	concurrency := settings.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(chunks) {
+		concurrency = len(chunks)
+	}
+	results := make([]*service.TranscriptionResult, len(chunks))
+	errs := make([]*dto.OpenAIErrorWithStatusCode, len(chunks))
+	// 固定数量的工作协程依次领取分片，长音频不会一次性创建大量协程
+	pending := make(chan int, len(chunks))
+	for i := range chunks {
+		pending <- i
+	}
+	close(pending)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		gopool.Go(func() {
+			defer wg.Done()
+			for i := range pending {
+				data, err := chunks[i].load()
+				if err != nil {
+					errs[i] = service.OpenAIErrorWrapperLocal(err, "transcode_audio_failed", http.StatusInternalServerError)
+					continue
+				}
+				results[i], errs[i] = transcribeAudioChunk(c, info, adaptors[i], keys, fields, request.Model, chunks[i].filename, data, upstreamFormats)
+			}
+		})
+	}
+	wg.Wait()
+	for i, chunkErr := range errs {
+		if chunkErr != nil {
+			common.LogError(c, fmt.Sprintf("audio chunk %d/%d failed: %s", i+1, len(chunks), chunkErr.Error.Message))
+			return nil, chunkErr
+		}
+	}
+
+	result := stitchTranscriptions(chunks, results)
+	if info.RelayMode == relayconstant.RelayModeAudioTranslation {
+		result.Task = "translate"
+	} else {
+		result.Task = "transcribe"
+	}
+	if duration > result.Duration {
+		result.Duration = duration
+	}
+	body, contentType, err := service.FormatTranscription(result, request.ResponseFormat)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "marshal_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, contentType, body)
+	info.CaptureContent("output_content", result.Text)
+
+	usage := &dto.Usage{PromptTokens: service.AudioDurationTokens(result.Duration)}
+	usage.TotalTokens = usage.PromptTokens
+	return usage, nil
+}
+
+func saveAudioToTemp(fileHeader *multipart.FileHeader) (string, int64, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "audio-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer dst.Close()
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", 0, err
+	}
+	return dst.Name(), size, nil
+}
+
+// planAudioChunks 按 ChunkSeconds 切分，相邻分片重叠 OverlapSeconds；分片统一转为 16kHz 单声道 WAV，
+// 单片时长同时受 UpstreamMaxBytes 限制，剩余不足 10% 的尾部并入最后一片
+func planAudioChunks(duration float64, settings *model_setting.AudioPipelineSettings, extract func(start, length float64) ([]byte, error)) []*audioPipelineChunk {
+	step := float64(settings.ChunkSeconds)
+	overlap := float64(settings.OverlapSeconds)
+	if settings.UpstreamMaxBytes > 0 {
+		maxSeconds := float64(settings.UpstreamMaxBytes-44)/float64(service.PipelineSampleRate*2)/1.1 - overlap
+		if step <= 0 || step > maxSeconds {
+			step = maxSeconds
+		}
+	}
+	if step <= 0 || duration <= 0 {
+		step = math.Max(duration, 1)
+	}
+	if overlap >= step {
+		overlap = 0
+	}
+	var chunks []*audioPipelineChunk
+	for start := 0.0; start < duration || len(chunks) == 0; start += step {
+		chunk := &audioPipelineChunk{
+			start:    start,
+			length:   step + overlap,
+			keepFrom: start + overlap/2,
+			keepTo:   start + step + overlap/2,
+			filename: fmt.Sprintf("chunk-%d.wav", len(chunks)),
+		}
+		if len(chunks) == 0 {
+			chunk.keepFrom = 0
+		}
+		last := duration-start <= step*1.1
+		if last {
+			chunk.length = duration - start
+			chunk.keepTo = math.Inf(1)
+		}
+		chunk.load = func() ([]byte, error) {
+			return extract(chunk.start, chunk.length)
+		}
+		chunks = append(chunks, chunk)
+		if last {
+			break
+		}
+	}
+	return chunks
+}
+
+// transcribeAudioChunk 以子请求转写单个分片，按 formats 的顺序请求上游格式，通常优先带时间戳的 verbose_json，上游不支持时退回 json
+func transcribeAudioChunk(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, keys map[string]any, fields url.Values, model string, filename string, data []byte, formats []string) (*service.TranscriptionResult, *dto.OpenAIErrorWithStatusCode) {
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	for _, responseFormat := range formats {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("model", model)
+		writer.WriteField("response_format", responseFormat)
+		for key, values := range fields {
+			for _, value := range values {
+				writer.WriteField(key, value)
+			}
+		}
+		part, err := writer.CreateFormFile("file", filename)
+		if err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "create_form_file_failed", http.StatusInternalServerError)
+		}
+		part.Write(data)
+		writer.Close()
+
+		sub := newSubRequestContext(c.Request.Context(), keys, c.Request.Header, httptest.NewRecorder(), c.Request.URL.Path, &body, writer.FormDataContentType())
+		if err := sub.Request.ParseMultipartForm(32 << 20); err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "parse_form_failed", http.StatusInternalServerError)
+		}
+		reader, err := adaptor.ConvertAudioRequest(sub, info, dto.AudioRequest{Model: model, ResponseFormat: responseFormat})
+		if err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		resp, err := adaptor.DoRequest(sub, info, reader)
+		if err != nil {
+			return nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		}
+		httpResp, ok := resp.(*http.Response)
+		if !ok || httpResp == nil {
+			return nil, service.OpenAIErrorWrapper(errors.New("empty response"), "do_request_failed", http.StatusInternalServerError)
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr = service.RelayErrorHandler(httpResp, false)
+			service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+			if httpResp.StatusCode == http.StatusBadRequest {
+				continue
+			}
+			return nil, openaiErr
+		}
+		responseBody, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			return nil, service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		}
+		return service.ParseTranscriptionResponse(responseBody), nil
+	}
+	return nil, openaiErr
+}
+
+// stitchTranscriptions 将分片内的时间戳平移到原音频时间轴，丢弃重叠区域中归属相邻分片的分段
+func stitchTranscriptions(chunks []*audioPipelineChunk, results []*service.TranscriptionResult) *service.TranscriptionResult {
+	if len(results) == 1 {
+		result := results[0]
+		if result.Duration < chunks[0].length {
+			result.Duration = chunks[0].length
+		}
+		return result
+	}
+	merged := &service.TranscriptionResult{Segments: []dto.Segment{}}
+	var texts []string
+	for i, result := range results {
+		chunk := chunks[i]
+		if merged.Language == "" {
+			merged.Language = result.Language
+		}
+		if len(result.Segments) == 0 {
+			// 上游未返回时间戳，整个分片作为一段
+			if result.Text != "" {
+				merged.Segments = append(merged.Segments, dto.Segment{
+					Id:    len(merged.Segments),
+					Start: chunk.keepFrom,
+					End:   math.Min(chunk.keepTo, chunk.start+chunk.length),
+					Text:  result.Text,
+				})
+				texts = append(texts, result.Text)
+			}
+			continue
+		}
+		for _, segment := range result.Segments {
+			segment.Start += chunk.start
+			segment.End += chunk.start
+			middle := (segment.Start + segment.End) / 2
+			if middle < chunk.keepFrom || middle >= chunk.keepTo {
+				continue
+			}
+			segment.Id = len(merged.Segments)
+			merged.Segments = append(merged.Segments, segment)
+			texts = append(texts, segment.Text)
+		}
+	}
+	merged.Text = service.JoinTranscriptText(texts)
+	last := chunks[len(chunks)-1]
+	merged.Duration = last.start + last.length
+	return merged
+}
@@ -20,14 +20,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 	"veloera/common"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
 	relayconstant "veloera/relay/constant"
 	"veloera/relay/helper"
 	"veloera/service"
-	"veloera/setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -43,14 +41,10 @@ func getAndValidAudioRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.
 		if audioRequest.Model == "" {
 			return nil, errors.New("model is required")
 		}
-		tokenGroup := c.GetString("token_group")
-		if setting.ShouldCheckPromptSensitiveWithGroup(tokenGroup) {
-			words, err := service.CheckSensitiveInput(audioRequest.Input)
-			if err != nil {
-				common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ",")))
-				return nil, err
-			}
+		if audioRequest.StreamFormat != "" && audioRequest.StreamFormat != "audio" && audioRequest.StreamFormat != "sse" {
+			return nil, errors.New("stream_format must be audio or sse")
 		}
+		info.IsStream = audioRequest.StreamFormat != ""
 	default:
 		err = c.Request.ParseForm()
 		if err != nil {
@@ -80,6 +74,11 @@ func AudioHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		common.LogError(c, fmt.Sprintf("getAndValidAudioRequest failed: %s", err.Error()))
 		return service.OpenAIErrorWrapper(err, "invalid_audio_request", http.StatusBadRequest)
 	}
+	if relayInfo.RelayMode == relayconstant.RelayModeAudioSpeech {
+		if openaiErr = service.ModeratePrompt(c, relayInfo, []*string{&audioRequest.Input}); openaiErr != nil {
+			return openaiErr
+		}
+	}
 
 	promptTokens := 0
 	preConsumedTokens := common.PreConsumedQuota
@@ -90,11 +89,19 @@ func AudioHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 		preConsumedTokens = promptTokens
 		relayInfo.PromptTokens = promptTokens
+		relayInfo.CaptureContent("input_content", audioRequest.Input)
 	}
 
-	priceData, err := helper.ModelPriceHelper(c, relayInfo, preConsumedTokens, 0)
-	if err != nil {
-		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	var priceData helper.PriceData
+	characterPriced := false
+	if relayInfo.RelayMode == relayconstant.RelayModeAudioSpeech {
+		priceData, characterPriced = helper.TTSCharacterPriceHelper(relayInfo, audioRequest.Input)
+	}
+	if !characterPriced {
+		priceData, err = helper.ModelPriceHelper(c, relayInfo, preConsumedTokens, 0)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+		}
 	}
 
 	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
@@ -120,6 +127,17 @@ func AudioHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	}
 	adaptor.Init(relayInfo)
 
+	if shouldUseAudioPipeline(relayInfo) {
+		var usage *dto.Usage
+		usage, openaiErr = audioPipelineHelper(c, relayInfo, audioRequest)
+		if openaiErr != nil {
+			return openaiErr
+		}
+		c.Set("response_written", true)
+		postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+		return nil
+	}
+
 	ioReader, err := adaptor.ConvertAudioRequest(c, relayInfo, *audioRequest)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
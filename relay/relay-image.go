@@ -26,11 +26,9 @@ import (
 	"strings"
 	"veloera/common"
 	"veloera/dto"
-	"veloera/model"
 	relaycommon "veloera/relay/common"
 	"veloera/relay/helper"
 	"veloera/service"
-	"veloera/setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -77,14 +75,6 @@ func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.
 	//if imageRequest.N != 0 && (imageRequest.N < 1 || imageRequest.N > 10) {
 	//	return service.OpenAIErrorWrapper(errors.New("n must be between 1 and 10"), "invalid_field_value", http.StatusBadRequest)
 	//}
-	tokenGroup := c.GetString("token_group")
-	if setting.ShouldCheckPromptSensitiveWithGroup(tokenGroup) {
-		words, err := service.CheckSensitiveInput(imageRequest.Prompt)
-		if err != nil {
-			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ",")))
-			return nil, err
-		}
-	}
 	return imageRequest, nil
 }
 
@@ -96,6 +86,9 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		common.LogError(c, fmt.Sprintf("getAndValidImageRequest failed: %s", err.Error()))
 		return service.OpenAIErrorWrapper(err, "invalid_image_request", http.StatusBadRequest)
 	}
+	if openaiErr := service.ModeratePrompt(c, relayInfo, []*string{&imageRequest.Prompt}); openaiErr != nil {
+		return openaiErr
+	}
 
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
@@ -114,11 +107,10 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		priceData.ModelPrice = 0.0025 * priceData.ModelRatio
 	}
 
-	userBalance, err := model.GetUserQuotaBalance(relayInfo.UserId, false)
+	totalQuota, err := service.GetRelayAvailableQuota(relayInfo)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
-	totalQuota := userBalance.Total()
 
 	sizeRatio := 1.0
 	// Size
@@ -32,7 +32,6 @@ import (
 	relaycommon "veloera/relay/common"
 	"veloera/relay/helper"
 	"veloera/service"
-	"veloera/setting"
 )
 
 func getAndValidateResponsesRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.OpenAIResponsesRequest, error) {
@@ -48,12 +47,32 @@ func getAndValidateResponsesRequest(c *gin.Context, relayInfo *relaycommon.Relay
 		return nil, errors.New("input is required")
 	}
 	relayInfo.IsStream = request.Stream
+	if common.LogChatContentEnabled {
+		if len(request.Instructions) > 0 {
+			relayInfo.CaptureContent("system_prompt", request.Instructions)
+		}
+		relayInfo.CaptureContent("input_content", request.Input)
+	}
 	return request, nil
 }
 
-func checkInputSensitive(textRequest *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) ([]string, error) {
-	sensitiveWords, err := service.CheckSensitiveInput(textRequest.Input)
-	return sensitiveWords, err
+func moderateResponsesRequest(c *gin.Context, textRequest *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	if textRequest.Instructions, openaiErr = service.ModerateJSONInput(c, info, textRequest.Instructions); openaiErr != nil {
+		return openaiErr
+	}
+	textRequest.Input, openaiErr = service.ModerateJSONInput(c, info, textRequest.Input)
+	return openaiErr
+}
+
+// guardResponsesRequest 在发往上游前检测请求中的密钥与 function_call_output 中的提示词注入
+func guardResponsesRequest(c *gin.Context, textRequest *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	if textRequest.Instructions, openaiErr = service.GuardJSONInput(c, info, textRequest.Instructions); openaiErr != nil {
+		return openaiErr
+	}
+	textRequest.Input, openaiErr = service.GuardJSONInput(c, info, textRequest.Input)
+	return openaiErr
 }
 
 func getInputTokens(req *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) (int, error) {
@@ -115,13 +134,11 @@ func validateAndPrepareRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo)
 		return nil, service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
 	}
 
-	tokenGroup := c.GetString("token_group")
-	if setting.ShouldCheckPromptSensitiveWithGroup(tokenGroup) {
-		sensitiveWords, err := checkInputSensitive(req, relayInfo)
-		if err != nil {
-			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(sensitiveWords, ", ")))
-			return nil, service.OpenAIErrorWrapperLocal(err, "check_request_sensitive_error", http.StatusBadRequest)
-		}
+	if openaiErr := moderateResponsesRequest(c, req, relayInfo); openaiErr != nil {
+		return nil, openaiErr
+	}
+	if openaiErr := guardResponsesRequest(c, req, relayInfo); openaiErr != nil {
+		return nil, openaiErr
 	}
 
 	return req, nil
@@ -146,10 +163,15 @@ func handleModelAndTokens(c *gin.Context, relayInfo *relaycommon.RelayInfo, req
 		c.Set("prompt_tokens", promptTokens)
 	}
 
+	if err = helper.ContextWindowHelper(relayInfo, relayInfo.PromptTokens, int(req.MaxOutputTokens)); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "context_length_exceeded", http.StatusBadRequest)
+	}
+
 	return nil
 }
 
 func handleQuotaAndPricing(c *gin.Context, relayInfo *relaycommon.RelayInfo, req *dto.OpenAIResponsesRequest) (helper.PriceData, int, int, *dto.OpenAIErrorWithStatusCode) {
+	relayInfo.PricingFeatures = helper.ResponsesPricingFeatures(req)
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, relayInfo.PromptTokens, int(req.MaxOutputTokens))
 	if err != nil {
 		return helper.PriceData{}, 0, 0, service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
@@ -249,6 +271,9 @@ func applyParamOverride(jsonData []byte, paramOverride map[string]interface{}) (
 func processResponse(c *gin.Context, httpResp *http.Response, relayInfo *relaycommon.RelayInfo) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if openaiErr == nil {
+		openaiErr = hedgeLostError(c)
+	}
 
 	if openaiErr != nil {
 		statusCodeMappingStr := c.GetString("status_code_mapping")
@@ -260,6 +285,7 @@ func processResponse(c *gin.Context, httpResp *http.Response, relayInfo *relayco
 }
 
 func postProcessQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData) {
+	priceData.ReapplyPricingRules(relayInfo, usage)
 	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
 	} else {
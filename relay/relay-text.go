@@ -36,7 +36,6 @@ import (
 	relayconstant "veloera/relay/constant"
 	"veloera/relay/helper"
 	"veloera/service"
-	"veloera/setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/shopspring/decimal"
@@ -91,6 +90,7 @@ func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo)
 	case relayconstant.RelayModeCompletions:
 		relayInfo.PromptMessages = textRequest.Prompt
 	}
+	relayInfo.CaptureContent("input_content", relayInfo.PromptMessages)
 
 	return textRequest, nil
 }
@@ -148,13 +148,11 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	// Prepend channel system prompt if configured
 	prependSystemPromptIfNeeded(c, textRequest, relayInfo)
 
-	tokenGroup := c.GetString("token_group")
-	if setting.ShouldCheckPromptSensitiveWithGroup(tokenGroup) {
-		words, err := checkRequestSensitive(textRequest, relayInfo)
-		if err != nil {
-			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
-			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
-		}
+	if openaiErr = moderateTextRequest(c, textRequest, relayInfo); openaiErr != nil {
+		return openaiErr
+	}
+	if openaiErr = guardTextRequest(c, textRequest, relayInfo); openaiErr != nil {
+		return openaiErr
 	}
 
 	err = helper.ModelMappedHelper(c, relayInfo)
@@ -178,7 +176,13 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		c.Set("prompt_tokens", promptTokens)
 	}
 
-	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(math.Max(float64(textRequest.MaxTokens), float64(textRequest.MaxCompletionTokens))))
+	maxTokens := int(math.Max(float64(textRequest.MaxTokens), float64(textRequest.MaxCompletionTokens)))
+	if err = helper.ContextWindowHelper(relayInfo, promptTokens, maxTokens); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "context_length_exceeded", http.StatusBadRequest)
+	}
+
+	relayInfo.PricingFeatures = helper.OpenAIPricingFeatures(textRequest)
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, maxTokens)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
 	}
@@ -323,6 +327,9 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 			c.Set("response_written", true)
 		}
 	}
+	if openaiErr == nil {
+		openaiErr = hedgeLostError(c)
+	}
 	if openaiErr != nil {
 		if pseudoStream && stopHeartbeat != nil {
 			stopHeartbeat()
@@ -332,6 +339,7 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		return openaiErr
 	}
 
+	priceData.ReapplyPricingRules(relayInfo, usage.(*dto.Usage))
 	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
 	} else {
@@ -363,29 +371,40 @@ func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.Re
 	return promptTokens, err
 }
 
-func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) ([]string, error) {
-	var err error
-	var words []string
+func moderateTextRequest(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	var openaiErr *dto.OpenAIErrorWithStatusCode
 	switch info.RelayMode {
 	case relayconstant.RelayModeChatCompletions:
-		words, err = service.CheckSensitiveMessages(textRequest.Messages)
+		openaiErr = service.ModerateMessages(c, info, textRequest.Messages)
 	case relayconstant.RelayModeCompletions:
-		words, err = service.CheckSensitiveInput(textRequest.Prompt)
-	case relayconstant.RelayModeModerations:
-		words, err = service.CheckSensitiveInput(textRequest.Input)
+		textRequest.Prompt, openaiErr = service.ModeratePromptInput(c, info, textRequest.Prompt)
+	case relayconstant.RelayModeModerations, relayconstant.RelayModeEmbeddings:
+		textRequest.Input, openaiErr = service.ModeratePromptInput(c, info, textRequest.Input)
+	}
+	return openaiErr
+}
+
+// guardTextRequest 在发往上游前检测请求中的密钥与工具结果中的提示词注入
+func guardTextRequest(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions:
+		openaiErr = service.GuardMessages(c, info, textRequest.Messages)
+	case relayconstant.RelayModeCompletions:
+		_, openaiErr = service.GuardStructuredContent(c, info, &textRequest.Prompt)
 	case relayconstant.RelayModeEmbeddings:
-		words, err = service.CheckSensitiveInput(textRequest.Input)
+		_, openaiErr = service.GuardStructuredContent(c, info, &textRequest.Input)
 	}
-	return words, err
+	return openaiErr
 }
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
-	userBalance, err := model.GetUserQuotaBalance(relayInfo.UserId, false)
+	// 后付费账户的可用额度包含剩余授信额度，组织令牌取组织额度池
+	totalQuota, err := service.GetRelayAvailableQuota(relayInfo)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
-	totalQuota := userBalance.Total()
 	if totalQuota <= 0 {
 		return 0, 0, service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
@@ -416,7 +435,7 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		subscriptionUsed, quotaUsed, consumeErr := model.ConsumeUserQuota(relayInfo.UserId, preConsumedQuota)
+		subscriptionUsed, quotaUsed, consumeErr := service.ConsumeRelayQuota(relayInfo, preConsumedQuota)
 		if consumeErr != nil {
 			rollbackErr := model.IncreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, preConsumedQuota)
 			if rollbackErr != nil {
@@ -429,6 +448,14 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	return preConsumedQuota, totalQuota, nil
 }
 
+// hedgeLostError 对冲请求中落败的一方按错误处理，从而退还预扣费额度且不计费
+func hedgeLostError(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	if !relaycommon.IsHedgeLost(c) {
+		return nil
+	}
+	return service.OpenAIErrorWrapperLocal(errors.New("hedged request lost"), "hedge_lost", http.StatusInternalServerError)
+}
+
 func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, userQuota int, preConsumedQuota int) {
 	if preConsumedQuota != 0 {
 		gopool.Go(func() {
@@ -36,6 +36,7 @@ import (
 	"veloera/relay/channel/openai"
 	"veloera/relay/channel/palm"
 	"veloera/relay/channel/perplexity"
+	"veloera/relay/channel/selfhosted"
 	"veloera/relay/channel/siliconflow"
 	"veloera/relay/channel/task/suno"
 	"veloera/relay/channel/tencent"
@@ -103,6 +104,8 @@ func GetAdaptor(apiType int) channel.Adaptor {
 		return &openai.Adaptor{}
 	case constant.APITypeXai:
 		return &xai.Adaptor{}
+	case constant.APITypeSelfHosted:
+		return &selfhosted.Adaptor{}
 	}
 	return nil
 }
@@ -27,6 +27,7 @@ import (
 	relayconstant "veloera/relay/constant"
 	"veloera/relay/helper"
 	"veloera/service"
+	"veloera/setting/model_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -104,6 +105,23 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	}
 	adaptor.Init(relayInfo)
 
+	inputs := embeddingRequest.ParseInput()
+	batchSize := embeddingBatchSize(relayInfo, adaptor)
+	if shouldUseEmbeddingPipeline(relayInfo, embeddingRequest, inputs, batchSize) {
+		var usage *dto.Usage
+		usage, openaiErr = embeddingPipelineHelper(c, relayInfo, embeddingRequest, inputs, batchSize)
+		if openaiErr != nil {
+			return openaiErr
+		}
+		if usage.PromptTokensDetails.CachedTokens > 0 {
+			priceData.CacheRatio = model_setting.GetEmbeddingSettings().CacheHitRatio
+		}
+		c.Set("response_written", true)
+		priceData.ReapplyPricingRules(relayInfo, usage)
+		postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+		return nil
+	}
+
 	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, relayInfo, *embeddingRequest)
 
 	if err != nil {
@@ -139,6 +157,7 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	}
 	// 标记响应已写入，用于空回复检测
 	c.Set("response_written", true)
+	priceData.ReapplyPricingRules(relayInfo, usage.(*dto.Usage))
 	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
 	return nil
 }
@@ -0,0 +1,242 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/service"
+	"veloera/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// embeddingOutputItem encoding_format 为 base64 时 embedding 为字符串
+type embeddingOutputItem struct {
+	Object    string `json:"object"`
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"`
+}
+
+type embeddingOutput struct {
+	Object string                `json:"object"`
+	Data   []embeddingOutputItem `json:"data"`
+	Model  string                `json:"model"`
+	Usage  dto.Usage             `json:"usage"`
+}
+
+// embeddingBatchSize 渠道设置优先，其次按渠道名取全局配置
+func embeddingBatchSize(info *relaycommon.RelayInfo, adaptor channel.Adaptor) int {
+	if size, ok := info.ChannelSetting[constant.ChannelSettingEmbeddingBatch].(float64); ok && size > 0 {
+		return int(size)
+	}
+	return model_setting.GetEmbeddingBatchSize(adaptor.GetChannelName())
+}
+
+// shouldUseEmbeddingPipeline 超出批量上限、启用缓存、需要模拟 dimensions 或 base64 输出时由网关处理，否则原样转发
+func shouldUseEmbeddingPipeline(info *relaycommon.RelayInfo, request *dto.EmbeddingRequest, inputs []string, batchSize int) bool {
+	if info.RelayMode != relayconstant.RelayModeEmbeddings || len(inputs) == 0 {
+		return false
+	}
+	// token 数组等非字符串输入保持原样转发
+	if list, ok := request.Input.([]any); ok && len(list) != len(inputs) {
+		return false
+	}
+	return len(inputs) > batchSize ||
+		model_setting.GetEmbeddingSettings().CacheEnabled ||
+		request.EncodingFormat == "base64" ||
+		(request.Dimensions > 0 && !model_setting.SupportsNativeDimensions(info.UpstreamModelName))
+}
+
+// embeddingPipelineHelper 查询缓存后将未命中的输入按批量上限拆分并发请求上游，按原顺序拼回，
+// 命中缓存的 token 记为 cached tokens 由调用方按 CacheHitRatio 计费
+func embeddingPipelineHelper(c *gin.Context, info *relaycommon.RelayInfo, request *dto.EmbeddingRequest, inputs []string, batchSize int) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	settings := model_setting.GetEmbeddingSettings()
+	nativeDimensions := model_setting.SupportsNativeDimensions(info.UpstreamModelName)
+	embeddings := make([][]float64, len(inputs))
+	cacheKeys := make([]string, len(inputs))
+	usage := &dto.Usage{}
+
+	var misses []int
+	for i, text := range inputs {
+		if settings.CacheEnabled {
+			cacheKeys[i] = service.EmbeddingCacheKey(info.UpstreamModelName, request.Dimensions, text)
+			if embedding, ok := service.GetCachedEmbedding(cacheKeys[i]); ok {
+				embeddings[i] = embedding
+				tokens, _ := service.CountTextToken(text, info.UpstreamModelName)
+				usage.PromptTokensDetails.CachedTokens += tokens
+				continue
+			}
+		}
+		misses = append(misses, i)
+	}
+
+	var batches [][]int
+	for start := 0; start < len(misses); start += batchSize {
+		batches = append(batches, misses[start:min(start+batchSize, len(misses))])
+	}
+	adaptors := make([]channel.Adaptor, len(batches))
+	for i := range batches {
+		adaptors[i] = GetAdaptor(info.ApiType)
+		adaptors[i].Init(info)
+	}
+	keys := make(map[string]any, len(c.Keys))
+	for k, v := range c.Keys {
+		keys[k] = v
+	}
+
+	concurrency := settings.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	batchUsages := make([]*dto.Usage, len(batches))
+	errs := make([]*dto.OpenAIErrorWithStatusCode, len(batches))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, batch []int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			texts := make([]string, len(batch))
+			for j, index := range batch {
+				texts[j] = inputs[index]
+			}
+			vectors, batchUsage, err := requestEmbeddingBatch(c, info, adaptors[i], keys, request, texts, nativeDimensions)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			batchUsages[i] = batchUsage
+			for j, index := range batch {
+				embeddings[index] = service.TruncateEmbedding(vectors[j], request.Dimensions)
+				if settings.CacheEnabled {
+					service.SetCachedEmbedding(cacheKeys[index], embeddings[index])
+				}
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+	for i, batchErr := range errs {
+		if batchErr != nil {
+			common.LogError(c, fmt.Sprintf("embedding batch %d/%d failed: %s", i+1, len(batches), batchErr.Error.Message))
+			return nil, batchErr
+		}
+	}
+	for _, batchUsage := range batchUsages {
+		usage.PromptTokens += batchUsage.PromptTokens
+	}
+	usage.PromptTokens += usage.PromptTokensDetails.CachedTokens
+	usage.TotalTokens = usage.PromptTokens
+
+	output := embeddingOutput{
+		Object: "list",
+		Data:   make([]embeddingOutputItem, len(embeddings)),
+		Model:  info.UpstreamModelName,
+		Usage:  *usage,
+	}
+	for i, embedding := range embeddings {
+		output.Data[i] = embeddingOutputItem{Object: "embedding", Index: i, Embedding: embedding}
+		if request.EncodingFormat == "base64" {
+			output.Data[i].Embedding = service.EncodeEmbeddingBase64(embedding)
+		}
+	}
+	c.JSON(http.StatusOK, output)
+	return usage, nil
+}
+
+// requestEmbeddingBatch 以子请求发送一批输入，复用渠道适配器的转换与响应处理，从输出中取回 OpenAI 格式的向量
+func requestEmbeddingBatch(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, keys map[string]any, request *dto.EmbeddingRequest, texts []string, nativeDimensions bool) ([][]float64, *dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	batchRequest := *request
+	batchRequest.Input = texts
+	batchRequest.EncodingFormat = ""
+	if !nativeDimensions {
+		batchRequest.Dimensions = 0
+	}
+	// 每个批次独立计算用量，避免并发写入同一个 RelayInfo
+	batchInfo := *info
+	batchInfo.PromptTokens = 0
+	batchInfo.Other = map[string]interface{}{relayconstant.KeyEmbeddingInput: texts}
+
+	jsonData, err := json.Marshal(batchRequest)
+	if err != nil {
+		return nil, nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	recorder := httptest.NewRecorder()
+	sub := newSubRequestContext(c.Request.Context(), keys, c.Request.Header, recorder, c.Request.URL.Path, bytes.NewReader(jsonData), "application/json")
+	convertedRequest, err := adaptor.ConvertEmbeddingRequest(sub, &batchInfo, batchRequest)
+	if err != nil {
+		return nil, nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err = json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	resp, err := adaptor.DoRequest(sub, &batchInfo, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok || httpResp == nil {
+		return nil, nil, service.OpenAIErrorWrapper(errors.New("empty response"), "do_request_failed", http.StatusInternalServerError)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		openaiErr := service.RelayErrorHandler(httpResp, false)
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return nil, nil, openaiErr
+	}
+	usage, openaiErr := adaptor.DoResponse(sub, httpResp, &batchInfo)
+	if openaiErr != nil {
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return nil, nil, openaiErr
+	}
+
+	var response dto.OpenAIEmbeddingResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return nil, nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, nil, service.OpenAIErrorWrapper(fmt.Errorf("upstream returned %d embeddings for %d inputs", len(response.Data), len(texts)), "embedding_count_mismatch", http.StatusBadGateway)
+	}
+	vectors := make([][]float64, len(texts))
+	for position, item := range response.Data {
+		index := item.Index
+		if index < 0 || index >= len(texts) || vectors[index] != nil {
+			index = position
+		}
+		vectors[index] = item.Embedding
+	}
+	batchUsage, _ := usage.(*dto.Usage)
+	if batchUsage == nil {
+		batchUsage = &dto.Usage{}
+	}
+	return vectors, batchUsage, nil
+}
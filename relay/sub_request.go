@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"veloera/common"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSubRequestContext 构造网关内部子请求使用的 gin 上下文，继承用户、令牌与渠道信息，
+// 但不继承已缓存的原始请求体
+func newSubRequestContext(ctx context.Context, keys map[string]any, header http.Header, w http.ResponseWriter, path string, body io.Reader, contentType string) *gin.Context {
+	sub, _ := gin.CreateTestContext(w)
+	if body == nil {
+		body = http.NoBody
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, path, body)
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", contentType)
+	sub.Request = req
+	for k, v := range keys {
+		if k == common.KeyRequestBody {
+			continue
+		}
+		sub.Set(k, v)
+	}
+	return sub
+}
+
+// doSubRequest 发起子请求并检查状态码，上下文取消时关闭响应体以尽快结束读取
+func doSubRequest(ctx context.Context, sub *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, body io.Reader) (*http.Response, func() bool, error) {
+	resp, err := adaptor.DoRequest(sub, info, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok || httpResp == nil {
+		return nil, nil, errors.New("empty response")
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		openaiErr := service.RelayErrorHandler(httpResp, false)
+		return nil, nil, fmt.Errorf("status code %d: %s", httpResp.StatusCode, openaiErr.Error.Message)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = httpResp.Body.Close()
+	})
+	return httpResp, stop, nil
+}
@@ -110,6 +110,18 @@ func WssHelper(c *gin.Context, ws *websocket.Conn) (openaiErr *dto.OpenAIErrorWi
 		}
 	}()
 
+	// 非 OpenAI 渠道由网关模拟实时会话
+	if shouldEmulateRealtime(relayInfo) {
+		var usage *dto.RealtimeUsage
+		openaiErr, usage = realtimeEmulationHandler(c, relayInfo)
+		if openaiErr != nil {
+			return openaiErr
+		}
+		service.PostWssConsumeQuota(c, relayInfo, relayInfo.UpstreamModelName, usage, preConsumedQuota,
+			userQuota, modelRatio, groupRatio, modelPrice, getModelPriceSuccess, "")
+		return nil
+	}
+
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
@@ -17,6 +17,7 @@
 package router
 
 import (
+	"veloera/common"
 	"veloera/controller"
 	"veloera/middleware"
 
@@ -41,7 +42,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(common.PermissionChannelsRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/about", controller.GetAbout)
 		//apiRouter.GET("/midjourney", controller.GetMidjourney)
@@ -51,16 +52,18 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			planRoute.GET("/", middleware.UserAuth(), controller.GetSubscriptionPlans)
 			planRoute.GET("/self", middleware.UserAuth(), controller.GetUserPlanOrders)
+			planRoute.GET("/self/daily", middleware.UserAuth(), controller.GetUserPlanDailyStatus)
+			planRoute.PUT("/self/:id/auto_renew", middleware.UserAuth(), controller.UpdateUserPlanOrderAutoRenew)
 			planRoute.GET("/purchase", controller.PurchaseSubscriptionPlanNotAllowed)
 			planRoute.POST("/purchase", middleware.UserAuth(), controller.PurchaseSubscriptionPlan)
 
 			planAdminRoute := planRoute.Group("/admin")
-			planAdminRoute.Use(middleware.AdminAuth())
 			{
-				planAdminRoute.GET("/", controller.AdminGetSubscriptionPlans)
-				planAdminRoute.POST("/", controller.AdminCreateSubscriptionPlan)
-				planAdminRoute.PUT("/", controller.AdminUpdateSubscriptionPlan)
-				planAdminRoute.DELETE("/:id", controller.AdminDeleteSubscriptionPlan)
+				planAdminRoute.GET("/", middleware.PermissionAuth(common.PermissionPlansRead), controller.AdminGetSubscriptionPlans)
+				planAdminRoute.POST("/", middleware.PermissionAuth(common.PermissionPlansWrite), controller.AdminCreateSubscriptionPlan)
+				planAdminRoute.PUT("/", middleware.PermissionAuth(common.PermissionPlansWrite), controller.AdminUpdateSubscriptionPlan)
+				// 删除套餐会向持有该套餐的用户退款
+				planAdminRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionPlansWrite, common.PermissionBillingRefund), controller.AdminDeleteSubscriptionPlan)
 			}
 		}
 		apiRouter.GET("/verification", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendEmailVerification)
@@ -91,6 +94,7 @@ func SetApiRouter(router *gin.Engine) {
 			{
 				selfRoute.GET("/self/groups", controller.GetUserGroups)
 				selfRoute.GET("/self", controller.GetSelf)
+				selfRoute.GET("/self/permissions", controller.GetSelfPermissions)
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
@@ -103,53 +107,79 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 				selfRoute.GET("/check_in_status", controller.CheckInStatus)
 				selfRoute.POST("/check_in", controller.CheckIn)
+				selfRoute.GET("/self/statement", controller.GetSelfStatement)
+				selfRoute.GET("/self/settlements", controller.GetSelfPostpaidSettlements)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
+				adminRoute.GET("/", middleware.PermissionAuth(common.PermissionUsersRead), controller.GetAllUsers)
+				adminRoute.GET("/search", middleware.PermissionAuth(common.PermissionUsersRead), controller.SearchUsers)
+				adminRoute.GET("/statement/export", middleware.PermissionAuth(common.PermissionBillingRead), controller.ExportStatements)
+				adminRoute.POST("/billing_mode", middleware.PermissionAuth(common.PermissionBillingManage), controller.UpdateUserBillingMode)
+				adminRoute.GET("/settlement", middleware.PermissionAuth(common.PermissionBillingRead), controller.GetAllPostpaidSettlements)
+				adminRoute.POST("/settlement", middleware.PermissionAuth(common.PermissionBillingManage), controller.CreatePostpaidSettlements)
+				adminRoute.POST("/settlement/:id/settle", middleware.PermissionAuth(common.PermissionBillingManage), controller.SettlePostpaidSettlement)
+				adminRoute.PUT("/role", middleware.PermissionAuth(common.PermissionUsersManage, common.PermissionRolesManage), controller.UpdateUserRole)
+				adminRoute.GET("/:id", middleware.PermissionAuth(common.PermissionUsersRead), controller.GetUser)
+				adminRoute.POST("/", middleware.PermissionAuth(common.PermissionUsersManage), controller.CreateUser)
+				adminRoute.POST("/manage", middleware.PermissionAuth(common.PermissionUsersManage), controller.ManageUser)
+				adminRoute.PUT("/", middleware.PermissionAuth(common.PermissionUsersManage), controller.UpdateUser)
+				adminRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionUsersManage), controller.DeleteUser)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
-			optionRoute.POST("/validate_fallback_pricing", controller.ValidateFallbackPricing)
+			optionRoute.GET("/", middleware.PermissionAuth(common.PermissionOptionsRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.UpdateOption)
+			optionRoute.POST("/rest_model_ratio", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.ResetModelRatio)
+			optionRoute.POST("/validate_fallback_pricing", middleware.PermissionAuth(common.PermissionOptionsRead), controller.ValidateFallbackPricing)
+		}
+		modelCatalogRoute := apiRouter.Group("/model_catalog")
+		{
+			modelCatalogRoute.GET("/", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetAllModelCatalogs)
+			modelCatalogRoute.GET("/:id", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetModelCatalog)
+			modelCatalogRoute.POST("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.AddModelCatalog)
+			modelCatalogRoute.PUT("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.UpdateModelCatalog)
+			modelCatalogRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionModelsWrite), controller.DeleteModelCatalog)
+			modelCatalogRoute.POST("/:id/notify", middleware.PermissionAuth(common.PermissionModelsWrite, common.PermissionMessagesWrite), controller.NotifyModelCatalogUsers)
+		}
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.PermissionAuth(common.PermissionRolesManage))
+		{
+			roleRoute.GET("/", controller.GetAllRoles)
+			roleRoute.GET("/permissions", controller.GetAllPermissions)
+			roleRoute.GET("/:id", controller.GetRole)
+			roleRoute.POST("/", controller.AddRole)
+			roleRoute.PUT("/", controller.UpdateRole)
+			roleRoute.DELETE("/:id", controller.DeleteRole)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
-		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/tags", controller.GetChannelTags)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+		{
+			channelRoute.GET("/", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetAllChannels)
+			channelRoute.GET("/search", middleware.PermissionAuth(common.PermissionChannelsRead), controller.SearchChannels)
+			channelRoute.GET("/tags", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannelTags)
+			channelRoute.GET("/models", middleware.PermissionAuth(common.PermissionChannelsRead), controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", middleware.PermissionAuth(common.PermissionChannelsRead), controller.EnabledListModels)
+			channelRoute.GET("/self_hosted/status", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetSelfHostedStatus)
+			channelRoute.GET("/:id", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannel)
+			channelRoute.GET("/test", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.TestAllChannels)
+			channelRoute.GET("/test/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.TestChannel)
+			channelRoute.GET("/update_balance", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateChannelBalance)
+			channelRoute.POST("/", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.AddChannel)
+			channelRoute.PUT("/", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.EnableTagChannels)
+			channelRoute.PUT("/tag", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.EditTagChannels)
+			channelRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteChannel)
+			channelRoute.POST("/batch", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.FetchUpstreamModels)
+			channelRoute.POST("/ollama/pull/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.PullOllamaModel)
+			channelRoute.POST("/fetch_models", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.FetchModels)
+			channelRoute.POST("/batch/tag", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.BatchSetChannelTag)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -161,31 +191,74 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		orgRoute := apiRouter.Group("/org")
+		orgRoute.Use(middleware.UserAuth())
+		{
+			orgRoute.GET("/self", controller.GetSelfOrganizations)
+			orgRoute.POST("/", controller.CreateOrganization)
+			orgRoute.GET("/invitation/self", controller.GetSelfOrganizationInvitations)
+			orgRoute.POST("/invitation/accept", controller.AcceptOrganizationInvitation)
+			orgRoute.GET("/admin", middleware.PermissionAuth(common.PermissionBillingRead), controller.GetAllOrganizations)
+			orgRoute.PUT("/admin", middleware.PermissionAuth(common.PermissionBillingManage), controller.AdminUpdateOrganization)
+			orgRoute.GET("/:id", controller.GetOrganization)
+			orgRoute.PUT("/:id", controller.UpdateOrganization)
+			orgRoute.DELETE("/:id", controller.DeleteOrganization)
+			orgRoute.POST("/:id/fund", controller.FundOrganization)
+			orgRoute.GET("/:id/member", controller.GetOrganizationMembers)
+			orgRoute.PUT("/:id/member", controller.UpdateOrganizationMember)
+			orgRoute.DELETE("/:id/member/:user_id", controller.RemoveOrganizationMember)
+			orgRoute.GET("/:id/invitation", controller.GetOrganizationInvitations)
+			orgRoute.POST("/:id/invitation", controller.CreateOrganizationInvitation)
+			orgRoute.DELETE("/:id/invitation/:invitation_id", controller.RevokeOrganizationInvitation)
+			orgRoute.GET("/:id/token", controller.GetOrganizationTokens)
+			orgRoute.GET("/:id/report", controller.GetOrganizationUsageReport)
+		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
-		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/count-by-name", controller.CountRedemptionsByName)
-			redemptionRoute.DELETE("/delete-by-name", controller.DeleteRedemptionsByName)
-			redemptionRoute.PUT("/batch-disable", controller.BatchDisableRedemptions)
-			redemptionRoute.DELETE("/delete-disabled", controller.DeleteDisabledRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+		{
+			redemptionRoute.GET("/", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.SearchRedemptions)
+			redemptionRoute.GET("/count-by-name", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.CountRedemptionsByName)
+			redemptionRoute.DELETE("/delete-by-name", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.DeleteRedemptionsByName)
+			redemptionRoute.PUT("/batch-disable", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.BatchDisableRedemptions)
+			redemptionRoute.DELETE("/delete-disabled", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.DeleteDisabledRedemptions)
+			redemptionRoute.GET("/:id", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.GetRedemption)
+			redemptionRoute.POST("/", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.AddRedemption)
+			redemptionRoute.PUT("/", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(common.PermissionLogsDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogsStat)
+		logRoute.GET("/archive", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogArchives)
+		logRoute.POST("/archive", middleware.PermissionAuth(common.PermissionLogsArchive), controller.ArchiveLogs)
+		logRoute.GET("/content", middleware.PermissionAuth(common.PermissionLogsContent), controller.GetChatContents)
+		logRoute.GET("/content/:id", middleware.PermissionAuth(common.PermissionLogsContent), controller.GetChatContent)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", middleware.PermissionAuth(common.PermissionLogsRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
+		configRoute := apiRouter.Group("/config")
+		{
+			configRoute.GET("/export", middleware.PermissionAuth(common.PermissionOptionsRead, common.PermissionChannelsRead, common.PermissionPlansRead), controller.ExportConfig)
+			configRoute.POST("/import", middleware.PermissionAuth(common.PermissionOptionsWrite, common.PermissionChannelsWrite, common.PermissionPlansWrite), controller.ImportConfig)
+		}
+		secretRoute := apiRouter.Group("/secret")
+		secretRoute.Use(middleware.PermissionAuth(common.PermissionChannelsWrite, common.PermissionOptionsWrite))
+		{
+			secretRoute.GET("/status", controller.GetSecretStatus)
+			secretRoute.POST("/rotate", controller.RotateSecrets)
+		}
+		auditLogRoute := apiRouter.Group("/audit_log")
+		auditLogRoute.Use(middleware.PermissionAuth(common.PermissionAuditRead))
+		{
+			auditLogRoute.GET("/", controller.GetAuditLogs)
+			auditLogRoute.GET("/export", controller.ExportAuditLogs)
+		}
+
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS())
@@ -194,29 +267,28 @@ func SetApiRouter(router *gin.Engine) {
 
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(common.PermissionChannelsRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
 		// Model mapping routes
 		modelMappingRoute := apiRouter.Group("/model_mapping")
-		modelMappingRoute.Use(middleware.AdminAuth())
 		{
-			modelMappingRoute.GET("/", controller.GetGlobalModelMapping)
-			modelMappingRoute.PUT("/", controller.UpdateGlobalModelMapping)
-			modelMappingRoute.GET("/config", controller.GetModelMappingConfig)
-			modelMappingRoute.PUT("/config", controller.UpdateModelMappingConfig)
-			modelMappingRoute.POST("/reload", controller.ReloadModelMapping)
+			modelMappingRoute.GET("/", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetGlobalModelMapping)
+			modelMappingRoute.PUT("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.UpdateGlobalModelMapping)
+			modelMappingRoute.GET("/config", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetModelMappingConfig)
+			modelMappingRoute.PUT("/config", middleware.PermissionAuth(common.PermissionModelsWrite), controller.UpdateModelMappingConfig)
+			modelMappingRoute.POST("/reload", middleware.PermissionAuth(common.PermissionModelsWrite), controller.ReloadModelMapping)
 		}
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(common.PermissionTasksRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(common.PermissionTasksRead), controller.GetAllTask)
 		}
 
 		// User message routes
@@ -230,15 +302,14 @@ func SetApiRouter(router *gin.Engine) {
 
 		// Admin message routes
 		adminMessageRoute := apiRouter.Group("/admin/messages")
-		adminMessageRoute.Use(middleware.AdminAuth())
-		{
-			adminMessageRoute.GET("/", controller.GetAllMessages)
-			adminMessageRoute.GET("/search", controller.SearchMessages)
-			adminMessageRoute.GET("/:id", controller.GetMessage)
-			adminMessageRoute.POST("/", controller.CreateMessage)
-			adminMessageRoute.PUT("/:id", controller.UpdateMessage)
-			adminMessageRoute.DELETE("/:id", controller.DeleteMessage)
-			adminMessageRoute.GET("/:id/recipients", controller.GetMessageRecipients)
+		{
+			adminMessageRoute.GET("/", middleware.PermissionAuth(common.PermissionMessagesRead), controller.GetAllMessages)
+			adminMessageRoute.GET("/search", middleware.PermissionAuth(common.PermissionMessagesRead), controller.SearchMessages)
+			adminMessageRoute.GET("/:id", middleware.PermissionAuth(common.PermissionMessagesRead), controller.GetMessage)
+			adminMessageRoute.POST("/", middleware.PermissionAuth(common.PermissionMessagesWrite), controller.CreateMessage)
+			adminMessageRoute.PUT("/:id", middleware.PermissionAuth(common.PermissionMessagesWrite), controller.UpdateMessage)
+			adminMessageRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionMessagesWrite), controller.DeleteMessage)
+			adminMessageRoute.GET("/:id/recipients", middleware.PermissionAuth(common.PermissionMessagesRead), controller.GetMessageRecipients)
 		}
 	}
 }
@@ -59,13 +59,13 @@ func handlePlanAPINoRoute(c *gin.Context) bool {
 	case path == "/api/plan/admin" || path == "/api/plan/admin/":
 		switch method {
 		case http.MethodGet:
-			runAuthAndHandle(c, middleware.AdminAuth(), controller.AdminGetSubscriptionPlans)
+			runAuthAndHandle(c, middleware.PermissionAuth(common.PermissionPlansRead), controller.AdminGetSubscriptionPlans)
 			return true
 		case http.MethodPost:
-			runAuthAndHandle(c, middleware.AdminAuth(), controller.AdminCreateSubscriptionPlan)
+			runAuthAndHandle(c, middleware.PermissionAuth(common.PermissionPlansWrite), controller.AdminCreateSubscriptionPlan)
 			return true
 		case http.MethodPut:
-			runAuthAndHandle(c, middleware.AdminAuth(), controller.AdminUpdateSubscriptionPlan)
+			runAuthAndHandle(c, middleware.PermissionAuth(common.PermissionPlansWrite), controller.AdminUpdateSubscriptionPlan)
 			return true
 		}
 	case method == http.MethodDelete && strings.HasPrefix(path, "/api/plan/admin/"):
@@ -78,7 +78,7 @@ func handlePlanAPINoRoute(c *gin.Context) bool {
 			Key:   "id",
 			Value: id,
 		})
-		runAuthAndHandle(c, middleware.AdminAuth(), controller.AdminDeleteSubscriptionPlan)
+		runAuthAndHandle(c, middleware.PermissionAuth(common.PermissionPlansWrite, common.PermissionBillingRefund), controller.AdminDeleteSubscriptionPlan)
 		return true
 	}
 
@@ -17,8 +17,11 @@
 package service
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 func parseAudio(audioBase64 string, format string) (duration float64, err error) {
@@ -45,3 +48,206 @@ func parseAudio(audioBase64 string, format string) (duration float64, err error)
 	duration = float64(samplesCount) / float64(sampleRate)
 	return duration, nil
 }
+
+// DecodeRealtimeAudio 将实时接口的音频（pcm16 / g711_ulaw / g711_alaw）解码为 16 位采样，返回采样与采样率
+func DecodeRealtimeAudio(data []byte, format string) ([]int16, int) {
+	switch format {
+	case "g711_ulaw":
+		samples := make([]int16, len(data))
+		for i, b := range data {
+			samples[i] = ulawDecode(b)
+		}
+		return samples, 8000
+	case "g711_alaw":
+		samples := make([]int16, len(data))
+		for i, b := range data {
+			samples[i] = alawDecode(b)
+		}
+		return samples, 8000
+	default:
+		samples := make([]int16, len(data)/2)
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+		}
+		return samples, 24000
+	}
+}
+
+// EncodeRealtimeAudio 将 16 位采样编码为实时接口的输出格式，必要时重采样
+func EncodeRealtimeAudio(samples []int16, sampleRate int, format string) []byte {
+	switch format {
+	case "g711_ulaw", "g711_alaw":
+		samples = ResamplePCM16(samples, sampleRate, 8000)
+		data := make([]byte, len(samples))
+		for i, sample := range samples {
+			if format == "g711_ulaw" {
+				data[i] = ulawEncode(sample)
+			} else {
+				data[i] = alawEncode(sample)
+			}
+		}
+		return data
+	default:
+		samples = ResamplePCM16(samples, sampleRate, 24000)
+		data := make([]byte, len(samples)*2)
+		for i, sample := range samples {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+		}
+		return data
+	}
+}
+
+// PCM16BytesToSamples 将小端 16 位 PCM 字节转换为采样
+func PCM16BytesToSamples(data []byte) []int16 {
+	samples, _ := DecodeRealtimeAudio(data, "pcm16")
+	return samples
+}
+
+// ResamplePCM16 线性插值重采样
+func ResamplePCM16(samples []int16, from int, to int) []int16 {
+	if from == to || from <= 0 || to <= 0 || len(samples) == 0 {
+		return samples
+	}
+	n := int(int64(len(samples)) * int64(to) / int64(from))
+	out := make([]int16, n)
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		idx := int(pos)
+		if idx >= len(samples)-1 {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := pos - float64(idx)
+		out[i] = int16(float64(samples[idx])*(1-frac) + float64(samples[idx+1])*frac)
+	}
+	return out
+}
+
+// AudioRMS 返回采样的归一化均方根能量，范围 0~1
+func AudioRMS(samples []int16) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, sample := range samples {
+		v := float64(sample) / 32768
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// PCM16ToWav 为单声道 16 位采样加上 WAV 文件头
+func PCM16ToWav(samples []int16, sampleRate int) []byte {
+	dataSize := len(samples) * 2
+	buf := bytes.NewBuffer(make([]byte, 0, 44+dataSize))
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1)) // PCM
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1)) // 单声道
+	_ = binary.Write(buf, binary.LittleEndian, uint32(sampleRate))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(sampleRate*2))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(dataSize))
+	_ = binary.Write(buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+// ExtractWavPCM 从 WAV 数据中取出 PCM 数据块与采样率，非 WAV 数据原样返回且采样率为 0
+func ExtractWavPCM(data []byte) ([]byte, int) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return data, 0
+	}
+	sampleRate := 0
+	offset := 12
+	for offset+8 <= len(data) {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := offset + 8
+		if chunkID == "fmt " && body+8 <= len(data) {
+			sampleRate = int(binary.LittleEndian.Uint32(data[body+4 : body+8]))
+		}
+		if chunkID == "data" {
+			end := body + chunkSize
+			if end > len(data) || chunkSize == 0 {
+				end = len(data)
+			}
+			return data[body:end], sampleRate
+		}
+		offset = body + chunkSize + chunkSize%2
+	}
+	return data, 0
+}
+
+func ulawDecode(u byte) int16 {
+	u = ^u
+	exponent := (u >> 4) & 0x07
+	mantissa := int(u & 0x0F)
+	sample := (((mantissa << 3) + 0x84) << exponent) - 0x84
+	if u&0x80 != 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
+
+func ulawEncode(sample int16) byte {
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > 32635 {
+		s = 32635
+	}
+	s += 0x84
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func alawDecode(a byte) int16 {
+	a ^= 0x55
+	exponent := (a >> 4) & 0x07
+	mantissa := int(a & 0x0F)
+	var sample int
+	if exponent == 0 {
+		sample = (mantissa << 4) + 8
+	} else {
+		sample = ((mantissa << 4) + 0x108) << (exponent - 1)
+	}
+	if a&0x80 == 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
+
+func alawEncode(sample int16) byte {
+	s := int(sample)
+	sign := 0x80
+	if s < 0 {
+		s = -s
+		sign = 0
+	}
+	if s > 32767 {
+		s = 32767
+	}
+	var exponent, mantissa int
+	if s >= 256 {
+		exponent = 7
+		for mask := 0x4000; s&mask == 0 && exponent > 1; mask >>= 1 {
+			exponent--
+		}
+		mantissa = (s >> (exponent + 3)) & 0x0F
+	} else {
+		mantissa = s >> 4
+	}
+	return byte(sign|exponent<<4|mantissa) ^ 0x55
+}
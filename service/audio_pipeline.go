@@ -0,0 +1,399 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+	"veloera/dto"
+)
+
+// PipelineSampleRate 转码与切分后发往上游的采样率，单声道 16 位
+const PipelineSampleRate = 16000
+
+// DetectAudioFormat 根据文件头识别音频格式，无法识别时返回空字符串
+func DetectAudioFormat(header []byte) string {
+	has := func(offset int, magic string) bool {
+		return len(header) >= offset+len(magic) && string(header[offset:offset+len(magic)]) == magic
+	}
+	switch {
+	case has(0, "RIFF") && has(8, "WAVE"):
+		return "wav"
+	case has(0, "fLaC"):
+		return "flac"
+	case has(0, "OggS"):
+		return "ogg"
+	case has(0, "\x1a\x45\xdf\xa3"):
+		return "webm"
+	case has(4, "ftyp"):
+		if has(8, "M4A") {
+			return "m4a"
+		}
+		return "mp4"
+	case has(0, "ID3"):
+		return "mp3"
+	case has(0, "#!AMR"):
+		return "amr"
+	case has(0, "FORM") && (has(8, "AIFF") || has(8, "AIFC")):
+		return "aiff"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		// ADTS 帧头，layer 固定为 0
+		return "aac"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return "mp3"
+	}
+	return ""
+}
+
+// WavInfo WAV 文件的格式与数据块位置
+type WavInfo struct {
+	AudioFormat   uint16
+	Channels      int
+	SampleRate    int
+	BitsPerSample int
+	DataOffset    int64
+	DataSize      int64
+}
+
+func (w *WavInfo) frameSize() int {
+	return w.Channels * w.BitsPerSample / 8
+}
+
+// Duration 音频时长（秒）
+func (w *WavInfo) Duration() float64 {
+	if w.SampleRate == 0 || w.frameSize() == 0 {
+		return 0
+	}
+	return float64(w.DataSize/int64(w.frameSize())) / float64(w.SampleRate)
+}
+
+// Decodable 是否可以由纯 Go 解码：整数 PCM 或 32 位浮点
+func (w *WavInfo) Decodable() bool {
+	switch w.AudioFormat {
+	case 1, 0xFFFE:
+		return w.BitsPerSample == 8 || w.BitsPerSample == 16 || w.BitsPerSample == 24 || w.BitsPerSample == 32
+	case 3:
+		return w.BitsPerSample == 32
+	}
+	return false
+}
+
+// ParseWavHeader 遍历 RIFF 块，找到 fmt 与 data 块
+func ParseWavHeader(r io.ReaderAt, size int64) (*WavInfo, error) {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a wav file")
+	}
+	info := &WavInfo{}
+	offset := int64(12)
+	chunk := make([]byte, 8)
+	for offset+8 <= size {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		chunkID := string(chunk[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		body := offset + 8
+		switch chunkID {
+		case "fmt ":
+			format := make([]byte, 16)
+			if _, err := r.ReadAt(format, body); err != nil {
+				return nil, err
+			}
+			info.AudioFormat = binary.LittleEndian.Uint16(format[0:2])
+			info.Channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+			info.BitsPerSample = int(binary.LittleEndian.Uint16(format[14:16]))
+		case "data":
+			info.DataOffset = body
+			// 流式写出的 WAV 数据块长度可能为 0 或 0xFFFFFFFF
+			if chunkSize == 0 || body+chunkSize > size {
+				chunkSize = size - body
+			}
+			info.DataSize = chunkSize
+			if info.SampleRate == 0 || info.Channels == 0 {
+				return nil, errors.New("wav fmt chunk is missing")
+			}
+			return info, nil
+		}
+		offset = body + chunkSize + chunkSize%2
+	}
+	return nil, errors.New("wav data chunk is missing")
+}
+
+// ReadWavSegment 读取 WAV 中 [start, start+length) 秒的音频，混为单声道并重采样为 16kHz WAV
+func ReadWavSegment(r io.ReaderAt, info *WavInfo, start float64, length float64) ([]byte, error) {
+	if !info.Decodable() {
+		return nil, fmt.Errorf("unsupported wav encoding: format %d, %d bits", info.AudioFormat, info.BitsPerSample)
+	}
+	frameSize := int64(info.frameSize())
+	totalFrames := info.DataSize / frameSize
+	first := int64(start * float64(info.SampleRate))
+	count := int64(length * float64(info.SampleRate))
+	if first > totalFrames {
+		first = totalFrames
+	}
+	if first+count > totalFrames {
+		count = totalFrames - first
+	}
+	data := make([]byte, count*frameSize)
+	if _, err := r.ReadAt(data, info.DataOffset+first*frameSize); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	bytesPerSample := info.BitsPerSample / 8
+	samples := make([]int16, count)
+	for i := range samples {
+		frame := data[int64(i)*frameSize : int64(i+1)*frameSize]
+		sum := 0.0
+		for ch := 0; ch < info.Channels; ch++ {
+			sum += decodeWavSample(frame[ch*bytesPerSample:(ch+1)*bytesPerSample], info.AudioFormat)
+		}
+		samples[i] = int16(math.Max(-32768, math.Min(32767, sum/float64(info.Channels)*32768)))
+	}
+	return PCM16ToWav(ResamplePCM16(samples, info.SampleRate, PipelineSampleRate), PipelineSampleRate), nil
+}
+
+// decodeWavSample 将单个采样解码为 -1~1 的浮点值
+func decodeWavSample(b []byte, audioFormat uint16) float64 {
+	switch len(b) {
+	case 1:
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 3:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / 8388608
+	case 4:
+		if audioFormat == 3 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+	return 0
+}
+
+// FFmpegAvailable 判断是否可以调用 ffmpeg
+func FFmpegAvailable(ffmpegPath string) bool {
+	if ffmpegPath == "" {
+		return false
+	}
+	_, err := exec.LookPath(ffmpegPath)
+	return err == nil
+}
+
+// TranscodeAudioSegment 使用 ffmpeg 截取 [start, start+length) 秒并转为 16kHz 单声道 WAV，length 为 0 表示到结尾
+func TranscodeAudioSegment(ctx context.Context, ffmpegPath string, input string, start float64, length float64) ([]byte, error) {
+	args := []string{"-v", "error", "-nostdin", "-ss", strconv.FormatFloat(start, 'f', 3, 64), "-i", input}
+	if length > 0 {
+		args = append(args, "-t", strconv.FormatFloat(length, 'f', 3, 64))
+	}
+	args = append(args, "-vn", "-ac", "1", "-ar", strconv.Itoa(PipelineSampleRate), "-f", "wav", "pipe:1")
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	// 写入管道时 ffmpeg 无法回填长度字段，重新生成文件头
+	pcm, _ := ExtractWavPCM(output)
+	return PCM16ToWav(PCM16BytesToSamples(pcm), PipelineSampleRate), nil
+}
+
+// AudioDurationTokens 按音频时长计算用量，1 分钟相当于 1k tokens
+func AudioDurationTokens(seconds float64) int {
+	return int(math.Round(math.Ceil(seconds) / 60.0 * 1000))
+}
+
+// TranscriptionResult 转写结果，时间以秒计
+type TranscriptionResult struct {
+	Task     string
+	Language string
+	Duration float64
+	Text     string
+	Segments []dto.Segment
+}
+
+// ParseTranscriptionResponse 解析上游的转写响应，非 JSON 响应作为纯文本处理
+func ParseTranscriptionResponse(body []byte) *TranscriptionResult {
+	var verbose dto.WhisperVerboseJSONResponse
+	if err := json.Unmarshal(body, &verbose); err == nil {
+		return &TranscriptionResult{
+			Task:     verbose.Task,
+			Language: verbose.Language,
+			Duration: verbose.Duration,
+			Text:     strings.TrimSpace(verbose.Text),
+			Segments: verbose.Segments,
+		}
+	}
+	// diarized_json 的分段 id 为字符串，无法按 verbose_json 解析
+	var diarized struct {
+		Task     string  `json:"task"`
+		Duration float64 `json:"duration"`
+		Text     string  `json:"text"`
+		Segments []struct {
+			Start   float64 `json:"start"`
+			End     float64 `json:"end"`
+			Text    string  `json:"text"`
+			Speaker string  `json:"speaker"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(body, &diarized); err == nil {
+		result := &TranscriptionResult{
+			Task:     diarized.Task,
+			Duration: diarized.Duration,
+			Text:     strings.TrimSpace(diarized.Text),
+		}
+		for i, segment := range diarized.Segments {
+			result.Segments = append(result.Segments, dto.Segment{
+				Id:      i,
+				Start:   segment.Start,
+				End:     segment.End,
+				Text:    segment.Text,
+				Speaker: segment.Speaker,
+			})
+		}
+		return result
+	}
+	return &TranscriptionResult{Text: strings.TrimSpace(string(body))}
+}
+
+// FormatTranscription 按 response_format 输出转写结果，返回响应体与 Content-Type
+func FormatTranscription(result *TranscriptionResult, format string) ([]byte, string, error) {
+	switch format {
+	case "text":
+		return []byte(result.Text), "text/plain; charset=utf-8", nil
+	case "srt":
+		return []byte(formatSubtitles(result, false)), "text/plain; charset=utf-8", nil
+	case "vtt":
+		return []byte(formatSubtitles(result, true)), "text/vtt; charset=utf-8", nil
+	case "verbose_json":
+		segments := result.Segments
+		if segments == nil {
+			segments = []dto.Segment{}
+		}
+		body, err := json.Marshal(struct {
+			Task     string        `json:"task"`
+			Language string        `json:"language"`
+			Duration float64       `json:"duration"`
+			Text     string        `json:"text"`
+			Segments []dto.Segment `json:"segments"`
+		}{result.Task, result.Language, result.Duration, result.Text, segments})
+		return body, "application/json", err
+	case "diarized_json":
+		type diarizedSegment struct {
+			Type    string  `json:"type"`
+			Id      string  `json:"id"`
+			Start   float64 `json:"start"`
+			End     float64 `json:"end"`
+			Text    string  `json:"text"`
+			Speaker string  `json:"speaker"`
+		}
+		segments := make([]diarizedSegment, 0, len(result.Segments))
+		for i, segment := range result.Segments {
+			segments = append(segments, diarizedSegment{
+				Type:    "transcript.text.segment",
+				Id:      fmt.Sprintf("seg_%03d", i+1),
+				Start:   segment.Start,
+				End:     segment.End,
+				Text:    segment.Text,
+				Speaker: segment.Speaker,
+			})
+		}
+		body, err := json.Marshal(struct {
+			Task     string            `json:"task"`
+			Duration float64           `json:"duration"`
+			Text     string            `json:"text"`
+			Segments []diarizedSegment `json:"segments"`
+		}{result.Task, result.Duration, result.Text, segments})
+		return body, "application/json", err
+	default:
+		body, err := json.Marshal(dto.AudioResponse{Text: result.Text})
+		return body, "application/json", err
+	}
+}
+
+func formatSubtitles(result *TranscriptionResult, vtt bool) string {
+	segments := result.Segments
+	if len(segments) == 0 && result.Text != "" {
+		segments = []dto.Segment{{Start: 0, End: result.Duration, Text: result.Text}}
+	}
+	var sb strings.Builder
+	if vtt {
+		sb.WriteString("WEBVTT\n\n")
+	}
+	for i, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if vtt {
+			if segment.Speaker != "" {
+				text = "<v " + segment.Speaker + ">" + text
+			}
+			fmt.Fprintf(&sb, "%s --> %s\n%s\n\n", formatSubtitleTime(segment.Start, "."), formatSubtitleTime(segment.End, "."), text)
+			continue
+		}
+		if segment.Speaker != "" {
+			text = segment.Speaker + ": " + text
+		}
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n", i+1, formatSubtitleTime(segment.Start, ","), formatSubtitleTime(segment.End, ","), text)
+	}
+	return sb.String()
+}
+
+func formatSubtitleTime(seconds float64, separator string) string {
+	ms := int64(math.Round(seconds * 1000))
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+// JoinTranscriptText 拼接分段文本，中日韩文字之间不加空格
+func JoinTranscriptText(parts []string) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			prev := []rune(sb.String())
+			if !isCJK(prev[len(prev)-1]) && !isCJK([]rune(part)[0]) {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(part)
+	}
+	return sb.String()
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) || unicode.In(r, unicode.P) && r > 0x3000
+}
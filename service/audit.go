@@ -0,0 +1,190 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/model"
+)
+
+// maskSecretRevealMinLength 密钥长度超过该值时才展示末 4 位，较短的密钥完全脱敏
+const maskSecretRevealMinLength = 16
+
+// MaskSecret 脱敏密钥用于审计和接口展示：短密钥完全隐藏，长密钥最多展示末 4 位
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	runes := []rune(secret)
+	if len(runes) <= maskSecretRevealMinLength {
+		return "******"
+	}
+	return "******" + string(runes[len(runes)-4:])
+}
+
+// MaskChannelKey 脱敏渠道密钥用于接口展示：逗号或换行分隔的多个密钥逐个脱敏，外部引用原样展示
+func MaskChannelKey(key string) string {
+	if common.IsSecretReference(key) {
+		return key
+	}
+	lines := strings.Split(key, "\n")
+	for i, line := range lines {
+		parts := strings.Split(line, ",")
+		for j, part := range parts {
+			parts[j] = MaskSecret(strings.TrimSpace(part))
+		}
+		lines[i] = strings.Join(parts, ",")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isSensitiveAuditField 按字段名判断是否需要脱敏，覆盖渠道密钥、密码、访问令牌及各类 Secret/Key 配置项
+func isSensitiveAuditField(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, "key") ||
+		strings.HasSuffix(name, "token") ||
+		strings.Contains(name, "secret") ||
+		strings.Contains(name, "password")
+}
+
+func maskAuditValue(value any) any {
+	if value == nil {
+		return nil
+	}
+	if s, ok := value.(string); ok {
+		return MaskSecret(s)
+	}
+	return "******"
+}
+
+// maskAuditNested 对嵌套对象中的敏感字段递归脱敏
+func maskAuditNested(value any) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	masked := make(map[string]any, len(object))
+	for k, v := range object {
+		if isSensitiveAuditField(k) {
+			masked[k] = maskAuditValue(v)
+		} else {
+			masked[k] = maskAuditNested(v)
+		}
+	}
+	return masked
+}
+
+func auditObject(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{"value": err.Error()}
+	}
+	object := make(map[string]any)
+	if err := json.Unmarshal(data, &object); err != nil {
+		var value any
+		_ = json.Unmarshal(data, &value)
+		return map[string]any{"value": value}
+	}
+	return object
+}
+
+// BuildAuditDiff 比较变更前后的对象，只保留发生变化的字段，嵌套对象按字段递归比较。
+// before 为 nil 表示新建，after 为 nil 表示删除；敏感字段以脱敏值记录，但仍会体现“已变更”
+func BuildAuditDiff(before any, after any) string {
+	data, err := json.Marshal(diffAuditObjects(auditObject(before), auditObject(after)))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func diffAuditObjects(b map[string]any, a map[string]any) map[string]any {
+	diff := make(map[string]any)
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range keys {
+		bv, bok := b[k]
+		av, aok := a[k]
+		if bok && aok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		bm, bIsObject := bv.(map[string]any)
+		am, aIsObject := av.(map[string]any)
+		if bIsObject && aIsObject && !isSensitiveAuditField(k) {
+			diff[k] = diffAuditObjects(bm, am)
+			continue
+		}
+		if isSensitiveAuditField(k) {
+			bv = maskAuditValue(bv)
+			av = maskAuditValue(av)
+		} else {
+			bv = maskAuditNested(bv)
+			av = maskAuditNested(av)
+		}
+		change := make(map[string]any, 2)
+		if bok {
+			change["before"] = bv
+		}
+		if aok {
+			change["after"] = av
+		}
+		diff[k] = change
+	}
+	return diff
+}
+
+func RenderAuditLogCSV(auditLogs []*model.AuditLog) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "time", "user_id", "username", "action", "target_type", "target_id", "ip", "request_id", "diff"})
+	for _, auditLog := range auditLogs {
+		_ = w.Write([]string{
+			strconv.Itoa(auditLog.Id),
+			time.Unix(auditLog.CreatedAt, 0).Format("2006-01-02 15:04:05"),
+			strconv.Itoa(auditLog.UserId),
+			auditLog.Username,
+			auditLog.Action,
+			auditLog.TargetType,
+			auditLog.TargetId,
+			auditLog.Ip,
+			auditLog.RequestId,
+			auditLog.Diff,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
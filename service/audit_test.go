@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		length int
+		want   string
+	}{
+		{0, ""},
+		{1, "******"},
+		{8, "******"},
+		{9, "******"},
+		{12, "******"},
+		{16, "******"},
+		{17, "******abcd"},
+		{48, "******abcd"},
+	}
+	for _, tt := range tests {
+		secret := strings.Repeat("x", tt.length)
+		if tt.length > 4 {
+			secret = strings.Repeat("x", tt.length-4) + "abcd"
+		}
+		got := MaskSecret(secret)
+		if got != tt.want {
+			t.Errorf("MaskSecret(len=%d) = %q, want %q", tt.length, got, tt.want)
+		}
+		if tt.length > 0 && strings.Contains(got, "x") {
+			t.Errorf("MaskSecret(len=%d) leaks leading characters: %q", tt.length, got)
+		}
+	}
+}
+
+func TestMaskChannelKey(t *testing.T) {
+	key := "short-key," + strings.Repeat("k", 40) + "wxyz"
+	want := "******,******wxyz"
+	if got := MaskChannelKey(key); got != want {
+		t.Errorf("MaskChannelKey() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"veloera/common"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 留存的内容字段，由各渠道处理器写入 RelayInfo.Other
+var chatContentKeys = []string{"system_prompt", "context", "input_content", "output_content", relayconstant.KeyEmbeddingInput}
+
+var (
+	chatContentCipher     *common.EnvelopeCipher
+	chatContentCipherErr  error
+	chatContentCipherOnce sync.Once
+)
+
+func getChatContentCipher() (*common.EnvelopeCipher, error) {
+	chatContentCipherOnce.Do(func() {
+		if common.ChatContentEncryptionKey == "" {
+			chatContentCipherErr = errors.New("CHAT_CONTENT_ENCRYPTION_KEY is not configured")
+			return
+		}
+		chatContentCipher, chatContentCipherErr = common.NewEnvelopeCipher(common.ChatContentEncryptionKey,
+			strings.Split(common.ChatContentEncryptionOldKeys, ",")...)
+	})
+	return chatContentCipher, chatContentCipherErr
+}
+
+// CaptureChatContent 将请求的对话内容脱敏、加密后写入留存表，返回关联的请求 ID，未留存时返回空字符串
+func CaptureChatContent(c *gin.Context, relayInfo *relaycommon.RelayInfo) string {
+	if !common.LogChatContentEnabled || relayInfo.Other == nil {
+		return ""
+	}
+	settings := system_setting.GetChatContentSettings()
+	if !settings.GroupEnabled(relayInfo.Group) {
+		return ""
+	}
+	payload := make(map[string]interface{})
+	for _, key := range chatContentKeys {
+		if value, ok := relayInfo.Other[key]; ok && value != nil {
+			payload[key] = value
+		}
+	}
+	if len(payload) == 0 {
+		return ""
+	}
+	cipher, cipherErr := getChatContentCipher()
+	if cipherErr != nil && settings.RequireEncryption {
+		return ""
+	}
+	requestId := c.GetString(common.RequestIdKey)
+	content := &model.ChatContent{
+		RequestId: requestId,
+		UserId:    relayInfo.UserId,
+		Username:  c.GetString("username"),
+		TokenId:   relayInfo.TokenId,
+		ChannelId: relayInfo.ChannelId,
+		ModelName: relayInfo.OriginModelName,
+		Group:     relayInfo.Group,
+	}
+	// 脱敏与加密在后台完成，不阻塞计费流程
+	gopool.Go(func() {
+		// 经过一次 JSON 往返，得到可以安全修改的副本
+		data, err := json.Marshal(payload)
+		if err != nil {
+			common.SysError("failed to marshal chat content: " + err.Error())
+			return
+		}
+		if settings.RedactPII {
+			var generic interface{}
+			if err = json.Unmarshal(data, &generic); err == nil {
+				generic, content.Redactions = RedactValue(generic)
+				data, err = json.Marshal(generic)
+			}
+			if err != nil {
+				common.SysError("failed to redact chat content: " + err.Error())
+				return
+			}
+		}
+		if settings.MaxContentLength > 0 && len(data) > settings.MaxContentLength {
+			// 截断后的内容不再是合法 JSON，改为以字符串形式保存
+			truncated, _ := json.Marshal(map[string]interface{}{
+				"truncated": true,
+				"raw":       string(data[:settings.MaxContentLength]),
+			})
+			data = truncated
+		}
+		if cipher != nil {
+			envelope, err := cipher.Encrypt(data)
+			if err != nil {
+				common.SysError("failed to encrypt chat content: " + err.Error())
+				return
+			}
+			content.Encrypted = true
+			content.KeyId = envelope.KeyId
+			content.WrappedKey = envelope.WrappedKey
+			content.Content = envelope.Ciphertext
+		} else {
+			content.Content = string(data)
+		}
+		if err = content.Insert(); err != nil {
+			common.SysError("failed to save chat content: " + err.Error())
+		}
+	})
+	return requestId
+}
+
+// DecryptChatContent 解密留存内容
+func DecryptChatContent(content *model.ChatContent) (json.RawMessage, error) {
+	if !content.Encrypted {
+		return json.RawMessage(content.Content), nil
+	}
+	cipher, err := getChatContentCipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := cipher.Decrypt(&common.Envelope{
+		KeyId:      content.KeyId,
+		WrappedKey: content.WrappedKey,
+		Ciphertext: content.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
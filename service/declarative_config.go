@@ -0,0 +1,869 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"veloera/common"
+	"veloera/model"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// DeclarativeConfigVersion 配置文件格式版本，格式不兼容变更时递增
+const DeclarativeConfigVersion = 1
+
+// 导出时密钥字段的处理方式
+const (
+	ConfigSecretsOmit    = "omit"    // 留空，导入时保留数据库中的原值
+	ConfigSecretsEnv     = "env"     // 写为 env://VAR 引用，导入时从环境变量读取
+	ConfigSecretsEncrypt = "encrypt" // 使用 CONFIG_ENCRYPTION_KEY 加密
+	ConfigSecretsPlain   = "plain"   // 明文
+)
+
+const (
+	configEnvRefPrefix    = "env://"
+	configEncryptedPrefix = "enc:"
+)
+
+// 配置变更的对象类型
+const (
+	ConfigKindOption           = "option"
+	ConfigKindChannel          = "channel"
+	ConfigKindSubscriptionPlan = "subscription_plan"
+)
+
+const (
+	ConfigActionCreate = "create"
+	ConfigActionUpdate = "update"
+	ConfigActionDelete = "delete"
+)
+
+// DeclarativeConfig 网关的完整配置。JSON 类选项（倍率、模型映射）单独成段以便在 git 中审阅差异；
+// 某一段缺省时导入不会触碰对应配置
+type DeclarativeConfig struct {
+	Version           int                      `json:"version"`
+	Options           map[string]string        `json:"options,omitempty"`
+	ModelRatio        any                      `json:"model_ratio,omitempty"`
+	ModelPrice        any                      `json:"model_price,omitempty"`
+	CompletionRatio   any                      `json:"completion_ratio,omitempty"`
+	CacheRatio        any                      `json:"cache_ratio,omitempty"`
+	GroupRatio        any                      `json:"group_ratio,omitempty"`
+	ModelMapping      any                      `json:"model_mapping,omitempty"`
+	Channels          []ConfigChannel          `json:"channels"`
+	SubscriptionPlans []ConfigSubscriptionPlan `json:"subscription_plans"`
+}
+
+// ConfigChannel 渠道的声明式表示，以名称作为标识，不含用量、余额等运行时字段
+type ConfigChannel struct {
+	Name               string  `json:"name"`
+	Type               int     `json:"type"`
+	Key                string  `json:"key,omitempty"`
+	Status             int     `json:"status"`
+	BaseURL            *string `json:"base_url,omitempty"`
+	Models             string  `json:"models"`
+	Group              string  `json:"group"`
+	ModelMapping       *string `json:"model_mapping,omitempty"`
+	StatusCodeMapping  *string `json:"status_code_mapping,omitempty"`
+	Priority           *int64  `json:"priority,omitempty"`
+	Weight             *uint   `json:"weight,omitempty"`
+	AutoBan            *int    `json:"auto_ban,omitempty"`
+	Tag                *string `json:"tag,omitempty"`
+	TestModel          *string `json:"test_model,omitempty"`
+	OpenAIOrganization *string `json:"openai_organization,omitempty"`
+	Other              string  `json:"other,omitempty"`
+	Setting            *string `json:"setting,omitempty"`
+	ParamOverride      *string `json:"param_override,omitempty"`
+	ModelPrefix        *string `json:"model_prefix,omitempty"`
+	SystemPrompt       *string `json:"system_prompt,omitempty"`
+}
+
+// ConfigSubscriptionPlan 订阅套餐的声明式表示，以名称作为标识
+type ConfigSubscriptionPlan struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Price         int    `json:"price"`
+	TotalQuota    int    `json:"total_quota"`
+	DailyQuota    int    `json:"daily_quota"`
+	DurationDays  int    `json:"duration_days"`
+	Models        string `json:"models,omitempty"`
+	AllowedGroups string `json:"allowed_groups,omitempty"`
+	Status        int    `json:"status"`
+	SortOrder     int    `json:"sort_order"`
+}
+
+type ConfigChange struct {
+	Kind   string          `json:"kind"`
+	Name   string          `json:"name"`
+	Action string          `json:"action"`
+	Diff   json.RawMessage `json:"diff,omitempty"`
+}
+
+type ConfigReconcileResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Changes []ConfigChange `json:"changes"`
+	Applied int            `json:"applied"`
+}
+
+type configOperation struct {
+	change ConfigChange
+	// apply 在事务中写入数据库，refresh 在事务提交后刷新内存缓存，可为空
+	apply   func(tx *gorm.DB) error
+	refresh func() error
+}
+
+// jsonOptions 返回单独成段的 JSON 选项与配置字段的对应关系
+func (cfg *DeclarativeConfig) jsonOptions() map[string]*any {
+	return map[string]*any{
+		"ModelRatio":           &cfg.ModelRatio,
+		"ModelPrice":           &cfg.ModelPrice,
+		"CompletionRatio":      &cfg.CompletionRatio,
+		"CacheRatio":           &cfg.CacheRatio,
+		"GroupRatio":           &cfg.GroupRatio,
+		"global_model_mapping": &cfg.ModelMapping,
+	}
+}
+
+func IsValidConfigSecretsMode(mode string) bool {
+	switch mode {
+	case ConfigSecretsOmit, ConfigSecretsEnv, ConfigSecretsEncrypt, ConfigSecretsPlain:
+		return true
+	}
+	return false
+}
+
+func getConfigCipher() (*common.EnvelopeCipher, error) {
+	if common.ConfigEncryptionKey == "" {
+		return nil, errors.New("CONFIG_ENCRYPTION_KEY is not configured")
+	}
+	return common.NewEnvelopeCipher(common.ConfigEncryptionKey)
+}
+
+// HasSecretReferences 配置中的密钥字段是否含有 env:// 或 file:// 引用，导入这类配置会读取服务器上的环境变量或文件
+func (cfg *DeclarativeConfig) HasSecretReferences() bool {
+	for key, value := range cfg.Options {
+		if common.IsSecretOptionKey(key) && common.IsSecretReference(value) {
+			return true
+		}
+	}
+	for _, channel := range cfg.Channels {
+		if common.IsSecretReference(channel.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// configSecretEnvName 生成密钥引用的环境变量名，如 VELOERA_SECRET_CHANNEL_OPENAI_MAIN_KEY，
+// 前缀与 env:// 引用允许读取的环境变量一致
+func configSecretEnvName(parts ...string) string {
+	name := strings.ToUpper(strings.Join(append([]string{strings.TrimSuffix(common.SecretEnvAllowedPrefix, "_")}, parts...), "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+type configSecretEncoder struct {
+	mode   string
+	cipher *common.EnvelopeCipher
+}
+
+func newConfigSecretEncoder(mode string) (*configSecretEncoder, error) {
+	if !IsValidConfigSecretsMode(mode) {
+		return nil, fmt.Errorf("unknown secrets mode: %s", mode)
+	}
+	encoder := &configSecretEncoder{mode: mode}
+	if mode == ConfigSecretsEncrypt {
+		cipher, err := getConfigCipher()
+		if err != nil {
+			return nil, err
+		}
+		encoder.cipher = cipher
+	}
+	return encoder, nil
+}
+
+func (e *configSecretEncoder) encode(value string, envParts ...string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	// 数据库中保存的外部引用本身不是密钥，原样导出
+	if e.mode != ConfigSecretsOmit && common.IsSecretReference(value) {
+		return value, nil
+	}
+	switch e.mode {
+	case ConfigSecretsPlain:
+		return value, nil
+	case ConfigSecretsEnv:
+		return configEnvRefPrefix + configSecretEnvName(envParts...), nil
+	case ConfigSecretsEncrypt:
+		envelope, err := e.cipher.Encrypt([]byte(value))
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			return "", err
+		}
+		return configEncryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+	}
+	return "", nil
+}
+
+// resolveConfigSecret 解析导入文件中的密钥字段：env:// 引用读取环境变量，enc: 前缀解密，其余视为明文
+func resolveConfigSecret(value string) (string, error) {
+	if err := common.ValidateSecretReference(value); err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(value, configEnvRefPrefix):
+		name := strings.TrimPrefix(value, configEnvRefPrefix)
+		resolved, ok := os.LookupEnv(name)
+		if !ok || resolved == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return resolved, nil
+	case strings.HasPrefix(value, configEncryptedPrefix):
+		cipher, err := getConfigCipher()
+		if err != nil {
+			return "", err
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, configEncryptedPrefix))
+		if err != nil {
+			return "", err
+		}
+		var envelope common.Envelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return "", err
+		}
+		plaintext, err := cipher.Decrypt(&envelope)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	}
+	return value, nil
+}
+
+func nilIfEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
+func channelToConfig(channel *model.Channel) ConfigChannel {
+	status := channel.Status
+	// 自动禁用属于运行时状态，不写入声明式配置
+	if status == common.ChannelStatusAutoDisabled {
+		status = common.ChannelStatusEnabled
+	}
+	return ConfigChannel{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Key:                channel.Key,
+		Status:             status,
+		BaseURL:            nilIfEmpty(channel.BaseURL),
+		Models:             channel.Models,
+		Group:              channel.Group,
+		ModelMapping:       nilIfEmpty(channel.ModelMapping),
+		StatusCodeMapping:  nilIfEmpty(channel.StatusCodeMapping),
+		Priority:           channel.Priority,
+		Weight:             channel.Weight,
+		AutoBan:            channel.AutoBan,
+		Tag:                nilIfEmpty(channel.Tag),
+		TestModel:          nilIfEmpty(channel.TestModel),
+		OpenAIOrganization: nilIfEmpty(channel.OpenAIOrganization),
+		Other:              channel.Other,
+		Setting:            nilIfEmpty(channel.Setting),
+		ParamOverride:      nilIfEmpty(channel.ParamOverride),
+		ModelPrefix:        nilIfEmpty(channel.ModelPrefix),
+		SystemPrompt:       nilIfEmpty(channel.SystemPrompt),
+	}
+}
+
+func emptyIfNil(s *string) *string {
+	if s == nil {
+		empty := ""
+		return &empty
+	}
+	return s
+}
+
+// applyConfigToChannel 写入声明式字段，字符串指针为空时写入空串以便清除原值
+func applyConfigToChannel(channel *model.Channel, cfg ConfigChannel) {
+	channel.Name = cfg.Name
+	channel.Type = cfg.Type
+	channel.Key = cfg.Key
+	channel.Status = cfg.Status
+	channel.BaseURL = emptyIfNil(cfg.BaseURL)
+	channel.Models = cfg.Models
+	channel.Group = cfg.Group
+	channel.ModelMapping = emptyIfNil(cfg.ModelMapping)
+	channel.StatusCodeMapping = emptyIfNil(cfg.StatusCodeMapping)
+	channel.Priority = cfg.Priority
+	channel.Weight = cfg.Weight
+	channel.AutoBan = cfg.AutoBan
+	channel.Tag = emptyIfNil(cfg.Tag)
+	channel.TestModel = emptyIfNil(cfg.TestModel)
+	channel.OpenAIOrganization = emptyIfNil(cfg.OpenAIOrganization)
+	channel.Other = cfg.Other
+	channel.Setting = emptyIfNil(cfg.Setting)
+	channel.ParamOverride = emptyIfNil(cfg.ParamOverride)
+	channel.ModelPrefix = emptyIfNil(cfg.ModelPrefix)
+	channel.SystemPrompt = emptyIfNil(cfg.SystemPrompt)
+}
+
+func planToConfig(plan *model.SubscriptionPlan) ConfigSubscriptionPlan {
+	return ConfigSubscriptionPlan{
+		Name:          plan.Name,
+		Description:   plan.Description,
+		Price:         plan.Price,
+		TotalQuota:    plan.TotalQuota,
+		DailyQuota:    plan.DailyQuota,
+		DurationDays:  plan.DurationDays,
+		Models:        plan.Models,
+		AllowedGroups: plan.AllowedGroups,
+		Status:        plan.Status,
+		SortOrder:     plan.SortOrder,
+	}
+}
+
+func applyConfigToPlan(plan *model.SubscriptionPlan, cfg ConfigSubscriptionPlan) {
+	plan.Name = cfg.Name
+	plan.Description = cfg.Description
+	plan.Price = cfg.Price
+	plan.TotalQuota = cfg.TotalQuota
+	plan.DailyQuota = cfg.DailyQuota
+	plan.DurationDays = cfg.DurationDays
+	plan.Models = cfg.Models
+	plan.AllowedGroups = cfg.AllowedGroups
+	plan.Status = cfg.Status
+	plan.SortOrder = cfg.SortOrder
+}
+
+func parseJSONOption(value string) (any, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func snapshotOptionMap() map[string]string {
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	options := make(map[string]string, len(common.OptionMap))
+	for k, v := range common.OptionMap {
+		options[k] = common.Interface2String(v)
+	}
+	return options
+}
+
+// ExportDeclarativeConfig 导出当前生效的完整配置，密钥字段按 secrets 指定的方式处理
+func ExportDeclarativeConfig(secrets string) (*DeclarativeConfig, error) {
+	encoder, err := newConfigSecretEncoder(secrets)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &DeclarativeConfig{
+		Version:           DeclarativeConfigVersion,
+		Options:           make(map[string]string),
+		Channels:          make([]ConfigChannel, 0),
+		SubscriptionPlans: make([]ConfigSubscriptionPlan, 0),
+	}
+	jsonOptions := cfg.jsonOptions()
+	for key, value := range snapshotOptionMap() {
+		if target, ok := jsonOptions[key]; ok {
+			if *target, err = parseJSONOption(value); err != nil {
+				return nil, fmt.Errorf("option %s is not valid JSON: %w", key, err)
+			}
+			continue
+		}
+		if common.IsSecretOptionKey(key) {
+			if value, err = encoder.encode(value, "option", key); err != nil {
+				return nil, err
+			}
+		}
+		cfg.Options[key] = value
+	}
+
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(channels, func(i, j int) bool { return channels[i].Id < channels[j].Id })
+	for _, channel := range channels {
+		item := channelToConfig(channel)
+		if item.Key, err = encoder.encode(item.Key, "channel", item.Name, "key"); err != nil {
+			return nil, err
+		}
+		cfg.Channels = append(cfg.Channels, item)
+	}
+
+	plans, err := model.GetAllSubscriptionPlans(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		cfg.SubscriptionPlans = append(cfg.SubscriptionPlans, planToConfig(plan))
+	}
+	return cfg, nil
+}
+
+// MarshalDeclarativeConfig 按 format（yaml 或 json）序列化配置
+func MarshalDeclarativeConfig(cfg *DeclarativeConfig, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if format == "json" {
+		return data, nil
+	}
+	// 经由通用结构转换为 YAML，字段名与 JSON 保持一致
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(generic); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseDeclarativeConfig 解析 YAML 或 JSON 格式的配置，未知字段视为错误以免拼写错误被静默忽略
+func ParseDeclarativeConfig(data []byte) (*DeclarativeConfig, error) {
+	var generic any
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	cfg := &DeclarativeConfig{}
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Version != DeclarativeConfigVersion {
+		return nil, fmt.Errorf("unsupported config version %d, expected %d", cfg.Version, DeclarativeConfigVersion)
+	}
+	return cfg, nil
+}
+
+func configDiff(before any, after any) json.RawMessage {
+	return json.RawMessage(BuildAuditDiff(before, after))
+}
+
+func planOptionOperations(cfg *DeclarativeConfig, current map[string]string) ([]configOperation, error) {
+	var ops []configOperation
+	jsonOptions := cfg.jsonOptions()
+	keys := make([]string, 0, len(cfg.Options))
+	for key := range cfg.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := jsonOptions[key]; ok {
+			return nil, fmt.Errorf("option %s must be configured in its own section", key)
+		}
+		currentValue, ok := current[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown option: %s", key)
+		}
+		value := cfg.Options[key]
+		if common.IsSecretOptionKey(key) && value != currentValue {
+			if value == "" {
+				continue
+			}
+			resolved, err := resolveConfigSecret(value)
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+			value = resolved
+		}
+		if value == currentValue {
+			continue
+		}
+		key, value := key, value
+		ops = append(ops, configOperation{
+			change: ConfigChange{
+				Kind:   ConfigKindOption,
+				Name:   key,
+				Action: ConfigActionUpdate,
+				Diff:   configDiff(map[string]string{key: currentValue}, map[string]string{key: value}),
+			},
+			apply:   func(tx *gorm.DB) error { return model.SaveOptionTx(tx, key, value) },
+			refresh: func() error { return model.RefreshOption(key, value) },
+		})
+	}
+
+	jsonKeys := make([]string, 0, len(jsonOptions))
+	for key := range jsonOptions {
+		jsonKeys = append(jsonKeys, key)
+	}
+	sort.Strings(jsonKeys)
+	for _, key := range jsonKeys {
+		desired := *jsonOptions[key]
+		if desired == nil {
+			continue
+		}
+		existing, err := parseJSONOption(current[key])
+		if err != nil {
+			existing = current[key]
+		}
+		if reflect.DeepEqual(existing, desired) {
+			continue
+		}
+		data, err := json.Marshal(desired)
+		if err != nil {
+			return nil, err
+		}
+		key, value := key, string(data)
+		op := configOperation{
+			change: ConfigChange{
+				Kind:   ConfigKindOption,
+				Name:   key,
+				Action: ConfigActionUpdate,
+				Diff:   configDiff(map[string]any{key: existing}, map[string]any{key: desired}),
+			},
+			apply:   func(tx *gorm.DB) error { return model.SaveOptionTx(tx, key, value) },
+			refresh: func() error { return model.RefreshOption(key, value) },
+		}
+		if key == "global_model_mapping" {
+			var afterCommit func() error
+			op.apply = func(tx *gorm.DB) error {
+				var err error
+				afterCommit, err = model.SaveGlobalModelMappingTx(tx, value)
+				return err
+			}
+			op.refresh = func() error { return afterCommit() }
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func planChannelOperations(desired []ConfigChannel, prune bool) ([]configOperation, error) {
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string][]*model.Channel)
+	for _, channel := range channels {
+		existing[channel.Name] = append(existing[channel.Name], channel)
+	}
+	var ops []configOperation
+	seen := make(map[string]bool, len(desired))
+	for _, item := range desired {
+		if item.Name == "" {
+			return nil, errors.New("channel name is required")
+		}
+		if seen[item.Name] {
+			return nil, fmt.Errorf("duplicate channel name in config: %s", item.Name)
+		}
+		seen[item.Name] = true
+		if item.Status == 0 {
+			item.Status = common.ChannelStatusEnabled
+		}
+		if item.Group == "" {
+			item.Group = "default"
+		}
+		matches := existing[item.Name]
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("channel name %s is used by %d channels in the database, rename them before importing", item.Name, len(matches))
+		}
+		// 与数据库中保存的引用相同时不解析，保留请求时解析的语义
+		if item.Key != "" && !(len(matches) == 1 && item.Key == matches[0].Key) {
+			if item.Key, err = resolveConfigSecret(item.Key); err != nil {
+				return nil, fmt.Errorf("channel %s: %w", item.Name, err)
+			}
+		}
+		if len(matches) == 0 {
+			if item.Key == "" {
+				return nil, fmt.Errorf("channel %s: key is required for new channels", item.Name)
+			}
+			item := item
+			ops = append(ops, configOperation{
+				change: ConfigChange{Kind: ConfigKindChannel, Name: item.Name, Action: ConfigActionCreate, Diff: configDiff(nil, item)},
+				apply: func(tx *gorm.DB) error {
+					channel := &model.Channel{CreatedTime: common.GetTimestamp()}
+					applyConfigToChannel(channel, item)
+					return channel.InsertTx(tx)
+				},
+			})
+			continue
+		}
+		channel := matches[0]
+		current := channelToConfig(channel)
+		// 未声明的密钥与数值字段沿用数据库中的值
+		if item.Key == "" {
+			item.Key = current.Key
+		}
+		if item.Priority == nil {
+			item.Priority = current.Priority
+		}
+		if item.Weight == nil {
+			item.Weight = current.Weight
+		}
+		if item.AutoBan == nil {
+			item.AutoBan = current.AutoBan
+		}
+		// 被自动禁用的渠道保持原状态，避免每次同步都把故障渠道重新启用
+		if channel.Status == common.ChannelStatusAutoDisabled && item.Status == common.ChannelStatusEnabled {
+			item.Status = channel.Status
+			current.Status = channel.Status
+		}
+		diff := BuildAuditDiff(current, item)
+		if diff == "{}" {
+			continue
+		}
+		item := item
+		ops = append(ops, configOperation{
+			change: ConfigChange{Kind: ConfigKindChannel, Name: item.Name, Action: ConfigActionUpdate, Diff: json.RawMessage(diff)},
+			apply: func(tx *gorm.DB) error {
+				applyConfigToChannel(channel, item)
+				return channel.UpdateTx(tx)
+			},
+		})
+	}
+	if prune {
+		for _, channel := range channels {
+			if seen[channel.Name] {
+				continue
+			}
+			channel := channel
+			ops = append(ops, configOperation{
+				change: ConfigChange{Kind: ConfigKindChannel, Name: channel.Name, Action: ConfigActionDelete, Diff: configDiff(channelToConfig(channel), nil)},
+				apply:  channel.DeleteTx,
+			})
+		}
+	}
+	return ops, nil
+}
+
+func planSubscriptionPlanOperations(desired []ConfigSubscriptionPlan, prune bool) ([]configOperation, error) {
+	plans, err := model.GetAllSubscriptionPlans(true)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string][]*model.SubscriptionPlan)
+	for _, plan := range plans {
+		existing[plan.Name] = append(existing[plan.Name], plan)
+	}
+	var ops []configOperation
+	seen := make(map[string]bool, len(desired))
+	for _, item := range desired {
+		if item.Name == "" {
+			return nil, errors.New("subscription plan name is required")
+		}
+		if seen[item.Name] {
+			return nil, fmt.Errorf("duplicate subscription plan name in config: %s", item.Name)
+		}
+		seen[item.Name] = true
+		matches := existing[item.Name]
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("subscription plan name %s is used by %d plans in the database, rename them before importing", item.Name, len(matches))
+		}
+		item := item
+		if len(matches) == 0 {
+			ops = append(ops, configOperation{
+				change: ConfigChange{Kind: ConfigKindSubscriptionPlan, Name: item.Name, Action: ConfigActionCreate, Diff: configDiff(nil, item)},
+				apply: func(tx *gorm.DB) error {
+					plan := &model.SubscriptionPlan{}
+					applyConfigToPlan(plan, item)
+					return plan.InsertTx(tx)
+				},
+			})
+			continue
+		}
+		plan := matches[0]
+		diff := BuildAuditDiff(planToConfig(plan), item)
+		if diff == "{}" {
+			continue
+		}
+		ops = append(ops, configOperation{
+			change: ConfigChange{Kind: ConfigKindSubscriptionPlan, Name: item.Name, Action: ConfigActionUpdate, Diff: json.RawMessage(diff)},
+			apply: func(tx *gorm.DB) error {
+				applyConfigToPlan(plan, item)
+				return plan.UpdateTx(tx)
+			},
+		})
+	}
+	if prune {
+		for _, plan := range plans {
+			if seen[plan.Name] {
+				continue
+			}
+			planId := plan.Id
+			// 退款的缓存更新与日志必须等事务提交后执行
+			var afterCommit func()
+			ops = append(ops, configOperation{
+				change: ConfigChange{Kind: ConfigKindSubscriptionPlan, Name: plan.Name, Action: ConfigActionDelete, Diff: configDiff(planToConfig(plan), nil)},
+				apply: func(tx *gorm.DB) error {
+					var err error
+					afterCommit, err = model.DeleteSubscriptionPlanByIdTx(tx, planId)
+					return err
+				},
+				refresh: func() error {
+					afterCommit()
+					return nil
+				},
+			})
+		}
+	}
+	return ops, nil
+}
+
+// ReconcileDeclarativeConfig 计算配置与数据库的差异，dryRun 为 false 时在同一事务中应用，提交后再刷新缓存。
+// 选项只增改不删除；prune 为 true 时删除配置中不存在的渠道和套餐（删除套餐会退还用户剩余额度）
+func ReconcileDeclarativeConfig(cfg *DeclarativeConfig, dryRun bool, prune bool) (*ConfigReconcileResult, error) {
+	ops, err := planOptionOperations(cfg, snapshotOptionMap())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Channels != nil {
+		channelOps, err := planChannelOperations(cfg.Channels, prune)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, channelOps...)
+	}
+	if cfg.SubscriptionPlans != nil {
+		planOps, err := planSubscriptionPlanOperations(cfg.SubscriptionPlans, prune)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, planOps...)
+	}
+
+	result := &ConfigReconcileResult{DryRun: dryRun, Changes: make([]ConfigChange, 0, len(ops))}
+	for _, op := range ops {
+		result.Changes = append(result.Changes, op.change)
+	}
+	if dryRun {
+		return result, nil
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		for _, op := range ops {
+			if err := op.apply(tx); err != nil {
+				return fmt.Errorf("failed to %s %s %s: %w", op.change.Action, op.change.Kind, op.change.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Applied = len(ops)
+
+	// 事务已提交，逐项刷新缓存；单项失败不影响其余项
+	var refreshErr error
+	channelsChanged, plansChanged := false, false
+	for _, op := range ops {
+		switch op.change.Kind {
+		case ConfigKindChannel:
+			channelsChanged = true
+		case ConfigKindSubscriptionPlan:
+			plansChanged = true
+		}
+		if op.refresh == nil {
+			continue
+		}
+		if err := op.refresh(); err != nil {
+			common.SysError(fmt.Sprintf("failed to refresh %s %s after reconcile: %s", op.change.Kind, op.change.Name, err.Error()))
+			if refreshErr == nil {
+				refreshErr = fmt.Errorf("config applied but failed to refresh %s %s: %w", op.change.Kind, op.change.Name, err)
+			}
+		}
+	}
+	if channelsChanged {
+		model.NotifyChannelsChanged()
+	}
+	if plansChanged {
+		model.InvalidatePlanAccessCache()
+	}
+	return result, refreshErr
+}
+
+// ExportConfigFile 供 --export-config 使用，path 为 - 时写到标准输出，扩展名为 .json 时输出 JSON
+func ExportConfigFile(path string, secrets string) error {
+	cfg, err := ExportDeclarativeConfig(secrets)
+	if err != nil {
+		return err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	data, err := MarshalDeclarativeConfig(cfg, format)
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReconcileConfigFile 供 --config-file 使用，在启动时将数据库同步为配置文件的内容
+func ReconcileConfigFile(path string, prune bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := ParseDeclarativeConfig(data)
+	if err != nil {
+		return err
+	}
+	result, err := ReconcileDeclarativeConfig(cfg, false, prune)
+	if result != nil {
+		for _, change := range result.Changes[:result.Applied] {
+			common.SysLog(fmt.Sprintf("config reconcile: %s %s %s", change.Action, change.Kind, change.Name))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("config reconciled from %s, %d changes applied", path, result.Applied))
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/setting/model_setting"
+)
+
+// TruncateEmbedding 按 Matryoshka 方式保留前 dimensions 维并重新做 L2 归一化
+func TruncateEmbedding(embedding []float64, dimensions int) []float64 {
+	if dimensions <= 0 || dimensions >= len(embedding) {
+		return embedding
+	}
+	truncated := append([]float64(nil), embedding[:dimensions]...)
+	norm := 0.0
+	for _, v := range truncated {
+		norm += v * v
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range truncated {
+			truncated[i] /= norm
+		}
+	}
+	return truncated
+}
+
+// EncodeEmbeddingBase64 与 OpenAI encoding_format=base64 一致，编码为小端 float32
+func EncodeEmbeddingBase64(embedding []float64) string {
+	buf := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func DecodeEmbeddingBase64(data string) ([]float64, error) {
+	buf, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("invalid embedding length %d", len(buf))
+	}
+	embedding := make([]float64, len(buf)/4)
+	for i := range embedding {
+		embedding[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+	}
+	return embedding, nil
+}
+
+// EmbeddingCacheKey 以模型、维度与输入内容的哈希作为缓存键
+func EmbeddingCacheKey(model string, dimensions int, text string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", model, dimensions, text)))
+	return "embedding:" + hex.EncodeToString(sum[:])
+}
+
+type embeddingCacheEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// 未启用 Redis 时使用进程内 LRU 缓存
+var embeddingMemoryCache = struct {
+	sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}{items: make(map[string]*list.Element), order: list.New()}
+
+// GetCachedEmbedding 读取缓存的向量
+func GetCachedEmbedding(key string) ([]float64, bool) {
+	var value string
+	if common.RedisEnabled {
+		v, err := common.RedisGet(key)
+		if err != nil {
+			return nil, false
+		}
+		value = v
+	} else {
+		cache := &embeddingMemoryCache
+		cache.Lock()
+		element, ok := cache.items[key]
+		if !ok {
+			cache.Unlock()
+			return nil, false
+		}
+		entry := element.Value.(*embeddingCacheEntry)
+		if time.Now().After(entry.expiresAt) {
+			cache.order.Remove(element)
+			delete(cache.items, key)
+			cache.Unlock()
+			return nil, false
+		}
+		cache.order.MoveToFront(element)
+		value = entry.value
+		cache.Unlock()
+	}
+	embedding, err := DecodeEmbeddingBase64(value)
+	if err != nil {
+		return nil, false
+	}
+	return embedding, true
+}
+
+// SetCachedEmbedding 写入缓存，向量以 float32 存储
+func SetCachedEmbedding(key string, embedding []float64) {
+	settings := model_setting.GetEmbeddingSettings()
+	ttl := time.Duration(settings.CacheTTLSeconds) * time.Second
+	value := EncodeEmbeddingBase64(embedding)
+	if common.RedisEnabled {
+		if err := common.RedisSet(key, value, ttl); err != nil {
+			common.SysError("failed to cache embedding: " + err.Error())
+		}
+		return
+	}
+	cache := &embeddingMemoryCache
+	cache.Lock()
+	defer cache.Unlock()
+	if element, ok := cache.items[key]; ok {
+		entry := element.Value.(*embeddingCacheEntry)
+		entry.value = value
+		entry.expiresAt = time.Now().Add(ttl)
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.items[key] = cache.order.PushFront(&embeddingCacheEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)})
+	for settings.CacheMaxEntries > 0 && cache.order.Len() > settings.CacheMaxEntries {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
@@ -17,7 +17,6 @@
 package service
 
 import (
-	"veloera/common"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
 
@@ -41,22 +40,33 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if relayInfo.ModelDeprecated {
+		other["model_deprecated"] = true
+	}
+	if relayInfo.RetiredModelName != "" {
+		other["retired_model"] = relayInfo.RetiredModelName
+		other["successor_model"] = relayInfo.SuccessorModelName
+	}
+	if relayInfo.FallbackFromModel != "" {
+		other["fallback_from"] = relayInfo.FallbackFromModel
+	}
+	if len(relayInfo.AppliedPricingRules) > 0 {
+		other["pricing_rules"] = relayInfo.AppliedPricingRules
+	}
+	if len(relayInfo.ModerationRecords) > 0 {
+		other["moderation"] = relayInfo.ModerationRecords
+	}
 
-	// 添加输入输出内容
-	if relayInfo.Other != nil && common.LogChatContentEnabled {
-		if inputContent, exists := relayInfo.Other["input_content"]; exists {
-			other["input_content"] = inputContent
-		}
-		if outputContent, exists := relayInfo.Other["output_content"]; exists {
-			other["output_content"] = outputContent
-		}
-		if context, exists := relayInfo.Other["context"]; exists {
-			other["context"] = context
-		}
+	// 对话内容脱敏加密后单独留存，日志中只记录关联的请求 ID
+	if requestId := CaptureChatContent(ctx, relayInfo); requestId != "" {
+		other["content_request_id"] = requestId
 	}
 
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
+	if attempt := relaycommon.GetHedgeAttempt(ctx); attempt != nil {
+		adminInfo["hedge"] = attempt.State().Stats()
+	}
 	other["admin_info"] = adminInfo
 	return other
 }
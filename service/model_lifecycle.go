@@ -0,0 +1,91 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/model"
+)
+
+// 向最近多少天内调用过该模型的用户发送弃用通知
+const modelLifecycleNoticeDays = 30
+
+// NotifyModelLifecycle 通过站内消息通知最近调用过已弃用/已退役模型的用户，返回通知的用户数
+func NotifyModelLifecycle(catalog *model.ModelCatalog, createdBy int) (int, error) {
+	lifecycle := catalog.GetLifecycle()
+	if lifecycle == model.ModelLifecycleActive {
+		return 0, fmt.Errorf("模型 %s 未弃用", catalog.ModelName)
+	}
+	since := time.Now().AddDate(0, 0, -modelLifecycleNoticeDays).Unix()
+	userIds, err := model.GetRecentModelUserIds(catalog.ModelName, since)
+	if err != nil {
+		return 0, err
+	}
+	if len(userIds) == 0 {
+		return 0, model.MarkModelCatalogNotified(catalog.Id)
+	}
+	message := &model.Message{
+		Title:     buildModelLifecycleTitle(catalog, lifecycle),
+		Content:   buildModelLifecycleContent(catalog, lifecycle),
+		Format:    "markdown",
+		CreatedBy: createdBy,
+	}
+	if err = model.CreateMessageForUsers(message, userIds); err != nil {
+		return 0, err
+	}
+	if err = model.MarkModelCatalogNotified(catalog.Id); err != nil {
+		common.SysError(fmt.Sprintf("failed to mark model %s notified: %s", catalog.ModelName, err.Error()))
+	}
+	return len(userIds), nil
+}
+
+func buildModelLifecycleTitle(catalog *model.ModelCatalog, lifecycle string) string {
+	if lifecycle == model.ModelLifecycleRetired {
+		return fmt.Sprintf("模型 %s 已下线", catalog.ModelName)
+	}
+	return fmt.Sprintf("模型 %s 已弃用", catalog.ModelName)
+}
+
+func buildModelLifecycleContent(catalog *model.ModelCatalog, lifecycle string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "您的令牌在最近 %d 天内调用过模型 `%s`。\n\n", modelLifecycleNoticeDays, catalog.ModelName)
+	if lifecycle == model.ModelLifecycleRetired {
+		b.WriteString("该模型已下线，")
+		if catalog.ReplacementModel != "" {
+			fmt.Fprintf(&b, "新的请求会自动转发到 `%s` 并按其价格计费。", catalog.ReplacementModel)
+		} else {
+			b.WriteString("新的请求将被拒绝。")
+		}
+	} else {
+		b.WriteString("该模型已弃用，")
+		if catalog.SunsetDate > 0 {
+			fmt.Fprintf(&b, "将于 %s 下线。", time.Unix(catalog.SunsetDate, 0).Format("2006-01-02 15:04"))
+		} else {
+			b.WriteString("后续将会下线。")
+		}
+		if catalog.ReplacementModel != "" {
+			fmt.Fprintf(&b, "下线后请求会自动转发到 `%s` 并按其价格计费。", catalog.ReplacementModel)
+		}
+	}
+	if catalog.ReplacementModel != "" {
+		fmt.Fprintf(&b, "\n\n建议尽快将调用的模型改为 `%s`。", catalog.ReplacementModel)
+	}
+	return b.String()
+}
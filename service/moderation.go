@@ -0,0 +1,583 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+	"veloera/setting"
+	"veloera/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ModerationStagePrompt     = "prompt"
+	ModerationStageCompletion = "completion"
+)
+
+// 命中内容的替换文本，与 SensitiveWordReplace 保持一致
+const moderationReplacement = "**###**"
+
+// ModerationResult 单个检查器的审核结果
+type ModerationResult struct {
+	Flagged    bool
+	Categories []string
+	Matches    []string // 命中的原文片段，为空时 redact 会替换整段文本
+}
+
+// ModerationChecker 内容审核检查器
+type ModerationChecker interface {
+	Name() string
+	Check(ctx context.Context, text string) (*ModerationResult, error)
+}
+
+var moderationCheckers = make(map[string]ModerationChecker)
+
+// RegisterModerationChecker 注册检查器，策略中按名称引用
+func RegisterModerationChecker(checker ModerationChecker) {
+	moderationCheckers[checker.Name()] = checker
+}
+
+func init() {
+	RegisterModerationChecker(keywordModerationChecker{})
+	RegisterModerationChecker(openaiModerationChecker{})
+	RegisterModerationChecker(httpModerationChecker{})
+}
+
+// textModeration 一段文本经过全部检查器后的结果
+type textModeration struct {
+	flagged    bool
+	unlocated  bool // 存在无法定位命中片段的检查器
+	checkers   []string
+	categories []string
+	matches    []string
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if item != "" && !common.StringsContains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (m *textModeration) merge(name string, result *ModerationResult) {
+	if result == nil || !result.Flagged {
+		return
+	}
+	m.flagged = true
+	m.checkers = appendUnique(m.checkers, name)
+	m.categories = appendUnique(m.categories, result.Categories...)
+	if len(result.Matches) == 0 {
+		m.unlocated = true
+	}
+	m.matches = appendUnique(m.matches, result.Matches...)
+}
+
+// redact 替换命中片段，无法定位时替换整段文本
+func (m *textModeration) redact(text string) string {
+	if !m.flagged {
+		return text
+	}
+	if m.unlocated {
+		return moderationReplacement
+	}
+	for _, match := range m.matches {
+		re, err := regexp.Compile("(?i)" + regexp.QuoteMeta(match))
+		if err != nil {
+			continue
+		}
+		text = re.ReplaceAllLiteralString(text, moderationReplacement)
+	}
+	return text
+}
+
+func moderateText(ctx context.Context, checkers []string, text string) *textModeration {
+	result := &textModeration{}
+	if strings.TrimSpace(text) == "" {
+		return result
+	}
+	settings := model_setting.GetModerationSettings()
+	for _, name := range checkers {
+		checker, ok := moderationCheckers[name]
+		if !ok {
+			continue
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, model_setting.GetModerationTimeout())
+		checked, err := checker.Check(checkCtx, text)
+		cancel()
+		if err != nil {
+			common.SysError(fmt.Sprintf("moderation checker %s failed: %s", name, err.Error()))
+			if settings.FailOpen {
+				continue
+			}
+			// 不允许放行时，检查失败视为命中
+			checked = &ModerationResult{Flagged: true, Categories: []string{"moderation_unavailable"}}
+		}
+		result.merge(name, checked)
+	}
+	return result
+}
+
+// ShouldModeratePrompt 分组是否需要审核请求内容
+func ShouldModeratePrompt(group string) bool {
+	return setting.ShouldCheckPromptSensitiveWithGroup(group) && !model_setting.ShouldBypassSafeCheck(group)
+}
+
+// ShouldModerateCompletion 分组是否需要审核输出内容
+func ShouldModerateCompletion(group string) bool {
+	return setting.ShouldCheckCompletionSensitiveWithGroup(group) && !model_setting.ShouldBypassSafeCheck(group)
+}
+
+func recordModeration(c *gin.Context, info *relaycommon.RelayInfo, stage string, action string, result *textModeration) {
+	info.ModerationRecords = append(info.ModerationRecords, relaycommon.ModerationRecord{
+		Stage:      stage,
+		Action:     action,
+		Checkers:   result.checkers,
+		Categories: result.categories,
+	})
+	// 请求被拦截时不会产生消费日志，错误日志从上下文中读取审核记录
+	c.Set("moderation_records", info.ModerationRecords)
+	common.LogWarn(c, fmt.Sprintf("content moderation %s hit on %s: checkers=%s, categories=%s",
+		action, stage, strings.Join(result.checkers, ","), strings.Join(result.categories, ",")))
+}
+
+func moderationBlockedError(c *gin.Context, categories []string) *dto.OpenAIErrorWithStatusCode {
+	// 直接构造错误，避免自定义提示中的链接被 OpenAIErrorWrapper 屏蔽
+	return &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: model_setting.FormatModerationBlockMessage(categories, c.GetString(common.RequestIdKey)),
+			Type:    "veloera_error",
+			Code:    "content_moderation_blocked",
+		},
+		StatusCode: http.StatusBadRequest,
+		LocalError: true,
+	}
+}
+
+// ModeratePrompt 审核请求中的文本片段，redact 策略下直接改写片段；返回错误表示请求应被拦截
+func ModeratePrompt(c *gin.Context, info *relaycommon.RelayInfo, texts []*string) *dto.OpenAIErrorWithStatusCode {
+	if !ShouldModeratePrompt(info.Group) {
+		return nil
+	}
+	policy := model_setting.GetModerationPolicy(info.Group)
+	if policy.Action == model_setting.ModerationActionRedact {
+		// 逐段审核，只替换命中的片段
+		merged := &textModeration{}
+		for _, text := range texts {
+			if text == nil {
+				continue
+			}
+			result := moderateText(c.Request.Context(), policy.Checkers, *text)
+			if result.flagged {
+				*text = result.redact(*text)
+				merged.flagged = true
+				merged.checkers = appendUnique(merged.checkers, result.checkers...)
+				merged.categories = appendUnique(merged.categories, result.categories...)
+			}
+		}
+		if merged.flagged {
+			info.RequestRewritten = true
+			recordModeration(c, info, ModerationStagePrompt, policy.Action, merged)
+		}
+		return nil
+	}
+
+	parts := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if text != nil && *text != "" {
+			parts = append(parts, *text)
+		}
+	}
+	result := moderateText(c.Request.Context(), policy.Checkers, strings.Join(parts, "\n"))
+	if !result.flagged {
+		return nil
+	}
+	recordModeration(c, info, ModerationStagePrompt, policy.Action, result)
+	if policy.Action == model_setting.ModerationActionBlock {
+		return moderationBlockedError(c, result.categories)
+	}
+	return nil
+}
+
+// ModeratePromptInput 审核 prompt / input 这类任意类型的输入，返回可能被改写的输入
+func ModeratePromptInput(c *gin.Context, info *relaycommon.RelayInfo, input any) (any, *dto.OpenAIErrorWithStatusCode) {
+	switch v := input.(type) {
+	case string:
+		return v, ModeratePrompt(c, info, []*string{&v})
+	case []string:
+		texts := make([]*string, len(v))
+		for i := range v {
+			texts[i] = &v[i]
+		}
+		return v, ModeratePrompt(c, info, texts)
+	case []any:
+		texts := make([]*string, 0, len(v))
+		values := make([]string, len(v))
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				values[i] = s
+				texts = append(texts, &values[i])
+			}
+		}
+		if err := ModeratePrompt(c, info, texts); err != nil {
+			return input, err
+		}
+		for i, item := range v {
+			if _, ok := item.(string); ok {
+				v[i] = values[i]
+			}
+		}
+		return v, nil
+	case nil:
+		return input, nil
+	}
+	text := fmt.Sprintf("%v", input)
+	return input, ModeratePrompt(c, info, []*string{&text})
+}
+
+// moderationJSONTextKeys 结构化输入中需要审核的文本字段
+var moderationJSONTextKeys = map[string]bool{"text": true, "content": true, "output": true}
+
+// collectJSONTexts 收集结构化输入中的文本字段，返回片段与对应的写回函数
+func collectJSONTexts(node any, texts *[]*string, writeBacks *[]func()) {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && moderationJSONTextKeys[key] {
+				text := s
+				*texts = append(*texts, &text)
+				m, k := v, key
+				*writeBacks = append(*writeBacks, func() { m[k] = text })
+				continue
+			}
+			collectJSONTexts(value, texts, writeBacks)
+		}
+	case []any:
+		for i, value := range v {
+			if s, ok := value.(string); ok {
+				text := s
+				*texts = append(*texts, &text)
+				list, idx := v, i
+				*writeBacks = append(*writeBacks, func() { list[idx] = text })
+				continue
+			}
+			collectJSONTexts(value, texts, writeBacks)
+		}
+	}
+}
+
+// ModerateStructuredContent 审核已解析为通用结构的内容（字符串或消息数组），redact 策略下原地改写，
+// 返回内容是否被改写
+func ModerateStructuredContent(c *gin.Context, info *relaycommon.RelayInfo, values ...*any) (bool, *dto.OpenAIErrorWithStatusCode) {
+	if !ShouldModeratePrompt(info.Group) {
+		return false, nil
+	}
+	var texts []*string
+	var writeBacks []func()
+	for _, value := range values {
+		if value == nil || *value == nil {
+			continue
+		}
+		if s, ok := (*value).(string); ok {
+			text, target := s, value
+			texts = append(texts, &text)
+			writeBacks = append(writeBacks, func() { *target = text })
+			continue
+		}
+		collectJSONTexts(*value, &texts, &writeBacks)
+	}
+	originals := make([]string, len(texts))
+	for i, text := range texts {
+		originals[i] = *text
+	}
+	if err := ModeratePrompt(c, info, texts); err != nil {
+		return false, err
+	}
+	changed := false
+	for i, text := range texts {
+		if *text != originals[i] {
+			changed = true
+		}
+	}
+	if changed {
+		for _, writeBack := range writeBacks {
+			writeBack()
+		}
+	}
+	return changed, nil
+}
+
+// ModerateJSONInput 审核 JSON 形式的输入（字符串或消息数组），返回可能被改写的输入
+func ModerateJSONInput(c *gin.Context, info *relaycommon.RelayInfo, raw json.RawMessage) (json.RawMessage, *dto.OpenAIErrorWithStatusCode) {
+	if !ShouldModeratePrompt(info.Group) || len(raw) == 0 {
+		return raw, nil
+	}
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		text := string(raw)
+		return raw, ModeratePrompt(c, info, []*string{&text})
+	}
+	changed, openaiErr := ModerateStructuredContent(c, info, &root)
+	if openaiErr != nil || !changed {
+		return raw, openaiErr
+	}
+	redacted, err := json.Marshal(root)
+	if err != nil {
+		return raw, nil
+	}
+	return redacted, nil
+}
+
+// ModerateMessages 审核 OpenAI 格式的消息列表，redact 策略下改写消息内容
+func ModerateMessages(c *gin.Context, info *relaycommon.RelayInfo, messages []dto.Message) *dto.OpenAIErrorWithStatusCode {
+	if !ShouldModeratePrompt(info.Group) || len(messages) == 0 {
+		return nil
+	}
+	var texts []*string
+	var writeBacks []func()
+	for i := range messages {
+		message := &messages[i]
+		if message.IsStringContent() {
+			content := message.StringContent()
+			texts = append(texts, &content)
+			writeBacks = append(writeBacks, func() {
+				if content != message.StringContent() {
+					message.SetStringContent(content)
+				}
+			})
+			continue
+		}
+		contents := message.ParseContent()
+		originals := make([]string, len(contents))
+		for j := range contents {
+			if contents[j].Type == dto.ContentTypeText {
+				originals[j] = contents[j].Text
+				texts = append(texts, &contents[j].Text)
+			}
+		}
+		writeBacks = append(writeBacks, func() {
+			for j := range contents {
+				if contents[j].Type == dto.ContentTypeText && contents[j].Text != originals[j] {
+					message.SetMediaContent(contents)
+					return
+				}
+			}
+		})
+	}
+	if err := ModeratePrompt(c, info, texts); err != nil {
+		return err
+	}
+	for _, writeBack := range writeBacks {
+		writeBack()
+	}
+	return nil
+}
+
+// ModerateCompletion 审核尚未下发的输出，返回处理后的文本以及是否被拦截
+func ModerateCompletion(c *gin.Context, info *relaycommon.RelayInfo, text string) (string, bool) {
+	if !ShouldModerateCompletion(info.Group) {
+		return text, false
+	}
+	policy := model_setting.GetModerationPolicy(info.Group)
+	result := moderateText(c.Request.Context(), policy.Checkers, text)
+	if !result.flagged {
+		return text, false
+	}
+	recordModeration(c, info, ModerationStageCompletion, policy.Action, result)
+	switch policy.Action {
+	case model_setting.ModerationActionBlock:
+		return model_setting.FormatModerationBlockMessage(result.categories, c.GetString(common.RequestIdKey)), true
+	case model_setting.ModerationActionRedact:
+		return result.redact(text), false
+	}
+	return text, false
+}
+
+// ReviewDeliveredCompletion 审核已经下发给用户的输出，只记录命中结果
+func ReviewDeliveredCompletion(c *gin.Context, info *relaycommon.RelayInfo, text string) {
+	if !ShouldModerateCompletion(info.Group) {
+		return
+	}
+	policy := model_setting.GetModerationPolicy(info.Group)
+	result := moderateText(c.Request.Context(), policy.Checkers, text)
+	if result.flagged {
+		recordModeration(c, info, ModerationStageCompletion, model_setting.ModerationActionFlag, result)
+	}
+}
+
+// keywordModerationChecker 基于屏蔽词与正则屏蔽词的检查器
+type keywordModerationChecker struct{}
+
+func (keywordModerationChecker) Name() string {
+	return model_setting.ModerationCheckerKeyword
+}
+
+func (keywordModerationChecker) Check(ctx context.Context, text string) (*ModerationResult, error) {
+	checkText := strings.ToLower(text)
+	var matches []string
+	for _, re := range setting.CompiledRegexSensitiveWords {
+		matches = appendUnique(matches, re.FindAllString(checkText, -1)...)
+	}
+	if ok, words := AcSearch(checkText, setting.SensitiveWords, false); ok {
+		matches = appendUnique(matches, words...)
+	}
+	if len(matches) == 0 {
+		return &ModerationResult{}, nil
+	}
+	return &ModerationResult{
+		Flagged:    true,
+		Categories: []string{"sensitive_words"},
+		Matches:    matches,
+	}, nil
+}
+
+// openaiModerationChecker 通过指定渠道调用 OpenAI 兼容的 /v1/moderations 接口
+type openaiModerationChecker struct{}
+
+type openaiModerationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+	Error *dto.OpenAIError `json:"error,omitempty"`
+}
+
+func (openaiModerationChecker) Name() string {
+	return model_setting.ModerationCheckerOpenAI
+}
+
+func (openaiModerationChecker) Check(ctx context.Context, text string) (*ModerationResult, error) {
+	settings := model_setting.GetModerationSettings()
+	if settings.OpenAIChannelId == 0 {
+		return nil, errors.New("moderation channel is not configured")
+	}
+	channel, err := model.GetChannelById(settings.OpenAIChannelId, true)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" && channel.Type >= 0 && channel.Type < len(common.ChannelBaseURLs) {
+		baseURL = common.ChannelBaseURLs[channel.Type]
+	}
+	payload, err := json.Marshal(map[string]any{
+		"model": settings.OpenAIModel,
+		"input": text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/v1/moderations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+channel.GetKey())
+	var response openaiModerationResponse
+	if err = doModerationRequest(req, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil && response.Error.Message != "" {
+		return nil, errors.New(response.Error.Message)
+	}
+	result := &ModerationResult{}
+	for _, item := range response.Results {
+		if !item.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for category, hit := range item.Categories {
+			if hit {
+				result.Categories = appendUnique(result.Categories, category)
+			}
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
+
+// httpModerationChecker 外部 HTTP 分类服务，
+// 请求体为 {"input": "..."}，响应体为 {"flagged": bool, "categories": [], "matches": []}
+type httpModerationChecker struct{}
+
+type httpModerationResponse struct {
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories"`
+	Matches    []string `json:"matches"`
+}
+
+func (httpModerationChecker) Name() string {
+	return model_setting.ModerationCheckerHTTP
+}
+
+func (httpModerationChecker) Check(ctx context.Context, text string) (*ModerationResult, error) {
+	settings := model_setting.GetModerationSettings()
+	if settings.HTTPEndpoint == "" {
+		return nil, errors.New("moderation endpoint is not configured")
+	}
+	payload, err := json.Marshal(map[string]string{"input": text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.HTTPEndpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if settings.HTTPToken != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.HTTPToken)
+	}
+	var response httpModerationResponse
+	if err = doModerationRequest(req, &response); err != nil {
+		return nil, err
+	}
+	return &ModerationResult{
+		Flagged:    response.Flagged,
+		Categories: response.Categories,
+		Matches:    response.Matches,
+	}, nil
+}
+
+func doModerationRequest(req *http.Request, v any) error {
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("moderation request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, v)
+}
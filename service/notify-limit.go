@@ -17,6 +17,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"github.com/bytedance/gopkg/util/gopool"
 	"strconv"
@@ -30,6 +31,7 @@ import (
 var (
 	notifyLimitStore sync.Map
 	cleanupOnce      sync.Once
+	notifiedStore    sync.Map
 )
 
 type limitCount struct {
@@ -131,3 +133,23 @@ func checkMemoryLimit(userId int, notifyType string) (bool, error) {
 
 	return currentLimit.Count <= limit, nil
 }
+
+// MarkNotifiedOnce 在有效期内为指定标识只返回一次 true，用于同一账期、同一阈值的提醒去重
+func MarkNotifiedOnce(key string, expiration time.Duration) (bool, error) {
+	key = "notified:" + key
+	if common.RedisEnabled {
+		ok, err := common.RDB.SetNX(context.Background(), key, "1", expiration).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to set notified flag: %w", err)
+		}
+		return ok, nil
+	}
+	now := time.Now()
+	if value, loaded := notifiedStore.LoadOrStore(key, now.Add(expiration)); loaded {
+		if now.Before(value.(time.Time)) {
+			return false, nil
+		}
+		notifiedStore.Store(key, now.Add(expiration))
+	}
+	return true, nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// simplePDF 是一个仅支持文本输出的极简 PDF 生成器，用于生成对账单等纯文本报表，避免引入额外依赖。
+// WinAnsi 字符集内的文本使用 Helvetica，包含中文等其他字符的文本使用 PDF 阅读器内置的
+// Adobe 标准中文字体 STSong-Light，以 UTF-16 编码输出，无需嵌入字体文件。
+type simplePDF struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+	y       float64
+}
+
+const (
+	pdfPageWidth   = 595.0 // A4
+	pdfPageHeight  = 842.0
+	pdfMarginLeft  = 50.0
+	pdfMarginTop   = 60.0
+	pdfMarginBelow = 60.0
+)
+
+func newSimplePDF() *simplePDF {
+	pdf := &simplePDF{}
+	pdf.addPage()
+	return pdf
+}
+
+func (p *simplePDF) addPage() {
+	p.current = &bytes.Buffer{}
+	p.pages = append(p.pages, p.current)
+	p.y = pdfPageHeight - pdfMarginTop
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteString(fmt.Sprintf("\\%03o", r))
+		}
+	}
+	return b.String()
+}
+
+// pdfIsWinAnsi 判断文本能否直接用 Helvetica 的 WinAnsi 编码输出
+func pdfIsWinAnsi(s string) bool {
+	for _, r := range s {
+		if (r < 0x20 || r >= 0x7f) && (r < 0xa0 || r > 0xff) {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfHexUTF16 将文本编码为 UTF-16BE 十六进制字符串，供 UniGB-UTF16-H 编码的中文字体使用
+func pdfHexUTF16(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, unit := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// Text 在指定横坐标处输出一行文本，不换行
+func (p *simplePDF) Text(x float64, size float64, bold bool, text string) {
+	if pdfIsWinAnsi(text) {
+		font := "F1"
+		if bold {
+			font = "F2"
+		}
+		fmt.Fprintf(p.current, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.y, pdfEscape(text))
+		return
+	}
+	// 中文字体没有粗体，粗体以描边加粗模拟
+	if bold {
+		fmt.Fprintf(p.current, "q 2 Tr %.2f w BT /F3 %.1f Tf %.2f %.2f Td %s Tj ET Q\n", size/30, size, x, p.y, pdfHexUTF16(text))
+		return
+	}
+	fmt.Fprintf(p.current, "BT /F3 %.1f Tf %.2f %.2f Td %s Tj ET\n", size, x, p.y, pdfHexUTF16(text))
+}
+
+// Line 输出一行文本并换行
+func (p *simplePDF) Line(size float64, bold bool, text string) {
+	p.Text(pdfMarginLeft, size, bold, text)
+	p.NewLine(size)
+}
+
+// Row 按列坐标输出表格行并换行
+func (p *simplePDF) Row(size float64, bold bool, columns []float64, cells ...string) {
+	for i, cell := range cells {
+		if i >= len(columns) {
+			break
+		}
+		p.Text(columns[i], size, bold, cell)
+	}
+	p.NewLine(size)
+}
+
+// Rule 在当前位置绘制一条水平分隔线
+func (p *simplePDF) Rule() {
+	fmt.Fprintf(p.current, "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMarginLeft, p.y+4, pdfPageWidth-pdfMarginLeft, p.y+4)
+	p.y -= 6
+}
+
+func (p *simplePDF) NewLine(size float64) {
+	p.y -= size * 1.5
+	if p.y < pdfMarginBelow {
+		p.addPage()
+	}
+}
+
+func (p *simplePDF) Space(height float64) {
+	p.y -= height
+	if p.y < pdfMarginBelow {
+		p.addPage()
+	}
+}
+
+// Bytes 序列化为 PDF 文件内容
+func (p *simplePDF) Bytes() []byte {
+	var out bytes.Buffer
+	offsets := make([]int, 0)
+	writeObj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// 1: catalog, 2: pages, 3: regular font, 4: bold font, 5-7: CJK font, then page/content pairs
+	pageCount := len(p.pages)
+	kids := make([]string, pageCount)
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 8+i*2)
+	}
+	writeObj("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	writeObj("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UTF16-H /Encoding /UniGB-UTF16-H /DescendantFonts [6 0 R] >>")
+	writeObj("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 4 >> /FontDescriptor 7 0 R /DW 1000 /W [1 95 500] >>")
+	writeObj("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, page := range p.pages {
+		writeObj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 9+i*2))
+		writeObj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
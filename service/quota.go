@@ -94,11 +94,10 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userBalance, err := model.GetUserQuotaBalance(relayInfo.UserId, false)
+	totalQuota, err := GetRelayAvailableQuota(relayInfo)
 	if err != nil {
 		return err
 	}
-	totalQuota := userBalance.Total()
 	relayInfo.UserQuota = totalQuota
 
 	token, err := model.GetTokenByKey(strings.TrimLeft(relayInfo.TokenKey, "sk-"), false)
@@ -392,12 +391,38 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	return nil
 }
 
+// GetRelayAvailableQuota 返回本次请求可用的额度，组织令牌取组织额度池与成员上限中的较小值
+func GetRelayAvailableQuota(relayInfo *relaycommon.RelayInfo) (int, error) {
+	if relayInfo.OrgId != 0 {
+		return model.GetOrgAvailableQuota(relayInfo.OrgId, relayInfo.UserId)
+	}
+	return model.GetUserAvailableQuota(relayInfo.UserId, false)
+}
+
+// ConsumeRelayQuota 按令牌归属从用户余额或组织额度池扣费，组织扣费全部计入 quotaUsed
+func ConsumeRelayQuota(relayInfo *relaycommon.RelayInfo, quota int) (subscriptionUsed int, quotaUsed int, err error) {
+	if relayInfo.OrgId != 0 {
+		if err = model.ConsumeOrgQuota(relayInfo.OrgId, relayInfo.UserId, quota); err != nil {
+			return 0, 0, err
+		}
+		return 0, quota, nil
+	}
+	return model.ConsumeUserQuota(relayInfo.UserId, quota, relayInfo.StartTime)
+}
+
+func RestoreRelayQuota(relayInfo *relaycommon.RelayInfo, subscriptionQuota int, quota int) error {
+	if relayInfo.OrgId != 0 {
+		return model.RestoreOrgQuota(relayInfo.OrgId, relayInfo.UserId, subscriptionQuota+quota)
+	}
+	return model.RestoreUserQuota(relayInfo.UserId, subscriptionQuota, quota, relayInfo.StartTime)
+}
+
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
 	var subscriptionUsed, quotaUsed int
 	if quota > 0 {
 		var consumeErr error
-		subscriptionUsed, quotaUsed, consumeErr = model.ConsumeUserQuota(relayInfo.UserId, quota)
+		subscriptionUsed, quotaUsed, consumeErr = ConsumeRelayQuota(relayInfo, quota)
 		if consumeErr != nil {
 			return consumeErr
 		}
@@ -430,7 +455,7 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			quotaRefund += refundTotal
 		}
 		if subscriptionRefund > 0 || quotaRefund > 0 {
-			err = model.RestoreUserQuota(relayInfo.UserId, subscriptionRefund, quotaRefund)
+			err = RestoreRelayQuota(relayInfo, subscriptionRefund, quotaRefund)
 			if err != nil {
 				return err
 			}
@@ -443,7 +468,7 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			tokenErr := model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 			if tokenErr != nil {
 				if subscriptionUsed > 0 || quotaUsed > 0 {
-					rollbackErr := model.RestoreUserQuota(relayInfo.UserId, subscriptionUsed, quotaUsed)
+					rollbackErr := RestoreRelayQuota(relayInfo, subscriptionUsed, quotaUsed)
 					if rollbackErr != nil {
 						common.SysError(fmt.Sprintf("failed to rollback user quota for user %d after token consume error: %s", relayInfo.UserId, rollbackErr.Error()))
 					} else {
@@ -460,7 +485,8 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	}
 
-	if sendEmail {
+	// 组织令牌消耗的是组织额度池，不触发个人额度提醒
+	if sendEmail && relayInfo.OrgId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -471,6 +497,10 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 
 func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int) {
 	gopool.Go(func() {
+		if balance, err := model.GetUserQuotaBalance(relayInfo.UserId, false); err == nil && balance.CreditLimit > 0 {
+			checkAndSendCreditNotify(relayInfo, balance)
+			return
+		}
 		userSetting := relayInfo.UserSetting
 		threshold := common.QuotaRemindThreshold
 		if userCustomThreshold, ok := userSetting[constant2.UserSettingQuotaWarningThreshold]; ok {
@@ -494,3 +524,32 @@ func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preCon
 		}
 	})
 }
+
+// checkAndSendCreditNotify 后付费账户授信额度使用率达到阈值时提醒用户，同一账期同一阈值只提醒一次
+func checkAndSendCreditNotify(relayInfo *relaycommon.RelayInfo, balance model.UserQuotaBalance) {
+	percentage := operation_setting.GetPostpaidSetting().WarningPercentage
+	// 授信只用于钱包透支，套餐余额不能抵扣已用授信
+	if percentage <= 0 || balance.Quota >= 0 {
+		return
+	}
+	usedCredit := -balance.Quota
+	if usedCredit*100 < balance.CreditLimit*percentage {
+		return
+	}
+	now := time.Now()
+	periodEnd := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.Local)
+	notifyKey := fmt.Sprintf("credit:%d:%s:%d", relayInfo.UserId, now.Format("2006-01"), percentage)
+	if first, err := MarkNotifiedOnce(notifyKey, periodEnd.Sub(now)); err != nil || !first {
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to check credit notify flag for user %d: %s", relayInfo.UserId, err.Error()))
+		}
+		return
+	}
+	prompt := "您的授信额度即将用尽"
+	content := "{{value}}，已使用授信额度 {{value}}，授信总额度 {{value}}。额度用尽后请求将被拒绝，请及时联系管理员结算。"
+	err := NotifyUser(relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting, dto.NewNotify(dto.NotifyTypeCreditLimit, prompt, content,
+		[]interface{}{prompt, common.FormatQuota(usedCredit), common.FormatQuota(balance.CreditLimit)}))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send credit notify to user %d: %s", relayInfo.UserId, err.Error()))
+	}
+}
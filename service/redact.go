@@ -0,0 +1,120 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+type redactPattern struct {
+	placeholder string
+	re          *regexp.Regexp
+	validate    func(match string) bool
+}
+
+// 脱敏规则按顺序应用，API Key 优先于数字类规则，避免密钥中的数字被误判为卡号或手机号
+var redactPatterns = []redactPattern{
+	{
+		placeholder: "[API_KEY]",
+		re:          regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_\-]{16,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_\-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9\-]{10,}|glpat-[A-Za-z0-9_\-]{20,})\b|(?i:bearer\s+)[A-Za-z0-9._\-]{20,}`),
+	},
+	{
+		placeholder: "[EMAIL]",
+		re:          regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		placeholder: "[CARD]",
+		re:          regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		validate:    luhnValid,
+	},
+	{
+		placeholder: "[PHONE]",
+		re:          regexp.MustCompile(`(?:\+\d{1,3}[ \-]?)?(?:\b1[3-9]\d{9}\b|\(?\b\d{3}\)?[ \-.]\d{3}[ \-.]\d{4}\b)`),
+	},
+}
+
+// luhnValid 使用 Luhn 校验排除普通长数字
+func luhnValid(s string) bool {
+	sum := 0
+	digits := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// RedactPII 替换文本中的邮箱、手机号、银行卡号与 API Key，返回脱敏后的文本和替换次数
+func RedactPII(text string) (string, int) {
+	count := 0
+	for _, pattern := range redactPatterns {
+		if !pattern.re.MatchString(text) {
+			continue
+		}
+		text = pattern.re.ReplaceAllStringFunc(text, func(match string) string {
+			if pattern.validate != nil && !pattern.validate(match) {
+				return match
+			}
+			count++
+			return pattern.placeholder
+		})
+	}
+	return text, count
+}
+
+// RedactValue 递归脱敏 JSON 结构中的所有字符串
+func RedactValue(v interface{}) (interface{}, int) {
+	switch value := v.(type) {
+	case string:
+		if strings.TrimSpace(value) == "" {
+			return value, 0
+		}
+		return RedactPII(value)
+	case map[string]interface{}:
+		total := 0
+		for k, item := range value {
+			redacted, count := RedactValue(item)
+			value[k] = redacted
+			total += count
+		}
+		return value, total
+	case []interface{}:
+		total := 0
+		for i, item := range value {
+			redacted, count := RedactValue(item)
+			value[i] = redacted
+			total += count
+		}
+		return value, total
+	default:
+		return v, 0
+	}
+}
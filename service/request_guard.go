@@ -0,0 +1,440 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ModerationStageRequestGuard = "request_guard"
+
+const (
+	requestGuardCheckerSecret    = "secret"
+	requestGuardCheckerInjection = "injection"
+	requestGuardInjectionMask    = "[FILTERED]"
+)
+
+type secretPattern struct {
+	category string
+	re       *regexp.Regexp
+}
+
+// 密钥规则按顺序匹配，先命中的规则优先，重叠区间不再重复计入
+var secretPatterns = []secretPattern{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----(?:[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----|[A-Za-z0-9+/=\s]*)`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws_secret_key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"anthropic_key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{20,}`)},
+	{"openai_key", regexp.MustCompile(`\bsk-(?:proj|svcacct|admin)-[A-Za-z0-9_\-]{20,}|\bsk-[A-Za-z0-9]{20}T3BlbkFJ[A-Za-z0-9]{20}\b`)},
+	// 本站令牌为 sk- 加 48 位随机字符
+	{"platform_token", regexp.MustCompile(`\bsk-[A-Za-z0-9]{48}\b`)},
+	{"api_key", regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`)},
+	{"github_token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{50,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`)},
+	{"gitlab_token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}`)},
+	{"stripe_key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{8,}\.eyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}`)},
+}
+
+// 高熵检测的候选片段，超长片段多为图片等编码数据，不计入
+var highEntropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_\-]+`)
+
+const highEntropyMaxLength = 256
+
+// 工具结果中常见的提示词注入特征
+var defaultInjectionPatterns = []string{
+	`ignore\s+(?:all\s+|any\s+)?(?:the\s+)?(?:previous|prior|above|earlier|preceding)\s+(?:instructions?|prompts?|messages?|rules?)`,
+	`disregard\s+(?:all\s+|any\s+)?(?:the\s+)?(?:previous|prior|above|earlier)\s+(?:instructions?|prompts?|rules?)`,
+	`forget\s+(?:all\s+)?(?:your|the)\s+(?:previous\s+)?(?:instructions?|rules?)`,
+	`you\s+are\s+now\s+(?:in\s+)?(?:developer|dan|jailbreak|god)\s+mode`,
+	`(?:reveal|print|show|output|repeat)\s+(?:your|the)\s+(?:system\s+prompt|initial\s+instructions|hidden\s+instructions)`,
+	`new\s+(?:system\s+)?instructions?\s*:`,
+	`<\|im_start\|>\s*system|<\|system\|>|\[/?INST\]`,
+	`(?:send|post|upload|exfiltrate)\s+(?:the\s+|all\s+|your\s+)?(?:api\s+keys?|credentials|secrets|passwords?)\s+to`,
+	`(?:忽略|无视)(?:之前|以上|前面|先前|上述)(?:的)?(?:所有)?(?:指令|指示|提示|规则)`,
+}
+
+var injectionCache struct {
+	sync.Mutex
+	key      string
+	patterns []*regexp.Regexp
+}
+
+// injectionPatterns 返回内置与自定义的注入特征，自定义规则变化时重新编译
+func injectionPatterns() []*regexp.Regexp {
+	extra := model_setting.GetRequestGuardSettings().InjectionPatterns
+	key := strings.Join(extra, "\n")
+	injectionCache.Lock()
+	defer injectionCache.Unlock()
+	if injectionCache.patterns != nil && injectionCache.key == key {
+		return injectionCache.patterns
+	}
+	patterns := make([]*regexp.Regexp, 0, len(defaultInjectionPatterns)+len(extra))
+	for _, pattern := range append(append([]string{}, defaultInjectionPatterns...), extra...) {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			common.SysError("invalid request guard injection pattern: " + pattern)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	injectionCache.key = key
+	injectionCache.patterns = patterns
+	return patterns
+}
+
+// guardSegment 待检测的文本片段，只有工具结果才检测提示词注入
+type guardSegment struct {
+	text       *string
+	toolResult bool
+}
+
+type guardSpan struct {
+	start    int
+	end      int
+	category string
+}
+
+// shannonEntropy 计算字符串每个字符的香农熵
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// looksLikeSecret 同时包含大小写字母与数字，排除十六进制哈希、UUID 与普通单词
+func looksLikeSecret(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+func overlaps(spans []guardSpan, start int, end int) bool {
+	for _, span := range spans {
+		if start < span.end && end > span.start {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSecrets 返回文本中疑似密钥的区间
+func detectSecrets(text string) []guardSpan {
+	var spans []guardSpan
+	for _, pattern := range secretPatterns {
+		for _, loc := range pattern.re.FindAllStringIndex(text, -1) {
+			if !overlaps(spans, loc[0], loc[1]) {
+				spans = append(spans, guardSpan{start: loc[0], end: loc[1], category: pattern.category})
+			}
+		}
+	}
+	settings := model_setting.GetRequestGuardSettings()
+	if settings.EntropyThreshold > 0 && settings.EntropyMinLength > 0 {
+		for _, loc := range highEntropyCandidate.FindAllStringIndex(text, -1) {
+			length := loc[1] - loc[0]
+			if length < settings.EntropyMinLength || length > highEntropyMaxLength || overlaps(spans, loc[0], loc[1]) {
+				continue
+			}
+			candidate := text[loc[0]:loc[1]]
+			if looksLikeSecret(candidate) && shannonEntropy(candidate) >= settings.EntropyThreshold {
+				spans = append(spans, guardSpan{start: loc[0], end: loc[1], category: "high_entropy_string"})
+			}
+		}
+	}
+	return spans
+}
+
+// detectInjection 返回文本中提示词注入特征的区间
+func detectInjection(text string) []guardSpan {
+	var spans []guardSpan
+	for _, re := range injectionPatterns() {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if !overlaps(spans, loc[0], loc[1]) {
+				spans = append(spans, guardSpan{start: loc[0], end: loc[1], category: "prompt_injection"})
+			}
+		}
+	}
+	return spans
+}
+
+// maskSpans 从后向前替换命中区间，避免替换后下标偏移
+func maskSpans(text string, spans []guardSpan, replacement func(span guardSpan) string) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	for _, span := range spans {
+		text = text[:span.start] + replacement(span) + text[span.end:]
+	}
+	return text
+}
+
+func requestGuardBlockedError(c *gin.Context, categories []string) *dto.OpenAIErrorWithStatusCode {
+	return &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: model_setting.FormatRequestGuardBlockMessage(categories, c.GetString(common.RequestIdKey)),
+			Type:    "veloera_error",
+			Code:    "request_guard_blocked",
+		},
+		StatusCode: http.StatusBadRequest,
+		LocalError: true,
+	}
+}
+
+// guardSegments 检测所有片段，mask 动作下原地改写片段；返回错误表示请求应被拦截
+func guardSegments(c *gin.Context, info *relaycommon.RelayInfo, segments []guardSegment) *dto.OpenAIErrorWithStatusCode {
+	policy := model_setting.GetRequestGuardPolicy(info.Group)
+	secretSpans := make([][]guardSpan, len(segments))
+	injectionSpans := make([][]guardSpan, len(segments))
+	secrets := &textModeration{checkers: []string{requestGuardCheckerSecret}}
+	injections := &textModeration{checkers: []string{requestGuardCheckerInjection}}
+	for i, segment := range segments {
+		if segment.text == nil || strings.TrimSpace(*segment.text) == "" {
+			continue
+		}
+		if policy.SecretAction != "" {
+			secretSpans[i] = detectSecrets(*segment.text)
+			for _, span := range secretSpans[i] {
+				secrets.flagged = true
+				secrets.categories = appendUnique(secrets.categories, span.category)
+			}
+		}
+		if policy.InjectionAction != "" && segment.toolResult {
+			injectionSpans[i] = detectInjection(*segment.text)
+			if len(injectionSpans[i]) > 0 {
+				injections.flagged = true
+				injections.categories = appendUnique(injections.categories, "prompt_injection")
+			}
+		}
+	}
+	if secrets.flagged {
+		recordModeration(c, info, ModerationStageRequestGuard, policy.SecretAction, secrets)
+	}
+	if injections.flagged {
+		recordModeration(c, info, ModerationStageRequestGuard, policy.InjectionAction, injections)
+	}
+
+	var blocked []string
+	if secrets.flagged && policy.SecretAction == model_setting.RequestGuardActionBlock {
+		blocked = appendUnique(blocked, secrets.categories...)
+	}
+	if injections.flagged && policy.InjectionAction == model_setting.RequestGuardActionBlock {
+		blocked = appendUnique(blocked, injections.categories...)
+	}
+	if len(blocked) > 0 {
+		return requestGuardBlockedError(c, blocked)
+	}
+
+	for i, segment := range segments {
+		var spans []guardSpan
+		if policy.SecretAction == model_setting.RequestGuardActionMask {
+			spans = append(spans, secretSpans[i]...)
+		}
+		if policy.InjectionAction == model_setting.RequestGuardActionMask {
+			for _, span := range injectionSpans[i] {
+				if !overlaps(spans, span.start, span.end) {
+					spans = append(spans, span)
+				}
+			}
+		}
+		if len(spans) == 0 {
+			continue
+		}
+		info.RequestRewritten = true
+		*segment.text = maskSpans(*segment.text, spans, func(span guardSpan) string {
+			if span.category == "prompt_injection" {
+				return requestGuardInjectionMask
+			}
+			return "[REDACTED:" + span.category + "]"
+		})
+	}
+	return nil
+}
+
+// isToolResultNode 判断结构化内容中的节点是否为工具调用结果
+func isToolResultNode(node map[string]any) bool {
+	switch node["type"] {
+	case "tool_result", "function_call_output", "custom_tool_call_output", "mcp_tool_result":
+		return true
+	}
+	return node["role"] == "tool" || node["role"] == "function"
+}
+
+// collectGuardSegments 收集结构化内容中的文本字段，工具结果下的文本会标记为需要检测注入
+func collectGuardSegments(node any, toolResult bool, segments *[]guardSegment, writeBacks *[]func()) {
+	switch v := node.(type) {
+	case map[string]any:
+		toolResult = toolResult || isToolResultNode(v)
+		for key, value := range v {
+			if s, ok := value.(string); ok && moderationJSONTextKeys[key] {
+				text := s
+				*segments = append(*segments, guardSegment{text: &text, toolResult: toolResult})
+				m, k := v, key
+				*writeBacks = append(*writeBacks, func() { m[k] = text })
+				continue
+			}
+			collectGuardSegments(value, toolResult, segments, writeBacks)
+		}
+	case []any:
+		for i, value := range v {
+			if s, ok := value.(string); ok {
+				text := s
+				*segments = append(*segments, guardSegment{text: &text, toolResult: toolResult})
+				list, idx := v, i
+				*writeBacks = append(*writeBacks, func() { list[idx] = text })
+				continue
+			}
+			collectGuardSegments(value, toolResult, segments, writeBacks)
+		}
+	}
+}
+
+// GuardStructuredContent 检测已解析为通用结构的内容（字符串、数组或 Claude 消息内容），mask 动作下原地改写，
+// 返回内容是否被改写
+func GuardStructuredContent(c *gin.Context, info *relaycommon.RelayInfo, values ...*any) (bool, *dto.OpenAIErrorWithStatusCode) {
+	if !model_setting.ShouldGuardRequest(info.Group) {
+		return false, nil
+	}
+	var segments []guardSegment
+	var writeBacks []func()
+	for _, value := range values {
+		if value == nil || *value == nil {
+			continue
+		}
+		if s, ok := (*value).(string); ok {
+			text, target := s, value
+			segments = append(segments, guardSegment{text: &text})
+			writeBacks = append(writeBacks, func() { *target = text })
+			continue
+		}
+		collectGuardSegments(*value, false, &segments, &writeBacks)
+	}
+	originals := make([]string, len(segments))
+	for i, segment := range segments {
+		originals[i] = *segment.text
+	}
+	if err := guardSegments(c, info, segments); err != nil {
+		return false, err
+	}
+	changed := false
+	for i, segment := range segments {
+		if *segment.text != originals[i] {
+			changed = true
+		}
+	}
+	if changed {
+		for _, writeBack := range writeBacks {
+			writeBack()
+		}
+	}
+	return changed, nil
+}
+
+// GuardJSONInput 检测 JSON 形式的输入（如 Responses 的 input），返回可能被改写的输入
+func GuardJSONInput(c *gin.Context, info *relaycommon.RelayInfo, raw json.RawMessage) (json.RawMessage, *dto.OpenAIErrorWithStatusCode) {
+	if !model_setting.ShouldGuardRequest(info.Group) || len(raw) == 0 {
+		return raw, nil
+	}
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return raw, nil
+	}
+	changed, openaiErr := GuardStructuredContent(c, info, &root)
+	if openaiErr != nil || !changed {
+		return raw, openaiErr
+	}
+	masked, err := json.Marshal(root)
+	if err != nil {
+		return raw, nil
+	}
+	return masked, nil
+}
+
+// GuardMessages 检测 OpenAI 格式的消息列表，tool 角色的消息视为工具结果
+func GuardMessages(c *gin.Context, info *relaycommon.RelayInfo, messages []dto.Message) *dto.OpenAIErrorWithStatusCode {
+	if !model_setting.ShouldGuardRequest(info.Group) || len(messages) == 0 {
+		return nil
+	}
+	var segments []guardSegment
+	var writeBacks []func()
+	for i := range messages {
+		message := &messages[i]
+		toolResult := message.Role == "tool" || message.Role == "function"
+		if message.IsStringContent() {
+			content := message.StringContent()
+			segments = append(segments, guardSegment{text: &content, toolResult: toolResult})
+			writeBacks = append(writeBacks, func() {
+				if content != message.StringContent() {
+					message.SetStringContent(content)
+				}
+			})
+			continue
+		}
+		contents := message.ParseContent()
+		originals := make([]string, len(contents))
+		for j := range contents {
+			if contents[j].Type == dto.ContentTypeText {
+				originals[j] = contents[j].Text
+				segments = append(segments, guardSegment{text: &contents[j].Text, toolResult: toolResult})
+			}
+		}
+		writeBacks = append(writeBacks, func() {
+			for j := range contents {
+				if contents[j].Type == dto.ContentTypeText && contents[j].Text != originals[j] {
+					message.SetMediaContent(contents)
+					return
+				}
+			}
+		})
+	}
+	if err := guardSegments(c, info, segments); err != nil {
+		return err
+	}
+	for _, writeBack := range writeBacks {
+		writeBack()
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// SelfHostedReplica 自建推理服务副本最近一次采集到的负载与健康状态
+type SelfHostedReplica struct {
+	ChannelId            int            `json:"channel_id"`
+	ChannelName          string         `json:"channel_name"`
+	Tag                  string         `json:"tag"`
+	Healthy              bool           `json:"healthy"`
+	Failures             int            `json:"failures"` // 连续健康检查失败次数
+	Running              int            `json:"running"`
+	Waiting              int            `json:"waiting"`
+	SlotsTotal           int            `json:"slots_total,omitempty"`
+	SlotsBusy            int            `json:"slots_busy,omitempty"`
+	Dispatched           int            `json:"dispatched"`               // 上次采集后新分配到该副本的请求数，指标尚未反映
+	ContextLength        map[string]int `json:"context_length,omitempty"` // 模型名 -> 最大上下文长度
+	DefaultContextLength int            `json:"default_context_length,omitempty"`
+	LastError            string         `json:"last_error,omitempty"`
+	UpdatedAt            int64          `json:"updated_at"`
+}
+
+func (r *SelfHostedReplica) load(waitingWeight int) int {
+	running := r.Running
+	if r.SlotsBusy > running {
+		running = r.SlotsBusy
+	}
+	return r.Waiting*waitingWeight + running + r.Dispatched
+}
+
+var (
+	selfHostedReplicas = make(map[int]*SelfHostedReplica)
+	selfHostedLock     sync.Mutex
+)
+
+// 各推理框架 /metrics 中表示运行中与排队请求数的指标
+var (
+	runningMetrics = []string{"vllm:num_requests_running", "tgi_batch_current_size", "llamacpp:requests_processing", "sglang:num_running_reqs"}
+	waitingMetrics = []string{"vllm:num_requests_waiting", "tgi_queue_size", "llamacpp:requests_deferred", "sglang:num_queue_reqs"}
+)
+
+const selfHostedRedisKey = "self_hosted_replicas"
+
+// StartSelfHostedMonitor 定时采集所有自建推理渠道的健康状态、负载与上下文长度。
+// 启用 Redis 时只由主节点采集并写入 Redis，从节点从 Redis 同步，避免每个节点都轮询数据库与推理服务
+func StartSelfHostedMonitor() {
+	for {
+		interval := operation_setting.GetSelfHostedSetting().ScrapeIntervalSeconds
+		if interval <= 0 {
+			interval = 10
+		}
+		if common.RedisEnabled && !common.IsMasterNode {
+			loadSelfHostedReplicasFromRedis()
+		} else {
+			scrapeSelfHostedReplicas()
+			if common.RedisEnabled {
+				saveSelfHostedReplicasToRedis(time.Duration(interval*3) * time.Second)
+			}
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+func saveSelfHostedReplicasToRedis(expiration time.Duration) {
+	selfHostedLock.Lock()
+	data, err := json.Marshal(selfHostedReplicas)
+	selfHostedLock.Unlock()
+	if err != nil {
+		common.SysError("failed to marshal self-hosted replicas: " + err.Error())
+		return
+	}
+	if err = common.RedisSet(selfHostedRedisKey, string(data), expiration); err != nil {
+		common.SysError("failed to save self-hosted replicas to redis: " + err.Error())
+	}
+}
+
+// loadSelfHostedReplicasFromRedis 同步主节点采集的副本状态，主节点停止写入导致数据过期时清空，回退到常规选择
+func loadSelfHostedReplicasFromRedis() {
+	replicas := make(map[int]*SelfHostedReplica)
+	data, err := common.RedisGet(selfHostedRedisKey)
+	if err == nil {
+		if err = json.Unmarshal([]byte(data), &replicas); err != nil {
+			common.SysError("failed to unmarshal self-hosted replicas: " + err.Error())
+			return
+		}
+	} else if err.Error() != "redis: nil" {
+		common.SysError("failed to load self-hosted replicas from redis: " + err.Error())
+		return
+	}
+	selfHostedLock.Lock()
+	selfHostedReplicas = replicas
+	selfHostedLock.Unlock()
+}
+
+func scrapeSelfHostedReplicas() {
+	channels, err := model.GetEnabledChannelsByType(common.ChannelTypeSelfHosted)
+	if err != nil {
+		common.SysError("failed to load self-hosted channels: " + err.Error())
+		return
+	}
+	var wg sync.WaitGroup
+	alive := make(map[int]bool, len(channels))
+	for _, channel := range channels {
+		alive[channel.Id] = true
+		wg.Add(1)
+		channel := channel
+		gopool.Go(func() {
+			defer wg.Done()
+			scrapeSelfHostedReplica(channel)
+		})
+	}
+	wg.Wait()
+	selfHostedLock.Lock()
+	for id := range selfHostedReplicas {
+		if !alive[id] {
+			delete(selfHostedReplicas, id)
+		}
+	}
+	selfHostedLock.Unlock()
+}
+
+// selfHostedRoot 去掉 Base URL 末尾的 /v1，/health、/metrics 等接口位于根路径
+func selfHostedRoot(channel *model.Channel) string {
+	baseURL := strings.TrimSuffix(channel.GetBaseURL(), "/")
+	return strings.TrimSuffix(baseURL, "/v1")
+}
+
+func scrapeSelfHostedReplica(channel *model.Channel) {
+	setting := operation_setting.GetSelfHostedSetting()
+	timeout := time.Duration(setting.ScrapeTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	root := selfHostedRoot(channel)
+	key := strings.Split(channel.GetKey(), ",")[0]
+
+	snapshot := &SelfHostedReplica{
+		ChannelId:     channel.Id,
+		ChannelName:   channel.Name,
+		Tag:           channel.GetTag(),
+		ContextLength: make(map[string]int),
+		UpdatedAt:     common.GetTimestamp(),
+	}
+	_, healthErr := selfHostedGet(ctx, root+"/health", key)
+	if healthErr == nil {
+		scrapeSelfHostedLoad(ctx, root, key, snapshot)
+		scrapeSelfHostedContext(ctx, root, key, snapshot)
+	}
+
+	selfHostedLock.Lock()
+	defer selfHostedLock.Unlock()
+	previous := selfHostedReplicas[channel.Id]
+	if healthErr != nil {
+		failures := 1
+		healthy := true
+		if previous != nil {
+			*snapshot = *previous
+			failures = previous.Failures + 1
+			healthy = previous.Healthy
+		}
+		threshold := setting.UnhealthyThreshold
+		if threshold <= 0 {
+			threshold = 1
+		}
+		if healthy && failures >= threshold {
+			healthy = false
+			common.SysError(fmt.Sprintf("self-hosted channel #%d (%s) marked unhealthy after %d failed health checks: %s", channel.Id, channel.Name, failures, healthErr.Error()))
+		}
+		snapshot.Healthy = healthy
+		snapshot.Failures = failures
+		snapshot.LastError = healthErr.Error()
+		snapshot.UpdatedAt = common.GetTimestamp()
+		selfHostedReplicas[channel.Id] = snapshot
+		return
+	}
+	if previous != nil && !previous.Healthy {
+		common.SysLog(fmt.Sprintf("self-hosted channel #%d (%s) is healthy again", channel.Id, channel.Name))
+	}
+	snapshot.Healthy = true
+	selfHostedReplicas[channel.Id] = snapshot
+}
+
+func selfHostedGet(ctx context.Context, url string, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status code %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parsePrometheusMetrics 按指标名汇总 Prometheus 文本格式中的样本值，忽略标签
+func parsePrometheusMetrics(body []byte) map[string]float64 {
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+		if idx := strings.Index(name, "{"); idx >= 0 {
+			name = name[:idx]
+		}
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			// 带时间戳的样本值在倒数第二列
+			if len(fields) < 3 {
+				continue
+			}
+			if value, err = strconv.ParseFloat(fields[len(fields)-2], 64); err != nil {
+				continue
+			}
+		}
+		metrics[name] += value
+	}
+	return metrics
+}
+
+func sumMetrics(metrics map[string]float64, names []string) (int, bool) {
+	total := 0.0
+	found := false
+	for _, name := range names {
+		if value, ok := metrics[name]; ok {
+			total += value
+			found = true
+		}
+	}
+	return int(total), found
+}
+
+// scrapeSelfHostedLoad 读取 /metrics 中的排队与运行请求数，llama.cpp 额外读取 /slots 的占用情况
+func scrapeSelfHostedLoad(ctx context.Context, root string, key string, snapshot *SelfHostedReplica) {
+	if body, err := selfHostedGet(ctx, root+"/metrics", key); err == nil {
+		metrics := parsePrometheusMetrics(body)
+		snapshot.Running, _ = sumMetrics(metrics, runningMetrics)
+		snapshot.Waiting, _ = sumMetrics(metrics, waitingMetrics)
+	}
+	if body, err := selfHostedGet(ctx, root+"/slots", key); err == nil {
+		var slots []struct {
+			IsProcessing bool `json:"is_processing"`
+		}
+		if json.Unmarshal(body, &slots) == nil {
+			snapshot.SlotsTotal = len(slots)
+			for _, slot := range slots {
+				if slot.IsProcessing {
+					snapshot.SlotsBusy++
+				}
+			}
+		}
+	}
+}
+
+// scrapeSelfHostedContext 读取模型最大上下文：vLLM 的 /v1/models max_model_len，其次是 TGI 的 /info 与 llama.cpp 的 /props
+func scrapeSelfHostedContext(ctx context.Context, root string, key string, snapshot *SelfHostedReplica) {
+	if body, err := selfHostedGet(ctx, root+"/v1/models", key); err == nil {
+		var models struct {
+			Data []struct {
+				Id          string `json:"id"`
+				MaxModelLen int    `json:"max_model_len"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(body, &models) == nil {
+			for _, m := range models.Data {
+				if m.MaxModelLen > 0 {
+					snapshot.ContextLength[m.Id] = m.MaxModelLen
+				}
+			}
+		}
+	}
+	if len(snapshot.ContextLength) > 0 {
+		return
+	}
+	if body, err := selfHostedGet(ctx, root+"/info", key); err == nil {
+		var info struct {
+			MaxTotalTokens int `json:"max_total_tokens"`
+		}
+		if json.Unmarshal(body, &info) == nil && info.MaxTotalTokens > 0 {
+			snapshot.DefaultContextLength = info.MaxTotalTokens
+			return
+		}
+	}
+	if body, err := selfHostedGet(ctx, root+"/props", key); err == nil {
+		var props struct {
+			DefaultGenerationSettings struct {
+				NCtx int `json:"n_ctx"`
+			} `json:"default_generation_settings"`
+		}
+		if json.Unmarshal(body, &props) == nil {
+			snapshot.DefaultContextLength = props.DefaultGenerationSettings.NCtx
+		}
+	}
+}
+
+// GetSelfHostedContextLength 返回副本上模型的最大上下文长度，未知时返回 0
+func GetSelfHostedContextLength(channelId int, modelName string) int {
+	selfHostedLock.Lock()
+	defer selfHostedLock.Unlock()
+	replica, ok := selfHostedReplicas[channelId]
+	if !ok {
+		return 0
+	}
+	if length, ok := replica.ContextLength[modelName]; ok {
+		return length
+	}
+	return replica.DefaultContextLength
+}
+
+// SelectSelfHostedReplica 选中自建推理渠道时，在同一标签内改选健康且负载最低的副本，
+// excludeIds 为本次请求已失败的渠道，重试时不会再选回；其他类型的渠道原样返回，不影响常规的优先级与权重选择
+func SelectSelfHostedReplica(channel *model.Channel, group string, modelName string, excludeIds ...int) *model.Channel {
+	if channel == nil || channel.Type != common.ChannelTypeSelfHosted {
+		return channel
+	}
+	excluded := make(map[int]bool, len(excludeIds))
+	for _, id := range excludeIds {
+		excluded[id] = true
+	}
+	candidates := make([]*model.Channel, 0)
+	if !excluded[channel.Id] {
+		candidates = append(candidates, channel)
+	}
+	if tag := channel.GetTag(); tag != "" {
+		for _, replica := range model.CacheGetChannelsByTag(group, modelName, tag) {
+			if replica.Type == common.ChannelTypeSelfHosted && replica.Id != channel.Id && !excluded[replica.Id] {
+				candidates = append(candidates, replica)
+			}
+		}
+	}
+
+	waitingWeight := operation_setting.GetSelfHostedSetting().WaitingWeight
+	selfHostedLock.Lock()
+	defer selfHostedLock.Unlock()
+	var best *model.Channel
+	bestLoad := 0
+	ties := 0
+	for _, candidate := range candidates {
+		load := 0
+		if replica, ok := selfHostedReplicas[candidate.Id]; ok {
+			if !replica.Healthy {
+				continue
+			}
+			load = replica.load(waitingWeight)
+		}
+		switch {
+		case best == nil || load < bestLoad:
+			best, bestLoad, ties = candidate, load, 1
+		case load == bestLoad:
+			// 负载相同的副本中随机选择
+			ties++
+			if rand.Intn(ties) == 0 {
+				best = candidate
+			}
+		}
+	}
+	if best == nil {
+		// 所有副本都不健康时保留原选择，交由重试与自动禁用处理
+		return channel
+	}
+	if replica, ok := selfHostedReplicas[best.Id]; ok {
+		replica.Dispatched++
+	}
+	return best
+}
+
+// GetSelfHostedReplicas 返回所有自建推理副本的状态
+func GetSelfHostedReplicas() []SelfHostedReplica {
+	selfHostedLock.Lock()
+	defer selfHostedLock.Unlock()
+	replicas := make([]SelfHostedReplica, 0, len(selfHostedReplicas))
+	for _, replica := range selfHostedReplicas {
+		replicas = append(replicas, *replica)
+	}
+	return replicas
+}
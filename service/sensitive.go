@@ -19,7 +19,6 @@ package service
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"veloera/dto"
 	"veloera/setting"
@@ -81,9 +80,9 @@ func SensitiveWordContains(text string) (bool, []string) {
 	checkText := strings.ToLower(text)
 
 	// First check regular expressions
-	for _, pattern := range setting.RegexSensitiveWords {
-		if matched, err := regexp.MatchString(pattern, checkText); err == nil && matched {
-			return true, []string{pattern}
+	for _, re := range setting.CompiledRegexSensitiveWords {
+		if re.MatchString(checkText) {
+			return true, []string{re.String()}
 		}
 	}
 
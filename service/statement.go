@@ -0,0 +1,258 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/setting/system_setting"
+)
+
+const statementTimeLayout = "2006-01-02 15:04:05"
+
+// StatementAmount 将额度换算为结算货币金额
+func StatementAmount(quota int) float64 {
+	if common.QuotaPerUnit <= 0 {
+		return 0
+	}
+	return float64(quota) / common.QuotaPerUnit
+}
+
+// StatementTotals 计算对账单的不含税金额、税额与总额
+func StatementTotals(statement *model.BillingStatement) (subtotal float64, tax float64, total float64) {
+	subtotal = StatementAmount(statement.TotalQuota)
+	rate := system_setting.GetStatementSettings().TaxRate
+	if rate > 0 {
+		tax = subtotal * rate / 100
+	}
+	return subtotal, tax, subtotal + tax
+}
+
+func formatStatementMoney(amount float64) string {
+	return fmt.Sprintf("%s %.4f", system_setting.GetStatementSettings().Currency, amount)
+}
+
+func formatStatementTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format(statementTimeLayout)
+}
+
+// StatementFileName 生成对账单下载文件名
+func StatementFileName(statement *model.BillingStatement, ext string) string {
+	return fmt.Sprintf("statement-%s-%d.%s", statement.Period, statement.UserId, ext)
+}
+
+func writeStatementLines(w *csv.Writer, section string, lines []model.StatementLine) {
+	for _, line := range lines {
+		_ = w.Write([]string{
+			section,
+			line.Name,
+			strconv.Itoa(line.Count),
+			strconv.Itoa(line.PromptTokens),
+			strconv.Itoa(line.CompletionTokens),
+			strconv.Itoa(line.Quota),
+			strconv.FormatFloat(StatementAmount(line.Quota), 'f', 6, 64),
+		})
+	}
+}
+
+// RenderStatementCSV 将对账单渲染为 CSV
+func RenderStatementCSV(statement *model.BillingStatement) ([]byte, error) {
+	settings := system_setting.GetStatementSettings()
+	subtotal, tax, total := StatementTotals(statement)
+
+	var buf bytes.Buffer
+	// UTF-8 BOM，方便 Excel 直接打开
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"issuer", settings.CompanyName})
+	_ = w.Write([]string{"issuer_address", settings.CompanyAddress})
+	_ = w.Write([]string{"issuer_tax_id", settings.TaxId})
+	_ = w.Write([]string{"user_id", strconv.Itoa(statement.UserId)})
+	_ = w.Write([]string{"username", statement.Username})
+	_ = w.Write([]string{"email", statement.Email})
+	_ = w.Write([]string{"period", statement.Period})
+	_ = w.Write([]string{"period_start", formatStatementTime(statement.StartTime)})
+	_ = w.Write([]string{"period_end", formatStatementTime(statement.EndTime)})
+	_ = w.Write([]string{"currency", settings.Currency})
+	_ = w.Write([]string{"subtotal", strconv.FormatFloat(subtotal, 'f', 6, 64)})
+	_ = w.Write([]string{"tax_rate", strconv.FormatFloat(settings.TaxRate, 'f', -1, 64)})
+	_ = w.Write([]string{"tax", strconv.FormatFloat(tax, 'f', 6, 64)})
+	_ = w.Write([]string{"total", strconv.FormatFloat(total, 'f', 6, 64)})
+	_ = w.Write(nil)
+
+	_ = w.Write([]string{"section", "name", "requests", "prompt_tokens", "completion_tokens", "quota", "amount"})
+	writeStatementLines(w, "model", statement.ByModel)
+	writeStatementLines(w, "token", statement.ByToken)
+	writeStatementLines(w, "group", statement.ByGroup)
+	_ = w.Write(nil)
+
+	_ = w.Write([]string{"credit_time", "source", "reference", "quota", "money", "description"})
+	for _, credit := range statement.Credits {
+		_ = w.Write([]string{
+			formatStatementTime(credit.Time),
+			credit.Source,
+			credit.Reference,
+			strconv.Itoa(credit.Quota),
+			strconv.FormatFloat(credit.Money, 'f', 2, 64),
+			credit.Description,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// RenderStatementSummaryCSV 将多个用户的对账单汇总为一张 CSV，用于管理员批量导出
+func RenderStatementSummaryCSV(statements []*model.BillingStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"period", "user_id", "username", "email", "requests", "prompt_tokens", "completion_tokens",
+		"quota", "subtotal", "tax", "total", "topup_quota", "redemption_quota"})
+	for _, statement := range statements {
+		subtotal, tax, total := StatementTotals(statement)
+		_ = w.Write([]string{
+			statement.Period,
+			strconv.Itoa(statement.UserId),
+			statement.Username,
+			statement.Email,
+			strconv.Itoa(statement.TotalCount),
+			strconv.Itoa(statement.PromptTokens),
+			strconv.Itoa(statement.CompletionTokens),
+			strconv.Itoa(statement.TotalQuota),
+			strconv.FormatFloat(subtotal, 'f', 6, 64),
+			strconv.FormatFloat(tax, 'f', 6, 64),
+			strconv.FormatFloat(total, 'f', 6, 64),
+			strconv.Itoa(statement.TopUpQuota),
+			strconv.Itoa(statement.RedemptionQuota),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func truncateStatementCell(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+func renderStatementSection(pdf *simplePDF, title string, lines []model.StatementLine) {
+	if len(lines) == 0 {
+		return
+	}
+	columns := []float64{50, 260, 320, 395, 470}
+	pdf.Space(8)
+	pdf.Line(12, true, title)
+	pdf.Row(9, true, columns, "Name", "Requests", "Prompt", "Completion", "Amount")
+	pdf.Rule()
+	for _, line := range lines {
+		name := line.Name
+		if name == "" {
+			name = "-"
+		}
+		pdf.Row(9, false, columns,
+			truncateStatementCell(name, 40),
+			strconv.Itoa(line.Count),
+			strconv.Itoa(line.PromptTokens),
+			strconv.Itoa(line.CompletionTokens),
+			strconv.FormatFloat(StatementAmount(line.Quota), 'f', 4, 64),
+		)
+	}
+}
+
+// RenderStatementPDF 将对账单渲染为 PDF
+func RenderStatementPDF(statement *model.BillingStatement) []byte {
+	settings := system_setting.GetStatementSettings()
+	subtotal, tax, total := StatementTotals(statement)
+	pdf := newSimplePDF()
+
+	issuer := settings.CompanyName
+	if issuer == "" {
+		issuer = common.SystemName
+	}
+	pdf.Line(18, true, issuer)
+	if settings.CompanyAddress != "" {
+		pdf.Line(9, false, settings.CompanyAddress)
+	}
+	if settings.CompanyEmail != "" {
+		pdf.Line(9, false, settings.CompanyEmail)
+	}
+	if settings.TaxId != "" {
+		pdf.Line(9, false, "Tax ID: "+settings.TaxId)
+	}
+	pdf.Space(10)
+	pdf.Line(14, true, "Billing Statement "+statement.Period)
+	pdf.Line(9, false, fmt.Sprintf("Period: %s - %s", formatStatementTime(statement.StartTime), formatStatementTime(statement.EndTime)))
+	pdf.Line(9, false, "Generated: "+formatStatementTime(statement.GeneratedAt))
+	pdf.Space(6)
+	pdf.Line(10, true, "Bill to")
+	pdf.Line(9, false, fmt.Sprintf("%s (ID %d)", statement.Username, statement.UserId))
+	if statement.DisplayName != "" && statement.DisplayName != statement.Username {
+		pdf.Line(9, false, statement.DisplayName)
+	}
+	if statement.Email != "" {
+		pdf.Line(9, false, statement.Email)
+	}
+
+	pdf.Space(8)
+	summary := []float64{50, 250}
+	pdf.Line(12, true, "Summary")
+	pdf.Row(9, false, summary, "Requests", strconv.Itoa(statement.TotalCount))
+	pdf.Row(9, false, summary, "Prompt tokens", strconv.Itoa(statement.PromptTokens))
+	pdf.Row(9, false, summary, "Completion tokens", strconv.Itoa(statement.CompletionTokens))
+	pdf.Row(9, false, summary, "Subtotal", formatStatementMoney(subtotal))
+	if settings.TaxRate > 0 {
+		pdf.Row(9, false, summary, fmt.Sprintf("%s (%s%%)", settings.TaxName, strconv.FormatFloat(settings.TaxRate, 'f', -1, 64)), formatStatementMoney(tax))
+	}
+	pdf.Row(10, true, summary, "Total", formatStatementMoney(total))
+	pdf.Row(9, false, summary, "Top-ups in period", formatStatementMoney(StatementAmount(statement.TopUpQuota)))
+	pdf.Row(9, false, summary, "Redemptions in period", formatStatementMoney(StatementAmount(statement.RedemptionQuota)))
+
+	renderStatementSection(pdf, "Usage by model", statement.ByModel)
+	renderStatementSection(pdf, "Usage by token", statement.ByToken)
+	renderStatementSection(pdf, "Usage by group", statement.ByGroup)
+
+	if len(statement.Credits) > 0 {
+		columns := []float64{50, 160, 230, 400, 470}
+		pdf.Space(8)
+		pdf.Line(12, true, "Top-ups and redemptions")
+		pdf.Row(9, true, columns, "Time", "Source", "Reference", "Paid", "Credit")
+		pdf.Rule()
+		for _, credit := range statement.Credits {
+			pdf.Row(9, false, columns,
+				formatStatementTime(credit.Time),
+				credit.Source,
+				truncateStatementCell(credit.Reference, 32),
+				strconv.FormatFloat(credit.Money, 'f', 2, 64),
+				strconv.FormatFloat(StatementAmount(credit.Quota), 'f', 4, 64),
+			)
+		}
+	}
+
+	if settings.FooterNote != "" {
+		pdf.Space(16)
+		pdf.Line(8, false, settings.FooterNote)
+	}
+	return pdf.Bytes()
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"veloera/common"
+	relaycommon "veloera/relay/common"
+	"veloera/setting"
+	"veloera/setting/model_setting"
+
+	goahocorasick "github.com/anknown/ahocorasick"
+	"github.com/gin-gonic/gin"
+)
+
+// StreamContentFilter 流式输出过滤器。
+// 每个输出序号保留尾部一段文本暂不下发，使跨分片的屏蔽词也能被完整匹配；
+// 命中后按策略替换屏蔽词，或截断在屏蔽词之前并终止输出。
+type StreamContentFilter struct {
+	c        *gin.Context
+	info     *relaycommon.RelayInfo
+	stop     bool
+	window   int // 暂不下发的尾部字符数
+	machine  *goahocorasick.Machine
+	regexes  []*regexp.Regexp
+	pending  map[int]string
+	stopped  bool
+	recorded bool
+}
+
+// NewStreamContentFilter 按分组策略创建流式过滤器，无需过滤时返回 nil
+func NewStreamContentFilter(c *gin.Context, info *relaycommon.RelayInfo) *StreamContentFilter {
+	if !ShouldModerateCompletion(info.Group) {
+		return nil
+	}
+	policy := model_setting.GetModerationPolicy(info.Group)
+	if policy.Action == model_setting.ModerationActionFlag ||
+		!common.StringsContains(policy.Checkers, model_setting.ModerationCheckerKeyword) {
+		return nil
+	}
+	if len(setting.SensitiveWords) == 0 && len(setting.RegexSensitiveWords) == 0 {
+		return nil
+	}
+	f := &StreamContentFilter{
+		c:       c,
+		info:    info,
+		stop:    policy.Action == model_setting.ModerationActionBlock && setting.StopOnSensitiveEnabled,
+		window:  setting.StreamCacheQueueLength,
+		pending: make(map[int]string),
+	}
+	// 窗口至少要能容纳最长屏蔽词去掉一个字符的长度，正则屏蔽词依赖 StreamCacheQueueLength 调大窗口
+	for _, word := range setting.SensitiveWords {
+		if n := utf8.RuneCountInString(strings.TrimSpace(word)) - 1; n > f.window {
+			f.window = n
+		}
+	}
+	if len(setting.SensitiveWords) > 0 {
+		f.machine = InitAc(setting.SensitiveWords)
+	}
+	f.regexes = setting.CompiledRegexSensitiveWords
+	return f
+}
+
+func (f *StreamContentFilter) matches(text string) []string {
+	checkText := strings.ToLower(text)
+	var matches []string
+	for _, re := range f.regexes {
+		matches = appendUnique(matches, re.FindAllString(checkText, -1)...)
+	}
+	if f.machine != nil && checkText != "" {
+		for _, hit := range f.machine.MultiPatternSearch([]rune(checkText), false) {
+			matches = appendUnique(matches, string(hit.Word))
+		}
+	}
+	return matches
+}
+
+func (f *StreamContentFilter) record(matches []string) {
+	if f.recorded {
+		return
+	}
+	f.recorded = true
+	action := model_setting.ModerationActionRedact
+	if f.stop {
+		action = model_setting.ModerationActionBlock
+	}
+	recordModeration(f.c, f.info, ModerationStageCompletion, action, &textModeration{
+		flagged:    true,
+		checkers:   []string{model_setting.ModerationCheckerKeyword},
+		categories: []string{"sensitive_words"},
+		matches:    matches,
+	})
+}
+
+// Push 写入某个输出序号新生成的文本，返回此时可以下发的文本；命中且需要终止输出时 stopped 为 true
+func (f *StreamContentFilter) Push(index int, text string) (release string, stopped bool) {
+	if f == nil {
+		return text, false
+	}
+	if f.stopped {
+		return "", true
+	}
+	pending := f.pending[index] + text
+	if matches := f.matches(pending); len(matches) > 0 {
+		f.record(matches)
+		if f.stop {
+			f.stopped = true
+			delete(f.pending, index)
+			return pending[:firstMatchIndex(pending, matches)], true
+		}
+		pending = (&textModeration{flagged: true, matches: matches}).redact(pending)
+	}
+	release, f.pending[index] = splitTail(pending, f.window)
+	return release, false
+}
+
+// Flush 输出结束时取出某个输出序号暂存的文本
+func (f *StreamContentFilter) Flush(index int) string {
+	if f == nil || f.stopped {
+		return ""
+	}
+	held := f.pending[index]
+	delete(f.pending, index)
+	return held
+}
+
+// PendingIndexes 返回仍有暂存文本的输出序号
+func (f *StreamContentFilter) PendingIndexes() []int {
+	if f == nil || f.stopped {
+		return nil
+	}
+	indexes := make([]int, 0, len(f.pending))
+	for index, held := range f.pending {
+		if held != "" {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Stopped 是否因命中屏蔽词终止了输出
+func (f *StreamContentFilter) Stopped() bool {
+	return f != nil && f.stopped
+}
+
+// firstMatchIndex 返回命中片段在原文中最早出现的位置
+func firstMatchIndex(text string, matches []string) int {
+	first := len(text)
+	for _, match := range matches {
+		re, err := regexp.Compile("(?i)" + regexp.QuoteMeta(match))
+		if err != nil {
+			continue
+		}
+		if loc := re.FindStringIndex(text); loc != nil && loc[0] < first {
+			first = loc[0]
+		}
+	}
+	if first == len(text) {
+		return 0
+	}
+	return first
+}
+
+// splitTail 将文本拆分为可下发部分与尾部 window 个字符
+func splitTail(text string, window int) (string, string) {
+	if window <= 0 {
+		return text, ""
+	}
+	runes := []rune(text)
+	if len(runes) <= window {
+		return "", text
+	}
+	return string(runes[:len(runes)-window]), string(runes[len(runes)-window:])
+}
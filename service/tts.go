@@ -0,0 +1,298 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"veloera/dto"
+	"veloera/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI 语音合成的 pcm 输出为 24kHz 16 位单声道
+const ttsPCMSampleRate = 24000
+
+var ttsContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+// NormalizeTTSFormat 规范化客户端请求的 response_format，默认 mp3
+func NormalizeTTSFormat(format string) string {
+	if format == "" {
+		return "mp3"
+	}
+	return strings.ToLower(format)
+}
+
+// PickTTSSourceFormat 在上游支持的格式中选择请求上游使用的格式：优先与客户端一致，其次 pcm，避免转码
+func PickTTSSourceFormat(format string, supported ...string) string {
+	format = NormalizeTTSFormat(format)
+	for _, f := range supported {
+		if f == format {
+			return f
+		}
+	}
+	for _, f := range supported {
+		if f == "pcm" {
+			return f
+		}
+	}
+	return supported[0]
+}
+
+// CheckTTSFormat 在请求上游前确认输出格式可以生成，需要转码时检查 ffmpeg
+func CheckTTSFormat(sourceFormat string, format string) error {
+	format = NormalizeTTSFormat(format)
+	if _, ok := ttsContentTypes[format]; !ok {
+		return fmt.Errorf("unsupported response_format: %s", format)
+	}
+	if ttsConvertInGo(sourceFormat, format) {
+		return nil
+	}
+	if !FFmpegAvailable(model_setting.GetAudioPipelineSettings().FFmpegPath) {
+		return fmt.Errorf("输出 %s 格式需要服务器安装 ffmpeg", format)
+	}
+	return nil
+}
+
+func ttsConvertInGo(sourceFormat string, format string) bool {
+	return sourceFormat == format || (sourceFormat == "pcm" && format == "wav") || (sourceFormat == "wav" && format == "pcm")
+}
+
+// TTSWriter 将上游音频按客户端请求的 response_format 写回。
+// 流式请求在无需转码时边收边发，需要 ffmpeg 转码的格式在上游结束后一次性输出
+type TTSWriter struct {
+	c            *gin.Context
+	format       string
+	streamFormat string
+	sourceFormat string
+	sampleRate   int // 上游为 pcm 时的采样率
+	buf          bytes.Buffer
+	pending      []byte
+	started      bool
+}
+
+func NewTTSWriter(c *gin.Context, format string, streamFormat string, sourceFormat string, sampleRate int) *TTSWriter {
+	return &TTSWriter{
+		c:            c,
+		format:       NormalizeTTSFormat(format),
+		streamFormat: streamFormat,
+		sourceFormat: sourceFormat,
+		sampleRate:   sampleRate,
+	}
+}
+
+func (w *TTSWriter) streaming() bool {
+	return w.streamFormat == "audio" || w.streamFormat == "sse"
+}
+
+// Write 写入一段上游音频
+func (w *TTSWriter) Write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if !w.streaming() {
+		w.buf.Write(data)
+		return nil
+	}
+	switch {
+	case w.sourceFormat == "pcm" && w.format == "pcm":
+		// 按整采样重采样，多出的半个采样留到下一段
+		data = append(w.pending, data...)
+		w.pending = append([]byte(nil), data[len(data)-len(data)%2:]...)
+		return w.emit(resamplePCM16Bytes(data[:len(data)-len(data)%2], w.sampleRate, ttsPCMSampleRate))
+	case w.sourceFormat == "pcm" && w.format == "wav":
+		// 流式 WAV 的长度未知，文件头写入最大长度
+		if !w.started {
+			header := PCM16ToWav(nil, w.sampleRate)
+			for _, offset := range []int{4, 40} {
+				copy(header[offset:offset+4], []byte{0xff, 0xff, 0xff, 0xff})
+			}
+			data = append(header, data...)
+		}
+		return w.emit(data)
+	case w.sourceFormat == w.format && w.format != "wav":
+		return w.emit(data)
+	}
+	w.buf.Write(data)
+	return nil
+}
+
+// Close 输出缓冲的音频，流式 sse 输出结束事件
+func (w *TTSWriter) Close(usage *dto.Usage) error {
+	if w.buf.Len() > 0 || (!w.streaming() && !w.started) {
+		data, err := w.convert(w.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if !w.streaming() {
+			w.c.Data(http.StatusOK, ttsContentTypes[w.format], data)
+			w.started = true
+			return nil
+		}
+		if err := w.emit(data); err != nil {
+			return err
+		}
+	}
+	if w.streamFormat == "sse" {
+		done := map[string]any{"type": "speech.audio.done"}
+		if usage != nil {
+			done["usage"] = map[string]int{
+				"input_tokens":  usage.PromptTokens,
+				"output_tokens": usage.CompletionTokens,
+				"total_tokens":  usage.TotalTokens,
+			}
+		}
+		return w.writeEvent(done)
+	}
+	return nil
+}
+
+func (w *TTSWriter) emit(data []byte) error {
+	if !w.started {
+		w.started = true
+		if w.streamFormat == "sse" {
+			w.c.Writer.Header().Set("Content-Type", "text/event-stream")
+			w.c.Writer.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.c.Writer.Header().Set("Content-Type", ttsContentTypes[w.format])
+		}
+		w.c.Writer.WriteHeader(http.StatusOK)
+	}
+	if w.streamFormat == "sse" {
+		return w.writeEvent(map[string]any{"type": "speech.audio.delta", "audio": base64.StdEncoding.EncodeToString(data)})
+	}
+	if _, err := w.c.Writer.Write(data); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+func (w *TTSWriter) writeEvent(event map[string]any) error {
+	data, _ := json.Marshal(event)
+	if _, err := fmt.Fprintf(w.c.Writer, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+func (w *TTSWriter) convert(data []byte) ([]byte, error) {
+	switch {
+	case w.sourceFormat == "pcm" && w.format == "pcm":
+		return resamplePCM16Bytes(data, w.sampleRate, ttsPCMSampleRate), nil
+	case w.sourceFormat == "pcm" && w.format == "wav":
+		return PCM16ToWav(PCM16BytesToSamples(data), w.sampleRate), nil
+	case w.sourceFormat == "wav" && w.format == "pcm":
+		pcm, sampleRate := ExtractWavPCM(data)
+		return resamplePCM16Bytes(pcm, sampleRate, ttsPCMSampleRate), nil
+	case w.sourceFormat == w.format:
+		return data, nil
+	}
+	var input []string
+	if w.sourceFormat == "pcm" {
+		input = []string{"-f", "s16le", "-ar", strconv.Itoa(w.sampleRate), "-ac", "1"}
+	}
+	return TranscodeAudio(w.c.Request.Context(), model_setting.GetAudioPipelineSettings().FFmpegPath, data, input, w.format)
+}
+
+func resamplePCM16Bytes(data []byte, from int, to int) []byte {
+	if from == to || from == 0 {
+		return data
+	}
+	samples := ResamplePCM16(PCM16BytesToSamples(data), from, to)
+	out := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		out[2*i] = byte(s)
+		out[2*i+1] = byte(s >> 8)
+	}
+	return out
+}
+
+// TranscodeAudio 通过 ffmpeg 将内存中的音频转为 mp3/opus/aac/flac/wav/pcm，inputArgs 用于声明裸 PCM 的输入格式
+func TranscodeAudio(ctx context.Context, ffmpegPath string, data []byte, inputArgs []string, format string) ([]byte, error) {
+	args := append([]string{"-v", "error", "-nostdin"}, inputArgs...)
+	args = append(args, "-i", "pipe:0", "-vn")
+	switch format {
+	case "mp3":
+		args = append(args, "-f", "mp3")
+	case "opus":
+		args = append(args, "-c:a", "libopus", "-f", "ogg")
+	case "aac":
+		args = append(args, "-c:a", "aac", "-f", "adts")
+	case "flac":
+		args = append(args, "-f", "flac")
+	case "wav":
+		args = append(args, "-f", "wav")
+	case "pcm":
+		args = append(args, "-f", "s16le", "-ar", strconv.Itoa(ttsPCMSampleRate), "-ac", "1")
+	default:
+		return nil, fmt.Errorf("unsupported audio format: %s", format)
+	}
+	args = append(args, "pipe:1")
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if format == "wav" {
+		// 写入管道时 ffmpeg 无法回填长度字段，重新生成文件头
+		pcm, sampleRate := ExtractWavPCM(output)
+		return PCM16ToWav(PCM16BytesToSamples(pcm), sampleRate), nil
+	}
+	return output, nil
+}
+
+// ScanSSEData 逐条读取 SSE 响应中的 data 字段
+func ScanSSEData(r io.Reader, handler func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		if err := handler(data); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
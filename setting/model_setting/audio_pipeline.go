@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"veloera/setting/config"
+)
+
+// AudioPipelineSettings 语音转写/翻译请求的网关侧处理：格式检测、转码、长音频分片与结果拼接
+type AudioPipelineSettings struct {
+	Enabled            bool     `json:"enabled"`
+	FFmpegPath         string   `json:"ffmpeg_path"`          // 转码与切分使用的 ffmpeg，未安装时仅支持 PCM WAV 的纯 Go 处理
+	ChunkSeconds       int      `json:"chunk_seconds"`        // 每个分片的时长
+	OverlapSeconds     int      `json:"overlap_seconds"`      // 相邻分片重叠的时长，避免在分片边界丢字
+	UpstreamMaxBytes   int64    `json:"upstream_max_bytes"`   // 上游接受的单文件大小上限，超过时切分
+	Concurrency        int      `json:"concurrency"`          // 同一请求并发转写的分片数
+	PassthroughFormats []string `json:"passthrough_formats"`  // 上游可直接接受、无需转码的格式
+	MaxDurationSeconds int      `json:"max_duration_seconds"` // 单个请求允许的最长音频，0 表示不限制
+}
+
+var defaultAudioPipelineSettings = AudioPipelineSettings{
+	Enabled:            false,
+	FFmpegPath:         "ffmpeg",
+	ChunkSeconds:       600,
+	OverlapSeconds:     2,
+	UpstreamMaxBytes:   24 * 1024 * 1024,
+	Concurrency:        3,
+	PassthroughFormats: []string{"flac", "mp3", "mp4", "m4a", "ogg", "wav", "webm"},
+	MaxDurationSeconds: 4 * 3600,
+}
+
+// 全局实例
+var audioPipelineSettings = defaultAudioPipelineSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audio_pipeline", &audioPipelineSettings)
+}
+
+func GetAudioPipelineSettings() *AudioPipelineSettings {
+	return &audioPipelineSettings
+}
+
+// IsAudioPassthroughFormat 判断音频格式是否可以不经转码直接发往上游
+func IsAudioPassthroughFormat(format string) bool {
+	for _, f := range audioPipelineSettings.PassthroughFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"strings"
+	"veloera/setting/config"
+)
+
+// EmbeddingSettings 向量请求的分批、维度截断与内容缓存
+type EmbeddingSettings struct {
+	BatchSize        map[string]int `json:"batch_size"`         // 渠道名 → 单次上游请求的最大输入条数，渠道设置 embedding_batch_size 优先
+	DefaultBatchSize int            `json:"default_batch_size"` // 未配置的渠道使用的上限
+	Concurrency      int            `json:"concurrency"`        // 同一请求并发发往上游的批次数
+	// 上游原生支持 dimensions 的模型前缀，其余模型由网关截断并重新归一化
+	NativeDimensionsModels []string `json:"native_dimensions_models"`
+	CacheEnabled           bool     `json:"cache_enabled"`
+	CacheTTLSeconds        int      `json:"cache_ttl_seconds"`
+	CacheMaxEntries        int      `json:"cache_max_entries"` // 未启用 Redis 时内存缓存的条数上限
+	CacheHitRatio          float64  `json:"cache_hit_ratio"`   // 缓存命中的 token 按此倍率计费
+}
+
+var defaultEmbeddingSettings = EmbeddingSettings{
+	BatchSize: map[string]int{
+		"openai":        2048,
+		"jina":          2048,
+		"google gemini": 1,
+		"ali":           10,
+		"baidu":         16,
+		"cohere":        96,
+		"mistral":       512,
+		"ollama":        512,
+		"siliconflow":   32,
+		"volcengine":    256,
+		"cloudflare":    100,
+		"zhipu":         64,
+	},
+	DefaultBatchSize: 256,
+	Concurrency:      4,
+	NativeDimensionsModels: []string{
+		"text-embedding-3", "text-embedding-004", "gemini-embedding", "text-embedding-v3", "text-embedding-v4",
+		"jina-embeddings-v3", "voyage-3",
+	},
+	CacheEnabled:    false,
+	CacheTTLSeconds: 7 * 24 * 3600,
+	CacheMaxEntries: 100000,
+	CacheHitRatio:   0.1,
+}
+
+// 全局实例
+var embeddingSettings = defaultEmbeddingSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("embedding", &embeddingSettings)
+}
+
+func GetEmbeddingSettings() *EmbeddingSettings {
+	return &embeddingSettings
+}
+
+// GetEmbeddingBatchSize 获取渠道单次请求的最大输入条数
+func GetEmbeddingBatchSize(channelName string) int {
+	if size, ok := embeddingSettings.BatchSize[channelName]; ok && size > 0 {
+		return size
+	}
+	if embeddingSettings.DefaultBatchSize > 0 {
+		return embeddingSettings.DefaultBatchSize
+	}
+	return 1
+}
+
+// SupportsNativeDimensions 判断上游模型是否原生支持 dimensions 参数
+func SupportsNativeDimensions(model string) bool {
+	for _, prefix := range embeddingSettings.NativeDimensionsModels {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
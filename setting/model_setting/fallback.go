@@ -0,0 +1,58 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"veloera/setting/config"
+)
+
+// ModelFallbackSettings 模型级回退链配置：首选模型的所有渠道均失败或超出上下文长度时依次改用后续模型
+type ModelFallbackSettings struct {
+	Enabled               bool                `json:"enabled"`
+	ClientFallbackEnabled bool                `json:"client_fallback_enabled"`
+	MaxFallbacks          int                 `json:"max_fallbacks"`
+	Chains                map[string][]string `json:"chains"`
+}
+
+// 默认配置
+var defaultModelFallbackSettings = ModelFallbackSettings{
+	Enabled:               true,
+	ClientFallbackEnabled: true,
+	MaxFallbacks:          3,
+	Chains:                map[string][]string{},
+}
+
+// 全局实例
+var modelFallbackSettings = defaultModelFallbackSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback", &modelFallbackSettings)
+}
+
+// GetModelFallbackSettings 获取模型回退配置
+func GetModelFallbackSettings() *ModelFallbackSettings {
+	return &modelFallbackSettings
+}
+
+// GetModelFallbackChain 获取管理员为模型配置的回退链，未配置时返回 nil
+func GetModelFallbackChain(modelName string) []string {
+	if !modelFallbackSettings.Enabled {
+		return nil
+	}
+	return modelFallbackSettings.Chains[modelName]
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"time"
+	"veloera/setting/config"
+)
+
+// HedgingSettings 请求对冲配置：首个渠道在延迟时间内未输出首字节时向第二个渠道发出相同请求，先响应者胜出
+type HedgingSettings struct {
+	Enabled bool     `json:"enabled"`
+	DelayMs int      `json:"delay_ms"`
+	Groups  []string `json:"groups"` // 对这些分组的请求启用对冲，管理员也可为单个令牌开启
+}
+
+// 默认配置
+var defaultHedgingSettings = HedgingSettings{
+	Enabled: false,
+	DelayMs: 2000,
+	Groups:  []string{},
+}
+
+// 全局实例
+var hedgingSettings = defaultHedgingSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedging", &hedgingSettings)
+}
+
+// GetHedgingSettings 获取请求对冲配置
+func GetHedgingSettings() *HedgingSettings {
+	return &hedgingSettings
+}
+
+// ShouldHedge 判断分组或令牌是否启用了请求对冲
+func ShouldHedge(group string, tokenHedgingEnabled bool) bool {
+	if !hedgingSettings.Enabled {
+		return false
+	}
+	if tokenHedgingEnabled {
+		return true
+	}
+	for _, g := range hedgingSettings.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHedgingDelay 获取发出对冲请求前等待首字节的时间
+func GetHedgingDelay() time.Duration {
+	if hedgingSettings.DelayMs <= 0 {
+		return 0
+	}
+	return time.Duration(hedgingSettings.DelayMs) * time.Millisecond
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"veloera/setting/config"
+)
+
+const (
+	ModerationActionBlock  = "block"  // 拦截请求
+	ModerationActionRedact = "redact" // 替换命中内容后继续
+	ModerationActionFlag   = "flag"   // 仅记录，不影响请求
+)
+
+const (
+	ModerationCheckerKeyword = "keyword" // 屏蔽词与正则屏蔽词
+	ModerationCheckerOpenAI  = "openai"  // 通过指定渠道调用 /v1/moderations
+	ModerationCheckerHTTP    = "http"    // 外部 HTTP 分类服务
+)
+
+// ModerationPolicy 分组的内容审核策略
+type ModerationPolicy struct {
+	Action   string   `json:"action"`
+	Checkers []string `json:"checkers"`
+}
+
+// ModerationSettings 内容审核流水线配置，总开关仍为 CheckSensitiveEnabled
+type ModerationSettings struct {
+	DefaultPolicy   ModerationPolicy            `json:"default_policy"`
+	GroupPolicies   map[string]ModerationPolicy `json:"group_policies"`    // 按分组覆盖默认策略
+	OpenAIChannelId int                         `json:"openai_channel_id"` // 用于调用审核接口的 OpenAI 兼容渠道
+	OpenAIModel     string                      `json:"openai_model"`
+	HTTPEndpoint    string                      `json:"http_endpoint"` // 外部分类服务地址
+	HTTPToken       string                      `json:"http_token"`    // 以 Bearer 方式携带
+	TimeoutSeconds  int                         `json:"timeout_seconds"`
+	FailOpen        bool                        `json:"fail_open"`     // 检查器调用失败时放行
+	BlockMessage    string                      `json:"block_message"` // 拦截时返回给用户的提示，支持 {categories} 与 {request_id}
+}
+
+// 默认配置，与原有的屏蔽词拦截行为保持一致
+var defaultModerationSettings = ModerationSettings{
+	DefaultPolicy: ModerationPolicy{
+		Action:   ModerationActionBlock,
+		Checkers: []string{ModerationCheckerKeyword},
+	},
+	GroupPolicies:  map[string]ModerationPolicy{},
+	OpenAIModel:    "omni-moderation-latest",
+	TimeoutSeconds: 10,
+	FailOpen:       true,
+	BlockMessage:   "内容审核未通过（{categories}），请求已被拦截。如有异议，请携带请求 ID {request_id} 联系管理员申诉",
+}
+
+// 全局实例
+var moderationSettings = defaultModerationSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("moderation", &moderationSettings)
+}
+
+func GetModerationSettings() *ModerationSettings {
+	return &moderationSettings
+}
+
+// GetModerationTimeout 获取检查器调用超时，未配置或配置非法时使用默认值
+func GetModerationTimeout() time.Duration {
+	seconds := moderationSettings.TimeoutSeconds
+	if seconds <= 0 {
+		seconds = defaultModerationSettings.TimeoutSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// GetModerationPolicy 获取分组生效的审核策略
+func GetModerationPolicy(group string) ModerationPolicy {
+	if policy, ok := moderationSettings.GroupPolicies[group]; ok {
+		if policy.Action == "" {
+			policy.Action = moderationSettings.DefaultPolicy.Action
+		}
+		if len(policy.Checkers) == 0 {
+			policy.Checkers = moderationSettings.DefaultPolicy.Checkers
+		}
+		return policy
+	}
+	return moderationSettings.DefaultPolicy
+}
+
+// FormatModerationBlockMessage 生成返回给用户的拦截说明
+func FormatModerationBlockMessage(categories []string, requestId string) string {
+	message := moderationSettings.BlockMessage
+	if message == "" {
+		message = defaultModerationSettings.BlockMessage
+	}
+	message = strings.ReplaceAll(message, "{categories}", strings.Join(categories, ", "))
+	return strings.ReplaceAll(message, "{request_id}", requestId)
+}
+
+func checkModerationPolicy(policy ModerationPolicy) error {
+	switch policy.Action {
+	case "", ModerationActionBlock, ModerationActionRedact, ModerationActionFlag:
+	default:
+		return fmt.Errorf("无效的审核动作：%s", policy.Action)
+	}
+	for _, checker := range policy.Checkers {
+		switch checker {
+		case ModerationCheckerKeyword, ModerationCheckerOpenAI, ModerationCheckerHTTP:
+		default:
+			return fmt.Errorf("无效的审核检查器：%s", checker)
+		}
+	}
+	return nil
+}
+
+// CheckModerationOption 校验审核策略配置项
+func CheckModerationOption(key string, value string) error {
+	switch key {
+	case "moderation.default_policy":
+		var policy ModerationPolicy
+		if err := json.Unmarshal([]byte(value), &policy); err != nil {
+			return errors.New("审核策略格式错误：" + err.Error())
+		}
+		if policy.Action == "" {
+			return errors.New("默认审核策略必须指定动作")
+		}
+		return checkModerationPolicy(policy)
+	case "moderation.group_policies":
+		var policies map[string]ModerationPolicy
+		if err := json.Unmarshal([]byte(value), &policies); err != nil {
+			return errors.New("审核策略格式错误：" + err.Error())
+		}
+		for group, policy := range policies {
+			if err := checkModerationPolicy(policy); err != nil {
+				return fmt.Errorf("分组 %s：%s", group, err.Error())
+			}
+		}
+	case "moderation.timeout_seconds":
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return errors.New("审核超时时间必须为正整数")
+		}
+	}
+	return nil
+}
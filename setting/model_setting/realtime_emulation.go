@@ -0,0 +1,50 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"veloera/setting/config"
+)
+
+// RealtimeEmulationSettings 非 OpenAI 渠道的实时接口模拟配置：语音识别 → 对话 → 语音合成
+type RealtimeEmulationSettings struct {
+	Enabled            bool    `json:"enabled"`
+	STTModel           string  `json:"stt_model"`            // 语音识别使用的模型，按普通模型选择渠道
+	TTSModel           string  `json:"tts_model"`            // 语音合成使用的模型，需支持 pcm 输出
+	DefaultVoice       string  `json:"default_voice"`        // 会话未指定 voice 时使用
+	VADEnergyThreshold float64 `json:"vad_energy_threshold"` // 服务端 VAD 的归一化 RMS 能量阈值，对应客户端 threshold=0.5
+}
+
+var defaultRealtimeEmulationSettings = RealtimeEmulationSettings{
+	Enabled:            true,
+	STTModel:           "whisper-1",
+	TTSModel:           "tts-1",
+	DefaultVoice:       "alloy",
+	VADEnergyThreshold: 0.02,
+}
+
+// 全局实例
+var realtimeEmulationSettings = defaultRealtimeEmulationSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime_emulation", &realtimeEmulationSettings)
+}
+
+func GetRealtimeEmulationSettings() *RealtimeEmulationSettings {
+	return &realtimeEmulationSettings
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"veloera/setting/config"
+)
+
+const (
+	RequestGuardActionBlock = "block" // 拦截请求
+	RequestGuardActionMask  = "mask"  // 替换命中内容后再发往上游
+	RequestGuardActionWarn  = "warn"  // 仅在日志中标记
+)
+
+// RequestGuardPolicy 分组的请求防护策略，动作为空表示不检测该类内容
+type RequestGuardPolicy struct {
+	SecretAction    string `json:"secret_action"`    // 密钥泄露
+	InjectionAction string `json:"injection_action"` // 工具结果中的提示词注入
+}
+
+// RequestGuardSettings 发往上游前的密钥泄露与提示词注入防护配置
+type RequestGuardSettings struct {
+	Enabled           bool                          `json:"enabled"`
+	DefaultPolicy     RequestGuardPolicy            `json:"default_policy"`
+	GroupPolicies     map[string]RequestGuardPolicy `json:"group_policies"`     // 按分组覆盖默认策略
+	EntropyThreshold  float64                       `json:"entropy_threshold"`  // 高熵字符串的香农熵阈值（比特/字符），0 表示不检测
+	EntropyMinLength  int                           `json:"entropy_min_length"` // 参与熵检测的最短长度
+	InjectionPatterns []string                      `json:"injection_patterns"` // 追加的注入特征正则，大小写不敏感
+	BlockMessage      string                        `json:"block_message"`      // 拦截时返回给用户的提示，支持 {categories} 与 {request_id}
+}
+
+var defaultRequestGuardSettings = RequestGuardSettings{
+	Enabled: false,
+	DefaultPolicy: RequestGuardPolicy{
+		SecretAction:    RequestGuardActionMask,
+		InjectionAction: RequestGuardActionWarn,
+	},
+	GroupPolicies:     map[string]RequestGuardPolicy{},
+	EntropyThreshold:  4.5,
+	EntropyMinLength:  32,
+	InjectionPatterns: []string{},
+	BlockMessage:      "请求中包含疑似密钥或提示词注入内容（{categories}），已被拦截。如有异议，请携带请求 ID {request_id} 联系管理员",
+}
+
+// 全局实例
+var requestGuardSettings = defaultRequestGuardSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("request_guard", &requestGuardSettings)
+}
+
+func GetRequestGuardSettings() *RequestGuardSettings {
+	return &requestGuardSettings
+}
+
+// GetRequestGuardPolicy 获取分组生效的防护策略
+func GetRequestGuardPolicy(group string) RequestGuardPolicy {
+	if policy, ok := requestGuardSettings.GroupPolicies[group]; ok {
+		return policy
+	}
+	return requestGuardSettings.DefaultPolicy
+}
+
+// ShouldGuardRequest 分组是否需要进行请求防护，与内容审核共用安全检查豁免分组
+func ShouldGuardRequest(group string) bool {
+	return requestGuardSettings.Enabled && !ShouldBypassSafeCheck(group)
+}
+
+// FormatRequestGuardBlockMessage 生成返回给用户的拦截说明
+func FormatRequestGuardBlockMessage(categories []string, requestId string) string {
+	message := requestGuardSettings.BlockMessage
+	if message == "" {
+		message = defaultRequestGuardSettings.BlockMessage
+	}
+	message = strings.ReplaceAll(message, "{categories}", strings.Join(categories, ", "))
+	return strings.ReplaceAll(message, "{request_id}", requestId)
+}
+
+func checkRequestGuardAction(action string) error {
+	switch action {
+	case "", RequestGuardActionBlock, RequestGuardActionMask, RequestGuardActionWarn:
+		return nil
+	}
+	return fmt.Errorf("无效的防护动作：%s", action)
+}
+
+func checkRequestGuardPolicy(policy RequestGuardPolicy) error {
+	if err := checkRequestGuardAction(policy.SecretAction); err != nil {
+		return err
+	}
+	return checkRequestGuardAction(policy.InjectionAction)
+}
+
+// CheckRequestGuardOption 校验请求防护配置项
+func CheckRequestGuardOption(key string, value string) error {
+	switch key {
+	case "request_guard.default_policy":
+		var policy RequestGuardPolicy
+		if err := json.Unmarshal([]byte(value), &policy); err != nil {
+			return errors.New("防护策略格式错误：" + err.Error())
+		}
+		return checkRequestGuardPolicy(policy)
+	case "request_guard.group_policies":
+		var policies map[string]RequestGuardPolicy
+		if err := json.Unmarshal([]byte(value), &policies); err != nil {
+			return errors.New("防护策略格式错误：" + err.Error())
+		}
+		for group, policy := range policies {
+			if err := checkRequestGuardPolicy(policy); err != nil {
+				return fmt.Errorf("分组 %s：%s", group, err.Error())
+			}
+		}
+	case "request_guard.injection_patterns":
+		var patterns []string
+		if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+			return errors.New("注入特征格式错误：" + err.Error())
+		}
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+				return fmt.Errorf("无效的注入特征正则 %s：%s", pattern, err.Error())
+			}
+		}
+	}
+	return nil
+}
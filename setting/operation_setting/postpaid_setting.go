@@ -0,0 +1,39 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+type PostpaidSetting struct {
+	WarningPercentage     int  `json:"warning_percentage"`      // 授信额度使用达到该百分比时提醒用户
+	AutoSettlementEnabled bool `json:"auto_settlement_enabled"` // 每月初自动生成上月结算单
+}
+
+// 默认配置
+var postpaidSetting = PostpaidSetting{
+	WarningPercentage:     80,
+	AutoSettlementEnabled: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("postpaid_setting", &postpaidSetting)
+}
+
+func GetPostpaidSetting() *PostpaidSetting {
+	return &postpaidSetting
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+)
+
+// PricingRule 动态计价规则，在模型基础倍率/价格之上按提示词长度档位、时段和请求特性调整计价。
+// 规则按配置顺序依次匹配，所有命中的规则都会生效，Stop 为 true 时命中后不再继续匹配。
+type PricingRule struct {
+	Name            string   `json:"name"`
+	Models          []string `json:"models"`                      // 支持 * 结尾的前缀匹配，留空匹配所有模型
+	MinPromptTokens int      `json:"min_prompt_tokens,omitempty"` // 提示词 token 数大于该值时命中，0 表示不限制
+	MaxPromptTokens int      `json:"max_prompt_tokens,omitempty"` // 提示词 token 数不超过该值时命中，0 表示不限制
+	TimeWindows     []string `json:"time_windows,omitempty"`      // 形如 22:00-06:00，支持跨零点
+	Weekdays        []int    `json:"weekdays,omitempty"`          // 0 表示周日
+	Timezone        string   `json:"timezone,omitempty"`          // 留空使用服务器时区
+	Tools           *bool    `json:"tools,omitempty"`             // 请求是否携带工具定义
+	Images          *bool    `json:"images,omitempty"`            // 请求是否包含图片
+	Reasoning       *bool    `json:"reasoning,omitempty"`         // 请求是否开启推理
+	ModelRatio      float64  `json:"model_ratio,omitempty"`       // 大于 0 时覆盖模型倍率
+	CompletionRatio float64  `json:"completion_ratio,omitempty"`  // 大于 0 时覆盖补全倍率
+	ModelPrice      float64  `json:"model_price,omitempty"`       // 大于 0 时覆盖按次计费价格
+	Multiplier      float64  `json:"multiplier,omitempty"`        // 在覆盖后再乘以该系数，0 表示不调整
+	Stop            bool     `json:"stop,omitempty"`
+
+	location *time.Location // 加载配置时解析的时区，nil 表示服务器时区
+	windows  [][2]int       // 加载配置时解析的时段，一天中的起止分钟数
+}
+
+// PricingFeatures 参与计价规则匹配的请求特性
+type PricingFeatures struct {
+	Tools     bool `json:"tools"`
+	Images    bool `json:"images"`
+	Reasoning bool `json:"reasoning"`
+}
+
+// PricingRuleResult 计价规则应用后的结果
+type PricingRuleResult struct {
+	ModelRatio      float64
+	CompletionRatio float64
+	ModelPrice      float64
+	Applied         []string
+}
+
+var pricingRules = make([]PricingRule, 0)
+var pricingRulesMutex sync.RWMutex
+
+func PricingRules2JSONString() string {
+	pricingRulesMutex.RLock()
+	defer pricingRulesMutex.RUnlock()
+	jsonBytes, err := json.Marshal(pricingRules)
+	if err != nil {
+		common.SysError("error marshalling pricing rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePricingRulesByJSONString(jsonStr string) error {
+	rules, err := parsePricingRules(jsonStr)
+	if err != nil {
+		return err
+	}
+	pricingRulesMutex.Lock()
+	defer pricingRulesMutex.Unlock()
+	pricingRules = rules
+	return nil
+}
+
+// CheckPricingRules 校验计价规则配置
+func CheckPricingRules(jsonStr string) error {
+	_, err := parsePricingRules(jsonStr)
+	return err
+}
+
+func parsePricingRules(jsonStr string) ([]PricingRule, error) {
+	rules := make([]PricingRule, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rule := &rules[i]
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.ModelRatio < 0 || rule.CompletionRatio < 0 || rule.ModelPrice < 0 || rule.Multiplier < 0 {
+			return nil, errors.New("pricing rule " + name + ": ratio, price and multiplier must be not less than 0")
+		}
+		if rule.MaxPromptTokens > 0 && rule.MaxPromptTokens <= rule.MinPromptTokens {
+			return nil, errors.New("pricing rule " + name + ": max_prompt_tokens must be greater than min_prompt_tokens")
+		}
+		for _, window := range rule.TimeWindows {
+			start, end, err := parseTimeWindow(window)
+			if err != nil {
+				return nil, errors.New("pricing rule " + name + ": " + err.Error())
+			}
+			rule.windows = append(rule.windows, [2]int{start, end})
+		}
+		for _, weekday := range rule.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return nil, errors.New("pricing rule " + name + ": weekday must be between 0 and 6")
+			}
+		}
+		if rule.Timezone != "" {
+			loc, err := time.LoadLocation(rule.Timezone)
+			if err != nil {
+				return nil, errors.New("pricing rule " + name + ": invalid timezone " + rule.Timezone)
+			}
+			rule.location = loc
+		}
+	}
+	return rules, nil
+}
+
+func parseClock(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, errors.New("invalid time " + s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, errors.New("invalid time " + s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, errors.New("invalid time " + s)
+	}
+	return hour*60 + minute, nil
+}
+
+// parseTimeWindow 解析 HH:MM-HH:MM 形式的时段，返回一天中的起止分钟数
+func parseTimeWindow(window string) (start int, end int, err error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("invalid time window " + window)
+	}
+	if start, err = parseClock(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, errors.New("empty time window " + window)
+	}
+	return start, end, nil
+}
+
+func (rule *PricingRule) matchModel(modelName string) bool {
+	if len(rule.Models) == 0 {
+		return true
+	}
+	for _, m := range rule.Models {
+		if m == modelName {
+			return true
+		}
+		if strings.HasSuffix(m, "*") && strings.HasPrefix(modelName, strings.TrimSuffix(m, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *PricingRule) matchTime(now time.Time) bool {
+	if len(rule.TimeWindows) == 0 && len(rule.Weekdays) == 0 {
+		return true
+	}
+	if rule.location != nil {
+		now = now.In(rule.location)
+	}
+	if len(rule.Weekdays) > 0 {
+		matched := false
+		for _, weekday := range rule.Weekdays {
+			if int(now.Weekday()) == weekday {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(rule.windows) == 0 {
+		return true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range rule.windows {
+		start, end := window[0], window[1]
+		if start < end && minute >= start && minute < end {
+			return true
+		}
+		// 跨零点的时段，例如 22:00-06:00
+		if start > end && (minute >= start || minute < end) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFeature(want *bool, actual bool) bool {
+	return want == nil || *want == actual
+}
+
+// Match 判断规则对当前请求是否命中
+func (rule *PricingRule) Match(modelName string, promptTokens int, features PricingFeatures, now time.Time) bool {
+	if !rule.matchModel(modelName) {
+		return false
+	}
+	if rule.MinPromptTokens > 0 && promptTokens <= rule.MinPromptTokens {
+		return false
+	}
+	if rule.MaxPromptTokens > 0 && promptTokens > rule.MaxPromptTokens {
+		return false
+	}
+	if !matchFeature(rule.Tools, features.Tools) ||
+		!matchFeature(rule.Images, features.Images) ||
+		!matchFeature(rule.Reasoning, features.Reasoning) {
+		return false
+	}
+	return rule.matchTime(now)
+}
+
+// ApplyPricingRules 根据请求信息调整模型倍率、补全倍率与按次价格
+func ApplyPricingRules(modelName string, promptTokens int, features PricingFeatures, now time.Time,
+	modelRatio float64, completionRatio float64, modelPrice float64) PricingRuleResult {
+	result := PricingRuleResult{
+		ModelRatio:      modelRatio,
+		CompletionRatio: completionRatio,
+		ModelPrice:      modelPrice,
+	}
+	pricingRulesMutex.RLock()
+	defer pricingRulesMutex.RUnlock()
+	for i := range pricingRules {
+		rule := &pricingRules[i]
+		if !rule.Match(modelName, promptTokens, features, now) {
+			continue
+		}
+		if rule.ModelRatio > 0 {
+			result.ModelRatio = rule.ModelRatio
+		}
+		if rule.CompletionRatio > 0 {
+			result.CompletionRatio = rule.CompletionRatio
+		}
+		if rule.ModelPrice > 0 {
+			result.ModelPrice = rule.ModelPrice
+		}
+		if rule.Multiplier > 0 {
+			result.ModelRatio *= rule.Multiplier
+			result.ModelPrice *= rule.Multiplier
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		result.Applied = append(result.Applied, name)
+		if rule.Stop {
+			break
+		}
+	}
+	return result
+}
+
+// GetPricingRulesForModel 返回适用于指定模型的计价规则，用于价格展示
+func GetPricingRulesForModel(modelName string) []PricingRule {
+	pricingRulesMutex.RLock()
+	defer pricingRulesMutex.RUnlock()
+	rules := make([]PricingRule, 0)
+	for i := range pricingRules {
+		if pricingRules[i].matchModel(modelName) {
+			rules = append(rules, pricingRules[i])
+		}
+	}
+	return rules
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+// SelfHostedSetting 自建推理服务渠道的负载采集与健康检查配置
+type SelfHostedSetting struct {
+	ScrapeIntervalSeconds int `json:"scrape_interval_seconds"` // 采集 /health、/metrics、/slots 的间隔
+	ScrapeTimeoutSeconds  int `json:"scrape_timeout_seconds"`
+	UnhealthyThreshold    int `json:"unhealthy_threshold"` // 连续健康检查失败多少次后标记为不健康
+	WaitingWeight         int `json:"waiting_weight"`      // 排队请求相对运行中请求的负载权重
+}
+
+// 默认配置
+var selfHostedSetting = SelfHostedSetting{
+	ScrapeIntervalSeconds: 10,
+	ScrapeTimeoutSeconds:  3,
+	UnhealthyThreshold:    3,
+	WaitingWeight:         4,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("self_hosted_setting", &selfHostedSetting)
+}
+
+func GetSelfHostedSetting() *SelfHostedSetting {
+	return &selfHostedSetting
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import (
+	"time"
+	"veloera/setting/config"
+)
+
+const (
+	SubscriptionStackingSum = "sum" // 多个套餐同时生效时每日额度相加
+	SubscriptionStackingMax = "max" // 多个套餐同时生效时取最大每日额度
+)
+
+type SubscriptionSetting struct {
+	DailyResetTimezone string `json:"daily_reset_timezone"` // 每日额度重置时区，例如 Asia/Shanghai，留空使用服务器时区
+	StackingMode       string `json:"stacking_mode"`        // sum / max
+	AutoRenewEnabled   bool   `json:"auto_renew_enabled"`   // 是否允许套餐到期自动续费
+}
+
+// 默认配置
+var subscriptionSetting = SubscriptionSetting{
+	DailyResetTimezone: "",
+	StackingMode:       SubscriptionStackingSum,
+	AutoRenewEnabled:   true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("subscription_setting", &subscriptionSetting)
+}
+
+func GetSubscriptionSetting() *SubscriptionSetting {
+	return &subscriptionSetting
+}
+
+// DailyResetLocation 返回每日额度重置所使用的时区，配置无效时回退到服务器时区
+func (s *SubscriptionSetting) DailyResetLocation() *time.Location {
+	if s.DailyResetTimezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(s.DailyResetTimezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
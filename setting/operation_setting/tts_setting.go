@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+// TTSSetting 语音合成的音色映射与按字符计费配置
+type TTSSetting struct {
+	// 渠道名（ali、gemini、volcengine、minimax）→ OpenAI 音色 → 上游音色，未命中时非 OpenAI 音色名原样透传
+	VoiceMapping map[string]map[string]string `json:"voice_mapping"`
+	// 模型 → 每百万字符价格（美元），配置后该模型的语音合成按输入字符数计费
+	CharacterPrice    map[string]float64 `json:"character_price"`
+	VolcengineCluster string             `json:"volcengine_cluster"` // 火山引擎语音合成的集群
+}
+
+// 默认配置
+var ttsSetting = TTSSetting{
+	VoiceMapping: map[string]map[string]string{
+		"ali": {
+			"alloy":   "Cherry",
+			"echo":    "Ethan",
+			"fable":   "Serena",
+			"onyx":    "Dylan",
+			"nova":    "Chelsie",
+			"shimmer": "Serena",
+		},
+		"gemini": {
+			"alloy":   "Kore",
+			"ash":     "Fenrir",
+			"coral":   "Aoede",
+			"echo":    "Puck",
+			"fable":   "Zephyr",
+			"onyx":    "Charon",
+			"nova":    "Leda",
+			"sage":    "Orus",
+			"shimmer": "Callirrhoe",
+		},
+		"volcengine": {
+			"alloy":   "BV001_streaming",
+			"echo":    "BV002_streaming",
+			"fable":   "BV700_streaming",
+			"onyx":    "BV701_streaming",
+			"nova":    "BV001_streaming",
+			"shimmer": "BV700_streaming",
+		},
+		"minimax": {
+			"alloy":   "female-shaonv",
+			"echo":    "male-qn-qingse",
+			"fable":   "audiobook_male_1",
+			"onyx":    "presenter_male",
+			"nova":    "female-yujie",
+			"shimmer": "presenter_female",
+		},
+	},
+	CharacterPrice:    map[string]float64{},
+	VolcengineCluster: "volcano_tts",
+}
+
+// openAIVoices OpenAI 的内置音色，未配置映射时回退到渠道的默认音色
+var openAIVoices = map[string]bool{
+	"alloy": true, "ash": true, "ballad": true, "coral": true, "echo": true, "fable": true,
+	"onyx": true, "nova": true, "sage": true, "shimmer": true, "verse": true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("tts_setting", &ttsSetting)
+}
+
+func GetTTSSetting() *TTSSetting {
+	return &ttsSetting
+}
+
+// MapTTSVoice 将请求中的音色转换为渠道的音色，空值或未映射的 OpenAI 音色使用 alloy 的映射
+func MapTTSVoice(channelName string, voice string) string {
+	mapping := ttsSetting.VoiceMapping[channelName]
+	if mapped, ok := mapping[voice]; ok {
+		return mapped
+	}
+	if voice != "" && !openAIVoices[voice] {
+		return voice
+	}
+	return mapping["alloy"]
+}
+
+// GetTTSCharacterPrice 获取模型的每百万字符价格
+func GetTTSCharacterPrice(model string) (float64, bool) {
+	price, ok := ttsSetting.CharacterPrice[model]
+	return price, ok && price > 0
+}
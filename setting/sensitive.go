@@ -27,7 +27,7 @@ var CheckSensitiveOnPromptEnabled = true
 var SafeCheckExemptEnabled = false
 var SafeCheckExemptGroup = "nsfw-ok"
 
-//var CheckSensitiveOnCompletionEnabled = true
+var CheckSensitiveOnCompletionEnabled = false
 
 // StopOnSensitiveEnabled 如果检测到敏感词，是否立刻停止生成，否则替换敏感词
 var StopOnSensitiveEnabled = true
@@ -43,11 +43,8 @@ var SensitiveWords = []string{
 // RegexSensitiveWords 正则表达式屏蔽词
 var RegexSensitiveWords = []string{}
 
-// 判断字符串是否是有效的正则表达式
-func isValidRegex(pattern string) bool {
-	_, err := regexp.Compile(pattern)
-	return err == nil
-}
+// CompiledRegexSensitiveWords 与 RegexSensitiveWords 一一对应的已编译正则，随屏蔽词配置一起更新
+var CompiledRegexSensitiveWords = []*regexp.Regexp{}
 
 func SensitiveWordsToString() string {
 	var builder strings.Builder
@@ -69,8 +66,9 @@ func SensitiveWordsToString() string {
 }
 
 func SensitiveWordsFromString(s string) {
-	SensitiveWords = []string{}
-	RegexSensitiveWords = []string{}
+	words := []string{}
+	patterns := []string{}
+	compiled := []*regexp.Regexp{}
 
 	lines := strings.Split(s, "\n")
 	for _, line := range lines {
@@ -82,13 +80,17 @@ func SensitiveWordsFromString(s string) {
 		// Check if line starts with "regex:"
 		if strings.HasPrefix(line, "regex:") {
 			pattern := strings.TrimPrefix(line, "regex:")
-			if isValidRegex(pattern) {
-				RegexSensitiveWords = append(RegexSensitiveWords, pattern)
+			if re, err := regexp.Compile(pattern); err == nil {
+				patterns = append(patterns, pattern)
+				compiled = append(compiled, re)
 			}
 		} else {
-			SensitiveWords = append(SensitiveWords, line)
+			words = append(words, line)
 		}
 	}
+	SensitiveWords = words
+	RegexSensitiveWords = patterns
+	CompiledRegexSensitiveWords = compiled
 }
 
 func ShouldCheckPromptSensitive() bool {
@@ -102,6 +104,13 @@ func ShouldCheckPromptSensitiveWithGroup(group string) bool {
 	return ShouldCheckPromptSensitive()
 }
 
-//func ShouldCheckCompletionSensitive() bool {
-//	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
-//}
+func ShouldCheckCompletionSensitive() bool {
+	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
+}
+
+func ShouldCheckCompletionSensitiveWithGroup(group string) bool {
+	if SafeCheckExemptEnabled && group == SafeCheckExemptGroup {
+		return false
+	}
+	return ShouldCheckCompletionSensitive()
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package system_setting
+
+import (
+	"strings"
+	"veloera/setting/config"
+)
+
+// ChatContentSettings 对话内容留存配置，总开关为 LogChatContentEnabled
+type ChatContentSettings struct {
+	Groups            string `json:"groups"`             // 参与留存的分组，逗号分隔，* 表示所有分组
+	RetentionDays     int    `json:"retention_days"`     // 留存天数，0 表示不自动清理
+	RedactPII         bool   `json:"redact_pii"`         // 存储前脱敏邮箱、手机号、银行卡号与 API Key
+	RequireEncryption bool   `json:"require_encryption"` // 未配置加密密钥时不留存
+	MaxContentLength  int    `json:"max_content_length"` // 单条留存内容的最大字节数，超出部分截断
+}
+
+// 默认配置
+var defaultChatContentSettings = ChatContentSettings{
+	Groups:            "*",
+	RetentionDays:     30,
+	RedactPII:         true,
+	RequireEncryption: true,
+	MaxContentLength:  64 * 1024,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("chat_content", &defaultChatContentSettings)
+}
+
+func GetChatContentSettings() *ChatContentSettings {
+	return &defaultChatContentSettings
+}
+
+// GroupEnabled 判断分组是否开启了对话内容留存
+func (s *ChatContentSettings) GroupEnabled(group string) bool {
+	for _, g := range strings.Split(s.Groups, ",") {
+		g = strings.TrimSpace(g)
+		if g == "*" || (g != "" && g == group) {
+			return true
+		}
+	}
+	return false
+}
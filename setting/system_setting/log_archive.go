@@ -0,0 +1,55 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package system_setting
+
+import "veloera/setting/config"
+
+// LogArchiveSettings 日志按自然月分区归档到对象存储，分区是 logs 表上的逻辑时间范围而非物理滚动表
+type LogArchiveSettings struct {
+	Enabled           bool   `json:"enabled"`
+	RetainMonths      int    `json:"retain_months"` // 数据库中保留的完整自然月数（不含当月），更早的分区会被归档
+	Storage           string `json:"storage"`       // local / s3
+	LocalDir          string `json:"local_dir"`     // Storage 为 local 时的归档目录
+	S3Endpoint        string `json:"s3_endpoint"`   // 留空使用 AWS 官方地址
+	S3Region          string `json:"s3_region"`
+	S3Bucket          string `json:"s3_bucket"`
+	S3AccessKeyId     string `json:"s3_access_key_id"`
+	S3SecretAccessKey string `json:"s3_secret_access_key"`
+	S3PathStyle       bool   `json:"s3_path_style"`
+	Prefix            string `json:"prefix"`           // 对象键前缀
+	BatchSize         int    `json:"batch_size"`       // 导出与删除时每批处理的行数
+	TransparentRead   bool   `json:"transparent_read"` // 管理员查询日志时自动读取已归档的时间范围
+}
+
+// 默认配置
+var defaultLogArchiveSettings = LogArchiveSettings{
+	RetainMonths:    3,
+	Storage:         "local",
+	LocalDir:        "./archives",
+	Prefix:          "logs",
+	BatchSize:       5000,
+	TransparentRead: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_archive", &defaultLogArchiveSettings)
+}
+
+func GetLogArchiveSettings() *LogArchiveSettings {
+	return &defaultLogArchiveSettings
+}
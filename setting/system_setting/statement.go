@@ -0,0 +1,46 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package system_setting
+
+import "veloera/setting/config"
+
+// StatementSettings 账单/对账单抬头信息
+type StatementSettings struct {
+	CompanyName    string  `json:"company_name"`
+	CompanyAddress string  `json:"company_address"`
+	CompanyEmail   string  `json:"company_email"`
+	TaxId          string  `json:"tax_id"`
+	TaxName        string  `json:"tax_name"`
+	TaxRate        float64 `json:"tax_rate"` // 百分比，例如 6 表示 6%
+	Currency       string  `json:"currency"`
+	FooterNote     string  `json:"footer_note"`
+}
+
+// 默认配置
+var defaultStatementSettings = StatementSettings{
+	TaxName:  "VAT",
+	Currency: "USD",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("statement", &defaultStatementSettings)
+}
+
+func GetStatementSettings() *StatementSettings {
+	return &defaultStatementSettings
+}
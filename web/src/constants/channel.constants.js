@@ -100,6 +100,7 @@ export const CHANNEL_OPTIONS = [
   { value: 25, color: 'green', label: 'Moonshot' },
   { value: 20, color: 'green', label: 'OpenRouter' },
   { value: 49, color: 'green', label: 'GitHub Models' },
+  { value: 50, color: 'blue', label: '自建推理服务（vLLM / TGI / llama.cpp）' },
   { value: 19, color: 'blue', label: '360 智脑' },
   { value: 23, color: 'teal', label: '腾讯混元' },
   { value: 31, color: 'green', label: '零一万物' },